@@ -14,8 +14,14 @@ import (
 	"github.com/Kovalyovv/auth-service/internal/config"
 	deliveryGRPC "github.com/Kovalyovv/auth-service/internal/delivery/grpc"
 	deliveryHTTP "github.com/Kovalyovv/auth-service/internal/delivery/http"
+	"github.com/Kovalyovv/auth-service/internal/delivery/multiplex"
+	"github.com/Kovalyovv/auth-service/internal/pkg/disposable"
+	"github.com/Kovalyovv/auth-service/internal/pkg/hash"
 	"github.com/Kovalyovv/auth-service/internal/pkg/jwt"
+	"github.com/Kovalyovv/auth-service/internal/pkg/mail"
+	"github.com/Kovalyovv/auth-service/internal/pkg/webhook"
 	"github.com/Kovalyovv/auth-service/internal/repository/postgres"
+	"github.com/Kovalyovv/auth-service/internal/repository/timed"
 	"github.com/Kovalyovv/auth-service/internal/usecase"
 	"github.com/Kovalyovv/auth-service/pkg/observability"
 	"github.com/Kovalyovv/auth-service/pkg/pb"
@@ -45,14 +51,13 @@ func main() {
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 	slog.SetDefault(logger)
 
-	cfg := config.NewFromEnv()
-
-	if cfg.JWTSecret == "" {
-		slog.Error("missing critical configuration: JWT_SECRET must be set")
+	cfg, err := config.NewFromEnv()
+	if err != nil {
+		slog.Error("failed to load configuration", "error", err)
 		os.Exit(1)
 	}
-	if cfg.DatabaseURL == "" {
-		slog.Error("missing critical configuration: DATABASE_URL must be set")
+	if err := cfg.Validate(); err != nil {
+		slog.Error("invalid configuration", "error", err)
 		os.Exit(1)
 	}
 
@@ -63,9 +68,122 @@ func main() {
 	}
 	defer pool.Close()
 
-	userRepo := postgres.NewUserRepo(pool)
-	tokenManager := jwt.NewTokenManager(cfg.JWTSecret)
-	authUC := usecase.NewAuthUseCase(userRepo, tokenManager, cfg.AccessTokenTTL, cfg.RefreshTokenTTL)
+	userRepo := timed.NewUserRepo(postgres.NewUserRepo(pool), cfg.SlowQueryThreshold)
+	jwtOpts := []jwt.Option{
+		jwt.WithLeeway(cfg.JWTLeeway),
+		jwt.WithExpiryLeeway(cfg.JWTExpiryLeeway),
+		jwt.WithAlgorithm(cfg.JWTAlgorithm),
+		jwt.WithPreviousSecret(cfg.JWTSecretPrevious),
+	}
+	if !cfg.AllowWeakJWTSecret {
+		jwtOpts = append(jwtOpts, jwt.WithSecretPolicy(cfg.JWTSecretMinEntropy))
+	}
+	tokenManager, err := jwt.NewTokenManager(cfg.JWTSecret, jwtOpts...)
+	if err != nil {
+		slog.Error("failed to create token manager", "error", err)
+		os.Exit(1)
+	}
+
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	ucOpts := []usecase.Option{
+		usecase.WithRegistrationEnabled(cfg.Features.RegistrationEnabled),
+		usecase.WithDefaultRole(cfg.DefaultRole),
+		usecase.WithFirstUserAdmin(cfg.Features.FirstUserIsAdmin),
+		usecase.WithRefreshTokenMode(cfg.RefreshTokenMode),
+		usecase.WithRefreshRotateThreshold(cfg.RefreshRotateThreshold),
+		usecase.WithMaxRefreshes(cfg.RefreshMaxCount),
+		usecase.WithVerifyExpiredGrace(cfg.VerifyExpiredGrace),
+		usecase.WithTokenVersionCheck(cfg.Features.TokenVersionCheck),
+		usecase.WithAuthTimeClaim(cfg.Features.AuthTimeClaim),
+		usecase.WithUsernameLogin(cfg.Features.UsernameLogin),
+		usecase.WithResourceAudiences(cfg.ResourceAudienceRoles()),
+		usecase.WithTokenVersionCache(cfg.TokenVersionCacheTTL),
+		usecase.WithStepUpTTL(cfg.StepUpTokenTTL),
+		usecase.WithMaxAccessTTL(cfg.MaxAccessTokenTTL),
+		usecase.WithPasswordChangeCooldown(cfg.PasswordChangeCooldown),
+		usecase.WithVerificationTokenTTL(cfg.EmailVerificationTTL),
+		usecase.WithVerificationResendInterval(cfg.VerificationResendInterval),
+		usecase.WithPasswordLength(cfg.PasswordMinLength, cfg.PasswordMaxBytes),
+		usecase.WithVerifyPasswordLimit(cfg.VerifyPasswordMaxFailures, cfg.VerifyPasswordWindow),
+		usecase.WithAccountLockout(cfg.LoginLockoutThreshold, cfg.LoginLockoutDuration),
+		usecase.WithLoginBackoff(cfg.LoginBackoffThreshold, cfg.LoginBackoffBase, cfg.LoginBackoffMax),
+		usecase.WithLoginIPLimit(cfg.LoginIPMaxFailures, cfg.LoginIPWindow),
+		usecase.WithLoginEmailLimit(cfg.LoginEmailMaxFailures, cfg.LoginEmailWindow),
+		usecase.WithLoginFailureLogLevel(cfg.LoginFailureLevel()),
+		usecase.WithHashConcurrency(cfg.HashConcurrency, cfg.HashQueueTimeout),
+		usecase.WithAuditLog(userRepo),
+		usecase.WithSingleSession(cfg.Features.SingleSession),
+		usecase.WithEnumerationSafeRegistration(cfg.Features.EnumerationSafeRegistration),
+		usecase.WithSignInOnRegister(cfg.Features.SignInOnRegister),
+		usecase.WithEmailDomains(cfg.AllowedEmailDomains, cfg.BlockedEmailDomains),
+		usecase.WithHasher(hash.NewHasher(cfg.PasswordHashAlgorithm, hash.Argon2Params{
+			Memory:      cfg.Argon2.Memory,
+			Iterations:  cfg.Argon2.Iterations,
+			Parallelism: cfg.Argon2.Parallelism,
+			SaltLength:  hash.DefaultArgon2Params.SaltLength,
+			KeyLength:   hash.DefaultArgon2Params.KeyLength,
+		})),
+	}
+	if cfg.DisposableEmailDomainsFile != "" {
+		disposableDomains, err := disposable.LoadFile(cfg.DisposableEmailDomainsFile)
+		if err != nil {
+			slog.Error("failed to load disposable email domains", "error", err)
+			os.Exit(1)
+		}
+		go disposableDomains.Watch(workerCtx, cfg.DisposableEmailReloadInterval)
+		ucOpts = append(ucOpts, usecase.WithDisposableEmailCheck(disposableDomains))
+	}
+	if cfg.Webhook.URL != "" {
+		dispatcher := webhook.NewDispatcher(cfg.Webhook.URL, cfg.Webhook.Secret,
+			webhook.WithMaxAttempts(cfg.Webhook.MaxAttempts),
+			webhook.WithTimeout(cfg.Webhook.Timeout),
+		)
+		go dispatcher.Run(workerCtx)
+		ucOpts = append(ucOpts, usecase.WithEventPublisher(dispatcher))
+	}
+	if cfg.Mail.Driver == "smtp" {
+		ucOpts = append(ucOpts, usecase.WithMailer(mail.NewSMTPMailer(mail.SMTPConfig{
+			Host:        cfg.Mail.SMTPHost,
+			Port:        cfg.Mail.SMTPPort,
+			Username:    cfg.Mail.SMTPUsername,
+			Password:    cfg.Mail.SMTPPassword,
+			From:        cfg.Mail.From,
+			LinkBaseURL: cfg.Mail.LinkBaseURL,
+		})))
+	} else {
+		ucOpts = append(ucOpts, usecase.WithMailer(mail.NewLogMailer(cfg.Mail.LinkBaseURL)))
+	}
+	authUC := usecase.NewAuthUseCase(userRepo, tokenManager, cfg.AccessTokenTTL, cfg.RefreshTokenTTL, ucOpts...)
+
+	handlerOpts := []deliveryHTTP.HandlerOption{
+		deliveryHTTP.WithProfileInResponse(cfg.Features.ProfileInTokenResponse),
+		deliveryHTTP.WithIdempotency(cfg.IdempotencyTTL),
+		deliveryHTTP.WithAcceptedRegistration(cfg.Features.EnumerationSafeRegistration),
+		deliveryHTTP.WithQueryTokenAuth(cfg.Features.QueryTokenAuth),
+		deliveryHTTP.WithStrictJSON(cfg.Features.StrictJSON),
+		deliveryHTTP.WithRejectAuthenticated(cfg.Features.RejectAuthenticatedRegister),
+		deliveryHTTP.WithUserLookupLimit(cfg.UserLookupRateLimit, cfg.UserLookupRateWindow),
+		deliveryHTTP.WithEmailMasking(cfg.Features.MaskAdminEmails, cfg.SuperAdminUserIDs()...),
+		deliveryHTTP.WithSecurityHeaders(deliveryHTTP.SecurityHeaders{
+			ContentTypeOptions:    cfg.Headers.Value(cfg.Headers.ContentTypeOptions),
+			FrameOptions:          cfg.Headers.Value(cfg.Headers.FrameOptions),
+			ReferrerPolicy:        cfg.Headers.Value(cfg.Headers.ReferrerPolicy),
+			ContentSecurityPolicy: cfg.Headers.Value(cfg.Headers.ContentSecurityPolicy),
+		}),
+	}
+	if cfg.Features.RefreshTokenCookie {
+		handlerOpts = append(handlerOpts, deliveryHTTP.WithRefreshTokenCookie(cfg.RefreshTokenTTL, !cfg.Features.RefreshCookieInsecure))
+	}
+	if cfg.AdminPort != "" {
+		handlerOpts = append(handlerOpts, deliveryHTTP.WithSeparateAdminRoutes(true))
+	}
+	if cfg.CleanupInterval > 0 {
+		cleaner := usecase.NewTokenCleaner(userRepo, cfg.CleanupInterval, usecase.WithVacuumThreshold(cfg.CleanupVacuumThreshold))
+		go cleaner.Run(workerCtx)
+		handlerOpts = append(handlerOpts, deliveryHTTP.WithCleanupStatus(cleaner))
+	}
 
 	var kaep = keepalive.EnforcementPolicy{
 		MinTime:             5 * time.Second,
@@ -81,36 +199,77 @@ func main() {
 		grpc.KeepaliveEnforcementPolicy(kaep),
 		grpc.KeepaliveParams(kasp),
 	)
-	pb.RegisterAuthServiceServer(grpcSrv, deliveryGRPC.NewServer(authUC))
-
-	lis, err := net.Listen("tcp", ":"+cfg.GRPCPort)
-	if err != nil {
-		slog.Error("failed to listen grpc", "error", err)
-		os.Exit(1)
+	authSrv := deliveryGRPC.NewServer(authUC, deliveryGRPC.WithHandlerTimeout(cfg.GRPCHandlerTimeout))
+	pb.RegisterAuthServiceServer(grpcSrv, authSrv)
+	if cfg.Features.RESTGateway {
+		gw, err := deliveryHTTP.NewGateway(authSrv, cfg.Features.EnumerationSafeRegistration, cfg.Features.StrictJSON)
+		if err != nil {
+			slog.Error("failed to build REST gateway", "error", err)
+			os.Exit(1)
+		}
+		handlerOpts = append(handlerOpts, deliveryHTTP.WithGateway(gw))
 	}
 
-	go func() {
-		slog.Info("gRPC server listening", "port", cfg.GRPCPort)
-		if err := grpcSrv.Serve(lis); err != nil {
-			slog.Error("grpc serve err", "error", err)
+	if cfg.ListenMode == "split" {
+		lis, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+		if err != nil {
+			slog.Error("failed to listen grpc", "error", err)
+			os.Exit(1)
 		}
-	}()
+
+		go func() {
+			slog.Info("gRPC server listening", "port", cfg.GRPCPort)
+			if err := grpcSrv.Serve(lis); err != nil {
+				slog.Error("grpc serve err", "error", err)
+			}
+		}()
+	}
 
 	router := gin.New()
-	router.Use(gin.Recovery())
+	router.Use(deliveryHTTP.Recovery())
 	router.Use(otelgin.Middleware(serviceName))
+	if cfg.AppEnv == "production" {
+		router.Use(deliveryHTTP.HSTS(cfg.HSTSMaxAge, cfg.Features.HTTPSRedirect))
+	}
+	if cfg.Features.Gzip {
+		router.Use(deliveryHTTP.Gzip(cfg.GzipLevel, cfg.GzipMinSize))
+	}
 
-	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
-
-	handler := deliveryHTTP.NewAuthHandler(authUC)
+	handler := deliveryHTTP.NewAuthHandler(authUC, handlerOpts...)
 	deliveryHTTP.SetupRoutes(router, handler)
+
+	var adminSrv *http.Server
+	if cfg.AdminPort != "" {
+		adminRouter := gin.New()
+		adminRouter.Use(deliveryHTTP.Recovery())
+		adminRouter.Use(otelgin.Middleware(serviceName))
+		adminRouter.GET("/metrics", gin.WrapH(promhttp.Handler()))
+		deliveryHTTP.SetupAdminRoutes(adminRouter, handler)
+		adminSrv = &http.Server{
+			Addr:    ":" + cfg.AdminPort,
+			Handler: adminRouter,
+		}
+
+		go func() {
+			slog.Info("admin HTTP server listening on", "port", cfg.AdminPort)
+			if err := adminSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("admin http listen err", "error", err)
+			}
+		}()
+	} else {
+		router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	}
+
 	httpSrv := &http.Server{
 		Addr:    ":" + cfg.HTTPPort,
 		Handler: router,
 	}
+	if cfg.ListenMode == "single" {
+		httpSrv = multiplex.NewServer(":"+cfg.HTTPPort, multiplex.Handler(grpcSrv, router))
+	}
 
 	go func() {
-		slog.Info("HTTP server listening on", "port", cfg.HTTPPort)
+		slog.Info("HTTP server listening on", "port", cfg.HTTPPort, "mode", cfg.ListenMode)
 		if err := httpSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			slog.Error("http listen err", "error", err)
 		}
@@ -120,8 +279,12 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
+	stopWorkers()
 	grpcSrv.GracefulStop()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	_ = httpSrv.Shutdown(ctx)
+	if adminSrv != nil {
+		_ = adminSrv.Shutdown(ctx)
+	}
 }
@@ -0,0 +1,7 @@
+CREATE TABLE revoked_refresh_tokens
+(
+    jti        TEXT PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ DEFAULT NOW()
+);
+CREATE INDEX idx_revoked_refresh_tokens_expires_at ON revoked_refresh_tokens (expires_at);
@@ -0,0 +1,12 @@
+CREATE TABLE auth_events
+(
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    INT REFERENCES users (id) ON DELETE SET NULL,
+    email      VARCHAR(255) NOT NULL DEFAULT '',
+    type       VARCHAR(64)  NOT NULL,
+    success    BOOLEAN      NOT NULL,
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_auth_events_created_at ON auth_events (created_at DESC, id DESC);
+CREATE INDEX idx_auth_events_user_id ON auth_events (user_id);
+CREATE INDEX idx_auth_events_email ON auth_events (email);
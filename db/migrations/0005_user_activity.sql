@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN last_login_at TIMESTAMPTZ,
+    ADD COLUMN disabled_at   TIMESTAMPTZ;
+CREATE INDEX idx_users_last_activity ON users (COALESCE(last_login_at, created_at)) WHERE disabled_at IS NULL;
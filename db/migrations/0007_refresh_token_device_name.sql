@@ -0,0 +1,2 @@
+ALTER TABLE refresh_tokens ADD COLUMN device_name VARCHAR(100) NOT NULL DEFAULT '';
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens (user_id);
@@ -0,0 +1 @@
+ALTER TABLE refresh_tokens ADD COLUMN refresh_count INT NOT NULL DEFAULT 0;
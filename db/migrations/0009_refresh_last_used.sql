@@ -0,0 +1,2 @@
+ALTER TABLE refresh_tokens ADD COLUMN last_used_at TIMESTAMPTZ;
+ALTER TABLE refresh_tokens ADD COLUMN last_used_ip VARCHAR(45) NOT NULL DEFAULT '';
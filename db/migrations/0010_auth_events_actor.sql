@@ -0,0 +1 @@
+ALTER TABLE auth_events ADD COLUMN actor_id INT REFERENCES users (id) ON DELETE SET NULL;
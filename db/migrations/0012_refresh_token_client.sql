@@ -0,0 +1,2 @@
+ALTER TABLE refresh_tokens ADD COLUMN user_agent VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN ip VARCHAR(45) NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+CREATE INDEX idx_users_username ON users (username);
@@ -0,0 +1 @@
+CREATE INDEX idx_refresh_tokens_expires_at ON refresh_tokens (expires_at);
@@ -1,47 +1,537 @@
 package config
 
 import (
+	"compress/gzip"
+	"errors"
+	"fmt"
 	"log/slog"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/Kovalyovv/auth-service/internal/pkg/jwt"
 	"github.com/joho/godotenv"
 )
 
+// Config is populated from environment variables by Load. Each field names
+// its variable in the env tag and, optionally, a fallback in the default tag.
 type Config struct {
-	HTTPPort        string
-	GRPCPort        string
-	DatabaseURL     string
-	JWTSecret       string
-	AccessTokenTTL  time.Duration
-	RefreshTokenTTL time.Duration
+	HTTPPort string `env:"HTTP_PORT" default:"8001"`
+	GRPCPort string `env:"GRPC_PORT" default:"50001"`
+	// ListenMode is "split" (HTTP on HTTPPort, gRPC on GRPCPort) or
+	// "single" (both multiplexed on HTTPPort; GRPCPort is unused).
+	ListenMode string `env:"LISTEN_MODE" default:"split"`
+	// AdminPort, when set, moves /metrics and the admin API off HTTPPort
+	// to a server of its own, which also answers /healthz.
+	AdminPort string `env:"ADMIN_PORT"`
+	// AppEnv names the deployment. In "production" every HTTP response
+	// carries Strict-Transport-Security with HSTSMaxAge.
+	AppEnv     string        `env:"APP_ENV" default:"development"`
+	HSTSMaxAge time.Duration `env:"HSTS_MAX_AGE" default:"8760h"`
+	// DatabaseURL takes precedence over DB; when unset, it is assembled from
+	// the DB components.
+	DatabaseURL string `env:"DATABASE_URL"`
+	JWTSecret   string `env:"JWT_SECRET"`
+	// JWTSecretPrevious is the secret JWTSecret replaced. Tokens signed with
+	// it stay valid until it is removed, which should wait until they have
+	// all expired.
+	JWTSecretPrevious string `env:"JWT_SECRET_PREVIOUS"`
+	// JWTSecretMinEntropy is the estimated entropy in bits JWTSecret and
+	// JWTSecretPrevious must have. AllowWeakJWTSecret skips this and the
+	// blocklist check, for test environments only.
+	JWTSecretMinEntropy int           `env:"JWT_SECRET_MIN_ENTROPY" default:"80"`
+	AllowWeakJWTSecret  bool          `env:"ALLOW_WEAK_JWT_SECRET" default:"false"`
+	AccessTokenTTL      time.Duration `env:"ACCESS_TOKEN_TTL" default:"15m"`
+	RefreshTokenTTL     time.Duration `env:"REFRESH_TOKEN_TTL" default:"168h"`
+	// MaxAccessTokenTTL caps the lifetime of every access token, whatever
+	// ACCESS_TOKEN_TTL or STEP_UP_TOKEN_TTL say. Zero disables the cap.
+	MaxAccessTokenTTL time.Duration `env:"MAX_ACCESS_TOKEN_TTL" default:"1h"`
+	// JWTLeeway absorbs clock skew between nodes when checking iat and nbf.
+	// JWTExpiryLeeway keeps accepting tokens for that long past exp; it is
+	// separate so that skew tolerance does not silently extend every
+	// token's lifetime.
+	JWTLeeway       time.Duration `env:"JWT_LEEWAY" default:"30s"`
+	JWTExpiryLeeway time.Duration `env:"JWT_EXPIRY_LEEWAY" default:"0s"`
+	// VerifyExpiredGrace is how long after expiry VerifyToken still accepts
+	// an access token, flagged as in grace. Zero disables it.
+	VerifyExpiredGrace time.Duration `env:"VERIFY_EXPIRED_GRACE" default:"0s"`
+	// TokenVersionCacheTTL is how long token versions read under
+	// TOKEN_VERSION_CHECK are cached. Zero reads the database every time.
+	TokenVersionCacheTTL time.Duration `env:"TOKEN_VERSION_CACHE_TTL" default:"30s"`
+	// JWTAlgorithm is the HMAC variant tokens are signed with: HS256, HS384
+	// or HS512. Tokens signed with another variant are rejected.
+	JWTAlgorithm string `env:"JWT_ALGORITHM" default:"HS256"`
+	// RefreshTokenMode is "opaque" (random tokens stored in the database) or
+	// "jwt" (signed tokens checked against a revocation list).
+	RefreshTokenMode string `env:"REFRESH_TOKEN_MODE" default:"opaque"`
+	// RefreshRotateThreshold keeps an opaque refresh token on refresh until
+	// it is within this duration of expiry. Zero rotates on every refresh.
+	RefreshRotateThreshold time.Duration `env:"REFRESH_ROTATE_THRESHOLD" default:"0s"`
+	// RefreshMaxCount is how many times an opaque refresh token may be
+	// rotated before the user must log in again. Zero means no limit.
+	RefreshMaxCount int `env:"REFRESH_MAX_COUNT" default:"0"`
+	// VerifyPasswordMaxFailures wrong passwords within
+	// VerifyPasswordWindow block /auth/verify-password for the user until
+	// the window ends. Zero disables the limit.
+	VerifyPasswordMaxFailures int           `env:"VERIFY_PASSWORD_MAX_FAILURES" default:"5"`
+	VerifyPasswordWindow      time.Duration `env:"VERIFY_PASSWORD_WINDOW" default:"15m"`
+	// LoginLockoutThreshold failed logins in a row lock the account for
+	// LoginLockoutDuration. Zero disables locking.
+	LoginLockoutThreshold int           `env:"LOGIN_LOCKOUT_THRESHOLD" default:"0"`
+	LoginLockoutDuration  time.Duration `env:"LOGIN_LOCKOUT_DURATION" default:"15m"`
+	// LoginBackoffThreshold failed logins in a row for an email make the
+	// next one wait LoginBackoffBase, doubling with each further failure up
+	// to LoginBackoffMax. Zero disables the backoff.
+	LoginBackoffThreshold int           `env:"LOGIN_BACKOFF_THRESHOLD" default:"0"`
+	LoginBackoffBase      time.Duration `env:"LOGIN_BACKOFF_BASE" default:"1s"`
+	LoginBackoffMax       time.Duration `env:"LOGIN_BACKOFF_MAX" default:"5m"`
+	// LoginIPMaxFailures failed logins from one IP within LoginIPWindow, and
+	// LoginEmailMaxFailures to one email within LoginEmailWindow, block
+	// further logins from that IP or to that email until the window ends.
+	// Zero disables the respective limit.
+	LoginIPMaxFailures    int           `env:"LOGIN_IP_MAX_FAILURES" default:"0"`
+	LoginIPWindow         time.Duration `env:"LOGIN_IP_WINDOW" default:"15m"`
+	LoginEmailMaxFailures int           `env:"LOGIN_EMAIL_MAX_FAILURES" default:"0"`
+	LoginEmailWindow      time.Duration `env:"LOGIN_EMAIL_WINDOW" default:"15m"`
+	// LoginFailureLogLevel is the level failed logins are logged at with
+	// their reason: debug, info, warn or error.
+	LoginFailureLogLevel string `env:"LOGIN_FAILURE_LOG_LEVEL" default:"warn"`
+	// PasswordHashAlgorithm is used for new password hashes: "bcrypt" or
+	// "argon2id". With argon2id, bcrypt hashes are upgraded on login.
+	PasswordHashAlgorithm string `env:"PASSWORD_HASH_ALGORITHM" default:"bcrypt"`
+	// PasswordMinLength and PasswordMaxBytes bound new passwords, in
+	// characters and bytes. bcrypt ignores everything past 72 bytes, so a
+	// larger maximum needs argon2id.
+	PasswordMinLength int `env:"PASSWORD_MIN_LENGTH" default:"8"`
+	PasswordMaxBytes  int `env:"PASSWORD_MAX_BYTES" default:"72"`
+	// HashConcurrency caps simultaneous password hash computations; requests
+	// that wait longer than HashQueueTimeout for a slot get 503.
+	HashConcurrency  int           `env:"HASH_CONCURRENCY" default:"8"`
+	HashQueueTimeout time.Duration `env:"HASH_QUEUE_TIMEOUT" default:"1s"`
+	// SlowQueryThreshold logs repository calls that take at least this long.
+	// Zero disables the log; latencies are always exported as metrics.
+	SlowQueryThreshold time.Duration `env:"SLOW_QUERY_THRESHOLD" default:"200ms"`
+	// GRPCHandlerTimeout bounds each gRPC call's work in the usecase.
+	GRPCHandlerTimeout time.Duration `env:"GRPC_HANDLER_TIMEOUT" default:"5s"`
+	// AllowedEmailDomains limits registration to these email domains; empty
+	// allows any domain not in BlockedEmailDomains.
+	AllowedEmailDomains []string `env:"ALLOWED_EMAIL_DOMAINS"`
+	BlockedEmailDomains []string `env:"BLOCKED_EMAIL_DOMAINS"`
+	// DisposableEmailDomainsFile lists disposable mailbox providers, one
+	// domain per line, whose addresses may not register. It is re-read every
+	// DisposableEmailReloadInterval. Empty disables the check.
+	DisposableEmailDomainsFile    string        `env:"DISPOSABLE_EMAIL_DOMAINS_FILE"`
+	DisposableEmailReloadInterval time.Duration `env:"DISPOSABLE_EMAIL_RELOAD_INTERVAL" default:"1h"`
+	// DefaultRole is the role new users get on registration: user or admin.
+	DefaultRole string `env:"DEFAULT_ROLE" default:"user"`
+	// ResourceAudiences lists the resource servers users may request scoped
+	// access tokens for at POST /auth/token, as "name" for any user or
+	// "name:role" for users with that role. Empty disables such tokens.
+	ResourceAudiences []string `env:"RESOURCE_AUDIENCES"`
+	// SuperAdminIDs are the ids of admins who see full emails in admin
+	// listings when MASK_ADMIN_EMAILS is on.
+	SuperAdminIDs []string `env:"SUPER_ADMIN_IDS"`
+	// StepUpTokenTTL is the lifetime of tokens issued after re-entering the
+	// password, which sensitive routes require.
+	StepUpTokenTTL time.Duration `env:"STEP_UP_TOKEN_TTL" default:"5m"`
+	// EmailVerificationTTL is how long an email verification link stays
+	// valid. VerificationResendInterval is the minimum time between two
+	// resend requests for the same address; zero allows any number.
+	EmailVerificationTTL       time.Duration `env:"EMAIL_VERIFICATION_TTL" default:"24h"`
+	VerificationResendInterval time.Duration `env:"VERIFICATION_RESEND_INTERVAL" default:"1m"`
+	// PasswordChangeCooldown is the minimum time between password changes.
+	// Zero allows changes at any time.
+	PasswordChangeCooldown time.Duration `env:"PASSWORD_CHANGE_COOLDOWN" default:"0s"`
+	// IdempotencyTTL is how long a registration response is replayed for a
+	// repeated Idempotency-Key. Zero ignores the header.
+	IdempotencyTTL time.Duration `env:"IDEMPOTENCY_TTL" default:"10m"`
+	// UserLookupRateLimit caps admin lookups of users by email to this many
+	// per UserLookupRateWindow and admin. Zero disables the cap.
+	UserLookupRateLimit  int           `env:"USER_LOOKUP_RATE_LIMIT" default:"30"`
+	UserLookupRateWindow time.Duration `env:"USER_LOOKUP_RATE_WINDOW" default:"1m"`
+	// GzipLevel and GzipMinSize configure response compression when
+	// Features.Gzip is on. Responses shorter than GzipMinSize bytes are sent
+	// uncompressed.
+	GzipLevel   int `env:"GZIP_LEVEL" default:"5"`
+	GzipMinSize int `env:"GZIP_MIN_SIZE" default:"1024"`
+	// CleanupInterval is how often expired refresh tokens are deleted. Zero
+	// disables the cleanup worker.
+	CleanupInterval time.Duration `env:"CLEANUP_INTERVAL" default:"1h"`
+	// CleanupVacuumThreshold vacuums the refresh token tables after a
+	// cleanup that deleted at least this many rows. Zero leaves it to
+	// autovacuum, which suffices unless expiries come in large bursts.
+	CleanupVacuumThreshold int64 `env:"CLEANUP_VACUUM_THRESHOLD" default:"0"`
+
+	DB       DBComponents
+	Argon2   Argon2
+	Webhook  Webhook
+	Mail     Mail
+	Headers  SecurityHeaders
+	Features Features
 }
 
-func NewFromEnv() *Config {
-	_ = godotenv.Load()
+// SecurityHeaders are the values of the baseline security headers set on
+// every HTTP response. "off" leaves a header out.
+type SecurityHeaders struct {
+	ContentTypeOptions    string `env:"X_CONTENT_TYPE_OPTIONS" default:"nosniff"`
+	FrameOptions          string `env:"X_FRAME_OPTIONS" default:"DENY"`
+	ReferrerPolicy        string `env:"REFERRER_POLICY" default:"no-referrer"`
+	ContentSecurityPolicy string `env:"CONTENT_SECURITY_POLICY" default:"default-src 'none'; frame-ancestors 'none'"`
+}
+
+// Value returns the header value v configures, or "" when it is "off".
+func (SecurityHeaders) Value(v string) string {
+	if v == "off" {
+		return ""
+	}
+	return v
+}
 
-	return &Config{
-		HTTPPort:        getEnv("HTTP_PORT", "8001"),
-		GRPCPort:        getEnv("GRPC_PORT", "50001"),
-		DatabaseURL:     os.Getenv("DATABASE_URL"),
-		JWTSecret:       os.Getenv("JWT_SECRET"),
-		AccessTokenTTL:  parseDuration(getEnv("ACCESS_TOKEN_TTL", "15m")),
-		RefreshTokenTTL: parseDuration(getEnv("REFRESH_TOKEN_TTL", "168h")),
+// LoginFailureLevel returns LoginFailureLogLevel as a slog level, or
+// slog.LevelWarn if it does not name one.
+func (c *Config) LoginFailureLevel() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LoginFailureLogLevel)); err != nil {
+		return slog.LevelWarn
 	}
+	return level
 }
 
-func parseDuration(s string) time.Duration {
-	d, err := time.ParseDuration(s)
-	if err != nil {
-		slog.Warn("could not parse duration, using default", "input", s, "error", err)
-		return time.Minute * 15
+// ResourceAudienceRoles maps each of ResourceAudiences to the role it
+// requires, "" if any user may request it.
+func (c *Config) ResourceAudienceRoles() map[string]string {
+	roles := make(map[string]string, len(c.ResourceAudiences))
+	for _, a := range c.ResourceAudiences {
+		name, role, _ := strings.Cut(a, ":")
+		roles[name] = role
 	}
-	return d
+	return roles
 }
 
-func getEnv(key, fallback string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
+// SuperAdminUserIDs parses SuperAdminIDs. Validate rejects malformed ids.
+func (c *Config) SuperAdminUserIDs() []int64 {
+	ids := make([]int64, 0, len(c.SuperAdminIDs))
+	for _, s := range c.SuperAdminIDs {
+		if id, err := strconv.ParseInt(s, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Webhook configures outbound event delivery. An empty URL disables it.
+type Webhook struct {
+	URL         string        `env:"WEBHOOK_URL"`
+	Secret      string        `env:"WEBHOOK_SECRET"`
+	MaxAttempts int           `env:"WEBHOOK_MAX_ATTEMPTS" default:"3"`
+	Timeout     time.Duration `env:"WEBHOOK_TIMEOUT" default:"5s"`
+}
+
+// Mail selects how account emails are sent: "log" writes them to the log for
+// development, "smtp" sends them through SMTPHost.
+type Mail struct {
+	Driver       string `env:"MAIL_DRIVER" default:"log"`
+	SMTPHost     string `env:"SMTP_HOST"`
+	SMTPPort     string `env:"SMTP_PORT" default:"587"`
+	SMTPUsername string `env:"SMTP_USERNAME"`
+	SMTPPassword string `env:"SMTP_PASSWORD"`
+	From         string `env:"MAIL_FROM"`
+	// LinkBaseURL is the frontend origin that verification and reset links
+	// in emails point to.
+	LinkBaseURL string `env:"MAIL_LINK_BASE_URL" default:"http://localhost:9000"`
+}
+
+// Argon2 holds the Argon2id cost parameters used for new hashes. Existing
+// hashes record their own parameters and keep verifying after these change.
+type Argon2 struct {
+	Memory      uint32 `env:"ARGON2_MEMORY" default:"65536"` // KiB
+	Iterations  uint32 `env:"ARGON2_ITERATIONS" default:"3"`
+	Parallelism uint8  `env:"ARGON2_PARALLELISM" default:"2"`
+}
+
+// Bounds for Argon2 parameters accepted at startup. The lower bounds follow
+// the OWASP minimum recommendation; the upper bounds keep a single login
+// from exhausting the host.
+const (
+	minArgon2Memory      = 19 * 1024
+	maxArgon2Memory      = 4 * 1024 * 1024
+	minArgon2Iterations  = 1
+	maxArgon2Iterations  = 20
+	minArgon2Parallelism = 1
+	maxArgon2Parallelism = 64
+)
+
+// bcryptMaxPasswordBytes is how much of a password bcrypt hashes.
+const bcryptMaxPasswordBytes = 72
+
+// DBComponents describes the database connection for platforms that inject
+// its parts separately instead of a single DATABASE_URL.
+type DBComponents struct {
+	Host     string `env:"DB_HOST"`
+	Port     string `env:"DB_PORT" default:"5432"`
+	User     string `env:"DB_USER"`
+	Password string `env:"DB_PASSWORD"`
+	Name     string `env:"DB_NAME"`
+	SSLMode  string `env:"DB_SSLMODE"`
+}
+
+// URL assembles a postgres connection string, escaping the credentials.
+func (d DBComponents) URL() string {
+	u := url.URL{
+		Scheme: "postgres",
+		Host:   net.JoinHostPort(d.Host, d.Port),
+		Path:   "/" + d.Name,
+	}
+	if d.User != "" {
+		if d.Password != "" {
+			u.User = url.UserPassword(d.User, d.Password)
+		} else {
+			u.User = url.User(d.User)
+		}
+	}
+	if d.SSLMode != "" {
+		u.RawQuery = url.Values{"sslmode": {d.SSLMode}}.Encode()
+	}
+	return u.String()
+}
+
+// Features groups the boolean switches that turn optional behaviour on or
+// off. They are parsed once here and passed down explicitly.
+type Features struct {
+	RegistrationEnabled bool `env:"REGISTRATION_ENABLED" default:"true"`
+	// ProfileInTokenResponse adds the user's id, username, email and role to
+	// login and refresh responses.
+	ProfileInTokenResponse bool `env:"PROFILE_IN_TOKEN_RESPONSE" default:"false"`
+	// SingleSession makes a new login revoke all earlier refresh tokens of
+	// the user. It requires REFRESH_TOKEN_MODE=opaque.
+	SingleSession bool `env:"SINGLE_SESSION" default:"false"`
+	// EnumerationSafeRegistration answers registration for a taken email
+	// like a new one, with 202 Accepted, and emails the account owner
+	// instead of returning 409.
+	EnumerationSafeRegistration bool `env:"ENUMERATION_SAFE_REGISTRATION" default:"false"`
+	// SignInOnRegister answers a registration with a token pair, as a login
+	// would. It has no effect with ENUMERATION_SAFE_REGISTRATION.
+	SignInOnRegister bool `env:"SIGN_IN_ON_REGISTER" default:"false"`
+	// QueryTokenAuth accepts the access token in the access_token query
+	// parameter when no Authorization header is sent, for EventSource and
+	// WebSocket clients that cannot set headers.
+	QueryTokenAuth bool `env:"QUERY_TOKEN_AUTH" default:"false"`
+	// RESTGateway serves /auth/register, /auth/login, /auth/refresh and
+	// /auth/verify through grpc-gateway, so REST and gRPC share one
+	// implementation. Login and refresh responses then carry only the
+	// token pair, whatever PROFILE_IN_TOKEN_RESPONSE says.
+	RESTGateway bool `env:"REST_GATEWAY" default:"false"`
+	// Gzip compresses HTTP responses for clients that accept it.
+	Gzip bool `env:"GZIP" default:"false"`
+	// StrictJSON rejects register, login and refresh bodies with unknown
+	// fields, naming the field, instead of ignoring them.
+	StrictJSON bool `env:"STRICT_JSON" default:"false"`
+	// RejectAuthenticatedRegister answers register and login requests that
+	// carry a valid access token with 409 already_authenticated.
+	RejectAuthenticatedRegister bool `env:"REJECT_AUTHENTICATED_REGISTER" default:"false"`
+	// HTTPSRedirect answers requests the proxy reports as plain http with
+	// X-Forwarded-Proto with a 308 to https. It applies with
+	// APP_ENV=production only.
+	HTTPSRedirect bool `env:"HTTPS_REDIRECT" default:"false"`
+	// RefreshTokenCookie sends web clients, which set X-Client-Type: web,
+	// their refresh token as an HttpOnly cookie rather than in the body.
+	// The cookie is https-only unless RefreshCookieInsecure is set.
+	RefreshTokenCookie    bool `env:"REFRESH_TOKEN_COOKIE" default:"false"`
+	RefreshCookieInsecure bool `env:"REFRESH_COOKIE_INSECURE" default:"false"`
+	// UsernameLogin lets users log in with their username as well as their
+	// email.
+	UsernameLogin bool `env:"USERNAME_LOGIN" default:"false"`
+	// TokenVersionCheck rejects access tokens issued before the user's last
+	// password or role change, at the cost of a database read per check.
+	// Admin tokens are checked regardless, so a demotion always takes effect.
+	TokenVersionCheck bool `env:"TOKEN_VERSION_CHECK" default:"false"`
+	// AuthTimeClaim adds auth_time, when the user last entered their
+	// password, to access tokens. Refreshes keep it unchanged.
+	AuthTimeClaim bool `env:"AUTH_TIME_CLAIM" default:"false"`
+	// FirstUserIsAdmin gives the admin role to whoever registers while
+	// there are no users yet, instead of DEFAULT_ROLE.
+	FirstUserIsAdmin bool `env:"FIRST_USER_IS_ADMIN" default:"false"`
+	// MaskAdminEmails shows admins other users' emails in listings as
+	// j***@example.com, unless they are one of SUPER_ADMIN_IDS.
+	MaskAdminEmails bool `env:"MASK_ADMIN_EMAILS" default:"false"`
+}
+
+// NewFromEnv loads the configuration from the environment and, when
+// CONFIG_FILE names one, a YAML or JSON file whose values the environment
+// overrides. See LoadFile.
+func NewFromEnv() (*Config, error) {
+	_ = godotenv.Load()
+
+	var cfg Config
+	load := Load
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		load = func(dst any) error { return LoadFile(dst, path) }
+	}
+	if err := load(&cfg); err != nil {
+		return nil, err
+	}
+	if cfg.DatabaseURL == "" && cfg.DB.Host != "" {
+		cfg.DatabaseURL = cfg.DB.URL()
+	}
+	return &cfg, nil
+}
+
+// Validate reports configuration that the service cannot start with.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.JWTSecret == "" {
+		errs = append(errs, errors.New("JWT_SECRET must be set"))
+	} else if !c.AllowWeakJWTSecret {
+		if err := jwt.CheckSecret(c.JWTSecret, c.JWTSecretMinEntropy); err != nil {
+			errs = append(errs, fmt.Errorf("JWT_SECRET %w", err))
+		}
+	}
+	if c.JWTSecretPrevious != "" {
+		if c.JWTSecretPrevious == c.JWTSecret {
+			errs = append(errs, errors.New("JWT_SECRET_PREVIOUS must differ from JWT_SECRET"))
+		} else if !c.AllowWeakJWTSecret {
+			if err := jwt.CheckSecret(c.JWTSecretPrevious, c.JWTSecretMinEntropy); err != nil {
+				errs = append(errs, fmt.Errorf("JWT_SECRET_PREVIOUS %w", err))
+			}
+		}
+	}
+	if c.DatabaseURL == "" {
+		errs = append(errs, errors.New("DATABASE_URL or DB_HOST must be set"))
+	}
+	switch c.JWTAlgorithm {
+	case "HS256", "HS384", "HS512":
+	default:
+		errs = append(errs, fmt.Errorf("JWT_ALGORITHM must be HS256, HS384 or HS512, got %q", c.JWTAlgorithm))
+	}
+	if c.ListenMode != "split" && c.ListenMode != "single" {
+		errs = append(errs, fmt.Errorf("LISTEN_MODE must be split or single, got %q", c.ListenMode))
+	}
+	if c.AdminPort != "" && (c.AdminPort == c.HTTPPort || c.AdminPort == c.GRPCPort) {
+		errs = append(errs, fmt.Errorf("ADMIN_PORT must differ from HTTP_PORT and GRPC_PORT, got %q", c.AdminPort))
+	}
+	if c.AppEnv == "production" && c.HSTSMaxAge <= 0 {
+		errs = append(errs, fmt.Errorf("HSTS_MAX_AGE must be positive, got %s", c.HSTSMaxAge))
+	}
+	if c.RefreshTokenMode != "opaque" && c.RefreshTokenMode != "jwt" {
+		errs = append(errs, fmt.Errorf("REFRESH_TOKEN_MODE must be opaque or jwt, got %q", c.RefreshTokenMode))
+	}
+	if c.Features.SingleSession && c.RefreshTokenMode != "opaque" {
+		errs = append(errs, errors.New("SINGLE_SESSION requires REFRESH_TOKEN_MODE=opaque"))
+	}
+	if c.RefreshMaxCount < 0 {
+		errs = append(errs, fmt.Errorf("REFRESH_MAX_COUNT must not be negative, got %d", c.RefreshMaxCount))
+	}
+	if c.RefreshMaxCount > 0 && c.RefreshTokenMode != "opaque" {
+		errs = append(errs, errors.New("REFRESH_MAX_COUNT requires REFRESH_TOKEN_MODE=opaque"))
+	}
+	if c.VerifyPasswordMaxFailures > 0 && c.VerifyPasswordWindow <= 0 {
+		errs = append(errs, fmt.Errorf("VERIFY_PASSWORD_WINDOW must be positive, got %s", c.VerifyPasswordWindow))
+	}
+	if c.LoginLockoutThreshold < 0 {
+		errs = append(errs, fmt.Errorf("LOGIN_LOCKOUT_THRESHOLD must not be negative, got %d", c.LoginLockoutThreshold))
+	}
+	if c.LoginLockoutThreshold > 0 && c.LoginLockoutDuration <= 0 {
+		errs = append(errs, fmt.Errorf("LOGIN_LOCKOUT_DURATION must be positive, got %s", c.LoginLockoutDuration))
+	}
+	if err := new(slog.Level).UnmarshalText([]byte(c.LoginFailureLogLevel)); err != nil {
+		errs = append(errs, fmt.Errorf("LOGIN_FAILURE_LOG_LEVEL must be debug, info, warn or error, got %q", c.LoginFailureLogLevel))
+	}
+	if c.LoginBackoffThreshold < 0 {
+		errs = append(errs, fmt.Errorf("LOGIN_BACKOFF_THRESHOLD must not be negative, got %d", c.LoginBackoffThreshold))
+	}
+	if c.LoginBackoffThreshold > 0 && (c.LoginBackoffBase <= 0 || c.LoginBackoffMax < c.LoginBackoffBase) {
+		errs = append(errs, fmt.Errorf("LOGIN_BACKOFF_BASE must be positive and at most LOGIN_BACKOFF_MAX, got %s and %s", c.LoginBackoffBase, c.LoginBackoffMax))
+	}
+	if c.LoginIPMaxFailures < 0 {
+		errs = append(errs, fmt.Errorf("LOGIN_IP_MAX_FAILURES must not be negative, got %d", c.LoginIPMaxFailures))
+	}
+	if c.LoginIPMaxFailures > 0 && c.LoginIPWindow <= 0 {
+		errs = append(errs, fmt.Errorf("LOGIN_IP_WINDOW must be positive, got %s", c.LoginIPWindow))
+	}
+	if c.LoginEmailMaxFailures < 0 {
+		errs = append(errs, fmt.Errorf("LOGIN_EMAIL_MAX_FAILURES must not be negative, got %d", c.LoginEmailMaxFailures))
+	}
+	if c.LoginEmailMaxFailures > 0 && c.LoginEmailWindow <= 0 {
+		errs = append(errs, fmt.Errorf("LOGIN_EMAIL_WINDOW must be positive, got %s", c.LoginEmailWindow))
+	}
+	if c.GzipLevel < gzip.DefaultCompression || c.GzipLevel > gzip.BestCompression {
+		errs = append(errs, fmt.Errorf("GZIP_LEVEL must be between %d and %d, got %d", gzip.DefaultCompression, gzip.BestCompression, c.GzipLevel))
+	}
+	if c.DisposableEmailDomainsFile != "" && c.DisposableEmailReloadInterval <= 0 {
+		errs = append(errs, fmt.Errorf("DISPOSABLE_EMAIL_RELOAD_INTERVAL must be positive, got %s", c.DisposableEmailReloadInterval))
+	}
+	if c.GzipMinSize < 0 {
+		errs = append(errs, fmt.Errorf("GZIP_MIN_SIZE must not be negative, got %d", c.GzipMinSize))
+	}
+	if c.HashConcurrency < 1 {
+		errs = append(errs, fmt.Errorf("HASH_CONCURRENCY must be at least 1, got %d", c.HashConcurrency))
+	}
+	if c.MaxAccessTokenTTL < 0 {
+		errs = append(errs, fmt.Errorf("MAX_ACCESS_TOKEN_TTL must not be negative, got %s", c.MaxAccessTokenTTL))
+	}
+	if c.StepUpTokenTTL <= 0 {
+		errs = append(errs, fmt.Errorf("STEP_UP_TOKEN_TTL must be positive, got %s", c.StepUpTokenTTL))
+	}
+	if c.EmailVerificationTTL <= 0 {
+		errs = append(errs, fmt.Errorf("EMAIL_VERIFICATION_TTL must be positive, got %s", c.EmailVerificationTTL))
+	}
+	if c.VerificationResendInterval < 0 {
+		errs = append(errs, fmt.Errorf("VERIFICATION_RESEND_INTERVAL must not be negative, got %s", c.VerificationResendInterval))
+	}
+	if c.PasswordHashAlgorithm != "bcrypt" && c.PasswordHashAlgorithm != "argon2id" {
+		errs = append(errs, fmt.Errorf("PASSWORD_HASH_ALGORITHM must be bcrypt or argon2id, got %q", c.PasswordHashAlgorithm))
+	}
+	if c.PasswordMinLength < 1 {
+		errs = append(errs, fmt.Errorf("PASSWORD_MIN_LENGTH must be positive, got %d", c.PasswordMinLength))
+	}
+	if c.PasswordMaxBytes < c.PasswordMinLength {
+		errs = append(errs, fmt.Errorf("PASSWORD_MAX_BYTES must be at least PASSWORD_MIN_LENGTH, got %d", c.PasswordMaxBytes))
+	}
+	if c.PasswordHashAlgorithm == "bcrypt" && c.PasswordMaxBytes > bcryptMaxPasswordBytes {
+		errs = append(errs, fmt.Errorf("PASSWORD_MAX_BYTES must be at most %d with bcrypt, got %d", bcryptMaxPasswordBytes, c.PasswordMaxBytes))
+	}
+	if m := c.Argon2.Memory; m < minArgon2Memory || m > maxArgon2Memory {
+		errs = append(errs, fmt.Errorf("ARGON2_MEMORY must be between %d and %d KiB, got %d", minArgon2Memory, maxArgon2Memory, m))
+	}
+	if t := c.Argon2.Iterations; t < minArgon2Iterations || t > maxArgon2Iterations {
+		errs = append(errs, fmt.Errorf("ARGON2_ITERATIONS must be between %d and %d, got %d", minArgon2Iterations, maxArgon2Iterations, t))
+	}
+	if p := c.Argon2.Parallelism; p < minArgon2Parallelism || p > maxArgon2Parallelism {
+		errs = append(errs, fmt.Errorf("ARGON2_PARALLELISM must be between %d and %d, got %d", minArgon2Parallelism, maxArgon2Parallelism, p))
+	}
+	if c.Webhook.URL != "" {
+		if c.Webhook.Secret == "" {
+			errs = append(errs, errors.New("WEBHOOK_SECRET must be set when WEBHOOK_URL is"))
+		}
+		if c.Webhook.MaxAttempts < 1 {
+			errs = append(errs, fmt.Errorf("WEBHOOK_MAX_ATTEMPTS must be at least 1, got %d", c.Webhook.MaxAttempts))
+		}
+	}
+	if c.DefaultRole != "user" && c.DefaultRole != "admin" {
+		errs = append(errs, fmt.Errorf("DEFAULT_ROLE must be user or admin, got %q", c.DefaultRole))
+	}
+	for _, a := range c.ResourceAudiences {
+		name, role, _ := strings.Cut(a, ":")
+		if name == "" || (role != "" && role != "user" && role != "admin") {
+			errs = append(errs, fmt.Errorf("RESOURCE_AUDIENCES entries must be name or name:user|admin, got %q", a))
+		}
+	}
+	for _, s := range c.SuperAdminIDs {
+		if id, err := strconv.ParseInt(s, 10, 64); err != nil || id <= 0 {
+			errs = append(errs, fmt.Errorf("SUPER_ADMIN_IDS entries must be user ids, got %q", s))
+		}
+	}
+	switch c.Mail.Driver {
+	case "log":
+	case "smtp":
+		if c.Mail.SMTPHost == "" || c.Mail.From == "" {
+			errs = append(errs, errors.New("SMTP_HOST and MAIL_FROM must be set when MAIL_DRIVER=smtp"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("MAIL_DRIVER must be log or smtp, got %q", c.Mail.Driver))
 	}
-	return fallback
+	return errors.Join(errs...)
 }
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadFile fills dst like Load, taking values that are not set in the
+// environment from the YAML or JSON file at path. The file is a flat object
+// keyed by variable name, e.g. `ACCESS_TOKEN_TTL: 15m`, so every setting is
+// spelled the same way in both places. Precedence is environment, then file,
+// then the default tag. Keys that name no field are reported as errors, so a
+// misspelt setting does not go unnoticed.
+func LoadFile(dst any, path string) error {
+	t := reflect.TypeOf(dst)
+	if t == nil || t.Kind() != reflect.Pointer || t.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: LoadFile expects a pointer to a struct, got %T", dst)
+	}
+
+	values, err := readFile(path)
+	if err != nil {
+		return err
+	}
+	known := envKeys(t.Elem())
+	var unknown []string
+	for key := range values {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		slices.Sort(unknown)
+		return fmt.Errorf("config: %s: unknown keys %s", path, strings.Join(unknown, ", "))
+	}
+
+	return load(dst, func(key string) string {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+		return values[key]
+	})
+}
+
+// readFile decodes the config file at path into raw values, formatted the
+// way they would be written in the environment.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+
+	var doc map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(&doc)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	default:
+		return nil, fmt.Errorf("config: %s: unsupported file type %q, want .yaml, .yml or .json", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config: %s: %w", path, err)
+	}
+
+	values := make(map[string]string, len(doc))
+	var errs []error
+	for key, v := range doc {
+		raw, err := rawValue(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("config: %s: %s: %w", path, key, err))
+			continue
+		}
+		values[key] = raw
+	}
+	return values, errors.Join(errs...)
+}
+
+// rawValue formats a decoded scalar, or a list as a comma-separated string.
+func rawValue(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool, int, int64, uint64, float64, json.Number:
+		return fmt.Sprint(v), nil
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := rawValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value of type %T", v)
+	}
+}
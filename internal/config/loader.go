@@ -0,0 +1,134 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load fills the struct pointed to by dst from environment variables.
+//
+// Fields tagged `env:"NAME"` are read from NAME, falling back to the
+// `default:"..."` tag when the variable is unset or empty. Untagged struct
+// fields are loaded recursively. Supported kinds are string, bool, integers,
+// time.Duration and comma-separated []string. Every value that fails to
+// parse is reported in the returned error.
+func Load(dst any) error {
+	return load(dst, os.Getenv)
+}
+
+// load is Load reading variables through lookup.
+func load(dst any, lookup func(string) string) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: Load expects a pointer to a struct, got %T", dst)
+	}
+	return loadStruct(v.Elem(), lookup)
+}
+
+func loadStruct(v reflect.Value, lookup func(string) string) error {
+	var errs []error
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		key, tagged := field.Tag.Lookup("env")
+		if !tagged {
+			if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+				if err := loadStruct(v.Field(i), lookup); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			continue
+		}
+
+		raw := lookup(key)
+		if raw == "" {
+			raw = field.Tag.Get("default")
+		}
+		if raw == "" {
+			continue
+		}
+
+		if err := setField(v.Field(i), raw); err != nil {
+			errs = append(errs, fmt.Errorf("config: %s=%q: %w", key, raw, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// envKeys returns the env tag of every field Load would fill in t.
+func envKeys(t reflect.Type) map[string]bool {
+	keys := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if key, ok := field.Tag.Lookup("env"); ok {
+			keys[key] = true
+		} else if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+			for k := range envKeys(field.Type) {
+				keys[k] = true
+			}
+		}
+	}
+	return keys
+}
+
+func setField(f reflect.Value, raw string) error {
+	if f.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Slice:
+		if f.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported slice type %s", f.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		f.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported field type %s", f.Type())
+	}
+	return nil
+}
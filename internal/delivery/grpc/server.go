@@ -3,34 +3,309 @@ package grpc
 import (
 	"context"
 	"errors"
+	"io"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Kovalyovv/auth-service/internal/domain"
-	"github.com/Kovalyovv/auth-service/internal/usecase"
 	"github.com/Kovalyovv/auth-service/pkg/pb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+type AuthUseCase interface {
+	Verify(ctx context.Context, token string) (userID int64, inGrace bool, err error)
+	Refresh(ctx context.Context, refreshToken string, client domain.ClientInfo) (domain.TokenPair, *domain.User, error)
+	Register(ctx context.Context, username, email, password string) (domain.RegisterResult, error)
+	Login(ctx context.Context, identifier, password string, client domain.ClientInfo) (domain.TokenPair, *domain.User, error)
+}
+
+// Header metadata of a successful Refresh: whether the presented refresh
+// token was consumed, "true" or "false", and when the current one expires,
+// in RFC 3339. The REST gateway forwards them as HTTP headers of the same
+// name.
+const (
+	RefreshTokenConsumedKey = "x-refresh-token-consumed"
+	RefreshExpiresAtKey     = "x-refresh-expires-at"
 )
 
 type Server struct {
 	pb.UnimplementedAuthServiceServer
-	uc *usecase.AuthUseCase
+	uc      AuthUseCase
+	timeout time.Duration
 }
 
-func NewServer(uc *usecase.AuthUseCase) *Server {
-	return &Server{uc: uc}
+// Option configures optional Server behaviour.
+type Option func(*Server)
+
+// WithHandlerTimeout bounds how long a single RPC may spend in the usecase,
+// so a slow database cannot hold the caller indefinitely. Zero disables it.
+func WithHandlerTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.timeout = d
+	}
+}
+
+func NewServer(uc AuthUseCase, opts ...Option) *Server {
+	s := &Server{uc: uc}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *Server) VerifyToken(ctx context.Context, req *pb.VerifyTokenRequest) (*pb.VerifyTokenResponse, error) {
-	userID, err := s.uc.Verify(req.GetToken())
+	ctx, cancel := s.withDeadline(ctx)
+	defer cancel()
+
+	userID, inGrace, apiErr := s.verify(ctx, req.GetToken())
+	if apiErr != nil {
+		return nil, newStatus(apiErr)
+	}
+
+	return &pb.VerifyTokenResponse{
+		UserId:  userID,
+		Valid:   true,
+		InGrace: inGrace,
+	}, nil
+}
+
+// VerifyTokenStream answers every token received with one response, in
+// order. Invalid tokens are reported in their response rather than ending
+// the stream. It returns when the client closes its side or the stream
+// fails, e.g. because the client cancelled it.
+func (s *Server) VerifyTokenStream(stream pb.AuthService_VerifyTokenStreamServer) error {
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		resp := &pb.VerifyTokenResponse{}
+		userID, inGrace, apiErr := s.verify(stream.Context(), req.GetToken())
+		if apiErr != nil {
+			resp.ErrorCode = apiErr.Code
+		} else {
+			resp.UserId, resp.Valid, resp.InGrace = userID, true, inGrace
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// verify validates token. Every failure other than expiry, or the service
+// being unable to check the token, is reported as invalid_token so callers
+// learn nothing about why a forged token failed.
+func (s *Server) verify(ctx context.Context, token string) (int64, bool, *domain.APIError) {
+	userID, inGrace, err := s.uc.Verify(ctx, token)
 	if err != nil {
-		if errors.Is(err, domain.ErrTokenExpired) {
-			return nil, status.Error(codes.Unauthenticated, "token has expired")
+		apiErr := domain.ToAPIError(err)
+		if apiErr.Code != domain.CodeTokenExpired && apiErr.Code != domain.CodeServiceUnavailable {
+			apiErr = &domain.APIError{Code: domain.CodeInvalidToken, Message: domain.ErrInvalidToken.Error()}
 		}
-		return nil, status.Error(codes.Unauthenticated, "invalid token")
+		return 0, false, apiErr
 	}
+	return userID, inGrace, nil
+}
 
-	return &pb.VerifyTokenResponse{
-		UserId: userID,
-		Valid:  true,
+func (s *Server) Refresh(ctx context.Context, req *pb.RefreshRequest) (*pb.RefreshResponse, error) {
+	if req.GetRefreshToken() == "" {
+		return nil, newStatus(&domain.APIError{Code: domain.CodeInvalidRequest, Message: "refresh_token is required"})
+	}
+
+	ctx, cancel := s.withDeadline(ctx)
+	defer cancel()
+
+	pair, _, err := s.uc.Refresh(ctx, req.GetRefreshToken(), domain.ClientInfo{IP: clientIP(ctx), AccessToken: req.GetAccessToken()})
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	md := metadata.Pairs(RefreshTokenConsumedKey, strconv.FormatBool(pair.Rotated))
+	if !pair.RefreshExpiresAt.IsZero() {
+		md.Set(RefreshExpiresAtKey, pair.RefreshExpiresAt.UTC().Format(time.RFC3339))
+	}
+	// SetHeader only fails without a transport stream, as when the server
+	// is called directly; the headers are informational.
+	_ = grpc.SetHeader(ctx, md)
+
+	return &pb.RefreshResponse{
+		AccessToken:  pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
 	}, nil
 }
+
+func (s *Server) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
+	email := strings.TrimSpace(req.GetEmail())
+	details := map[string]string{}
+	if req.GetUsername() == "" {
+		details["username"] = "required"
+	}
+	if email == "" {
+		details["email"] = "required"
+	} else if _, err := mail.ParseAddress(email); err != nil {
+		details["email"] = "email"
+	}
+	if req.GetPassword() == "" {
+		details["password"] = "required"
+	}
+	if len(details) > 0 {
+		return nil, newStatus(&domain.APIError{Code: domain.CodeInvalidRequest, Message: "invalid request body", Details: details})
+	}
+
+	ctx, cancel := s.withDeadline(ctx)
+	defer cancel()
+
+	if _, err := s.uc.Register(ctx, req.GetUsername(), email, req.GetPassword()); err != nil {
+		return nil, toStatus(ctx, err)
+	}
+	return &pb.RegisterResponse{}, nil
+}
+
+func (s *Server) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
+	identifier := req.GetIdentifier()
+	if identifier == "" {
+		identifier = req.GetEmail()
+	}
+	if identifier == "" || req.GetPassword() == "" {
+		return nil, newStatus(&domain.APIError{Code: domain.CodeInvalidRequest, Message: "email and password are required"})
+	}
+
+	ctx, cancel := s.withDeadline(ctx)
+	defer cancel()
+
+	pair, _, err := s.uc.Login(ctx, identifier, req.GetPassword(), domain.ClientInfo{
+		DeviceName: req.GetDeviceName(),
+		IP:         clientIP(ctx),
+		UserAgent:  clientUserAgent(ctx),
+	})
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	return &pb.LoginResponse{
+		AccessToken:  pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+	}, nil
+}
+
+// clientIP returns the caller's address: the peer for direct gRPC calls, or
+// the X-Forwarded-For value grpc-gateway sets for REST calls.
+func clientIP(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if xff := md.Get("x-forwarded-for"); len(xff) > 0 {
+			ip, _, _ := strings.Cut(xff[0], ",")
+			return strings.TrimSpace(ip)
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			return p.Addr.String()
+		}
+		return host
+	}
+	return ""
+}
+
+// clientUserAgent returns the caller's user agent, preferring the one a REST
+// client sent through the gateway over the gateway's own.
+func clientUserAgent(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	for _, key := range []string{"grpcgateway-user-agent", "user-agent"} {
+		if ua := md.Get(key); len(ua) > 0 {
+			return ua[0]
+		}
+	}
+	return ""
+}
+
+func (s *Server) withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.timeout)
+}
+
+// errorDomain identifies this service in ErrorInfo details.
+const errorDomain = "auth-service"
+
+// toStatus maps a usecase error to a gRPC status. Context errors are checked
+// first because drivers often wrap them in their own error types.
+func toStatus(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return newStatusCode(codes.DeadlineExceeded, &domain.APIError{Code: domain.CodeTimeout, Message: "request timed out"})
+	case errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled):
+		return newStatusCode(codes.Canceled, &domain.APIError{Code: domain.CodeTimeout, Message: "request cancelled"})
+	default:
+		return newStatus(domain.ToAPIError(err))
+	}
+}
+
+// newStatus renders apiErr as a status whose ErrorInfo reason carries the
+// same code HTTP clients receive in the response body.
+func newStatus(apiErr *domain.APIError) error {
+	return newStatusCode(grpcCode(apiErr.Code), apiErr)
+}
+
+func newStatusCode(c codes.Code, apiErr *domain.APIError) error {
+	st := status.New(c, apiErr.Message)
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{
+		Reason:   apiErr.Code,
+		Domain:   errorDomain,
+		Metadata: apiErr.Details,
+	}}
+	if apiErr.RetryAfter > 0 {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(time.Duration(apiErr.RetryAfter) * time.Second)})
+	}
+	withInfo, err := st.WithDetails(details...)
+	if err != nil {
+		return st.Err()
+	}
+	return withInfo.Err()
+}
+
+// grpcCode maps a domain error code to its gRPC status code.
+func grpcCode(code string) codes.Code {
+	switch code {
+	case domain.CodeInvalidRequest, domain.CodeInvalidRole, domain.CodePasswordTooShort, domain.CodePasswordTooLong:
+		return codes.InvalidArgument
+	case domain.CodeInvalidCredentials, domain.CodeInvalidToken, domain.CodeTokenExpired,
+		domain.CodeInvalidRefreshToken, domain.CodeRefreshLimitReached, domain.CodeUnauthenticated:
+		return codes.Unauthenticated
+	case domain.CodeForbidden, domain.CodeRegistrationClosed, domain.CodeEmailDomainNotAllowed, domain.CodeStepUpRequired,
+		domain.CodeAccountDisabled, domain.CodeDisposableEmail, domain.CodeAccountLocked:
+		return codes.PermissionDenied
+	case domain.CodeUserNotFound, domain.CodeNotFound:
+		return codes.NotFound
+	case domain.CodeEmailExists:
+		return codes.AlreadyExists
+	case domain.CodePasswordChangeTooSoon, domain.CodeAlreadyAuthenticated:
+		return codes.FailedPrecondition
+	case domain.CodeTooManyAttempts, domain.CodeRateLimited:
+		return codes.ResourceExhausted
+	case domain.CodeTimeout:
+		return codes.DeadlineExceeded
+	case domain.CodeServiceUnavailable:
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
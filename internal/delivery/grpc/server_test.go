@@ -0,0 +1,307 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/Kovalyovv/auth-service/pkg/pb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type stubUseCase struct {
+	verify   func(token string) (int64, bool, error)
+	refresh  func(ctx context.Context, refreshToken string) (domain.TokenPair, error)
+	register func(ctx context.Context, username, email, password string) error
+	login    func(ctx context.Context, email, password string, client domain.ClientInfo) (domain.TokenPair, error)
+}
+
+func (s *stubUseCase) Verify(_ context.Context, token string) (int64, bool, error) {
+	if s.verify == nil {
+		return 0, false, errors.New("not implemented")
+	}
+	return s.verify(token)
+}
+
+func (s *stubUseCase) Refresh(ctx context.Context, refreshToken string, _ domain.ClientInfo) (domain.TokenPair, *domain.User, error) {
+	pair, err := s.refresh(ctx, refreshToken)
+	return pair, nil, err
+}
+
+func (s *stubUseCase) Register(ctx context.Context, username, email, password string) (domain.RegisterResult, error) {
+	if s.register == nil {
+		return domain.RegisterResult{}, errors.New("not implemented")
+	}
+	return domain.RegisterResult{}, s.register(ctx, username, email, password)
+}
+
+func (s *stubUseCase) Login(ctx context.Context, email, password string, client domain.ClientInfo) (domain.TokenPair, *domain.User, error) {
+	if s.login == nil {
+		return domain.TokenPair{}, nil, errors.New("not implemented")
+	}
+	pair, err := s.login(ctx, email, password, client)
+	return pair, nil, err
+}
+
+func TestServer_Refresh(t *testing.T) {
+	t.Run("Given a slow usecase", func(t *testing.T) {
+		uc := &stubUseCase{refresh: func(ctx context.Context, _ string) (domain.TokenPair, error) {
+			<-ctx.Done()
+			return domain.TokenPair{}, ctx.Err()
+		}}
+		srv := NewServer(uc, WithHandlerTimeout(10*time.Millisecond))
+
+		_, err := srv.Refresh(context.Background(), &pb.RefreshRequest{RefreshToken: "token"})
+
+		assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	})
+
+	t.Run("Given an unexpected usecase error", func(t *testing.T) {
+		uc := &stubUseCase{refresh: func(context.Context, string) (domain.TokenPair, error) {
+			return domain.TokenPair{}, errors.New("boom")
+		}}
+		srv := NewServer(uc, WithHandlerTimeout(time.Second))
+
+		_, err := srv.Refresh(context.Background(), &pb.RefreshRequest{RefreshToken: "token"})
+
+		assert.Equal(t, codes.Internal, status.Code(err))
+	})
+
+	t.Run("Given an unknown refresh token", func(t *testing.T) {
+		uc := &stubUseCase{refresh: func(context.Context, string) (domain.TokenPair, error) {
+			return domain.TokenPair{}, domain.ErrRefreshTokenNotFound
+		}}
+		srv := NewServer(uc)
+
+		_, err := srv.Refresh(context.Background(), &pb.RefreshRequest{RefreshToken: "token"})
+
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("Given a valid refresh token", func(t *testing.T) {
+		uc := &stubUseCase{refresh: func(context.Context, string) (domain.TokenPair, error) {
+			return domain.TokenPair{AccessToken: "access", RefreshToken: "refresh"}, nil
+		}}
+		srv := NewServer(uc, WithHandlerTimeout(time.Second))
+
+		resp, err := srv.Refresh(context.Background(), &pb.RefreshRequest{RefreshToken: "token"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "access", resp.GetAccessToken())
+		assert.Equal(t, "refresh", resp.GetRefreshToken())
+	})
+}
+
+func TestServer_Refresh_ErrorCodes(t *testing.T) {
+	tests := []struct {
+		err  error
+		code codes.Code
+	}{
+		{domain.ErrRefreshTokenNotFound, codes.Unauthenticated},
+		{domain.ErrUserNotFound, codes.NotFound},
+		{fmt.Errorf("persist refresh token: %w", errors.New("connection reset")), codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			uc := &stubUseCase{refresh: func(context.Context, string) (domain.TokenPair, error) {
+				return domain.TokenPair{}, tt.err
+			}}
+			srv := NewServer(uc)
+
+			_, err := srv.Refresh(context.Background(), &pb.RefreshRequest{RefreshToken: "token"})
+
+			st := status.Convert(err)
+			assert.Equal(t, tt.code, st.Code())
+			assert.NotContains(t, st.Message(), "connection reset")
+			if assert.Len(t, st.Details(), 1) {
+				info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+				assert.True(t, ok)
+				assert.Equal(t, domain.ToAPIError(tt.err).Code, info.GetReason())
+			}
+		})
+	}
+}
+
+func TestServer_Register(t *testing.T) {
+	t.Run("Given an invalid request", func(t *testing.T) {
+		srv := NewServer(&stubUseCase{})
+
+		_, err := srv.Register(context.Background(), &pb.RegisterRequest{Email: "not-an-email"})
+
+		st := status.Convert(err)
+		assert.Equal(t, codes.InvalidArgument, st.Code())
+		if assert.Len(t, st.Details(), 1) {
+			info := st.Details()[0].(*errdetails.ErrorInfo)
+			assert.Equal(t, domain.CodeInvalidRequest, info.GetReason())
+			assert.Equal(t, map[string]string{"username": "required", "email": "email", "password": "required"}, info.GetMetadata())
+		}
+	})
+
+	t.Run("Given a valid request", func(t *testing.T) {
+		var gotEmail string
+		uc := &stubUseCase{register: func(_ context.Context, _, email, _ string) error {
+			gotEmail = email
+			return nil
+		}}
+		srv := NewServer(uc)
+
+		_, err := srv.Register(context.Background(), &pb.RegisterRequest{Username: "alice", Email: " alice@example.com ", Password: "secret123"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "alice@example.com", gotEmail)
+	})
+
+	t.Run("Given a taken email", func(t *testing.T) {
+		uc := &stubUseCase{register: func(context.Context, string, string, string) error {
+			return domain.ErrEmailExists
+		}}
+		srv := NewServer(uc)
+
+		_, err := srv.Register(context.Background(), &pb.RegisterRequest{Username: "alice", Email: "alice@example.com", Password: "secret123"})
+
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	})
+}
+
+func TestServer_Login(t *testing.T) {
+	t.Run("Given missing credentials", func(t *testing.T) {
+		srv := NewServer(&stubUseCase{})
+
+		_, err := srv.Login(context.Background(), &pb.LoginRequest{Email: "alice@example.com"})
+
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("Given valid credentials", func(t *testing.T) {
+		var gotClient domain.ClientInfo
+		uc := &stubUseCase{login: func(_ context.Context, _, _ string, client domain.ClientInfo) (domain.TokenPair, error) {
+			gotClient = client
+			return domain.TokenPair{AccessToken: "access", RefreshToken: "refresh"}, nil
+		}}
+		srv := NewServer(uc)
+
+		resp, err := srv.Login(context.Background(), &pb.LoginRequest{Email: "alice@example.com", Password: "secret123", DeviceName: "laptop"})
+
+		require.NoError(t, err)
+		assert.Equal(t, "access", resp.GetAccessToken())
+		assert.Equal(t, "refresh", resp.GetRefreshToken())
+		assert.Equal(t, "laptop", gotClient.DeviceName)
+	})
+
+	t.Run("Given wrong credentials", func(t *testing.T) {
+		uc := &stubUseCase{login: func(context.Context, string, string, domain.ClientInfo) (domain.TokenPair, error) {
+			return domain.TokenPair{}, domain.ErrInvalidCredentials
+		}}
+		srv := NewServer(uc)
+
+		_, err := srv.Login(context.Background(), &pb.LoginRequest{Email: "alice@example.com", Password: "wrong"})
+
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+}
+
+// startServer serves srv over an in-memory listener and returns a client.
+func startServer(t *testing.T, srv *Server) pb.AuthServiceClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	pb.RegisterAuthServiceServer(gs, srv)
+	go func() { _ = gs.Serve(lis) }()
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return pb.NewAuthServiceClient(conn)
+}
+
+func TestServer_VerifyTokenStream(t *testing.T) {
+	uc := &stubUseCase{verify: func(token string) (int64, bool, error) {
+		switch token {
+		case "expired":
+			return 0, false, domain.ErrTokenExpired
+		case "forged":
+			return 0, false, fmt.Errorf("%w: signature is invalid", domain.ErrInvalidToken)
+		case "in-grace":
+			return 4, true, nil
+		default:
+			var id int64
+			_, err := fmt.Sscanf(token, "user-%d", &id)
+			return id, false, err
+		}
+	}}
+	client := startServer(t, NewServer(uc))
+
+	t.Run("Given valid and invalid tokens", func(t *testing.T) {
+		stream, err := client.VerifyTokenStream(context.Background())
+		require.NoError(t, err)
+
+		tokens := []string{"user-1", "expired", "user-2", "forged", "user-3", "in-grace"}
+		for _, token := range tokens {
+			require.NoError(t, stream.Send(&pb.VerifyTokenRequest{Token: token}))
+		}
+		require.NoError(t, stream.CloseSend())
+
+		var got []*pb.VerifyTokenResponse
+		for {
+			resp, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+			got = append(got, resp)
+		}
+
+		want := []struct {
+			userID  int64
+			valid   bool
+			inGrace bool
+			code    string
+		}{
+			{1, true, false, ""},
+			{0, false, false, domain.CodeTokenExpired},
+			{2, true, false, ""},
+			{0, false, false, domain.CodeInvalidToken},
+			{3, true, false, ""},
+			{4, true, true, ""},
+		}
+		require.Len(t, got, len(want))
+		for i, w := range want {
+			assert.Equal(t, w.userID, got[i].GetUserId(), "token %d", i)
+			assert.Equal(t, w.valid, got[i].GetValid(), "token %d", i)
+			assert.Equal(t, w.inGrace, got[i].GetInGrace(), "token %d", i)
+			assert.Equal(t, w.code, got[i].GetErrorCode(), "token %d", i)
+		}
+	})
+
+	t.Run("Given the client cancels the stream", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream, err := client.VerifyTokenStream(ctx)
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(&pb.VerifyTokenRequest{Token: "user-1"}))
+		_, err = stream.Recv()
+		require.NoError(t, err)
+
+		cancel()
+
+		_, err = stream.Recv()
+		assert.Equal(t, codes.Canceled, status.Code(err))
+	})
+}
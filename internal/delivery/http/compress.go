@@ -0,0 +1,125 @@
+package http
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Gzip compresses responses for clients that accept gzip. The body is held
+// back until minSize bytes have been written, so responses smaller than that
+// go out uncompressed. Error responses and bodies that already carry a
+// Content-Encoding, such as the Prometheus handler's, are never compressed.
+//
+// gin-contrib/gzip is not used because it has no minimum size, so it would
+// drop GZIP_MIN_SIZE, and it ignores "gzip;q=0" in Accept-Encoding.
+func Gzip(level, minSize int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !acceptsGzip(c.Request) {
+			c.Next()
+			return
+		}
+
+		w := &gzipWriter{ResponseWriter: c.Writer, level: level, minSize: minSize}
+		c.Writer = w
+		c.Header("Vary", "Accept-Encoding")
+		defer w.close()
+		c.Next()
+	}
+}
+
+func acceptsGzip(r *http.Request) bool {
+	if strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade") {
+		return false
+	}
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipWriter buffers the start of a response until it knows whether the body
+// is large enough to compress.
+type gzipWriter struct {
+	gin.ResponseWriter
+	level   int
+	minSize int
+	buf     []byte
+	gz      *gzip.Writer
+	// passthrough is set once the response is known to go out as is.
+	passthrough bool
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	switch {
+	case w.gz != nil:
+		return w.gz.Write(b)
+	case w.passthrough:
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) < w.minSize {
+		return len(b), nil
+	}
+	if err := w.start(); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// start sends the buffered body, compressed if the response allows it.
+func (w *gzipWriter) start() error {
+	buf := w.buf
+	w.buf = nil
+	if w.Status() >= http.StatusBadRequest || w.Header().Get("Content-Encoding") != "" {
+		w.passthrough = true
+		_, err := w.ResponseWriter.Write(buf)
+		return err
+	}
+
+	gz, err := gzip.NewWriterLevel(w.ResponseWriter, w.level)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Del("Content-Length")
+	w.gz = gz
+	_, err = gz.Write(buf)
+	return err
+}
+
+// Flush sends a still-buffered body uncompressed: a flushing handler is
+// streaming and must not wait for minSize bytes.
+func (w *gzipWriter) Flush() {
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	} else if !w.passthrough {
+		w.passthrough = true
+		if len(w.buf) > 0 {
+			_, _ = w.ResponseWriter.Write(w.buf)
+			w.buf = nil
+		}
+	}
+	w.ResponseWriter.Flush()
+}
+
+// close finishes the response once the handler returns.
+func (w *gzipWriter) close() {
+	if w.gz != nil {
+		_ = w.gz.Close()
+		return
+	}
+	if len(w.buf) > 0 {
+		_, _ = w.ResponseWriter.Write(w.buf)
+	}
+}
@@ -0,0 +1,72 @@
+package http
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGzip(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	large := strings.Repeat("a", 2048)
+
+	router := gin.New()
+	router.Use(Gzip(gzip.DefaultCompression, 1024))
+	router.GET("/large", func(c *gin.Context) { c.String(http.StatusOK, large) })
+	router.GET("/small", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	router.GET("/error", func(c *gin.Context) { c.String(http.StatusBadRequest, large) })
+
+	send := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Given a large response and a client accepting gzip", func(t *testing.T) {
+		rr := send("/large", "br, gzip")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", rr.Header().Get("Vary"))
+		zr, err := gzip.NewReader(rr.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		assert.Equal(t, large, string(body))
+	})
+
+	t.Run("Given a small response", func(t *testing.T) {
+		rr := send("/small", "gzip")
+
+		assert.Empty(t, rr.Header().Get("Content-Encoding"))
+		assert.Equal(t, "ok", rr.Body.String())
+	})
+
+	t.Run("Given a client not accepting gzip", func(t *testing.T) {
+		for _, enc := range []string{"", "br", "gzip;q=0"} {
+			rr := send("/large", enc)
+
+			assert.Empty(t, rr.Header().Get("Content-Encoding"), enc)
+			assert.Equal(t, large, rr.Body.String(), enc)
+		}
+	})
+
+	t.Run("Given an error response", func(t *testing.T) {
+		rr := send("/error", "gzip")
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Empty(t, rr.Header().Get("Content-Encoding"))
+		assert.Equal(t, large, rr.Body.String())
+	})
+}
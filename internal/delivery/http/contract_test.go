@@ -0,0 +1,270 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/Kovalyovv/auth-service/internal/pkg/jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/contract")
+
+// contractResponse is what a golden file records for one request.
+type contractResponse struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body"`
+}
+
+// TestContract pins the JSON responses of the public endpoints to the golden
+// files in testdata/contract. A failure means a response changed shape;
+// if the change is intended, rerun with -update and review the diff.
+func TestContract(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	user := &domain.User{ID: 7, Username: "alice", Email: "alice@example.com", Role: domain.RoleUser}
+	pair := domain.TokenPair{AccessToken: "access", RefreshToken: "refresh"}
+
+	tests := []struct {
+		name   string
+		opts   []HandlerOption
+		method string
+		path   string
+		body   string
+		role   string
+		setup  func(m *MockAuthUseCase)
+	}{
+		{
+			name: "login", method: http.MethodPost, path: "/auth/login",
+			body: `{"email":"alice@example.com","password":"password123"}`,
+			setup: func(m *MockAuthUseCase) {
+				m.On("Login", mock.Anything, "alice@example.com", "password123", mock.Anything).Return(pair, user, nil)
+			},
+		},
+		{
+			name: "login_with_profile", opts: []HandlerOption{WithProfileInResponse(true)},
+			method: http.MethodPost, path: "/auth/login",
+			body: `{"email":"alice@example.com","password":"password123"}`,
+			setup: func(m *MockAuthUseCase) {
+				m.On("Login", mock.Anything, "alice@example.com", "password123", mock.Anything).Return(pair, user, nil)
+			},
+		},
+		{
+			name: "login_invalid_credentials", method: http.MethodPost, path: "/auth/login",
+			body: `{"email":"alice@example.com","password":"wrong"}`,
+			setup: func(m *MockAuthUseCase) {
+				m.On("Login", mock.Anything, "alice@example.com", "wrong", mock.Anything).Return(domain.TokenPair{}, nil, domain.ErrInvalidCredentials)
+			},
+		},
+		{
+			name: "login_too_many_attempts", method: http.MethodPost, path: "/auth/login",
+			body: `{"email":"alice@example.com","password":"password123"}`,
+			setup: func(m *MockAuthUseCase) {
+				m.On("Login", mock.Anything, "alice@example.com", "password123", mock.Anything).
+					Return(domain.TokenPair{}, nil, &domain.TooManyAttemptsError{RetryAfter: 30 * time.Second})
+			},
+		},
+		{
+			name: "login_invalid_body", method: http.MethodPost, path: "/auth/login",
+			body: `{"email":"alice@example.com"}`,
+		},
+		{
+			name: "refresh", method: http.MethodPost, path: "/auth/refresh",
+			body: `{"refresh_token":"refresh"}`,
+			setup: func(m *MockAuthUseCase) {
+				m.On("Refresh", mock.Anything, "refresh", mock.Anything).Return(pair, user, nil)
+			},
+		},
+		{
+			name: "refresh_invalid_token", method: http.MethodPost, path: "/auth/refresh",
+			body: `{"refresh_token":"stale"}`,
+			setup: func(m *MockAuthUseCase) {
+				m.On("Refresh", mock.Anything, "stale", mock.Anything).Return(domain.TokenPair{}, nil, domain.ErrInvalidToken)
+			},
+		},
+		{
+			name: "register", method: http.MethodPost, path: "/auth/register",
+			body: `{"username":"alice","email":"alice@example.com","password":"password123"}`,
+			setup: func(m *MockAuthUseCase) {
+				m.On("Register", mock.Anything, "alice", "alice@example.com", "password123").Return(domain.RegisterResult{}, nil)
+			},
+		},
+		{
+			name: "register_dry_run", method: http.MethodPost, path: "/auth/register?dry_run=true",
+			body: `{"username":"alice","email":"alice@example.com","password":"password123"}`,
+			setup: func(m *MockAuthUseCase) {
+				m.On("ValidateRegistration", mock.Anything, "alice", "alice@example.com", "password123").Return(nil)
+			},
+		},
+		{
+			name: "register_email_taken", method: http.MethodPost, path: "/auth/register",
+			body: `{"username":"alice","email":"alice@example.com","password":"password123"}`,
+			setup: func(m *MockAuthUseCase) {
+				m.On("Register", mock.Anything, "alice", "alice@example.com", "password123").Return(domain.RegisterResult{}, domain.ErrEmailExists)
+			},
+		},
+		{
+			name: "register_invalid_body", method: http.MethodPost, path: "/auth/register",
+			body: `{"username":"alice","email":"not-an-email","password":"short"}`,
+		},
+		{
+			name: "session_expiry", method: http.MethodGet, path: "/auth/session-expiry",
+			body: `{"refresh_token":"refresh"}`,
+			setup: func(m *MockAuthUseCase) {
+				m.On("SessionExpiry", mock.Anything, "refresh").Return(at, nil)
+			},
+		},
+		{
+			name: "step_up", method: http.MethodPost, path: "/auth/step-up", role: domain.RoleUser,
+			body: `{"password":"password123"}`,
+			setup: func(m *MockAuthUseCase) {
+				m.On("StepUp", mock.Anything, int64(7), "password123").Return("step-up", nil)
+			},
+		},
+		{
+			name: "verify_password", method: http.MethodPost, path: "/auth/verify-password", role: domain.RoleUser,
+			body: `{"password":"password123"}`,
+			setup: func(m *MockAuthUseCase) {
+				m.On("VerifyPassword", mock.Anything, int64(7), "password123").Return(true, nil)
+			},
+		},
+		{
+			name: "sessions", method: http.MethodGet, path: "/auth/sessions", role: domain.RoleUser,
+			setup: func(m *MockAuthUseCase) {
+				lastUsed := at.Add(time.Hour)
+				m.On("ListSessions", mock.Anything, int64(7)).Return([]domain.Session{{
+					ID: 1, UserID: 7, DeviceName: "laptop", CreatedAt: at, ExpiresAt: at.Add(72 * time.Hour),
+					UserAgent: "curl/8.0", IP: "192.0.2.1", LastUsedAt: &lastUsed, LastUsedIP: "192.0.2.1",
+				}}, nil)
+			},
+		},
+		{
+			name: "sessions_unauthenticated", method: http.MethodGet, path: "/auth/sessions",
+		},
+		{
+			name: "logout", method: http.MethodPost, path: "/auth/logout", role: domain.RoleUser,
+			setup: func(m *MockAuthUseCase) {
+				m.On("Logout", mock.Anything, int64(7), int64(0), "").Return(nil)
+			},
+		},
+		{
+			name: "update_role_forbidden", method: http.MethodPut, path: "/auth/users/8/role", role: domain.RoleUser,
+			body: `{"role":"admin"}`,
+		},
+		{
+			name: "audit_events", method: http.MethodGet, path: "/auth/audit-events", role: domain.RoleAdmin,
+			setup: func(m *MockAuthUseCase) {
+				m.On("ListAuthEvents", mock.Anything, mock.Anything).Return([]domain.AuthEvent{{
+					ID: 1, UserID: 7, Email: "alice@example.com", Type: domain.EventUserLogin, Success: true, CreatedAt: at,
+				}}, nil)
+			},
+		},
+		{
+			name: "dormant_users", method: http.MethodGet, path: "/auth/users/dormant?days=90", role: domain.RoleAdmin,
+			setup: func(m *MockAuthUseCase) {
+				m.On("ListDormantUsers", mock.Anything, 90*24*time.Hour).Return([]domain.User{{
+					ID: 7, Username: "alice", Email: "alice@example.com", CreatedAt: at,
+				}}, nil)
+			},
+		},
+		{
+			name: "deactivate_dormant_users", method: http.MethodPost, path: "/auth/users/dormant/deactivate?days=90", role: domain.RoleAdmin,
+			setup: func(m *MockAuthUseCase) {
+				m.On("DeactivateDormantUsers", mock.Anything, 90*24*time.Hour).Return(3, nil)
+			},
+		},
+		{
+			name: "import_users", method: http.MethodPost, path: "/auth/users/import", role: domain.RoleAdmin,
+			body: `{"users":[{"username":"bob","email":"bob@example.com","password_hash":"hash"}]}`,
+			setup: func(m *MockAuthUseCase) {
+				m.On("ImportUsers", mock.Anything, mock.Anything).Return(domain.ImportResult{
+					Imported: 0,
+					Failed:   []domain.ImportFailure{{Index: 0, Email: "bob@example.com", Code: domain.CodeInvalidRequest, Message: "unsupported password hash"}},
+				}, nil)
+			},
+		},
+		{
+			name: "user_by_email", method: http.MethodGet, path: "/auth/users/by-email?email=alice@example.com", role: domain.RoleAdmin,
+			setup: func(m *MockAuthUseCase) {
+				m.On("GetUserByEmail", mock.Anything, "alice@example.com").Return(&domain.User{
+					ID: 7, Username: "alice", Email: "alice@example.com", Role: domain.RoleUser, CreatedAt: at, LastLoginAt: at.Add(time.Hour),
+				}, nil)
+			},
+		},
+		{
+			name: "user_by_email_not_found", method: http.MethodGet, path: "/auth/users/by-email?email=nobody@example.com", role: domain.RoleAdmin,
+			setup: func(m *MockAuthUseCase) {
+				m.On("GetUserByEmail", mock.Anything, "nobody@example.com").Return(nil, domain.ErrUserNotFound)
+			},
+		},
+		{
+			name: "users_count", method: http.MethodGet, path: "/auth/users/count", role: domain.RoleAdmin,
+			setup: func(m *MockAuthUseCase) {
+				m.On("CountUsers", mock.Anything).Return(int64(42), nil)
+			},
+		},
+		{
+			name: "cleanup_status_disabled", method: http.MethodGet, path: "/auth/cleanup-status", role: domain.RoleAdmin,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUC := new(MockAuthUseCase)
+			if tt.role != "" {
+				mockUC.On("Authenticate", mock.Anything, "token").Return(&jwt.Claims{UserID: 7, Role: tt.role}, nil)
+			}
+			if tt.setup != nil {
+				tt.setup(mockUC)
+			}
+			router := gin.New()
+			SetupRoutes(router, NewAuthHandler(mockUC, tt.opts...))
+
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.role != "" {
+				req.Header.Set("Authorization", "Bearer token")
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assertGolden(t, tt.name, rr)
+			mockUC.AssertExpectations(t)
+		})
+	}
+}
+
+// assertGolden compares the recorded response with testdata/contract/name.json,
+// or rewrites that file under -update.
+func assertGolden(t *testing.T, name string, rr *httptest.ResponseRecorder) {
+	t.Helper()
+	got := contractResponse{Status: rr.Code, Body: json.RawMessage("null")}
+	if rr.Body.Len() > 0 {
+		require.True(t, json.Valid(rr.Body.Bytes()), "response body is not JSON: %s", rr.Body.String())
+		got.Body = rr.Body.Bytes()
+	}
+	encoded, err := json.MarshalIndent(got, "", "  ")
+	require.NoError(t, err)
+	encoded = append(encoded, '\n')
+
+	path := filepath.Join("testdata", "contract", name+".json")
+	if *update {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, encoded, 0o644))
+		return
+	}
+	want, err := os.ReadFile(path)
+	require.NoError(t, err, "missing golden file; run go test -run TestContract -update")
+	assert.JSONEq(t, string(want), string(encoded))
+}
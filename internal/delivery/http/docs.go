@@ -0,0 +1,45 @@
+package http
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openAPISpec is the contract of the public HTTP endpoints. It is maintained
+// by hand; update it together with the request and response types.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+  <title>auth-service API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>`
+
+// docsCSP replaces a Content-Security-Policy set by Secure on the docs page,
+// which loads Swagger UI from unpkg and runs an inline script.
+const docsCSP = "default-src 'none'; script-src https://unpkg.com 'unsafe-inline'; " +
+	"style-src https://unpkg.com; img-src 'self' data:; connect-src 'self'; frame-ancestors 'none'"
+
+// OpenAPISpec serves the OpenAPI document.
+func OpenAPISpec(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", openAPISpec)
+}
+
+// Docs serves a Swagger UI page rendering OpenAPISpec.
+func Docs(c *gin.Context) {
+	if c.Writer.Header().Get("Content-Security-Policy") != "" {
+		c.Header("Content-Security-Policy", docsCSP)
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(docsPage))
+}
@@ -0,0 +1,140 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/Kovalyovv/auth-service/pkg/pb"
+	"github.com/gin-gonic/gin"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// WithGateway serves /auth/register, /auth/login, /auth/refresh and
+// /auth/verify through gw, built by NewGateway, instead of the hand-written
+// handlers, so both transports share one implementation. Registration dry
+// runs stay on the hand-written handler.
+func WithGateway(gw http.Handler) HandlerOption {
+	return func(h *AuthHandler) {
+		h.gateway = gw
+	}
+}
+
+// NewGateway returns the REST reverse proxy for srv. Field names and error
+// bodies match the hand-written handlers, so existing clients see no
+// difference beyond the response fields the RPCs define. strictJSON rejects
+// unknown request fields, like WithStrictJSON.
+func NewGateway(srv pb.AuthServiceServer, acceptRegister, strictJSON bool) (http.Handler, error) {
+	registerStatus := http.StatusCreated
+	if acceptRegister {
+		registerStatus = http.StatusAccepted
+	}
+
+	mux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+			MarshalOptions:   protojson.MarshalOptions{UseProtoNames: true},
+			UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: !strictJSON},
+		}),
+		runtime.WithErrorHandler(gatewayError),
+		runtime.WithOutgoingHeaderMatcher(gatewayHeader),
+		runtime.WithForwardResponseOption(func(_ context.Context, w http.ResponseWriter, m proto.Message) error {
+			if _, ok := m.(*pb.RegisterResponse); ok {
+				w.WriteHeader(registerStatus)
+			}
+			return nil
+		}),
+	)
+	if err := pb.RegisterAuthServiceHandlerServer(context.Background(), mux, srv); err != nil {
+		return nil, err
+	}
+	return mux, nil
+}
+
+// gatewayHeader passes the refresh headers through under their HTTP names
+// and prefixes other header metadata as the gateway does by default.
+func gatewayHeader(key string) (string, bool) {
+	switch h := http.CanonicalHeaderKey(key); h {
+	case RefreshTokenConsumedHeader, RefreshExpiresAtHeader:
+		return h, true
+	}
+	return runtime.MetadataHeaderPrefix + key, true
+}
+
+// gatewayError renders a gRPC status in the apiError format. The code comes
+// from the status' ErrorInfo; statuses without one were raised by the
+// gateway itself, typically for a body it could not decode.
+func gatewayError(_ context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	st := status.Convert(err)
+	apiErr := &domain.APIError{Code: domain.CodeInternal, Message: "internal server error"}
+	if st.Code() == codes.InvalidArgument {
+		apiErr = &domain.APIError{Code: domain.CodeInvalidRequest, Message: "invalid request body"}
+		if field, ok := unknownField(st.Message()); ok {
+			apiErr.Details = map[string]string{field: "unknown"}
+		}
+	}
+	var retryAfter int
+	for _, d := range st.Details() {
+		switch d := d.(type) {
+		case *errdetails.ErrorInfo:
+			apiErr = &domain.APIError{Code: d.GetReason(), Message: st.Message(), Details: d.GetMetadata()}
+		case *errdetails.RetryInfo:
+			retryAfter = int(d.GetRetryDelay().AsDuration().Seconds())
+		}
+	}
+	apiErr.RetryAfter = retryAfter
+	resp := newAPIError(apiErr)
+	if apiErr.Code == domain.CodeInternal {
+		resp.ErrorID = newErrorID()
+		slog.Error("gateway error", "path", r.URL.Path, "error_id", resp.ErrorID, "error", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if apiErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(apiErr.RetryAfter))
+	}
+	w.WriteHeader(httpStatus(apiErr.Code))
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// viaGateway serves the route through the gateway when one is configured
+// and through fallback otherwise.
+func (h *AuthHandler) viaGateway(fallback gin.HandlerFunc) gin.HandlerFunc {
+	if h.gateway == nil {
+		return fallback
+	}
+	return gin.WrapH(h.gateway)
+}
+
+// loginRoute is Login behind viaGateway. The RPC always issues a refresh
+// token, so access-only logins always reach the hand-written handler.
+func (h *AuthHandler) loginRoute() gin.HandlerFunc {
+	login := h.viaGateway(h.Login)
+	return func(c *gin.Context) {
+		if noRefresh(c) {
+			h.Login(c)
+			return
+		}
+		login(c)
+	}
+}
+
+// registerRoute is Register behind viaGateway. Dry runs have no RPC, so they
+// always reach the hand-written handler.
+func (h *AuthHandler) registerRoute() gin.HandlerFunc {
+	register := h.viaGateway(h.Register)
+	return func(c *gin.Context) {
+		if c.Query("dry_run") == "true" {
+			h.Register(c)
+			return
+		}
+		register(c)
+	}
+}
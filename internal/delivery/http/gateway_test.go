@@ -0,0 +1,166 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/Kovalyovv/auth-service/pkg/pb"
+	"github.com/gin-gonic/gin"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// stubAuthServer records the requests the gateway forwards to it.
+type stubAuthServer struct {
+	pb.UnimplementedAuthServiceServer
+	login    *pb.LoginRequest
+	register *pb.RegisterRequest
+}
+
+func (s *stubAuthServer) Login(_ context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
+	s.login = req
+	if req.GetPassword() != "secret123" {
+		st, _ := status.New(codes.Unauthenticated, domain.ErrInvalidCredentials.Error()).
+			WithDetails(&errdetails.ErrorInfo{Reason: domain.CodeInvalidCredentials})
+		return nil, st.Err()
+	}
+	return &pb.LoginResponse{AccessToken: "access", RefreshToken: "refresh"}, nil
+}
+
+func (s *stubAuthServer) Refresh(ctx context.Context, _ *pb.RefreshRequest) (*pb.RefreshResponse, error) {
+	_ = grpc.SetHeader(ctx, metadata.Pairs(
+		"x-refresh-token-consumed", "true",
+		"x-refresh-expires-at", "2030-01-08T11:00:00Z",
+		"x-request-id", "req-1",
+	))
+	return &pb.RefreshResponse{AccessToken: "access", RefreshToken: "refresh"}, nil
+}
+
+func (s *stubAuthServer) Register(_ context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
+	s.register = req
+	return &pb.RegisterResponse{}, nil
+}
+
+func newGatewayRouter(t *testing.T, srv pb.AuthServiceServer, mockUC *MockAuthUseCase) *gin.Engine {
+	t.Helper()
+	gw, err := NewGateway(srv, false, false)
+	require.NoError(t, err)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	SetupRoutes(router, NewAuthHandler(mockUC, WithGateway(gw)))
+	return router
+}
+
+func TestGateway(t *testing.T) {
+	t.Run("Given a login through REST", func(t *testing.T) {
+		srv := &stubAuthServer{}
+		router := newGatewayRouter(t, srv, new(MockAuthUseCase))
+
+		body := `{"email":"alice@example.com","password":"secret123","device_name":"laptop"}`
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"access_token":"access","refresh_token":"refresh"}`, w.Body.String())
+		require.NotNil(t, srv.login)
+		assert.Equal(t, "alice@example.com", srv.login.GetEmail())
+		assert.Equal(t, "laptop", srv.login.GetDeviceName())
+	})
+
+	t.Run("Given the RPC fails", func(t *testing.T) {
+		router := newGatewayRouter(t, &stubAuthServer{}, new(MockAuthUseCase))
+
+		body := `{"email":"alice@example.com","password":"wrong"}`
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		var resp apiError
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, domain.CodeInvalidCredentials, resp.Code)
+		assert.Equal(t, domain.ErrInvalidCredentials.Error(), resp.Error)
+	})
+
+	t.Run("Given a malformed body", func(t *testing.T) {
+		router := newGatewayRouter(t, &stubAuthServer{}, new(MockAuthUseCase))
+
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewBufferString(`{"email":`))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"`+domain.CodeInvalidRequest+`"`)
+	})
+
+	t.Run("Given an unknown field and strict decoding", func(t *testing.T) {
+		gw, err := NewGateway(&stubAuthServer{}, false, true)
+		require.NoError(t, err)
+
+		body := `{"email":"alice@example.com","passwrod":"secret123"}`
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		gw.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"error":"invalid request body","code":"invalid_request","details":{"passwrod":"unknown"}}`, w.Body.String())
+	})
+
+	t.Run("Given a registration", func(t *testing.T) {
+		srv := &stubAuthServer{}
+		router := newGatewayRouter(t, srv, new(MockAuthUseCase))
+
+		body := `{"username":"alice","email":"alice@example.com","password":"secret123"}`
+		req := httptest.NewRequest(http.MethodPost, "/auth/register", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		require.NotNil(t, srv.register)
+		assert.Equal(t, "alice", srv.register.GetUsername())
+	})
+
+	t.Run("Given a registration dry run", func(t *testing.T) {
+		srv := &stubAuthServer{}
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("ValidateRegistration", mock.Anything, "alice", "alice@example.com", "secret123").Return(nil)
+		router := newGatewayRouter(t, srv, mockUC)
+
+		body := `{"username":"alice","email":"alice@example.com","password":"secret123"}`
+		req := httptest.NewRequest(http.MethodPost, "/auth/register?dry_run=true", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Nil(t, srv.register)
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given a refresh", func(t *testing.T) {
+		router := newGatewayRouter(t, &stubAuthServer{}, new(MockAuthUseCase))
+
+		req := httptest.NewRequest(http.MethodPost, "/auth/refresh", bytes.NewBufferString(`{"refresh_token":"token"}`))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "true", w.Header().Get(RefreshTokenConsumedHeader))
+		assert.Equal(t, "2030-01-08T11:00:00Z", w.Header().Get(RefreshExpiresAtHeader))
+		assert.Equal(t, "req-1", w.Header().Get(runtime.MetadataHeaderPrefix+"x-request-id"))
+	})
+}
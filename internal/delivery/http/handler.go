@@ -2,104 +2,1191 @@ package http
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Kovalyovv/auth-service/internal/domain"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
 	"log/slog"
 )
 
 type AuthUseCase interface {
-	Register(ctx context.Context, username, email, password string) error
-	Login(ctx context.Context, email, password string) (domain.TokenPair, error)
-	Refresh(ctx context.Context, refreshToken string) (domain.TokenPair, error)
+	TokenAuthenticator
+	Register(ctx context.Context, username, email, password string) (domain.RegisterResult, error)
+	ValidateRegistration(ctx context.Context, username, email, password string) error
+	Login(ctx context.Context, identifier, password string, client domain.ClientInfo) (domain.TokenPair, *domain.User, error)
+	LoginAccessOnly(ctx context.Context, identifier, password string, client domain.ClientInfo) (domain.TokenPair, *domain.User, error)
+	Refresh(ctx context.Context, refreshToken string, client domain.ClientInfo) (domain.TokenPair, *domain.User, error)
+	SessionExpiry(ctx context.Context, refreshToken string) (time.Time, error)
+	ResendVerification(ctx context.Context, email string) error
+	VerifyEmail(ctx context.Context, token string) error
+	UpdateRole(ctx context.Context, userID int64, role string) error
+	StepUp(ctx context.Context, userID int64, password string) (string, error)
+	IssueResourceToken(ctx context.Context, userID int64, audience string) (string, error)
+	VerifyPassword(ctx context.Context, userID int64, password string) (bool, error)
+	ChangePassword(ctx context.Context, userID int64, newPassword string) error
+	ListSessions(ctx context.Context, userID int64) ([]domain.Session, error)
+	Logout(ctx context.Context, userID, sessionID int64, refreshToken string) error
+	RevokeSession(ctx context.Context, userID, sessionID int64) error
+	ExportUserData(ctx context.Context, userID int64) (domain.UserExport, error)
+	DeleteAccount(ctx context.Context, userID int64) error
+	ListAuthEvents(ctx context.Context, f domain.AuthEventFilter) ([]domain.AuthEvent, error)
+	ListDormantUsers(ctx context.Context, inactiveFor time.Duration) ([]domain.User, error)
+	DeactivateDormantUsers(ctx context.Context, inactiveFor time.Duration) (int64, error)
+	ImportUsers(ctx context.Context, users []domain.User) (domain.ImportResult, error)
+	GetUserByEmail(ctx context.Context, email string) (*domain.User, error)
+	CountUsers(ctx context.Context) (int64, error)
+	RotateSigningKey(ctx context.Context, secret string) error
+}
+
+type CleanupStatusProvider interface {
+	Status() domain.CleanupStatus
 }
 
 type AuthHandler struct {
-	uc AuthUseCase
+	uc             AuthUseCase
+	cleanup        CleanupStatusProvider
+	includeProfile bool
+	idempotency    *idempotencyStore
+	acceptRegister bool
+	queryToken     bool
+	gateway        http.Handler
+	strictJSON     bool
+	rejectAuthed   bool
+	lookupLimiter  *rateLimiter
+	headers        SecurityHeaders
+	separateAdmin  bool
+	refreshCookie  *refreshCookieConfig
+	maskEmails     bool
+	superAdmins    map[int64]bool
+}
+
+// HandlerOption configures optional AuthHandler dependencies.
+type HandlerOption func(*AuthHandler)
+
+// WithCleanupStatus exposes the token cleanup worker's status.
+func WithCleanupStatus(p CleanupStatusProvider) HandlerOption {
+	return func(h *AuthHandler) {
+		h.cleanup = p
+	}
+}
+
+// WithProfileInResponse adds the user's profile to login and refresh
+// responses so clients need not fetch it separately.
+func WithProfileInResponse(enabled bool) HandlerOption {
+	return func(h *AuthHandler) {
+		h.includeProfile = enabled
+	}
+}
+
+// WithIdempotency makes /auth/register honour the Idempotency-Key header,
+// replaying the first response to a key for ttl. Zero disables it.
+func WithIdempotency(ttl time.Duration) HandlerOption {
+	return func(h *AuthHandler) {
+		if ttl > 0 {
+			h.idempotency = newIdempotencyStore(ttl)
+		}
+	}
+}
+
+// WithAcceptedRegistration answers every successful registration with 202
+// Accepted instead of 201 Created. It pairs with the use case's
+// enumeration-safe registration, where success no longer means a new
+// account was created.
+func WithAcceptedRegistration(enabled bool) HandlerOption {
+	return func(h *AuthHandler) {
+		h.acceptRegister = enabled
+	}
+}
+
+// WithQueryTokenAuth lets authenticated routes take the access token from
+// the access_token query parameter when no Authorization header is sent, for
+// EventSource and WebSocket clients.
+func WithQueryTokenAuth(enabled bool) HandlerOption {
+	return func(h *AuthHandler) {
+		h.queryToken = enabled
+	}
+}
+
+// WithStrictJSON makes register, login and refresh reject bodies with fields
+// they do not define, such as a misspelt "passwrod", instead of ignoring
+// them. The 400 response names the unexpected field.
+func WithStrictJSON(enabled bool) HandlerOption {
+	return func(h *AuthHandler) {
+		h.strictJSON = enabled
+	}
+}
+
+// WithRejectAuthenticated makes register and login answer 409
+// already_authenticated to requests carrying a valid bearer access token.
+// Invalid and expired tokens are ignored, so a client whose session ran out
+// can still log in.
+func WithRejectAuthenticated(enabled bool) HandlerOption {
+	return func(h *AuthHandler) {
+		h.rejectAuthed = enabled
+	}
+}
+
+// Default limit on user lookups per admin, unless WithUserLookupLimit says
+// otherwise.
+const (
+	DefaultUserLookupLimit  = 30
+	DefaultUserLookupWindow = time.Minute
+)
+
+// WithUserLookupLimit caps how many user lookups by email each admin may make
+// per window. A zero limit or window disables the cap.
+func WithUserLookupLimit(limit int, window time.Duration) HandlerOption {
+	return func(h *AuthHandler) {
+		h.lookupLimiter = newRateLimiter(limit, window)
+	}
+}
+
+// WithSecurityHeaders replaces DefaultSecurityHeaders as the headers set on
+// every response.
+func WithSecurityHeaders(headers SecurityHeaders) HandlerOption {
+	return func(h *AuthHandler) {
+		h.headers = headers
+	}
+}
+
+// WithSeparateAdminRoutes leaves the admin API out of SetupRoutes, for
+// deployments that serve it through SetupAdminRoutes on an admin port.
+func WithSeparateAdminRoutes(enabled bool) HandlerOption {
+	return func(h *AuthHandler) {
+		h.separateAdmin = enabled
+	}
+}
+
+// WithEmailMasking masks the emails of other users in admin listings, see
+// MaskEmail, except for the superAdmins, who see them in full.
+func WithEmailMasking(enabled bool, superAdmins ...int64) HandlerOption {
+	return func(h *AuthHandler) {
+		h.maskEmails = enabled
+		h.superAdmins = make(map[int64]bool, len(superAdmins))
+		for _, id := range superAdmins {
+			h.superAdmins[id] = true
+		}
+	}
+}
+
+// WithRefreshTokenCookie lets web clients, which name themselves through
+// ClientTypeHeader or the client_type field, keep their refresh token in an
+// HttpOnly cookie: login and refresh set it for maxAge instead of returning
+// the token in the body, and refresh reads it when the body has none. Other
+// clients get both tokens in the body as before. secure restricts the cookie
+// to https.
+func WithRefreshTokenCookie(maxAge time.Duration, secure bool) HandlerOption {
+	return func(h *AuthHandler) {
+		h.refreshCookie = &refreshCookieConfig{maxAge: maxAge, secure: secure}
+	}
 }
 
-func NewAuthHandler(uc AuthUseCase) *AuthHandler {
-	return &AuthHandler{uc: uc}
+func NewAuthHandler(uc AuthUseCase, opts ...HandlerOption) *AuthHandler {
+	h := &AuthHandler{
+		uc:            uc,
+		lookupLimiter: newRateLimiter(DefaultUserLookupLimit, DefaultUserLookupWindow),
+		headers:       DefaultSecurityHeaders,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// emailAddress is an email field of a request body. Surrounding whitespace,
+// often pasted along with the address, is dropped before validation.
+type emailAddress string
+
+func (e *emailAddress) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*e = emailAddress(strings.TrimSpace(s))
+	return nil
 }
 
 type registerReq struct {
-	Username string `json:"username" binding:"required"`
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Username string       `json:"username" binding:"required"`
+	Email    emailAddress `json:"email" binding:"required,email"`
+	Password string       `json:"password" binding:"required"`
+}
+
+type validationResp struct {
+	Valid bool `json:"valid"`
 }
 
 type loginReq struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required"`
+	// Identifier is the email or, with username login enabled, the
+	// username. Clients may send Email instead.
+	Identifier string       `json:"identifier" binding:"required_without=Email"`
+	Email      emailAddress `json:"email" binding:"required_without=Identifier,omitempty,email"`
+	Password   string       `json:"password" binding:"required"`
+	// DeviceName labels the session in the session list. Names longer than
+	// domain.MaxDeviceNameLength are truncated.
+	DeviceName string `json:"device_name"`
+	ClientType string `json:"client_type"`
 }
 
 type refreshReq struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
+	// AccessToken, if sent, must belong to the same user as RefreshToken.
+	// It may have expired.
+	AccessToken string `json:"access_token"`
+	ClientType  string `json:"client_type"`
+}
+
+// refreshTokenCookie is the cookie a browser client may carry its refresh
+// token in instead of the request body.
+const refreshTokenCookie = "refresh_token"
+
+// ClientTypeHeader tells login and refresh how the client wants its tokens
+// delivered; the client_type body field takes precedence over it. See
+// WithRefreshTokenCookie.
+const ClientTypeHeader = "X-Client-Type"
+
+// ClientTypeWeb is the client type that gets its refresh token as a cookie.
+const ClientTypeWeb = "web"
+
+// RefreshAuthScheme is the Authorization scheme, as in "Refresh <token>",
+// under which Refresh accepts a refresh token instead of the body field.
+const RefreshAuthScheme = "Refresh"
+
+// Headers of a successful refresh, for clients debugging rotation. They
+// carry metadata only, never a token: whether the presented refresh token
+// was consumed, "true" or "false", and when the current one expires, in
+// RFC 3339.
+const (
+	RefreshTokenConsumedHeader = "X-Refresh-Token-Consumed"
+	RefreshExpiresAtHeader     = "X-Refresh-Expires-At"
+)
+
+type refreshCookieConfig struct {
+	maxAge time.Duration
+	secure bool
+}
+
+// cookieClient reports whether the refresh token of this request travels in
+// refreshTokenCookie, given the client_type field of its body.
+func (h *AuthHandler) cookieClient(c *gin.Context, clientType string) bool {
+	if h.refreshCookie == nil {
+		return false
+	}
+	if clientType == "" {
+		clientType = c.GetHeader(ClientTypeHeader)
+	}
+	return clientType == ClientTypeWeb
+}
+
+// respondTokens answers login and refresh. Cookie clients get the refresh
+// token in an HttpOnly cookie scoped to /auth, and only the access token in
+// the body.
+func (h *AuthHandler) respondTokens(c *gin.Context, cookie bool, pair domain.TokenPair, user *domain.User) {
+	if cookie {
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:     refreshTokenCookie,
+			Value:    pair.RefreshToken,
+			Path:     "/auth",
+			MaxAge:   int(h.refreshCookie.maxAge / time.Second),
+			Secure:   h.refreshCookie.secure,
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+		pair.RefreshToken = ""
+	}
+	c.JSON(http.StatusOK, h.tokenResponse(pair, user))
+}
+
+type sessionExpiryReq struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type sessionExpiryResp struct {
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// tokenResp is the body of login and refresh responses.
+type tokenResp struct {
+	domain.TokenPair
+	User *userProfile `json:"user,omitempty"`
+}
+
+type userProfile struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+}
+
+func (h *AuthHandler) tokenResponse(pair domain.TokenPair, user *domain.User) tokenResp {
+	resp := tokenResp{TokenPair: pair}
+	if h.includeProfile && user != nil {
+		resp.User = &userProfile{
+			ID:       user.ID,
+			Username: user.Username,
+			Email:    user.Email,
+			Role:     user.Role,
+		}
+	}
+	return resp
+}
+
+type stepUpReq struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type resourceTokenReq struct {
+	Audience string `json:"audience" binding:"required"`
+}
+
+type resourceTokenResp struct {
+	AccessToken string `json:"access_token"`
+	Audience    string `json:"audience"`
+}
+
+type verifyPasswordReq struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type stepUpResp struct {
+	StepUpToken string `json:"step_up_token"`
+}
+
+type sessionsResp struct {
+	Sessions []domain.Session `json:"sessions"`
+}
+
+type resendVerificationReq struct {
+	Email emailAddress `json:"email" binding:"required,email"`
+}
+
+type verifyEmailReq struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type logoutReq struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type changePasswordReq struct {
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type authEventsResp struct {
+	Events []domain.AuthEvent `json:"events"`
+	Limit  int                `json:"limit"`
+	Offset int                `json:"offset"`
+}
+
+type dormantUser struct {
+	ID          int64      `json:"id"`
+	Username    string     `json:"username"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+// adminUserResp is an account as shown to admins. It never includes the
+// password hash.
+type adminUserResp struct {
+	ID          int64      `json:"id"`
+	Username    string     `json:"username"`
+	Email       string     `json:"email"`
+	Role        string     `json:"role"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	DisabledAt  *time.Time `json:"disabled_at"`
 }
+
+type dormantUsersResp struct {
+	Users []dormantUser `json:"users"`
+}
+
+type userCountResp struct {
+	Count int64 `json:"count"`
+}
+
+type deactivateDormantResp struct {
+	Deactivated int64 `json:"deactivated"`
+}
+
+type updateRoleReq struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// apiError is the HTTP rendering of domain.APIError. The message stays under
+// "error" so clients written before codes were introduced keep working.
 type apiError struct {
-	Error string `json:"error"`
+	Error   string            `json:"error"`
+	Code    string            `json:"code,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+	// RetryAfter repeats the Retry-After header, in seconds.
+	RetryAfter int `json:"retry_after,omitempty"`
+	// ErrorID identifies the log entry of an internal error.
+	ErrorID string `json:"error_id,omitempty"`
 }
 
-func (h *AuthHandler) handleError(c *gin.Context, err error) {
-	slog.Error("http handler error", "path", c.Request.URL.Path, "error", err)
-
-	switch {
-	case errors.Is(err, domain.ErrInvalidCredentials):
-		c.AbortWithStatusJSON(http.StatusUnauthorized, apiError{Error: err.Error()})
-	case errors.Is(err, domain.ErrRefreshTokenNotFound):
-		c.AbortWithStatusJSON(http.StatusUnauthorized, apiError{Error: err.Error()})
-	case errors.Is(err, domain.ErrEmailExists):
-		c.AbortWithStatusJSON(http.StatusConflict, apiError{Error: err.Error()})
+func newAPIError(e *domain.APIError) apiError {
+	return apiError{Error: e.Message, Code: e.Code, Details: e.Details, RetryAfter: e.RetryAfter}
+}
+
+// httpStatus maps a domain error code to its HTTP status.
+func httpStatus(code string) int {
+	switch code {
+	case domain.CodeInvalidRequest, domain.CodeInvalidRole, domain.CodePasswordTooShort, domain.CodePasswordTooLong:
+		return http.StatusBadRequest
+	case domain.CodeInvalidCredentials, domain.CodeInvalidToken, domain.CodeTokenExpired,
+		domain.CodeInvalidRefreshToken, domain.CodeRefreshLimitReached, domain.CodeUnauthenticated:
+		return http.StatusUnauthorized
+	case domain.CodeForbidden, domain.CodeRegistrationClosed, domain.CodeEmailDomainNotAllowed, domain.CodeStepUpRequired,
+		domain.CodeAccountDisabled, domain.CodeDisposableEmail, domain.CodeAccountLocked:
+		return http.StatusForbidden
+	case domain.CodeUserNotFound, domain.CodeNotFound:
+		return http.StatusNotFound
+	case domain.CodeEmailExists, domain.CodeAlreadyAuthenticated:
+		return http.StatusConflict
+	case domain.CodePasswordChangeTooSoon, domain.CodeTooManyAttempts, domain.CodeRateLimited:
+		return http.StatusTooManyRequests
+	case domain.CodeTimeout:
+		return http.StatusGatewayTimeout
+	case domain.CodeServiceUnavailable:
+		return http.StatusServiceUnavailable
 	default:
-		c.AbortWithStatusJSON(http.StatusInternalServerError, apiError{Error: "an internal server error occurred"})
+		return http.StatusInternalServerError
+	}
+}
+
+func (h *AuthHandler) handleError(c *gin.Context, err error) {
+	apiErr := domain.ToAPIError(err)
+	resp := newAPIError(apiErr)
+	if apiErr.Code == domain.CodeInternal {
+		resp.ErrorID = newErrorID()
+		slog.Error("http handler error", "path", c.Request.URL.Path, "error_id", resp.ErrorID, "error", err)
+	} else {
+		slog.Error("http handler error", "path", c.Request.URL.Path, "error", err)
+	}
+
+	if apiErr.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(apiErr.RetryAfter))
+	}
+	c.AbortWithStatusJSON(httpStatus(apiErr.Code), resp)
+}
+
+func invalidRequest(message string) apiError {
+	return apiError{Error: message, Code: domain.CodeInvalidRequest}
+}
+
+// invalidRequestBody reports a binding failure, naming each invalid field and
+// the rule it broke when the validator provides them, or the field strict
+// decoding did not expect.
+func invalidRequestBody(err error) apiError {
+	resp := invalidRequest("invalid request body")
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		resp.Details = make(map[string]string, len(verrs))
+		for _, fe := range verrs {
+			resp.Details[strings.ToLower(fe.Field())] = fe.Tag()
+		}
+	}
+	if field, ok := unknownField(err.Error()); ok {
+		resp.Details = map[string]string{field: "unknown"}
+	}
+	return resp
+}
+
+// unknownFieldPattern matches the error encoding/json and protojson give for
+// a field the target does not define.
+var unknownFieldPattern = regexp.MustCompile(`unknown field "([^"]*)"`)
+
+// unknownField extracts the field name from an unknown field error message.
+func unknownField(msg string) (string, bool) {
+	m := unknownFieldPattern.FindStringSubmatch(msg)
+	if m == nil {
+		return "", false
 	}
+	return m[1], true
 }
 
+// bindJSON is ShouldBindJSON, rejecting unknown fields under WithStrictJSON.
+func (h *AuthHandler) bindJSON(c *gin.Context, req any) error {
+	if !h.strictJSON {
+		return c.ShouldBindJSON(req)
+	}
+	return c.ShouldBindWith(req, strictJSONBinding{})
+}
+
+// strictJSONBinding decodes like gin's JSON binding, except that fields the
+// target does not define are an error.
+type strictJSONBinding struct{}
+
+func (strictJSONBinding) Name() string { return "json" }
+
+func (strictJSONBinding) Bind(r *http.Request, obj any) error {
+	if r == nil || r.Body == nil {
+		return errors.New("invalid request")
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(obj); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(obj)
+}
+
+// Register creates an account. With ?dry_run=true it only validates the
+// payload and email availability and answers {"valid":true}. A registration
+// that signed the user in answers with the tokens, like Login.
 func (h *AuthHandler) Register(c *gin.Context) {
 	var req registerReq
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, apiError{Error: "invalid request body"})
+	if err := h.bindJSON(c, &req); err != nil {
+		c.JSON(http.StatusBadRequest, invalidRequestBody(err))
+		return
+	}
+
+	if c.Query("dry_run") == "true" {
+		if err := h.uc.ValidateRegistration(c.Request.Context(), req.Username, string(req.Email), req.Password); err != nil {
+			h.handleError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, validationResp{Valid: true})
 		return
 	}
 
-	if err := h.uc.Register(c.Request.Context(), req.Username, req.Email, req.Password); err != nil {
+	result, err := h.uc.Register(c.Request.Context(), req.Username, string(req.Email), req.Password)
+	if err != nil {
 		h.handleError(c, err)
 		return
 	}
 
+	if result.Tokens != nil {
+		c.JSON(http.StatusCreated, h.tokenResponse(*result.Tokens, result.User))
+		return
+	}
+	if h.acceptRegister {
+		c.Status(http.StatusAccepted)
+		return
+	}
 	c.Status(http.StatusCreated)
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req loginReq
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, apiError{Error: "invalid request body"})
+	if err := h.bindJSON(c, &req); err != nil {
+		c.JSON(http.StatusBadRequest, invalidRequestBody(err))
+		return
+	}
+
+	identifier := req.Identifier
+	if identifier == "" {
+		identifier = string(req.Email)
+	}
+	client := domain.ClientInfo{
+		DeviceName: req.DeviceName,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+	if noRefresh(c) {
+		pair, user, err := h.uc.LoginAccessOnly(c.Request.Context(), identifier, req.Password, client)
+		if err != nil {
+			h.handleError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, h.tokenResponse(pair, user))
 		return
 	}
 
-	pair, err := h.uc.Login(c.Request.Context(), req.Email, req.Password)
+	pair, user, err := h.uc.Login(c.Request.Context(), identifier, req.Password, client)
 	if err != nil {
 		h.handleError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, pair)
+	h.respondTokens(c, h.cookieClient(c, req.ClientType), pair, user)
 }
 
+// noRefresh reports whether a login asks for an access token only, with
+// no_refresh=true.
+func noRefresh(c *gin.Context) bool {
+	v, _ := strconv.ParseBool(c.Query("no_refresh"))
+	return v
+}
+
+// Refresh exchanges a refresh token for a new pair. The token may also come
+// in an Authorization header using RefreshAuthScheme or, under
+// WithRefreshTokenCookie, in refreshTokenCookie, with an empty body. The
+// body takes precedence over the header, and the header over the cookie.
 func (h *AuthHandler) Refresh(c *gin.Context) {
 	var req refreshReq
+	var err error
+	if h.refreshCookie != nil {
+		req.RefreshToken, _ = c.Cookie(refreshTokenCookie)
+	}
+	fromHeader := false
+	if header := c.GetHeader("Authorization"); hasScheme(header, RefreshAuthScheme) {
+		token, ok := schemeToken(header, RefreshAuthScheme)
+		if !ok {
+			c.JSON(http.StatusBadRequest, invalidRequest("empty refresh token in Authorization header"))
+			return
+		}
+		req.RefreshToken, fromHeader = token, true
+	}
+	if (h.refreshCookie != nil || fromHeader) && c.Request.ContentLength == 0 {
+		err = binding.Validator.ValidateStruct(&req)
+	} else {
+		err = h.bindJSON(c, &req)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, invalidRequestBody(err))
+		return
+	}
+
+	pair, user, err := h.uc.Refresh(c.Request.Context(), req.RefreshToken, domain.ClientInfo{IP: c.ClientIP(), AccessToken: req.AccessToken})
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.Header(RefreshTokenConsumedHeader, strconv.FormatBool(pair.Rotated))
+	if !pair.RefreshExpiresAt.IsZero() {
+		c.Header(RefreshExpiresAtHeader, pair.RefreshExpiresAt.UTC().Format(time.RFC3339))
+	}
+	h.respondTokens(c, h.cookieClient(c, req.ClientType), pair, user)
+}
+
+func (h *AuthHandler) SessionExpiry(c *gin.Context) {
+	var req sessionExpiryReq
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, invalidRequest("invalid request body"))
+			return
+		}
+	}
+	if req.RefreshToken == "" {
+		req.RefreshToken, _ = c.Cookie(refreshTokenCookie)
+	}
+	if req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, invalidRequest("refresh token is required"))
+		return
+	}
+
+	expiresAt, err := h.uc.SessionExpiry(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, domain.ErrRefreshTokenNotFound) {
+			c.JSON(http.StatusNotFound, newAPIError(domain.ToAPIError(err)))
+			return
+		}
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, sessionExpiryResp{ExpiresAt: expiresAt})
+}
+
+// ResendVerification mails a new verification link. It is accepted for any
+// well-formed address, so it does not reveal which are registered.
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	var req resendVerificationReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, invalidRequestBody(err))
+		return
+	}
+
+	if err := h.uc.ResendVerification(c.Request.Context(), string(req.Email)); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+// VerifyEmail confirms the address a verification link was sent to.
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req verifyEmailReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, invalidRequestBody(err))
+		return
+	}
+
+	if err := h.uc.VerifyEmail(c.Request.Context(), req.Token); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// StepUp re-checks the caller's password and returns a short-lived token that
+// routes guarded by RequireStepUp accept.
+func (h *AuthHandler) StepUp(c *gin.Context) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, apiError{Error: "unauthenticated", Code: domain.CodeUnauthenticated})
+		return
+	}
+
+	var req stepUpReq
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, apiError{Error: "invalid request body"})
+		c.JSON(http.StatusBadRequest, invalidRequest("invalid request body"))
 		return
 	}
 
-	pair, err := h.uc.Refresh(c.Request.Context(), req.RefreshToken)
+	token, err := h.uc.StepUp(c.Request.Context(), claims.UserID, req.Password)
 	if err != nil {
 		h.handleError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, pair)
+	c.JSON(http.StatusOK, stepUpResp{StepUpToken: token})
+}
+
+// ResourceToken issues the caller an access token scoped to the requested
+// resource server. Resources the caller may not access are refused with 403.
+func (h *AuthHandler) ResourceToken(c *gin.Context) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, apiError{Error: "unauthenticated", Code: domain.CodeUnauthenticated})
+		return
+	}
+
+	var req resourceTokenReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, invalidRequest("invalid request body"))
+		return
+	}
+
+	token, err := h.uc.IssueResourceToken(c.Request.Context(), claims.UserID, req.Audience)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resourceTokenResp{AccessToken: token, Audience: req.Audience})
+}
+
+// VerifyPassword checks the caller's password without issuing a token, for
+// confirmation dialogs. A wrong password is reported as valid=false, not as
+// an error.
+func (h *AuthHandler) VerifyPassword(c *gin.Context) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, apiError{Error: "unauthenticated", Code: domain.CodeUnauthenticated})
+		return
+	}
+
+	var req verifyPasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, invalidRequest("invalid request body"))
+		return
+	}
+
+	valid, err := h.uc.VerifyPassword(c.Request.Context(), claims.UserID, req.Password)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, validationResp{Valid: valid})
+}
+
+// ChangePassword sets a new password for the caller. The route requires a
+// step-up token, which stands in for asking for the current password.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, apiError{Error: "unauthenticated", Code: domain.CodeUnauthenticated})
+		return
+	}
+
+	var req changePasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, invalidRequestBody(err))
+		return
+	}
+
+	if err := h.uc.ChangePassword(c.Request.Context(), claims.UserID, req.NewPassword); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Sessions lists the caller's live sessions.
+func (h *AuthHandler) Sessions(c *gin.Context) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, apiError{Error: "unauthenticated", Code: domain.CodeUnauthenticated})
+		return
+	}
+
+	sessions, err := h.uc.ListSessions(c.Request.Context(), claims.UserID)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, sessionsResp{Sessions: sessions})
+}
+
+// Logout ends the session the caller's access token was issued for. The
+// caller's other sessions stay signed in. With JWT refresh tokens, which
+// access tokens do not tie to a session, the refresh token to revoke is read
+// from the body or, failing that, the refresh_token cookie.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, apiError{Error: "unauthenticated", Code: domain.CodeUnauthenticated})
+		return
+	}
+
+	var req logoutReq
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, invalidRequest("invalid request body"))
+			return
+		}
+	}
+	if req.RefreshToken == "" {
+		req.RefreshToken, _ = c.Cookie(refreshTokenCookie)
+	}
+
+	if err := h.uc.Logout(c.Request.Context(), claims.UserID, claims.SessionID, req.RefreshToken); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeSession ends one of the caller's sessions, named by its id in
+// GET /auth/sessions. Other users' sessions are refused with 403.
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, apiError{Error: "unauthenticated", Code: domain.CodeUnauthenticated})
+		return
+	}
+
+	sessionID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, invalidRequest("invalid session id"))
+		return
+	}
+
+	if err := h.uc.RevokeSession(c.Request.Context(), claims.UserID, sessionID); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ExportData returns everything the service keeps about the caller: their
+// account, live sessions and audit events. The password hash is left out.
+func (h *AuthHandler) ExportData(c *gin.Context) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, apiError{Error: "unauthenticated", Code: domain.CodeUnauthenticated})
+		return
+	}
+
+	export, err := h.uc.ExportUserData(c.Request.Context(), claims.UserID)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, export)
+}
+
+// DeleteAccount erases the caller's account, sessions and audit events. It
+// must be asked for with hard=true, as there is no soft deletion to fall
+// back to.
+func (h *AuthHandler) DeleteAccount(c *gin.Context) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, apiError{Error: "unauthenticated", Code: domain.CodeUnauthenticated})
+		return
+	}
+	if hard, _ := strconv.ParseBool(c.Query("hard")); !hard {
+		c.JSON(http.StatusBadRequest, invalidRequest("only hard deletion is supported: pass hard=true"))
+		return
+	}
+
+	if err := h.uc.DeleteAccount(c.Request.Context(), claims.UserID); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AuthHandler) UpdateRole(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, invalidRequest("invalid user id"))
+		return
+	}
+
+	var req updateRoleReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, invalidRequest("invalid request body"))
+		return
+	}
+
+	if err := h.uc.UpdateRole(c.Request.Context(), userID, req.Role); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type rotateKeyReq struct {
+	Secret string `json:"secret" binding:"omitempty,min=32"`
+}
+
+// RotateKey replaces the token signing secret with the one given, or with a
+// generated one; the secret is never sent back. A given secret must pass the
+// strength check JWT_SECRET does. Tokens signed with the replaced secret
+// stay valid until they expire. The key lives in memory, so only the
+// instance serving the request rotates, until it restarts: deployments with
+// several instances must rotate JWT_SECRET and JWT_SECRET_PREVIOUS through
+// their configuration instead.
+func (h *AuthHandler) RotateKey(c *gin.Context) {
+	var req rotateKeyReq
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, invalidRequestBody(err))
+			return
+		}
+	}
+
+	if err := h.uc.RotateSigningKey(c.Request.Context(), req.Secret); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	if claims, ok := claimsFromContext(c); ok {
+		slog.Warn("token signing key rotated", "admin_id", claims.UserID)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AuthHandler) CleanupStatus(c *gin.Context) {
+	if h.cleanup == nil {
+		c.JSON(http.StatusNotFound, apiError{Error: "token cleanup is disabled", Code: domain.CodeNotFound})
+		return
+	}
+	c.JSON(http.StatusOK, h.cleanup.Status())
+}
+
+// AuthEvents lists audit events, newest first. Query parameters user_id,
+// email, type, success, from and to (RFC 3339) filter the results; limit and
+// offset paginate them, with limit clamped to domain.MaxAuditPageSize.
+func (h *AuthHandler) AuthEvents(c *gin.Context) {
+	f, err := parseAuthEventFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, invalidRequest(err.Error()))
+		return
+	}
+
+	events, err := h.uc.ListAuthEvents(c.Request.Context(), f)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	for i := range events {
+		events[i].Email = h.visibleEmail(c, events[i].UserID, events[i].Email)
+	}
+
+	c.JSON(http.StatusOK, authEventsResp{Events: events, Limit: f.PageSize(), Offset: f.Offset})
+}
+
+// DormantUsers lists active accounts with no login, or registration if they
+// never logged in, within the last ?days=N days.
+func (h *AuthHandler) DormantUsers(c *gin.Context) {
+	inactiveFor, err := parseInactiveDays(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, invalidRequest(err.Error()))
+		return
+	}
+
+	users, err := h.uc.ListDormantUsers(c.Request.Context(), inactiveFor)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	resp := dormantUsersResp{Users: make([]dormantUser, 0, len(users))}
+	for _, u := range users {
+		du := dormantUser{ID: u.ID, Username: u.Username, Email: h.visibleEmail(c, u.ID, u.Email), CreatedAt: u.CreatedAt}
+		if !u.LastLoginAt.IsZero() {
+			du.LastLoginAt = &u.LastLoginAt
+		}
+		resp.Users = append(resp.Users, du)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// UserByEmail looks up the account registered with ?email=.
+func (h *AuthHandler) UserByEmail(c *gin.Context) {
+	email := strings.TrimSpace(c.Query("email"))
+	if email == "" {
+		c.JSON(http.StatusBadRequest, invalidRequest("email is required"))
+		return
+	}
+
+	user, err := h.uc.GetUserByEmail(c.Request.Context(), email)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	resp := adminUserResp{ID: user.ID, Username: user.Username, Email: user.Email, Role: user.Role, CreatedAt: user.CreatedAt}
+	if !user.LastLoginAt.IsZero() {
+		resp.LastLoginAt = &user.LastLoginAt
+	}
+	if user.Disabled() {
+		resp.DisabledAt = &user.DisabledAt
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// UserCount reports how many accounts exist, disabled ones included.
+func (h *AuthHandler) UserCount(c *gin.Context) {
+	n, err := h.uc.CountUsers(c.Request.Context())
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, userCountResp{Count: n})
+}
+
+// DeactivateDormantUsers disables every account DormantUsers would list for
+// the same ?days=N and revokes their refresh tokens.
+func (h *AuthHandler) DeactivateDormantUsers(c *gin.Context) {
+	inactiveFor, err := parseInactiveDays(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, invalidRequest(err.Error()))
+		return
+	}
+
+	n, err := h.uc.DeactivateDormantUsers(c.Request.Context(), inactiveFor)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, deactivateDormantResp{Deactivated: n})
+}
+
+type importUsersReq struct {
+	Users []importUser `json:"users" binding:"required"`
+}
+
+// importUser is an account from another system. PasswordHash must be a
+// bcrypt or Argon2id hash; Role and CreatedAt are optional.
+type importUser struct {
+	Username     string    `json:"username"`
+	Email        string    `json:"email"`
+	PasswordHash string    `json:"password_hash"`
+	Role         string    `json:"role"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ImportUsers creates users migrated from another system with their existing
+// password hashes. Users that cannot be imported are listed in the response
+// with their index in the request; the others are imported regardless.
+func (h *AuthHandler) ImportUsers(c *gin.Context) {
+	var req importUsersReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, invalidRequest("invalid request body"))
+		return
+	}
+
+	users := make([]domain.User, len(req.Users))
+	for i, u := range req.Users {
+		users[i] = domain.User{
+			Username:     u.Username,
+			Email:        u.Email,
+			PasswordHash: u.PasswordHash,
+			Role:         u.Role,
+			CreatedAt:    u.CreatedAt,
+		}
+	}
+
+	result, err := h.uc.ImportUsers(c.Request.Context(), users)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func parseInactiveDays(c *gin.Context) (time.Duration, error) {
+	days, err := strconv.Atoi(c.Query("days"))
+	if err != nil || days < 1 {
+		return 0, errors.New("days must be a positive integer")
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+func parseAuthEventFilter(c *gin.Context) (domain.AuthEventFilter, error) {
+	f := domain.AuthEventFilter{
+		Email: c.Query("email"),
+		Type:  c.Query("type"),
+	}
+
+	ints := []struct {
+		name string
+		dst  *int
+	}{{"limit", &f.Limit}, {"offset", &f.Offset}}
+	for _, p := range ints {
+		if v := c.Query(p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return f, fmt.Errorf("invalid %s", p.name)
+			}
+			*p.dst = n
+		}
+	}
+	if v := c.Query("user_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return f, errors.New("invalid user_id")
+		}
+		f.UserID = id
+	}
+	if v := c.Query("success"); v != "" {
+		success, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, errors.New("invalid success")
+		}
+		f.Success = &success
+	}
+
+	times := []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &f.From}, {"to", &f.To}}
+	for _, p := range times {
+		if v := c.Query(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, fmt.Errorf("invalid %s", p.name)
+			}
+			*p.dst = t
+		}
+	}
+	return f, nil
 }
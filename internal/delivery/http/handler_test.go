@@ -4,11 +4,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/Kovalyovv/auth-service/internal/pkg/jwt"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -18,19 +23,142 @@ type MockAuthUseCase struct {
 	mock.Mock
 }
 
-func (m *MockAuthUseCase) Register(ctx context.Context, username, email, password string) error {
+func (m *MockAuthUseCase) Register(ctx context.Context, username, email, password string) (domain.RegisterResult, error) {
+	args := m.Called(ctx, username, email, password)
+	return args.Get(0).(domain.RegisterResult), args.Error(1)
+}
+
+func (m *MockAuthUseCase) ValidateRegistration(ctx context.Context, username, email, password string) error {
 	args := m.Called(ctx, username, email, password)
 	return args.Error(0)
 }
 
-func (m *MockAuthUseCase) Login(ctx context.Context, email, password string) (domain.TokenPair, error) {
-	args := m.Called(ctx, email, password)
-	return args.Get(0).(domain.TokenPair), args.Error(1)
+func (m *MockAuthUseCase) Login(ctx context.Context, email, password string, client domain.ClientInfo) (domain.TokenPair, *domain.User, error) {
+	args := m.Called(ctx, email, password, client)
+	user, _ := args.Get(1).(*domain.User)
+	return args.Get(0).(domain.TokenPair), user, args.Error(2)
+}
+
+func (m *MockAuthUseCase) Refresh(ctx context.Context, refreshToken string, client domain.ClientInfo) (domain.TokenPair, *domain.User, error) {
+	args := m.Called(ctx, refreshToken, client)
+	user, _ := args.Get(1).(*domain.User)
+	return args.Get(0).(domain.TokenPair), user, args.Error(2)
+}
+
+func (m *MockAuthUseCase) Authenticate(ctx context.Context, token string) (*jwt.Claims, error) {
+	args := m.Called(ctx, token)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*jwt.Claims), args.Error(1)
+}
+
+func (m *MockAuthUseCase) UpdateRole(ctx context.Context, userID int64, role string) error {
+	args := m.Called(ctx, userID, role)
+	return args.Error(0)
 }
 
-func (m *MockAuthUseCase) Refresh(ctx context.Context, refreshToken string) (domain.TokenPair, error) {
+func (m *MockAuthUseCase) SessionExpiry(ctx context.Context, refreshToken string) (time.Time, error) {
 	args := m.Called(ctx, refreshToken)
-	return args.Get(0).(domain.TokenPair), args.Error(1)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+func (m *MockAuthUseCase) ResendVerification(ctx context.Context, email string) error {
+	args := m.Called(ctx, email)
+	return args.Error(0)
+}
+
+func (m *MockAuthUseCase) VerifyEmail(ctx context.Context, token string) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockAuthUseCase) StepUp(ctx context.Context, userID int64, password string) (string, error) {
+	args := m.Called(ctx, userID, password)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockAuthUseCase) IssueResourceToken(ctx context.Context, userID int64, audience string) (string, error) {
+	args := m.Called(ctx, userID, audience)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockAuthUseCase) VerifyPassword(ctx context.Context, userID int64, password string) (bool, error) {
+	args := m.Called(ctx, userID, password)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockAuthUseCase) ChangePassword(ctx context.Context, userID int64, newPassword string) error {
+	args := m.Called(ctx, userID, newPassword)
+	return args.Error(0)
+}
+
+func (m *MockAuthUseCase) ListAuthEvents(ctx context.Context, f domain.AuthEventFilter) ([]domain.AuthEvent, error) {
+	args := m.Called(ctx, f)
+	return args.Get(0).([]domain.AuthEvent), args.Error(1)
+}
+
+func (m *MockAuthUseCase) ListSessions(ctx context.Context, userID int64) ([]domain.Session, error) {
+	args := m.Called(ctx, userID)
+	sessions, _ := args.Get(0).([]domain.Session)
+	return sessions, args.Error(1)
+}
+
+func (m *MockAuthUseCase) Logout(ctx context.Context, userID, sessionID int64, refreshToken string) error {
+	args := m.Called(ctx, userID, sessionID, refreshToken)
+	return args.Error(0)
+}
+
+func (m *MockAuthUseCase) RevokeSession(ctx context.Context, userID, sessionID int64) error {
+	args := m.Called(ctx, userID, sessionID)
+	return args.Error(0)
+}
+
+func (m *MockAuthUseCase) LoginAccessOnly(ctx context.Context, identifier, password string, client domain.ClientInfo) (domain.TokenPair, *domain.User, error) {
+	args := m.Called(ctx, identifier, password, client)
+	user, _ := args.Get(1).(*domain.User)
+	return args.Get(0).(domain.TokenPair), user, args.Error(2)
+}
+
+func (m *MockAuthUseCase) ExportUserData(ctx context.Context, userID int64) (domain.UserExport, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(domain.UserExport), args.Error(1)
+}
+
+func (m *MockAuthUseCase) DeleteAccount(ctx context.Context, userID int64) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockAuthUseCase) ListDormantUsers(ctx context.Context, inactiveFor time.Duration) ([]domain.User, error) {
+	args := m.Called(ctx, inactiveFor)
+	return args.Get(0).([]domain.User), args.Error(1)
+}
+
+func (m *MockAuthUseCase) ImportUsers(ctx context.Context, users []domain.User) (domain.ImportResult, error) {
+	args := m.Called(ctx, users)
+	return args.Get(0).(domain.ImportResult), args.Error(1)
+}
+
+func (m *MockAuthUseCase) DeactivateDormantUsers(ctx context.Context, inactiveFor time.Duration) (int64, error) {
+	args := m.Called(ctx, inactiveFor)
+	return int64(args.Int(0)), args.Error(1)
+}
+
+func (m *MockAuthUseCase) CountUsers(ctx context.Context) (int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockAuthUseCase) RotateSigningKey(ctx context.Context, secret string) error {
+	args := m.Called(ctx, secret)
+	return args.Error(0)
+}
+
+func (m *MockAuthUseCase) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	args := m.Called(ctx, email)
+	user, _ := args.Get(0).(*domain.User)
+	return user, args.Error(1)
 }
 
 func TestAuthHandler_Login(t *testing.T) {
@@ -42,7 +170,7 @@ func TestAuthHandler_Login(t *testing.T) {
 
 		expectedPair := domain.TokenPair{AccessToken: "access", RefreshToken: "refresh"}
 		loginReq := loginReq{Email: "test@example.com", Password: "password"}
-		mockUC.On("Login", mock.Anything, loginReq.Email, loginReq.Password).Return(expectedPair, nil).Once()
+		mockUC.On("Login", mock.Anything, string(loginReq.Email), loginReq.Password, domain.ClientInfo{}).Return(expectedPair, nil, nil).Once()
 
 		router := gin.New()
 		router.POST("/login", handler.Login)
@@ -64,6 +192,41 @@ func TestAuthHandler_Login(t *testing.T) {
 		mockUC.AssertExpectations(t)
 	})
 
+	user := &domain.User{ID: 7, Username: "test", Email: "test@example.com", PasswordHash: "hash", Role: domain.RoleUser}
+	for name, tt := range map[string]struct {
+		enabled bool
+		want    string
+	}{
+		"Given profiles are enabled": {
+			enabled: true,
+			want:    `{"access_token":"access","refresh_token":"refresh","user":{"id":7,"username":"test","email":"test@example.com","role":"user"}}`,
+		},
+		"Given profiles are disabled": {
+			enabled: false,
+			want:    `{"access_token":"access","refresh_token":"refresh"}`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mockUC := new(MockAuthUseCase)
+			handler := NewAuthHandler(mockUC, WithProfileInResponse(tt.enabled))
+			pair := domain.TokenPair{AccessToken: "access", RefreshToken: "refresh"}
+			mockUC.On("Login", mock.Anything, user.Email, "password", domain.ClientInfo{}).Return(pair, user, nil).Once()
+
+			router := gin.New()
+			router.POST("/login", handler.Login)
+
+			req, _ := http.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(`{"email":"test@example.com","password":"password"}`))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.JSONEq(t, tt.want, rr.Body.String())
+			mockUC.AssertExpectations(t)
+		})
+	}
+
 	t.Run("Given invalid json", func(t *testing.T) {
 		mockUC := new(MockAuthUseCase)
 		handler := NewAuthHandler(mockUC)
@@ -79,4 +242,1897 @@ func TestAuthHandler_Login(t *testing.T) {
 
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
 	})
+
+	t.Run("Given an email with surrounding whitespace", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("Login", mock.Anything, "test@test.com", " password ", domain.ClientInfo{}).Return(domain.TokenPair{}, nil, nil).Once()
+
+		router := gin.New()
+		router.POST("/login", NewAuthHandler(mockUC).Login)
+
+		req, _ := http.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(`{"email": " test@test.com\t", "password": " password "}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given an identifier", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("Login", mock.Anything, "test", "password", domain.ClientInfo{}).Return(domain.TokenPair{}, nil, nil).Once()
+
+		router := gin.New()
+		router.POST("/login", NewAuthHandler(mockUC).Login)
+
+		req, _ := http.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(`{"identifier": "test", "password": "password"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given neither an identifier nor an email", func(t *testing.T) {
+		router := gin.New()
+		router.POST("/login", NewAuthHandler(new(MockAuthUseCase)).Login)
+
+		req, _ := http.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(`{"password": "password"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestAuthHandler_Login_NoRefresh(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockUC := new(MockAuthUseCase)
+	router := gin.New()
+	SetupRoutes(router, NewAuthHandler(mockUC, WithRefreshTokenCookie(time.Hour, true)))
+	mockUC.On("LoginAccessOnly", mock.Anything, "test@example.com", "password", mock.Anything).
+		Return(domain.TokenPair{AccessToken: "access"}, nil, nil).Once()
+
+	req, _ := http.NewRequest(http.MethodPost, "/auth/login?no_refresh=true",
+		bytes.NewBufferString(`{"email":"test@example.com","password":"password","client_type":"web"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"access_token":"access"}`, rr.Body.String())
+	assert.Empty(t, rr.Result().Cookies(), "no refresh cookie is set")
+	mockUC.AssertNotCalled(t, "Login", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockUC.AssertExpectations(t)
+}
+
+func TestAuthHandler_Login_AccountLocked(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockUC := new(MockAuthUseCase)
+	lockedUntil := time.Now().Add(90 * time.Second)
+	mockUC.On("Login", mock.Anything, "test@example.com", "password", domain.ClientInfo{}).
+		Return(domain.TokenPair{}, nil, &domain.AccountLockedError{Until: lockedUntil}).Once()
+
+	router := gin.New()
+	router.POST("/login", NewAuthHandler(mockUC).Login)
+
+	req, _ := http.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(`{"email":"test@example.com","password":"password"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, "90", rr.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"error":"account is temporarily locked, try again later","code":"account_locked","retry_after":90}`, rr.Body.String())
+	mockUC.AssertExpectations(t)
+}
+
+func TestAuthHandler_RejectAuthenticated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const body = `{"username":"alice","email":"alice@example.com","password":"password123"}`
+	newRequest := func(path, token string) *http.Request {
+		req, _ := http.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return req
+	}
+
+	t.Run("Given an authenticated register attempt", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC, WithRejectAuthenticated(true)))
+		mockUC.On("Authenticate", mock.Anything, "token").Return(&jwt.Claims{UserID: 7, Role: domain.RoleUser}, nil).Once()
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newRequest("/auth/register", "token"))
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.JSONEq(t, `{"error":"already authenticated","code":"already_authenticated"}`, rr.Body.String())
+		mockUC.AssertNotCalled(t, "Register", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Given an authenticated login attempt", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC, WithRejectAuthenticated(true)))
+		mockUC.On("Authenticate", mock.Anything, "token").Return(&jwt.Claims{UserID: 7, Role: domain.RoleUser}, nil).Once()
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newRequest("/auth/login", "token"))
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		mockUC.AssertNotCalled(t, "Login", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Given an anonymous register attempt", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC, WithRejectAuthenticated(true)))
+		mockUC.On("Register", mock.Anything, "alice", "alice@example.com", "password123").Return(domain.RegisterResult{}, nil).Once()
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newRequest("/auth/register", ""))
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given a register attempt with an expired token", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC, WithRejectAuthenticated(true)))
+		mockUC.On("Authenticate", mock.Anything, "expired").Return(nil, domain.ErrTokenExpired).Once()
+		mockUC.On("Register", mock.Anything, "alice", "alice@example.com", "password123").Return(domain.RegisterResult{}, nil).Once()
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newRequest("/auth/register", "expired"))
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given an authenticated register attempt with the check disabled", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+		mockUC.On("Register", mock.Anything, "alice", "alice@example.com", "password123").Return(domain.RegisterResult{}, nil).Once()
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newRequest("/auth/register", "token"))
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		mockUC.AssertExpectations(t)
+		mockUC.AssertNotCalled(t, "Authenticate", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthHandler_StrictJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	requests := map[string]string{
+		"/register": `{"username":"alice","email":"alice@example.com","password":"password123","passwrod":"x"}`,
+		"/login":    `{"email":"alice@example.com","password":"password123","passwrod":"x"}`,
+		"/refresh":  `{"refresh_token":"token","passwrod":"x"}`,
+	}
+	newRouter := func(mockUC *MockAuthUseCase, strict bool) *gin.Engine {
+		handler := NewAuthHandler(mockUC, WithStrictJSON(strict))
+		router := gin.New()
+		router.POST("/register", handler.Register)
+		router.POST("/login", handler.Login)
+		router.POST("/refresh", handler.Refresh)
+		return router
+	}
+
+	for path, body := range requests {
+		t.Run("Given an unknown field in strict mode on "+path, func(t *testing.T) {
+			mockUC := new(MockAuthUseCase)
+
+			req, _ := http.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			newRouter(mockUC, true).ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			assert.JSONEq(t, `{"error":"invalid request body","code":"invalid_request","details":{"passwrod":"unknown"}}`, rr.Body.String())
+			mockUC.AssertExpectations(t)
+		})
+	}
+
+	t.Run("Given an unknown field in lenient mode", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("Login", mock.Anything, "alice@example.com", "password123", domain.ClientInfo{}).Return(domain.TokenPair{}, nil, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(requests["/login"]))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		newRouter(mockUC, false).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given a known but invalid field in strict mode", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+
+		req, _ := http.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(`{"email":"not-an-email","password":"password123"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		newRouter(mockUC, true).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"email":"email"`)
+	})
+}
+
+func TestAuthHandler_Refresh(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("Given profiles are enabled", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		handler := NewAuthHandler(mockUC, WithProfileInResponse(true))
+		pair := domain.TokenPair{AccessToken: "access", RefreshToken: "refresh"}
+		user := &domain.User{ID: 7, Username: "test", Email: "test@example.com", Role: domain.RoleAdmin}
+		mockUC.On("Refresh", mock.Anything, "token", domain.ClientInfo{IP: "192.0.2.1"}).Return(pair, user, nil).Once()
+
+		router := gin.New()
+		router.POST("/refresh", handler.Refresh)
+
+		req, _ := http.NewRequest(http.MethodPost, "/refresh", bytes.NewBufferString(`{"refresh_token":"token"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "192.0.2.1:54321"
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"access_token":"access","refresh_token":"refresh","user":{"id":7,"username":"test","email":"test@example.com","role":"admin"}}`, rr.Body.String())
+		mockUC.AssertExpectations(t)
+	})
+
+	expiresAt := time.Date(2030, 1, 8, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	rotationTests := map[string]struct {
+		pair         domain.TokenPair
+		wantConsumed string
+		wantExpires  string
+	}{
+		"Given a rotated refresh token": {
+			pair:         domain.TokenPair{AccessToken: "access", RefreshToken: "refresh", RefreshExpiresAt: expiresAt, Rotated: true},
+			wantConsumed: "true", wantExpires: "2030-01-08T11:00:00Z",
+		},
+		"Given a reissued access token": {
+			pair:         domain.TokenPair{AccessToken: "access", RefreshToken: "token", RefreshExpiresAt: expiresAt},
+			wantConsumed: "false", wantExpires: "2030-01-08T11:00:00Z",
+		},
+	}
+	for name, tt := range rotationTests {
+		t.Run(name, func(t *testing.T) {
+			mockUC := new(MockAuthUseCase)
+			mockUC.On("Refresh", mock.Anything, "token", mock.Anything).Return(tt.pair, &domain.User{ID: 7}, nil).Once()
+			router := gin.New()
+			router.POST("/refresh", NewAuthHandler(mockUC).Refresh)
+
+			req, _ := http.NewRequest(http.MethodPost, "/refresh", bytes.NewBufferString(`{"refresh_token":"token"}`))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.wantConsumed, rr.Header().Get(RefreshTokenConsumedHeader))
+			assert.Equal(t, tt.wantExpires, rr.Header().Get(RefreshExpiresAtHeader))
+			for _, values := range rr.Header() {
+				for _, v := range values {
+					assert.NotContains(t, v, tt.pair.RefreshToken)
+				}
+			}
+			mockUC.AssertExpectations(t)
+		})
+	}
+
+	t.Run("Given a failed refresh", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("Refresh", mock.Anything, "token", mock.Anything).Return(domain.TokenPair{}, nil, domain.ErrRefreshTokenNotFound).Once()
+		router := gin.New()
+		router.POST("/refresh", NewAuthHandler(mockUC).Refresh)
+
+		req, _ := http.NewRequest(http.MethodPost, "/refresh", bytes.NewBufferString(`{"refresh_token":"token"}`))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Empty(t, rr.Header().Get(RefreshTokenConsumedHeader))
+		assert.Empty(t, rr.Header().Get(RefreshExpiresAtHeader))
+	})
+}
+
+func TestAuthHandler_Refresh_AuthorizationHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	pair := domain.TokenPair{AccessToken: "access", RefreshToken: "refresh"}
+
+	tests := map[string]struct {
+		header     string
+		body       string
+		wantToken  string
+		wantStatus int
+	}{
+		"Given the token in the body":                 {body: `{"refresh_token":"body-token"}`, wantToken: "body-token", wantStatus: http.StatusOK},
+		"Given the token in the header":               {header: "Refresh header-token", wantToken: "header-token", wantStatus: http.StatusOK},
+		"Given a lowercase scheme":                    {header: "refresh header-token", wantToken: "header-token", wantStatus: http.StatusOK},
+		"Given the token in the header and the body":  {header: "Refresh header-token", body: `{"refresh_token":"body-token"}`, wantToken: "body-token", wantStatus: http.StatusOK},
+		"Given the header and a body without a token": {header: "Refresh header-token", body: `{"access_token":"access"}`, wantToken: "header-token", wantStatus: http.StatusOK},
+		"Given the scheme without a token":            {header: "Refresh ", wantStatus: http.StatusBadRequest},
+		"Given another scheme":                        {header: "Bearer header-token", wantStatus: http.StatusBadRequest},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockUC := new(MockAuthUseCase)
+			if tt.wantToken != "" {
+				mockUC.On("Refresh", mock.Anything, tt.wantToken, mock.Anything).Return(pair, nil, nil).Once()
+			}
+			router := gin.New()
+			router.POST("/refresh", NewAuthHandler(mockUC).Refresh)
+
+			req, _ := http.NewRequest(http.MethodPost, "/refresh", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			mockUC.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthHandler_RefreshTokenCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	pair := domain.TokenPair{AccessToken: "access", RefreshToken: "refresh"}
+	send := func(handler *AuthHandler, path, body string, prepare func(*http.Request)) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.POST("/auth/login", handler.Login)
+		router.POST("/auth/refresh", handler.Refresh)
+
+		req, _ := http.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if prepare != nil {
+			prepare(req)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	login := `{"email":"test@example.com","password":"password123"}`
+
+	t.Run("Given an API client", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("Login", mock.Anything, "test@example.com", "password123", mock.Anything).Return(pair, nil, nil).Once()
+
+		rr := send(NewAuthHandler(mockUC, WithRefreshTokenCookie(time.Hour, true)), "/auth/login", login, nil)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"access_token":"access","refresh_token":"refresh"}`, rr.Body.String())
+		assert.Empty(t, rr.Result().Cookies())
+	})
+
+	t.Run("Given a web client", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("Login", mock.Anything, "test@example.com", "password123", mock.Anything).Return(pair, nil, nil).Once()
+
+		rr := send(NewAuthHandler(mockUC, WithRefreshTokenCookie(time.Hour, true)), "/auth/login", login, func(req *http.Request) {
+			req.Header.Set(ClientTypeHeader, ClientTypeWeb)
+		})
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"access_token":"access"}`, rr.Body.String())
+		cookies := rr.Result().Cookies()
+		if assert.Len(t, cookies, 1) {
+			assert.Equal(t, refreshTokenCookie, cookies[0].Name)
+			assert.Equal(t, "refresh", cookies[0].Value)
+			assert.Equal(t, "/auth", cookies[0].Path)
+			assert.Equal(t, 3600, cookies[0].MaxAge)
+			assert.True(t, cookies[0].HttpOnly)
+			assert.True(t, cookies[0].Secure)
+			assert.Equal(t, http.SameSiteStrictMode, cookies[0].SameSite)
+		}
+	})
+
+	t.Run("Given a web client named in the body", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("Login", mock.Anything, "test@example.com", "password123", mock.Anything).Return(pair, nil, nil).Once()
+
+		rr := send(NewAuthHandler(mockUC, WithRefreshTokenCookie(time.Hour, false)), "/auth/login",
+			`{"email":"test@example.com","password":"password123","client_type":"web"}`, nil)
+
+		assert.JSONEq(t, `{"access_token":"access"}`, rr.Body.String())
+		if assert.Len(t, rr.Result().Cookies(), 1) {
+			assert.False(t, rr.Result().Cookies()[0].Secure)
+		}
+	})
+
+	t.Run("Given a web client refreshing with its cookie", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("Refresh", mock.Anything, "cookie-token", mock.Anything).Return(pair, nil, nil).Once()
+
+		rr := send(NewAuthHandler(mockUC, WithRefreshTokenCookie(time.Hour, true)), "/auth/refresh", "", func(req *http.Request) {
+			req.Header.Set(ClientTypeHeader, ClientTypeWeb)
+			req.AddCookie(&http.Cookie{Name: refreshTokenCookie, Value: "cookie-token"})
+		})
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"access_token":"access"}`, rr.Body.String())
+		if assert.Len(t, rr.Result().Cookies(), 1) {
+			assert.Equal(t, "refresh", rr.Result().Cookies()[0].Value)
+		}
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given an API client refreshing", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("Refresh", mock.Anything, "token", mock.Anything).Return(pair, nil, nil).Once()
+
+		rr := send(NewAuthHandler(mockUC, WithRefreshTokenCookie(time.Hour, true)), "/auth/refresh", `{"refresh_token":"token"}`, nil)
+
+		assert.JSONEq(t, `{"access_token":"access","refresh_token":"refresh"}`, rr.Body.String())
+		assert.Empty(t, rr.Result().Cookies())
+	})
+
+	t.Run("Given cookies are disabled", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("Login", mock.Anything, "test@example.com", "password123", mock.Anything).Return(pair, nil, nil).Once()
+
+		rr := send(NewAuthHandler(mockUC), "/auth/login", login, func(req *http.Request) {
+			req.Header.Set(ClientTypeHeader, ClientTypeWeb)
+		})
+
+		assert.JSONEq(t, `{"access_token":"access","refresh_token":"refresh"}`, rr.Body.String())
+		assert.Empty(t, rr.Result().Cookies())
+	})
+}
+
+func TestAuthHandler_Register(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registerReq := registerReq{Username: "test", Email: "test@example.com", Password: "password"}
+
+	t.Run("Given registration is enabled", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		handler := NewAuthHandler(mockUC)
+		mockUC.On("Register", mock.Anything, registerReq.Username, string(registerReq.Email), registerReq.Password).Return(domain.RegisterResult{}, nil).Once()
+
+		router := gin.New()
+		router.POST("/register", handler.Register)
+
+		body, _ := json.Marshal(registerReq)
+		req, _ := http.NewRequest(http.MethodPost, "/register", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given registration is disabled", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		handler := NewAuthHandler(mockUC)
+		mockUC.On("Register", mock.Anything, registerReq.Username, string(registerReq.Email), registerReq.Password).Return(domain.RegisterResult{}, domain.ErrRegistrationClosed).Once()
+
+		router := gin.New()
+		router.POST("/register", handler.Register)
+
+		body, _ := json.Marshal(registerReq)
+		req, _ := http.NewRequest(http.MethodPost, "/register", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		var resp apiError
+		err := json.Unmarshal(rr.Body.Bytes(), &resp)
+		assert.NoError(t, err)
+		assert.Equal(t, domain.ErrRegistrationClosed.Error(), resp.Error)
+		assert.Equal(t, domain.CodeRegistrationClosed, resp.Code)
+
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given registration signs the user in", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		handler := NewAuthHandler(mockUC)
+		mockUC.On("Register", mock.Anything, registerReq.Username, string(registerReq.Email), registerReq.Password).Return(domain.RegisterResult{
+			User:   &domain.User{ID: 1, Username: "test", Email: "test@example.com"},
+			Tokens: &domain.TokenPair{AccessToken: "access", RefreshToken: "refresh"},
+		}, nil).Once()
+
+		router := gin.New()
+		router.POST("/register", handler.Register)
+
+		body, _ := json.Marshal(registerReq)
+		req, _ := http.NewRequest(http.MethodPost, "/register", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.JSONEq(t, `{"access_token":"access","refresh_token":"refresh"}`, rr.Body.String())
+		mockUC.AssertExpectations(t)
+	})
+}
+
+func TestAuthHandler_Register_EnumerationSafe(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registerReq := registerReq{Username: "test", Email: "test@example.com", Password: "password"}
+	created := domain.RegisterResult{User: &domain.User{ID: 1, Username: "test", Email: "test@example.com"}}
+
+	// In enumeration-safe mode the use case reports success for a taken
+	// email, so both cases must look the same to the client.
+	tests := map[string]struct {
+		opts        []HandlerOption
+		result      domain.RegisterResult
+		registerErr error
+		wantStatus  int
+		wantCode    string
+	}{
+		"Given the default mode and a new email": {
+			result:     created,
+			wantStatus: http.StatusCreated,
+		},
+		"Given the default mode and a taken email": {
+			registerErr: domain.ErrEmailExists,
+			wantStatus:  http.StatusConflict,
+			wantCode:    domain.CodeEmailExists,
+		},
+		"Given the enumeration-safe mode and a new email": {
+			opts:       []HandlerOption{WithAcceptedRegistration(true)},
+			result:     created,
+			wantStatus: http.StatusAccepted,
+		},
+		"Given the enumeration-safe mode and a taken email": {
+			opts:       []HandlerOption{WithAcceptedRegistration(true)},
+			wantStatus: http.StatusAccepted,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockUC := new(MockAuthUseCase)
+			mockUC.On("Register", mock.Anything, registerReq.Username, string(registerReq.Email), registerReq.Password).Return(tt.result, tt.registerErr).Once()
+			router := gin.New()
+			SetupRoutes(router, NewAuthHandler(mockUC, tt.opts...))
+
+			body, _ := json.Marshal(registerReq)
+			req, _ := http.NewRequest(http.MethodPost, "/auth/register", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			if tt.wantCode != "" {
+				var resp apiError
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+				assert.Equal(t, tt.wantCode, resp.Code)
+			} else {
+				assert.Empty(t, rr.Body.String())
+			}
+			mockUC.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthHandler_Register_IdempotencyKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	send := func(router *gin.Engine, key, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, "/auth/register", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(IdempotencyKeyHeader, key)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	newRouter := func(mockUC *MockAuthUseCase) *gin.Engine {
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC, WithIdempotency(time.Minute)))
+		return router
+	}
+	body := `{"username":"test","email":"test@example.com","password":"password"}`
+
+	t.Run("Given a repeated key after success", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := newRouter(mockUC)
+		mockUC.On("Register", mock.Anything, "test", "test@example.com", "password").Return(domain.RegisterResult{}, nil).Once()
+
+		first := send(router, "key-1", body)
+		second := send(router, "key-1", body)
+
+		assert.Equal(t, http.StatusCreated, first.Code)
+		assert.Equal(t, http.StatusCreated, second.Code)
+		assert.Equal(t, "true", second.Header().Get(IdempotentReplayedHeader))
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given a repeated key after a conflict", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := newRouter(mockUC)
+		mockUC.On("Register", mock.Anything, "test", "test@example.com", "password").Return(domain.RegisterResult{}, domain.ErrEmailExists).Once()
+
+		first := send(router, "key-1", body)
+		second := send(router, "key-1", body)
+
+		assert.Equal(t, http.StatusConflict, first.Code)
+		assert.Equal(t, http.StatusConflict, second.Code)
+		assert.JSONEq(t, first.Body.String(), second.Body.String())
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given a repeated key after a server error", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := newRouter(mockUC)
+		mockUC.On("Register", mock.Anything, "test", "test@example.com", "password").Return(domain.RegisterResult{}, errors.New("db down")).Once()
+		mockUC.On("Register", mock.Anything, "test", "test@example.com", "password").Return(domain.RegisterResult{}, nil).Once()
+
+		first := send(router, "key-1", body)
+		second := send(router, "key-1", body)
+
+		assert.Equal(t, http.StatusInternalServerError, first.Code)
+		assert.Equal(t, http.StatusCreated, second.Code)
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given a key reused with a different body", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := newRouter(mockUC)
+		mockUC.On("Register", mock.Anything, "test", "test@example.com", "password").Return(domain.RegisterResult{}, nil).Once()
+
+		send(router, "key-1", body)
+		rr := send(router, "key-1", `{"username":"other","email":"other@example.com","password":"password"}`)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		mockUC.AssertExpectations(t)
+	})
+}
+
+func TestAuthHandler_Register_DryRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	send := func(handler *AuthHandler, body string) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.POST("/register", handler.Register)
+		req, _ := http.NewRequest(http.MethodPost, "/register?dry_run=true", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Given a valid payload", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("ValidateRegistration", mock.Anything, "test", "test@example.com", "password").Return(nil).Once()
+
+		rr := send(NewAuthHandler(mockUC), `{"username":"test","email":"test@example.com","password":"password"}`)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"valid":true}`, rr.Body.String())
+		mockUC.AssertNotCalled(t, "Register", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given a too short password", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("ValidateRegistration", mock.Anything, "test", "test@example.com", "short").
+			Return(&domain.PasswordLengthError{MinLength: 8, MaxBytes: 72}).Once()
+
+		rr := send(NewAuthHandler(mockUC), `{"username":"test","email":"test@example.com","password":"short"}`)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		var resp apiError
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Equal(t, domain.CodePasswordTooShort, resp.Code)
+		assert.Equal(t, "password must be at least 8 characters", resp.Error)
+		assert.Equal(t, map[string]string{"min_length": "8", "max_bytes": "72"}, resp.Details)
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given a taken email", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("ValidateRegistration", mock.Anything, "test", "taken@example.com", "password").Return(domain.ErrEmailExists).Once()
+
+		rr := send(NewAuthHandler(mockUC), `{"username":"test","email":"taken@example.com","password":"password"}`)
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Contains(t, rr.Body.String(), domain.CodeEmailExists)
+		mockUC.AssertExpectations(t)
+	})
+}
+
+func TestAuthHandler_UpdateRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	adminClaims := &jwt.Claims{UserID: 1, Role: domain.RoleAdmin}
+	userClaims := &jwt.Claims{UserID: 2, Role: domain.RoleUser}
+
+	newRequest := func(body string, token string) *http.Request {
+		req, _ := http.NewRequest(http.MethodPut, "/auth/users/42/role", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return req
+	}
+
+	t.Run("Given an admin and a valid role", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+
+		mockUC.On("Authenticate", mock.Anything, "admin-token").Return(adminClaims, nil).Once()
+		mockUC.On("UpdateRole", mock.Anything, int64(42), domain.RoleAdmin).Return(nil).Once()
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newRequest(`{"role":"admin"}`, "admin-token"))
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given an invalid role value", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+
+		mockUC.On("Authenticate", mock.Anything, "admin-token").Return(adminClaims, nil).Once()
+		mockUC.On("UpdateRole", mock.Anything, int64(42), "superuser").Return(domain.ErrInvalidRole).Once()
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newRequest(`{"role":"superuser"}`, "admin-token"))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given a non-admin caller", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+
+		mockUC.On("Authenticate", mock.Anything, "user-token").Return(userClaims, nil).Once()
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newRequest(`{"role":"admin"}`, "user-token"))
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		mockUC.AssertNotCalled(t, "UpdateRole", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Given no bearer token", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newRequest(`{"role":"admin"}`, ""))
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
+
+func TestAuthHandler_SessionExpiry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("Given a valid token in the body", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		handler := NewAuthHandler(mockUC)
+		expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+		mockUC.On("SessionExpiry", mock.Anything, "valid-token").Return(expiresAt, nil).Once()
+
+		router := gin.New()
+		router.GET("/session-expiry", handler.SessionExpiry)
+
+		req, _ := http.NewRequest(http.MethodGet, "/session-expiry", bytes.NewBufferString(`{"refresh_token":"valid-token"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"expires_at":"2030-01-02T03:04:05Z"}`, rr.Body.String())
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given a valid token in a cookie", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		handler := NewAuthHandler(mockUC)
+		expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+		mockUC.On("SessionExpiry", mock.Anything, "cookie-token").Return(expiresAt, nil).Once()
+
+		router := gin.New()
+		router.GET("/session-expiry", handler.SessionExpiry)
+
+		req, _ := http.NewRequest(http.MethodGet, "/session-expiry", nil)
+		req.AddCookie(&http.Cookie{Name: refreshTokenCookie, Value: "cookie-token"})
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		mockUC.AssertExpectations(t)
+	})
+
+	for name, token := range map[string]string{
+		"Given an expired token": "expired-token",
+		"Given an unknown token": "unknown-token",
+	} {
+		t.Run(name, func(t *testing.T) {
+			mockUC := new(MockAuthUseCase)
+			handler := NewAuthHandler(mockUC)
+			mockUC.On("SessionExpiry", mock.Anything, token).Return(time.Time{}, domain.ErrRefreshTokenNotFound).Once()
+
+			router := gin.New()
+			router.GET("/session-expiry", handler.SessionExpiry)
+
+			req, _ := http.NewRequest(http.MethodGet, "/session-expiry", bytes.NewBufferString(`{"refresh_token":"`+token+`"}`))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusNotFound, rr.Code)
+			assert.NotContains(t, rr.Body.String(), "user")
+			mockUC.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthHandler_ResendVerification(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	send := func(handler *AuthHandler, body string) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.POST("/resend-verification", handler.ResendVerification)
+		req, _ := http.NewRequest(http.MethodPost, "/resend-verification", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Given an email", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("ResendVerification", mock.Anything, "alice@example.com").Return(nil).Once()
+
+		rr := send(NewAuthHandler(mockUC), `{"email":"alice@example.com"}`)
+
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given a request within the resend interval", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("ResendVerification", mock.Anything, "alice@example.com").
+			Return(&domain.TooManyAttemptsError{RetryAfter: 45 * time.Second}).Once()
+
+		rr := send(NewAuthHandler(mockUC), `{"email":"alice@example.com"}`)
+
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Equal(t, "45", rr.Header().Get("Retry-After"))
+		assert.Contains(t, rr.Body.String(), domain.CodeTooManyAttempts)
+	})
+
+	t.Run("Given no email", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+
+		rr := send(NewAuthHandler(mockUC), `{}`)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		mockUC.AssertNotCalled(t, "ResendVerification", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthHandler_VerifyEmail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	send := func(handler *AuthHandler, body string) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.POST("/verify-email", handler.VerifyEmail)
+		req, _ := http.NewRequest(http.MethodPost, "/verify-email", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Given a valid token", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("VerifyEmail", mock.Anything, "verify-token").Return(nil).Once()
+
+		rr := send(NewAuthHandler(mockUC), `{"token":"verify-token"}`)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given an expired token", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("VerifyEmail", mock.Anything, "old-token").Return(domain.ErrTokenExpired).Once()
+
+		rr := send(NewAuthHandler(mockUC), `{"token":"old-token"}`)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
+
+func TestAuthHandler_ErrorCodes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{domain.ErrRefreshTokenNotFound, http.StatusUnauthorized},
+		{domain.ErrUserNotFound, http.StatusNotFound},
+		{&domain.TooManyAttemptsError{RetryAfter: 30 * time.Second}, http.StatusTooManyRequests},
+		{&domain.RateLimitedError{RetryAfter: time.Minute}, http.StatusTooManyRequests},
+		{fmt.Errorf("%w: consume refresh token: %w", domain.ErrServiceUnavailable, context.Canceled), http.StatusServiceUnavailable},
+		{fmt.Errorf("persist refresh token: %w", errors.New("connection reset")), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			mockUC := new(MockAuthUseCase)
+			handler := NewAuthHandler(mockUC)
+			mockUC.On("Refresh", mock.Anything, "token", mock.Anything).Return(domain.TokenPair{}, nil, tt.err).Once()
+
+			router := gin.New()
+			router.POST("/refresh", handler.Refresh)
+
+			req, _ := http.NewRequest(http.MethodPost, "/refresh", bytes.NewBufferString(`{"refresh_token":"token"}`))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.status, rr.Code)
+			var resp apiError
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Equal(t, domain.ToAPIError(tt.err).Code, resp.Code)
+			assert.NotContains(t, rr.Body.String(), "connection reset")
+		})
+	}
+}
+
+func TestAuthHandler_StepUp(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("Given the correct password", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+		mockUC.On("Authenticate", mock.Anything, "user-token").Return(&jwt.Claims{UserID: 2, Role: domain.RoleUser}, nil).Once()
+		mockUC.On("StepUp", mock.Anything, int64(2), "password").Return("step-up-token", nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/auth/step-up", bytes.NewBufferString(`{"password":"password"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer user-token")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"step_up_token":"step-up-token"}`, rr.Body.String())
+		mockUC.AssertExpectations(t)
+	})
+}
+
+func TestAuthHandler_ResourceToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for name, tt := range map[string]struct {
+		token      string
+		err        error
+		wantStatus int
+		wantBody   string
+	}{
+		"Given an authorized resource": {
+			token:      "reports-token",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"access_token":"reports-token","audience":"reports"}`,
+		},
+		"Given an unauthorized resource": {
+			err:        domain.ErrAudienceNotAllowed,
+			wantStatus: http.StatusForbidden,
+			wantBody:   `{"error":"not allowed to request tokens for this audience","code":"forbidden"}`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mockUC := new(MockAuthUseCase)
+			router := gin.New()
+			SetupRoutes(router, NewAuthHandler(mockUC))
+			mockUC.On("Authenticate", mock.Anything, "user-token").Return(&jwt.Claims{UserID: 2, Role: domain.RoleUser}, nil).Once()
+			mockUC.On("IssueResourceToken", mock.Anything, int64(2), "reports").Return(tt.token, tt.err).Once()
+
+			req, _ := http.NewRequest(http.MethodPost, "/auth/token", bytes.NewBufferString(`{"audience":"reports"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer user-token")
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.JSONEq(t, tt.wantBody, rr.Body.String())
+			mockUC.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthHandler_VerifyPassword(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for name, tt := range map[string]struct {
+		valid      bool
+		err        error
+		wantStatus int
+		wantBody   string
+	}{
+		"Given the correct password": {valid: true, wantStatus: http.StatusOK, wantBody: `{"valid":true}`},
+		"Given a wrong password":     {valid: false, wantStatus: http.StatusOK, wantBody: `{"valid":false}`},
+		"Given too many attempts": {
+			err:        domain.ErrTooManyAttempts,
+			wantStatus: http.StatusTooManyRequests,
+			wantBody:   `{"error":"too many failed attempts, try again later","code":"too_many_attempts"}`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mockUC := new(MockAuthUseCase)
+			router := gin.New()
+			SetupRoutes(router, NewAuthHandler(mockUC))
+			mockUC.On("Authenticate", mock.Anything, "user-token").Return(&jwt.Claims{UserID: 2, Role: domain.RoleUser}, nil).Once()
+			mockUC.On("VerifyPassword", mock.Anything, int64(2), "password").Return(tt.valid, tt.err).Once()
+
+			req, _ := http.NewRequest(http.MethodPost, "/auth/verify-password", bytes.NewBufferString(`{"password":"password"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer user-token")
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.JSONEq(t, tt.wantBody, rr.Body.String())
+			mockUC.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthHandler_ChangePassword(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	send := func(mockUC *MockAuthUseCase, body string) *httptest.ResponseRecorder {
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+		req, _ := http.NewRequest(http.MethodPut, "/auth/password", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer step-up-token")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Given a step-up token", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("Authenticate", mock.Anything, "step-up-token").Return(&jwt.Claims{UserID: 7, Role: domain.RoleUser, ACR: jwt.ACRStepUp}, nil).Once()
+		mockUC.On("ChangePassword", mock.Anything, int64(7), "new-password").Return(nil).Once()
+
+		rr := send(mockUC, `{"new_password":"new-password"}`)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given a change within the cooldown", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("Authenticate", mock.Anything, "step-up-token").Return(&jwt.Claims{UserID: 7, Role: domain.RoleUser, ACR: jwt.ACRStepUp}, nil).Once()
+		mockUC.On("ChangePassword", mock.Anything, int64(7), "new-password").Return(domain.ErrPasswordChangeTooSoon).Once()
+
+		rr := send(mockUC, `{"new_password":"new-password"}`)
+
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Contains(t, rr.Body.String(), domain.CodePasswordChangeTooSoon)
+	})
+
+	t.Run("Given a regular access token", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("Authenticate", mock.Anything, "step-up-token").Return(&jwt.Claims{UserID: 7, Role: domain.RoleUser}, nil).Once()
+
+		rr := send(mockUC, `{"new_password":"new-password"}`)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		mockUC.AssertNotCalled(t, "ChangePassword", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthHandler_Sessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("Given a login with a device name", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+		client := domain.ClientInfo{DeviceName: "Work laptop", IP: "192.0.2.1", UserAgent: "curl/8.5.0"}
+		mockUC.On("Login", mock.Anything, "test@example.com", "password", client).
+			Return(domain.TokenPair{AccessToken: "a", RefreshToken: "r"}, nil, nil).Once()
+
+		body := `{"email":"test@example.com","password":"password","device_name":"Work laptop"}`
+		req, _ := http.NewRequest(http.MethodPost, "/auth/login", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "curl/8.5.0")
+		req.RemoteAddr = "192.0.2.1:1234"
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given an authenticated user", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+		mockUC.On("Authenticate", mock.Anything, "token").Return(&jwt.Claims{UserID: 7, Role: domain.RoleUser}, nil).Once()
+		mockUC.On("ListSessions", mock.Anything, int64(7)).Return([]domain.Session{{ID: 3, DeviceName: "Work laptop"}}, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/auth/sessions", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var resp sessionsResp
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Len(t, resp.Sessions, 1)
+		assert.Equal(t, "Work laptop", resp.Sessions[0].DeviceName)
+	})
+}
+
+func TestAuthHandler_Logout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("Given an access token with a session", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+		mockUC.On("Authenticate", mock.Anything, "token").Return(&jwt.Claims{UserID: 7, Role: domain.RoleUser, SessionID: 3}, nil).Once()
+		mockUC.On("Logout", mock.Anything, int64(7), int64(3), "").Return(nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/auth/logout", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given a refresh token in the body", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+		mockUC.On("Authenticate", mock.Anything, "token").Return(&jwt.Claims{UserID: 7, Role: domain.RoleUser}, nil).Once()
+		mockUC.On("Logout", mock.Anything, int64(7), int64(0), "refresh-jwt").Return(nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/auth/logout", bytes.NewBufferString(`{"refresh_token":"refresh-jwt"}`))
+		req.Header.Set("Authorization", "Bearer token")
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given no access token", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+
+		req, _ := http.NewRequest(http.MethodPost, "/auth/logout", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		mockUC.AssertNotCalled(t, "Logout", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthHandler_RevokeSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for name, tt := range map[string]struct {
+		path       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		"Given one of the caller's sessions": {path: "/auth/sessions/3", wantStatus: http.StatusNoContent},
+		"Given another user's session":       {path: "/auth/sessions/3", err: domain.ErrSessionNotOwned, wantStatus: http.StatusForbidden, wantCode: domain.CodeForbidden},
+		"Given an unknown session":           {path: "/auth/sessions/3", err: domain.ErrSessionNotFound, wantStatus: http.StatusNotFound, wantCode: domain.CodeNotFound},
+		"Given a malformed session id":       {path: "/auth/sessions/abc", wantStatus: http.StatusBadRequest, wantCode: domain.CodeInvalidRequest},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mockUC := new(MockAuthUseCase)
+			router := gin.New()
+			SetupRoutes(router, NewAuthHandler(mockUC))
+			mockUC.On("Authenticate", mock.Anything, "token").Return(&jwt.Claims{UserID: 7, Role: domain.RoleUser}, nil).Once()
+			if tt.wantCode != domain.CodeInvalidRequest {
+				mockUC.On("RevokeSession", mock.Anything, int64(7), int64(3)).Return(tt.err).Once()
+			}
+
+			req, _ := http.NewRequest(http.MethodDelete, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer token")
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			if tt.wantCode != "" {
+				var resp apiError
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+				assert.Equal(t, tt.wantCode, resp.Code)
+			}
+			mockUC.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthHandler_ExportData(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("Given an authenticated user", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+		mockUC.On("Authenticate", mock.Anything, "token").Return(&jwt.Claims{UserID: 7, Role: domain.RoleUser}, nil).Once()
+		mockUC.On("ExportUserData", mock.Anything, int64(7)).Return(domain.UserExport{
+			User:       domain.ExportedUser{ID: 7, Email: "alice@example.com"},
+			Sessions:   []domain.Session{{ID: 3, UserID: 7}},
+			AuthEvents: []domain.AuthEvent{{ID: 1, UserID: 7, Type: domain.EventUserLogin}},
+		}, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/auth/me/export", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var resp map[string]json.RawMessage
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Contains(t, resp, "user")
+		assert.Contains(t, resp, "sessions")
+		assert.Contains(t, resp, "auth_events")
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given no access token", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+
+		req, _ := http.NewRequest(http.MethodGet, "/auth/me/export", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		mockUC.AssertNotCalled(t, "ExportUserData", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthHandler_DeleteAccount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for name, tt := range map[string]struct {
+		claims     *jwt.Claims
+		path       string
+		err        error
+		wantStatus int
+	}{
+		"Given a step-up token and hard=true": {
+			claims: &jwt.Claims{UserID: 7, Role: domain.RoleUser, ACR: jwt.ACRStepUp}, path: "/auth/me?hard=true", wantStatus: http.StatusNoContent,
+		},
+		"Given a plain access token": {
+			claims: &jwt.Claims{UserID: 7, Role: domain.RoleUser}, path: "/auth/me?hard=true", wantStatus: http.StatusForbidden,
+		},
+		"Given no hard flag": {
+			claims: &jwt.Claims{UserID: 7, Role: domain.RoleUser, ACR: jwt.ACRStepUp}, path: "/auth/me", wantStatus: http.StatusBadRequest,
+		},
+		"Given a user that is already gone": {
+			claims: &jwt.Claims{UserID: 7, Role: domain.RoleUser, ACR: jwt.ACRStepUp}, path: "/auth/me?hard=true", err: domain.ErrUserNotFound, wantStatus: http.StatusNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mockUC := new(MockAuthUseCase)
+			router := gin.New()
+			SetupRoutes(router, NewAuthHandler(mockUC))
+			mockUC.On("Authenticate", mock.Anything, "token").Return(tt.claims, nil).Once()
+			if tt.wantStatus == http.StatusNoContent || tt.err != nil {
+				mockUC.On("DeleteAccount", mock.Anything, int64(7)).Return(tt.err).Once()
+			}
+
+			req, _ := http.NewRequest(http.MethodDelete, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer token")
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			mockUC.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthMiddleware_IdentityHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var gotID, gotRole string
+	newRouter := func(mockUC *MockAuthUseCase) *gin.Engine {
+		router := gin.New()
+		router.GET("/me", AuthMiddleware(mockUC), func(c *gin.Context) {
+			gotID, gotRole = c.GetHeader(UserIDHeader), c.GetHeader(UserRoleHeader)
+			c.Status(http.StatusNoContent)
+		})
+		return router
+	}
+
+	t.Run("Given spoofed identity headers", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("Authenticate", mock.Anything, "token").Return(&jwt.Claims{UserID: 7, Role: domain.RoleUser}, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		req.Header.Set(UserIDHeader, "1")
+		req.Header.Add(UserIDHeader, "2")
+		req.Header.Set(UserRoleHeader, domain.RoleAdmin)
+		rr := httptest.NewRecorder()
+
+		newRouter(mockUC).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Equal(t, "7", gotID)
+		assert.Equal(t, domain.RoleUser, gotRole)
+		assert.Equal(t, []string{"7"}, req.Header.Values(UserIDHeader))
+	})
+}
+
+func TestAuthMiddleware_Actor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockUC := new(MockAuthUseCase)
+	handler := NewAuthHandler(mockUC)
+	router := gin.New()
+	router.PUT("/users/:id/role", AuthMiddleware(mockUC), handler.UpdateRole)
+
+	mockUC.On("Authenticate", mock.Anything, "token").Return(&jwt.Claims{UserID: 1, Role: domain.RoleAdmin}, nil).Once()
+	actedByAdmin := mock.MatchedBy(func(ctx context.Context) bool {
+		actor, ok := domain.ActorFromContext(ctx)
+		return ok && actor == domain.Actor{UserID: 1, Role: domain.RoleAdmin}
+	})
+	mockUC.On("UpdateRole", actedByAdmin, int64(42), domain.RoleAdmin).Return(nil).Once()
+
+	req, _ := http.NewRequest(http.MethodPut, "/users/42/role", bytes.NewBufferString(`{"role":"admin"}`))
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	mockUC.AssertExpectations(t)
+}
+
+func TestAuthMiddleware_QueryToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var gotURI string
+	newRouter := func(mockUC *MockAuthUseCase, enabled bool) *gin.Engine {
+		router := gin.New()
+		router.GET("/events", AuthMiddleware(mockUC, WithQueryToken(enabled)), func(c *gin.Context) {
+			gotURI = c.Request.RequestURI
+			c.String(http.StatusOK, c.GetHeader(UserIDHeader))
+		})
+		return router
+	}
+	send := func(router *gin.Engine, url, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Given a query token", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("Authenticate", mock.Anything, "query-token").Return(&jwt.Claims{UserID: 7, Role: domain.RoleUser}, nil).Once()
+
+		rr := send(newRouter(mockUC, true), "/events?topic=news&access_token=query-token", "")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "7", rr.Body.String())
+		assert.Equal(t, "/events?topic=news", gotURI, "the token must not stay in the URL")
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given an invalid query token", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("Authenticate", mock.Anything, "query-token").Return(nil, domain.ErrInvalidToken).Once()
+
+		rr := send(newRouter(mockUC, true), "/events?access_token=query-token", "")
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Contains(t, rr.Body.String(), domain.CodeInvalidToken)
+	})
+
+	t.Run("Given both a header and a query token", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("Authenticate", mock.Anything, "header-token").Return(&jwt.Claims{UserID: 8, Role: domain.RoleUser}, nil).Once()
+
+		rr := send(newRouter(mockUC, true), "/events?access_token=query-token", "Bearer header-token")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "8", rr.Body.String())
+		mockUC.AssertNotCalled(t, "Authenticate", mock.Anything, "query-token")
+	})
+
+	t.Run("Given a malformed header and a query token", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+
+		rr := send(newRouter(mockUC, true), "/events?access_token=query-token", "Basic Zm9vOmJhcg==")
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		mockUC.AssertNotCalled(t, "Authenticate", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Given a query token while disabled", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+
+		rr := send(newRouter(mockUC, false), "/events?access_token=query-token", "")
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		mockUC.AssertNotCalled(t, "Authenticate", mock.Anything, mock.Anything)
+	})
+}
+
+func TestRequireStepUp(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for name, tt := range map[string]struct {
+		claims *jwt.Claims
+		status int
+	}{
+		"Given a normal access token": {&jwt.Claims{UserID: 2, Role: domain.RoleUser}, http.StatusForbidden},
+		"Given a step-up token":       {&jwt.Claims{UserID: 2, Role: domain.RoleUser, ACR: jwt.ACRStepUp}, http.StatusNoContent},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mockUC := new(MockAuthUseCase)
+			mockUC.On("Authenticate", mock.Anything, "token").Return(tt.claims, nil).Once()
+
+			router := gin.New()
+			router.POST("/sensitive", AuthMiddleware(mockUC), RequireStepUp(), func(c *gin.Context) {
+				c.Status(http.StatusNoContent)
+			})
+
+			req, _ := http.NewRequest(http.MethodPost, "/sensitive", nil)
+			req.Header.Set("Authorization", "Bearer token")
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.status, rr.Code)
+			if tt.status == http.StatusForbidden {
+				assert.Contains(t, rr.Body.String(), domain.CodeStepUpRequired)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_AuthEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(mockUC *MockAuthUseCase) *gin.Engine {
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+		mockUC.On("Authenticate", mock.Anything, "admin-token").Return(&jwt.Claims{UserID: 1, Role: domain.RoleAdmin}, nil).Once()
+		return router
+	}
+
+	t.Run("Given filters and an oversized limit", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := newRouter(mockUC)
+		success := false
+		want := domain.AuthEventFilter{
+			UserID:  7,
+			Type:    domain.EventUserLogin,
+			Success: &success,
+			From:    time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+			Limit:   1000,
+			Offset:  20,
+		}
+		mockUC.On("ListAuthEvents", mock.Anything, want).Return([]domain.AuthEvent{}, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/auth/audit-events?user_id=7&type=user.login&success=false&from=2030-01-01T00:00:00Z&limit=1000&offset=20", nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"events":[],"limit":200,"offset":20}`, rr.Body.String())
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given a malformed time", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := newRouter(mockUC)
+
+		req, _ := http.NewRequest(http.MethodGet, "/auth/audit-events?from=yesterday", nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		mockUC.AssertNotCalled(t, "ListAuthEvents", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthHandler_DormantUsers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(mockUC *MockAuthUseCase) *gin.Engine {
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+		mockUC.On("Authenticate", mock.Anything, "admin-token").Return(&jwt.Claims{UserID: 1, Role: domain.RoleAdmin}, nil).Once()
+		return router
+	}
+
+	t.Run("Given a number of days", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := newRouter(mockUC)
+		createdAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+		users := []domain.User{{ID: 2, Username: "old", Email: "old@example.com", PasswordHash: "hash", CreatedAt: createdAt}}
+		mockUC.On("ListDormantUsers", mock.Anything, 90*24*time.Hour).Return(users, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/auth/users/dormant?days=90", nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"users":[{"id":2,"username":"old","email":"old@example.com","created_at":"2030-01-01T00:00:00Z","last_login_at":null}]}`, rr.Body.String())
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given no days", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := newRouter(mockUC)
+
+		req, _ := http.NewRequest(http.MethodGet, "/auth/users/dormant", nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		mockUC.AssertNotCalled(t, "ListDormantUsers", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Given a deactivation request", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := newRouter(mockUC)
+		mockUC.On("DeactivateDormantUsers", mock.Anything, 30*24*time.Hour).Return(3, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/auth/users/dormant/deactivate?days=30", nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"deactivated":3}`, rr.Body.String())
+		mockUC.AssertExpectations(t)
+	})
+}
+
+func TestAuthHandler_UserCount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	send := func(mockUC *MockAuthUseCase, role string) *httptest.ResponseRecorder {
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+		mockUC.On("Authenticate", mock.Anything, "token").Return(&jwt.Claims{UserID: 1, Role: role}, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/auth/users/count", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Given an admin", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("CountUsers", mock.Anything).Return(int64(3), nil).Once()
+
+		rr := send(mockUC, domain.RoleAdmin)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"count":3}`, rr.Body.String())
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given a regular user", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+
+		rr := send(mockUC, domain.RoleUser)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		mockUC.AssertNotCalled(t, "CountUsers", mock.Anything)
+	})
+
+	t.Run("Given the count fails", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("CountUsers", mock.Anything).Return(int64(0), errors.New("db down")).Once()
+
+		rr := send(mockUC, domain.RoleAdmin)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+func TestAuthHandler_UserByEmail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	adminClaims := &jwt.Claims{UserID: 1, Role: domain.RoleAdmin}
+	newRequest := func(email, token string) *http.Request {
+		req, _ := http.NewRequest(http.MethodGet, "/auth/users/by-email?email="+email, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req
+	}
+
+	t.Run("Given an existing user", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+		createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		mockUC.On("Authenticate", mock.Anything, "admin-token").Return(adminClaims, nil).Once()
+		mockUC.On("GetUserByEmail", mock.Anything, "alice@example.com").Return(&domain.User{
+			ID: 7, Username: "alice", Email: "alice@example.com", PasswordHash: "hash", Role: domain.RoleUser, CreatedAt: createdAt,
+		}, nil).Once()
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newRequest("alice@example.com", "admin-token"))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"id":7,"username":"alice","email":"alice@example.com","role":"user",
+			"created_at":"2024-05-01T12:00:00Z","last_login_at":null,"disabled_at":null}`, rr.Body.String())
+		assert.NotContains(t, rr.Body.String(), "hash")
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given an unknown email", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+		mockUC.On("Authenticate", mock.Anything, "admin-token").Return(adminClaims, nil).Once()
+		mockUC.On("GetUserByEmail", mock.Anything, "nobody@example.com").Return(nil, domain.ErrUserNotFound).Once()
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newRequest("nobody@example.com", "admin-token"))
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.JSONEq(t, `{"error":"user not found","code":"user_not_found"}`, rr.Body.String())
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given no email", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+		mockUC.On("Authenticate", mock.Anything, "admin-token").Return(adminClaims, nil).Once()
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newRequest("", "admin-token"))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		mockUC.AssertNotCalled(t, "GetUserByEmail", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Given a non-admin caller", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+		mockUC.On("Authenticate", mock.Anything, "user-token").Return(&jwt.Claims{UserID: 2, Role: domain.RoleUser}, nil).Once()
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newRequest("alice@example.com", "user-token"))
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		mockUC.AssertNotCalled(t, "GetUserByEmail", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Given an admin over the lookup limit", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC, WithUserLookupLimit(2, time.Minute)))
+		mockUC.On("Authenticate", mock.Anything, "admin-token").Return(adminClaims, nil).Times(3)
+		mockUC.On("GetUserByEmail", mock.Anything, "alice@example.com").Return(nil, domain.ErrUserNotFound).Twice()
+
+		for range 2 {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, newRequest("alice@example.com", "admin-token"))
+			assert.Equal(t, http.StatusNotFound, rr.Code)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newRequest("alice@example.com", "admin-token"))
+
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Equal(t, "60", rr.Header().Get("Retry-After"))
+		assert.JSONEq(t, `{"error":"too many requests, try again later","code":"rate_limited","retry_after":60}`, rr.Body.String())
+		mockUC.AssertExpectations(t)
+	})
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	SetupRoutes(router, NewAuthHandler(new(MockAuthUseCase)))
+
+	req, _ := http.NewRequest(http.MethodGet, "/openapi.json", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var spec struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &spec))
+	assert.NotEmpty(t, spec.OpenAPI)
+	for _, path := range []string{"/auth/register", "/auth/login", "/auth/refresh"} {
+		assert.Contains(t, spec.Paths, path)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/docs", nil)
+	rr = httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "/openapi.json")
+}
+
+type stubCleanupStatus struct {
+	status domain.CleanupStatus
+}
+
+func (s stubCleanupStatus) Status() domain.CleanupStatus {
+	return s.status
+}
+
+func TestAuthHandler_RotateKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	send := func(mockUC *MockAuthUseCase, body string) *httptest.ResponseRecorder {
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+		req, _ := http.NewRequest(http.MethodPost, "/auth/rotate-key", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer token")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Given an admin with a step-up token and no secret", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("Authenticate", mock.Anything, "token").Return(&jwt.Claims{UserID: 1, Role: domain.RoleAdmin, ACR: jwt.ACRStepUp}, nil).Once()
+		mockUC.On("RotateSigningKey", mock.Anything, "").Return(nil).Once()
+
+		rr := send(mockUC, "")
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Empty(t, rr.Body.String(), "a generated secret must not be sent back")
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given a weak secret", func(t *testing.T) {
+		secret := strings.Repeat("a", 32)
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("Authenticate", mock.Anything, "token").Return(&jwt.Claims{UserID: 1, Role: domain.RoleAdmin, ACR: jwt.ACRStepUp}, nil).Once()
+		mockUC.On("RotateSigningKey", mock.Anything, secret).Return(&domain.APIError{
+			Code:    domain.CodeInvalidRequest,
+			Message: "signing secret is too predictable",
+		}).Once()
+
+		rr := send(mockUC, `{"secret":"`+secret+`"}`)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), domain.CodeInvalidRequest)
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given an admin with a step-up token and a secret", func(t *testing.T) {
+		secret := strings.Repeat("k", 32)
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("Authenticate", mock.Anything, "token").Return(&jwt.Claims{UserID: 1, Role: domain.RoleAdmin, ACR: jwt.ACRStepUp}, nil).Once()
+		mockUC.On("RotateSigningKey", mock.Anything, secret).Return(nil).Once()
+
+		rr := send(mockUC, `{"secret":"`+secret+`"}`)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Empty(t, rr.Body.String(), "the secret must not be echoed")
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given a short secret", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("Authenticate", mock.Anything, "token").Return(&jwt.Claims{UserID: 1, Role: domain.RoleAdmin, ACR: jwt.ACRStepUp}, nil).Once()
+
+		rr := send(mockUC, `{"secret":"short"}`)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		mockUC.AssertNotCalled(t, "RotateSigningKey", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Given an admin without a step-up token", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("Authenticate", mock.Anything, "token").Return(&jwt.Claims{UserID: 1, Role: domain.RoleAdmin}, nil).Once()
+
+		rr := send(mockUC, "")
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), domain.CodeStepUpRequired)
+		mockUC.AssertNotCalled(t, "RotateSigningKey", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Given a user with a step-up token", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		mockUC.On("Authenticate", mock.Anything, "token").Return(&jwt.Claims{UserID: 2, Role: domain.RoleUser, ACR: jwt.ACRStepUp}, nil).Once()
+
+		rr := send(mockUC, "")
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), domain.CodeForbidden)
+		mockUC.AssertNotCalled(t, "RotateSigningKey", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthHandler_CleanupStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockUC := new(MockAuthUseCase)
+	lastRun := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	handler := NewAuthHandler(mockUC, WithCleanupStatus(stubCleanupStatus{
+		status: domain.CleanupStatus{LastRun: lastRun, DeletedLastRun: 7},
+	}))
+	router := gin.New()
+	SetupRoutes(router, handler)
+	mockUC.On("Authenticate", mock.Anything, "admin-token").Return(&jwt.Claims{UserID: 1, Role: domain.RoleAdmin}, nil).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "/auth/cleanup-status", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"last_run":"2030-01-02T03:04:05Z","deleted_last_run":7}`, rr.Body.String())
 }
@@ -0,0 +1,167 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// IdempotencyKeyHeader lets a client mark retries of the same request.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed from the store.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// idempotencyStore remembers responses by Idempotency-Key for ttl so a
+// retried request replays the original outcome instead of running again.
+// Entries live in memory, so replays only work against the same instance.
+type idempotencyStore struct {
+	ttl       time.Duration
+	mu        sync.Mutex
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+}
+
+type idempotencyEntry struct {
+	fingerprint [sha256.Size]byte
+	// done is closed once the first request with the key has responded.
+	done        chan struct{}
+	status      int
+	contentType string
+	body        []byte
+	expiresAt   time.Time
+}
+
+func newIdempotencyStore(ttl time.Duration) *idempotencyStore {
+	return &idempotencyStore{ttl: ttl, entries: make(map[string]*idempotencyEntry)}
+}
+
+// begin returns the entry for key, creating it if there is none or it has
+// expired. owner reports whether the caller created it and must finish it.
+func (s *idempotencyStore) begin(key string, fingerprint [sha256.Size]byte) (entry *idempotencyEntry, owner bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > s.ttl {
+		for k, e := range s.entries {
+			if e.expired(now) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if e, ok := s.entries[key]; ok && !e.expired(now) {
+		return e, false
+	}
+	e := &idempotencyEntry{fingerprint: fingerprint, done: make(chan struct{})}
+	s.entries[key] = e
+	return e, true
+}
+
+// finish records the response of the request that owns entry. Server errors
+// are handed to requests already waiting but not kept, so a later retry runs
+// again.
+func (s *idempotencyStore) finish(key string, e *idempotencyEntry, status int, contentType string, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e.status, e.contentType, e.body = status, contentType, body
+	e.expiresAt = time.Now().Add(s.ttl)
+	if status >= http.StatusInternalServerError {
+		delete(s.entries, key)
+	}
+	close(e.done)
+}
+
+func (e *idempotencyEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
+
+// recordingWriter keeps a copy of the response body.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// middleware replays the stored response for a known Idempotency-Key. A
+// request that arrives while the first one with its key is still running
+// waits for it. Reusing a key with a different body is rejected. Requests
+// without the header pass through untouched.
+func (s *idempotencyStore) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, invalidRequest("idempotency key is too long"))
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, invalidRequest("invalid request body"))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		fingerprint := sha256.Sum256(body)
+
+		entry, owner := s.begin(key, fingerprint)
+		if !owner {
+			if entry.fingerprint != fingerprint {
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, invalidRequest("idempotency key was used with a different request"))
+				return
+			}
+			select {
+			case <-entry.done:
+			case <-c.Request.Context().Done():
+				c.Abort()
+				return
+			}
+			c.Header(IdempotentReplayedHeader, "true")
+			c.Data(entry.status, entry.contentType, entry.body)
+			c.Abort()
+			return
+		}
+
+		w := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		defer func() {
+			if r := recover(); r != nil {
+				s.finish(key, entry, http.StatusInternalServerError, "", nil)
+				panic(r)
+			}
+			s.finish(key, entry, w.Status(), w.Header().Get("Content-Type"), w.body.Bytes())
+		}()
+		c.Next()
+	}
+}
+
+// idempotent applies the handler's idempotency store, if any.
+func (h *AuthHandler) idempotent() gin.HandlerFunc {
+	if h.idempotency == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return h.idempotency.middleware()
+}
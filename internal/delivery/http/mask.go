@@ -0,0 +1,32 @@
+package http
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaskEmail hides all of email's local part but its first character, e.g.
+// j***@example.com. Input without a local part and domain is masked whole.
+func MaskEmail(email string) string {
+	at := strings.LastIndexByte(email, '@')
+	if at <= 0 || at == len(email)-1 {
+		return "***"
+	}
+	_, size := utf8.DecodeRuneInString(email)
+	return email[:size] + "***" + email[at:]
+}
+
+// visibleEmail is email, the address of user ownerID, as the caller may see
+// it: masked under WithEmailMasking unless the caller owns the account or is
+// a super-admin.
+func (h *AuthHandler) visibleEmail(c *gin.Context, ownerID int64, email string) string {
+	if !h.maskEmails || email == "" {
+		return email
+	}
+	if claims, ok := claimsFromContext(c); ok && (claims.UserID == ownerID || h.superAdmins[claims.UserID]) {
+		return email
+	}
+	return MaskEmail(email)
+}
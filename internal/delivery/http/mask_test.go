@@ -0,0 +1,112 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/Kovalyovv/auth-service/internal/pkg/jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestMaskEmail(t *testing.T) {
+	tests := map[string]struct {
+		email string
+		want  string
+	}{
+		"Given an address":                  {email: "john@example.com", want: "j***@example.com"},
+		"Given a one-letter local part":     {email: "j@example.com", want: "j***@example.com"},
+		"Given a multibyte first letter":    {email: "ёжик@example.com", want: "ё***@example.com"},
+		"Given an @ in a quoted local part": {email: `"a@b"@example.com`, want: `"***@example.com`},
+		"Given no local part":               {email: "@example.com", want: "***"},
+		"Given no domain":                   {email: "john@", want: "***"},
+		"Given no @":                        {email: "john", want: "***"},
+		"Given an empty string":             {email: "", want: "***"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.want, MaskEmail(tt.email))
+		})
+	}
+}
+
+func TestAuthHandler_EmailMasking(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	users := []domain.User{
+		{ID: 1, Username: "admin", Email: "admin@example.com"},
+		{ID: 2, Username: "old", Email: "old@example.com"},
+	}
+	listDormant := func(callerID int64, opts ...HandlerOption) []dormantUser {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC, opts...))
+		mockUC.On("Authenticate", mock.Anything, "admin-token").Return(&jwt.Claims{UserID: callerID, Role: domain.RoleAdmin}, nil).Once()
+		mockUC.On("ListDormantUsers", mock.Anything, 90*24*time.Hour).Return(users, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/auth/users/dormant?days=90", nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var resp dormantUsersResp
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		mockUC.AssertExpectations(t)
+		return resp.Users
+	}
+	emails := func(users []dormantUser) []string {
+		var out []string
+		for _, u := range users {
+			out = append(out, u.Email)
+		}
+		return out
+	}
+
+	t.Run("Given masking is off", func(t *testing.T) {
+		got := listDormant(1)
+
+		assert.Equal(t, []string{"admin@example.com", "old@example.com"}, emails(got))
+	})
+
+	t.Run("Given an admin with masking on", func(t *testing.T) {
+		got := listDormant(1, WithEmailMasking(true))
+
+		assert.Equal(t, []string{"admin@example.com", "o***@example.com"}, emails(got))
+	})
+
+	t.Run("Given a super-admin with masking on", func(t *testing.T) {
+		got := listDormant(9, WithEmailMasking(true, 9))
+
+		assert.Equal(t, []string{"admin@example.com", "old@example.com"}, emails(got))
+	})
+
+	t.Run("Given an admin listing audit events with masking on", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC, WithEmailMasking(true, 9)))
+		mockUC.On("Authenticate", mock.Anything, "admin-token").Return(&jwt.Claims{UserID: 1, Role: domain.RoleAdmin}, nil).Once()
+		mockUC.On("ListAuthEvents", mock.Anything, mock.Anything).Return([]domain.AuthEvent{
+			{ID: 1, UserID: 1, Email: "admin@example.com", Type: domain.EventUserLogin},
+			{ID: 2, Email: "unknown@example.com", Type: domain.EventUserLogin},
+		}, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/auth/audit-events", nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var resp authEventsResp
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		if assert.Len(t, resp.Events, 2) {
+			assert.Equal(t, "admin@example.com", resp.Events[0].Email)
+			assert.Equal(t, "u***@example.com", resp.Events[1].Email)
+		}
+		mockUC.AssertExpectations(t)
+	})
+}
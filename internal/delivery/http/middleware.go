@@ -0,0 +1,191 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/Kovalyovv/auth-service/internal/pkg/jwt"
+	"github.com/gin-gonic/gin"
+)
+
+const claimsKey = "claims"
+
+// Identity headers carry the authenticated user to handlers and proxied
+// upstreams. AuthMiddleware sets them from the verified token and drops any
+// value the client sent, so their presence can be trusted.
+const (
+	UserIDHeader   = "X-User-ID"
+	UserRoleHeader = "X-User-Role"
+)
+
+// AccessTokenQueryParam carries the access token for clients that cannot set
+// headers, such as browser EventSource and WebSocket.
+const AccessTokenQueryParam = "access_token"
+
+type TokenAuthenticator interface {
+	Authenticate(ctx context.Context, token string) (*jwt.Claims, error)
+}
+
+type authMiddlewareConfig struct {
+	queryToken bool
+}
+
+// AuthMiddlewareOption configures AuthMiddleware.
+type AuthMiddlewareOption func(*authMiddlewareConfig)
+
+// WithQueryToken lets requests without an Authorization header authenticate
+// with the AccessTokenQueryParam query parameter instead. The token is
+// validated exactly like a bearer token.
+func WithQueryToken(enabled bool) AuthMiddlewareOption {
+	return func(cfg *authMiddlewareConfig) {
+		cfg.queryToken = enabled
+	}
+}
+
+// AuthMiddleware requires a valid bearer access token and stores its claims
+// in the gin context for downstream handlers. It also sets UserIDHeader and
+// UserRoleHeader on the request, and the caller as the domain.Actor of the
+// request context, so usecases can tell who acted.
+func AuthMiddleware(auth TokenAuthenticator, opts ...AuthMiddlewareOption) gin.HandlerFunc {
+	var cfg authMiddlewareConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return func(c *gin.Context) {
+		c.Request.Header.Del(UserIDHeader)
+		c.Request.Header.Del(UserRoleHeader)
+		queryToken := takeQueryToken(c.Request)
+
+		header := c.GetHeader("Authorization")
+		token, ok := bearerToken(header)
+		if header == "" && cfg.queryToken {
+			token, ok = queryToken, queryToken != ""
+		}
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, apiError{Error: "missing or malformed bearer token", Code: domain.CodeUnauthenticated})
+			return
+		}
+
+		claims, err := auth.Authenticate(c.Request.Context(), token)
+		if err != nil {
+			apiErr := domain.ToAPIError(err)
+			if apiErr.Code != domain.CodeTokenExpired && apiErr.Code != domain.CodeServiceUnavailable {
+				apiErr = &domain.APIError{Code: domain.CodeInvalidToken, Message: domain.ErrInvalidToken.Error()}
+			}
+			c.AbortWithStatusJSON(httpStatus(apiErr.Code), newAPIError(apiErr))
+			return
+		}
+
+		c.Set(claimsKey, claims)
+		c.Request = c.Request.WithContext(domain.WithActor(c.Request.Context(), domain.Actor{UserID: claims.UserID, Role: claims.Role}))
+		c.Request.Header.Set(UserIDHeader, strconv.FormatInt(claims.UserID, 10))
+		c.Request.Header.Set(UserRoleHeader, claims.Role)
+		c.Next()
+	}
+}
+
+// RejectAuthenticated aborts requests that carry a valid bearer access token
+// with 409 and domain.ErrAlreadyAuthenticated. Requests without a token, or
+// with one that does not authenticate, pass through.
+func RejectAuthenticated(auth TokenAuthenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok {
+			c.Next()
+			return
+		}
+		if _, err := auth.Authenticate(c.Request.Context(), token); err != nil {
+			c.Next()
+			return
+		}
+		apiErr := domain.ToAPIError(domain.ErrAlreadyAuthenticated)
+		c.AbortWithStatusJSON(httpStatus(apiErr.Code), newAPIError(apiErr))
+	}
+}
+
+// RequireRole rejects requests whose access token does not carry one of roles.
+// It must run after AuthMiddleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := claimsFromContext(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, apiError{Error: "unauthenticated", Code: domain.CodeUnauthenticated})
+			return
+		}
+
+		for _, role := range roles {
+			if claims.Role == role {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, apiError{Error: "insufficient permissions", Code: domain.CodeForbidden})
+	}
+}
+
+// RequireStepUp guards sensitive routes: the bearer token must be a step-up
+// token obtained by re-entering the password. It must run after
+// AuthMiddleware.
+func RequireStepUp() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := claimsFromContext(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, apiError{Error: "unauthenticated", Code: domain.CodeUnauthenticated})
+			return
+		}
+		if claims.ACR != jwt.ACRStepUp {
+			c.AbortWithStatusJSON(http.StatusForbidden, newAPIError(domain.ToAPIError(domain.ErrStepUpRequired)))
+			return
+		}
+		c.Next()
+	}
+}
+
+func claimsFromContext(c *gin.Context) (*jwt.Claims, bool) {
+	v, ok := c.Get(claimsKey)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := v.(*jwt.Claims)
+	return claims, ok
+}
+
+// takeQueryToken removes AccessTokenQueryParam from r's URL and returns its
+// value, so the token cannot end up in logs or traces that record the URL.
+func takeQueryToken(r *http.Request) string {
+	query := r.URL.Query()
+	if !query.Has(AccessTokenQueryParam) {
+		return ""
+	}
+	token := query.Get(AccessTokenQueryParam)
+	query.Del(AccessTokenQueryParam)
+	r.URL.RawQuery = query.Encode()
+	r.RequestURI = r.URL.RequestURI()
+	return token
+}
+
+func bearerToken(header string) (string, bool) {
+	return schemeToken(header, "Bearer")
+}
+
+// hasScheme reports whether an Authorization header uses scheme, whether or
+// not it carries credentials.
+func hasScheme(header, scheme string) bool {
+	s, _, _ := strings.Cut(header, " ")
+	return strings.EqualFold(s, scheme)
+}
+
+// schemeToken returns the credentials of an Authorization header using
+// scheme, which is matched case-insensitively.
+func schemeToken(header, scheme string) (string, bool) {
+	s, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(s, scheme) {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
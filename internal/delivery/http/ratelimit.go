@@ -0,0 +1,84 @@
+package http
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimiter admits at most limit requests per key in fixed windows. It
+// keeps state in memory, so each instance counts on its own. A nil limiter
+// admits everything.
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	windows   map[string]*rateWindow
+	lastSweep time.Time
+}
+
+type rateWindow struct {
+	requests int
+	resetAt  time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	if limit <= 0 || window <= 0 {
+		return nil
+	}
+	return &rateLimiter{limit: limit, window: window, now: time.Now, windows: make(map[string]*rateWindow)}
+}
+
+// allow counts a request by key and reports whether it is within the limit.
+// If not, retryAfter is how long until the key's window ends.
+func (l *rateLimiter) allow(key string) (retryAfter time.Duration, ok bool) {
+	if l == nil {
+		return 0, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) > l.window {
+		for k, w := range l.windows {
+			if !now.Before(w.resetAt) {
+				delete(l.windows, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	w, ok := l.windows[key]
+	if !ok || !now.Before(w.resetAt) {
+		w = &rateWindow{resetAt: now.Add(l.window)}
+		l.windows[key] = w
+	}
+	if w.requests >= l.limit {
+		return w.resetAt.Sub(now), false
+	}
+	w.requests++
+	return 0, true
+}
+
+// rateLimit rejects requests with 429 rate_limited once the caller used up
+// l. Authenticated callers are counted by user, others by client IP.
+func rateLimit(l *rateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := "ip:" + c.ClientIP()
+		if claims, ok := claimsFromContext(c); ok {
+			key = "user:" + strconv.FormatInt(claims.UserID, 10)
+		}
+		if wait, ok := l.allow(key); !ok {
+			apiErr := domain.ToAPIError(&domain.RateLimitedError{RetryAfter: wait})
+			c.Header("Retry-After", strconv.Itoa(apiErr.RetryAfter))
+			c.AbortWithStatusJSON(httpStatus(apiErr.Code), newAPIError(apiErr))
+			return
+		}
+		c.Next()
+	}
+}
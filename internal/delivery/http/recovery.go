@@ -0,0 +1,39 @@
+package http
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// errorIDBytes is the entropy of an error id: short enough to read out to
+// support, long enough not to collide within a log retention window.
+const errorIDBytes = 6
+
+// newErrorID returns a random id tying an internal error response to the log
+// entry that records the underlying error.
+func newErrorID() string {
+	b := make([]byte, errorIDBytes)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Recovery turns a panic in a later handler into a 500 carrying an error id,
+// and logs the panic value and stack under that id.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+		id := newErrorID()
+		slog.Error("http handler panic", "path", c.Request.URL.Path, "error_id", id,
+			"panic", recovered, "stack", string(debug.Stack()))
+		resp := newAPIError(domain.ToAPIError(fmt.Errorf("panic: %v", recovered)))
+		resp.ErrorID = id
+		c.AbortWithStatusJSON(http.StatusInternalServerError, resp)
+	})
+}
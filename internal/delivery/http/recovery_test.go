@@ -0,0 +1,97 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/Kovalyovv/auth-service/internal/pkg/jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// loggedErrorID returns the error_id of the single JSON log entry in logs.
+func loggedErrorID(t *testing.T, logs *bytes.Buffer) string {
+	t.Helper()
+	var entry struct {
+		ErrorID string `json:"error_id"`
+	}
+	assert.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+	return entry.ErrorID
+}
+
+func TestRecovery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("Given a handler that panics", func(t *testing.T) {
+		var logs bytes.Buffer
+		defer slog.SetDefault(slog.Default())
+		slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+		router := gin.New()
+		router.Use(Recovery())
+		router.GET("/auth/me", func(c *gin.Context) { panic("nil map") })
+
+		req, _ := http.NewRequest(http.MethodGet, "/auth/me", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var resp apiError
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Equal(t, domain.CodeInternal, resp.Code)
+		assert.Len(t, resp.ErrorID, 2*errorIDBytes)
+		assert.Equal(t, resp.ErrorID, loggedErrorID(t, &logs))
+		assert.Contains(t, logs.String(), "nil map")
+	})
+}
+
+func TestAuthHandler_ErrorID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("Given an internal error", func(t *testing.T) {
+		var logs bytes.Buffer
+		defer slog.SetDefault(slog.Default())
+		slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+		mockUC.On("Authenticate", mock.Anything, "token").Return(&jwt.Claims{UserID: 7, Role: domain.RoleUser, SessionID: 3}, nil).Once()
+		mockUC.On("Logout", mock.Anything, int64(7), int64(3), "").Return(errors.New("connection reset")).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/auth/logout", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var resp apiError
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.NotEmpty(t, resp.ErrorID)
+		assert.Equal(t, resp.ErrorID, loggedErrorID(t, &logs))
+		assert.Contains(t, logs.String(), "connection reset")
+		mockUC.AssertExpectations(t)
+	})
+
+	t.Run("Given a client error", func(t *testing.T) {
+		mockUC := new(MockAuthUseCase)
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+		mockUC.On("Authenticate", mock.Anything, "token").Return(&jwt.Claims{UserID: 7, Role: domain.RoleUser, SessionID: 3}, nil).Once()
+		mockUC.On("Logout", mock.Anything, int64(7), int64(3), "").Return(domain.ErrSessionNotFound).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/auth/logout", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.NotContains(t, rr.Body.String(), "error_id")
+	})
+}
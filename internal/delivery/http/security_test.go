@@ -0,0 +1,101 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHSTS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	send := func(redirect bool, proto string) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.Use(HSTS(365*24*time.Hour, redirect))
+		router.GET("/auth/sessions", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+		req := httptest.NewRequest(http.MethodGet, "http://auth.example.com/auth/sessions?limit=5", nil)
+		if proto != "" {
+			req.Header.Set(ForwardedProtoHeader, proto)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Given a request forwarded over https", func(t *testing.T) {
+		rr := send(true, "https")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "max-age=31536000; includeSubDomains", rr.Header().Get("Strict-Transport-Security"))
+	})
+
+	t.Run("Given a request forwarded over http", func(t *testing.T) {
+		rr := send(true, "http")
+
+		assert.Equal(t, http.StatusPermanentRedirect, rr.Code)
+		assert.Equal(t, "https://auth.example.com/auth/sessions?limit=5", rr.Header().Get("Location"))
+	})
+
+	t.Run("Given a request forwarded over http without redirects", func(t *testing.T) {
+		rr := send(false, "http")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotEmpty(t, rr.Header().Get("Strict-Transport-Security"))
+	})
+
+	t.Run("Given a request without a forwarded proto", func(t *testing.T) {
+		rr := send(true, "")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotEmpty(t, rr.Header().Get("Strict-Transport-Security"))
+	})
+}
+
+func TestSecure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	send := func(path string, opts ...HandlerOption) *httptest.ResponseRecorder {
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(new(MockAuthUseCase), opts...))
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	t.Run("Given the default headers", func(t *testing.T) {
+		rr := send("/openapi.json")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "nosniff", rr.Header().Get("X-Content-Type-Options"))
+		assert.Equal(t, "DENY", rr.Header().Get("X-Frame-Options"))
+		assert.Equal(t, "no-referrer", rr.Header().Get("Referrer-Policy"))
+		assert.Equal(t, "default-src 'none'; frame-ancestors 'none'", rr.Header().Get("Content-Security-Policy"))
+	})
+
+	t.Run("Given a disabled header", func(t *testing.T) {
+		headers := DefaultSecurityHeaders
+		headers.FrameOptions = ""
+		rr := send("/openapi.json", WithSecurityHeaders(headers))
+
+		assert.NotContains(t, rr.Header(), "X-Frame-Options")
+		assert.Equal(t, "nosniff", rr.Header().Get("X-Content-Type-Options"))
+	})
+
+	t.Run("Given the docs page", func(t *testing.T) {
+		rr := send("/docs")
+
+		assert.Equal(t, docsCSP, rr.Header().Get("Content-Security-Policy"))
+	})
+
+	t.Run("Given the docs page without a policy", func(t *testing.T) {
+		headers := DefaultSecurityHeaders
+		headers.ContentSecurityPolicy = ""
+		rr := send("/docs", WithSecurityHeaders(headers))
+
+		assert.NotContains(t, rr.Header(), "Content-Security-Policy")
+	})
+}
@@ -1,26 +1,102 @@
 package http
 
 import (
+	"net/http"
 	"time"
 
+	"github.com/Kovalyovv/auth-service/internal/domain"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
+// SetupRoutes registers the public API on router, and the admin API as well
+// unless the handler was built WithSeparateAdminRoutes.
 func SetupRoutes(router *gin.Engine, handler *AuthHandler) {
+	router.Use(Secure(handler.headers))
+
 	// CORS middleware can be applied here or in main.go. Let's keep it here.
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:9000", "http://127.0.0.1:9000", "http://[::1]:9000", "http://0.0.0.0:9000", "http://0.0.0.0:9002", "http://[::1]:9002", "http://localhost:9002", "http://127.0.0.1:9002"},
-		AllowMethods:     []string{"GET", "POST", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", IdempotencyKeyHeader, ClientTypeHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
+	router.GET("/openapi.json", OpenAPISpec)
+	router.GET("/docs", Docs)
+
 	auth := router.Group("/auth")
 	{
-		auth.POST("/register", handler.Register)
-		auth.POST("/login", handler.Login)
-		auth.POST("/refresh", handler.Refresh)
+		auth.POST("/register", handler.rejectAuthenticated(), handler.idempotent(), handler.registerRoute())
+		auth.POST("/login", handler.rejectAuthenticated(), handler.loginRoute())
+		auth.POST("/refresh", handler.viaGateway(handler.Refresh))
+		auth.GET("/session-expiry", handler.SessionExpiry)
+		auth.POST("/resend-verification", handler.ResendVerification)
+		auth.POST("/verify-email", handler.VerifyEmail)
+		if handler.gateway != nil {
+			auth.POST("/verify", gin.WrapH(handler.gateway))
+		}
+	}
+
+	authenticated := router.Group("/auth", handler.authenticate())
+	{
+		authenticated.POST("/step-up", handler.StepUp)
+		authenticated.POST("/token", handler.ResourceToken)
+		authenticated.POST("/verify-password", handler.VerifyPassword)
+		authenticated.PUT("/password", RequireStepUp(), handler.ChangePassword)
+		authenticated.GET("/sessions", handler.Sessions)
+		authenticated.DELETE("/sessions/:id", handler.RevokeSession)
+		authenticated.GET("/me/export", handler.ExportData)
+		authenticated.DELETE("/me", RequireStepUp(), handler.DeleteAccount)
+		authenticated.POST("/logout", handler.Logout)
 	}
+
+	if !handler.separateAdmin {
+		adminRoutes(router, handler)
+	}
+}
+
+// SetupAdminRoutes registers the admin API and GET /healthz on router, for a
+// server on its own port that is not exposed publicly. Pair it with
+// WithSeparateAdminRoutes so SetupRoutes leaves the admin API out.
+func SetupAdminRoutes(router *gin.Engine, handler *AuthHandler) {
+	router.Use(Secure(handler.headers))
+
+	router.GET("/healthz", Health)
+	adminRoutes(router, handler)
+}
+
+func adminRoutes(router *gin.Engine, handler *AuthHandler) {
+	admin := router.Group("/auth", handler.authenticate(), RequireRole(domain.RoleAdmin))
+	{
+		admin.PUT("/users/:id/role", handler.UpdateRole)
+		admin.GET("/cleanup-status", handler.CleanupStatus)
+		admin.GET("/audit-events", handler.AuthEvents)
+		admin.GET("/users/dormant", handler.DormantUsers)
+		admin.GET("/users/count", handler.UserCount)
+		admin.GET("/users/by-email", rateLimit(handler.lookupLimiter), handler.UserByEmail)
+		admin.POST("/users/dormant/deactivate", handler.DeactivateDormantUsers)
+		admin.POST("/users/import", handler.ImportUsers)
+		admin.POST("/rotate-key", RequireStepUp(), handler.RotateKey)
+	}
+}
+
+// Health answers 200 while the process is serving requests.
+func Health(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// rejectAuthenticated is RejectAuthenticated under WithRejectAuthenticated
+// and a no-op otherwise.
+func (h *AuthHandler) rejectAuthenticated() gin.HandlerFunc {
+	if !h.rejectAuthed {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return RejectAuthenticated(h.uc)
+}
+
+// authenticate is AuthMiddleware configured from the handler's options.
+func (h *AuthHandler) authenticate() gin.HandlerFunc {
+	return AuthMiddleware(h.uc, WithQueryToken(h.queryToken))
 }
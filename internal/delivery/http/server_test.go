@@ -0,0 +1,91 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/Kovalyovv/auth-service/internal/pkg/jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSetupAdminRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockUC := new(MockAuthUseCase)
+	mockUC.On("Authenticate", mock.Anything, "token").Return(&jwt.Claims{UserID: 1, Role: domain.RoleAdmin}, nil)
+	mockUC.On("ListAuthEvents", mock.Anything, mock.Anything).Return([]domain.AuthEvent{}, nil)
+	handler := NewAuthHandler(mockUC, WithSeparateAdminRoutes(true))
+
+	public := gin.New()
+	SetupRoutes(public, handler)
+	admin := gin.New()
+	SetupAdminRoutes(admin, handler)
+
+	send := func(router *gin.Engine, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer token")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Given an admin endpoint", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send(admin, "/auth/audit-events").Code)
+		assert.Equal(t, http.StatusNotFound, send(public, "/auth/audit-events").Code)
+	})
+
+	t.Run("Given the health check", func(t *testing.T) {
+		rr := send(admin, "/healthz")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"status":"ok"}`, rr.Body.String())
+		assert.Equal(t, http.StatusNotFound, send(public, "/healthz").Code)
+	})
+
+	t.Run("Given a public endpoint", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, send(admin, "/openapi.json").Code)
+		assert.Equal(t, http.StatusOK, send(public, "/openapi.json").Code)
+	})
+
+	t.Run("Given the admin API is not separate", func(t *testing.T) {
+		router := gin.New()
+		SetupRoutes(router, NewAuthHandler(mockUC))
+
+		assert.Equal(t, http.StatusOK, send(router, "/auth/audit-events").Code)
+	})
+}
+
+func TestSetupRoutes_CORSPreflight(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	SetupRoutes(router, NewAuthHandler(new(MockAuthUseCase)))
+
+	preflight := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodOptions, path, nil)
+		req.Header.Set("Origin", "http://localhost:9000")
+		req.Header.Set("Access-Control-Request-Method", method)
+		req.Header.Set("Access-Control-Request-Headers", "Authorization")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Given a session revocation", func(t *testing.T) {
+		rr := preflight(http.MethodDelete, "/auth/sessions/3")
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Equal(t, "http://localhost:9000", rr.Header().Get("Access-Control-Allow-Origin"))
+		assert.Contains(t, rr.Header().Get("Access-Control-Allow-Methods"), http.MethodDelete)
+	})
+
+	t.Run("Given an account deletion", func(t *testing.T) {
+		rr := preflight(http.MethodDelete, "/auth/me")
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Equal(t, "http://localhost:9000", rr.Header().Get("Access-Control-Allow-Origin"))
+		assert.Contains(t, rr.Header().Get("Access-Control-Allow-Methods"), http.MethodDelete)
+	})
+}
@@ -0,0 +1,39 @@
+// Package multiplex serves gRPC and HTTP on a single listener. gRPC calls
+// are told apart from other requests by their HTTP/2 content type, and
+// cleartext HTTP/2 (h2c) is enabled so gRPC clients can connect without TLS.
+package multiplex
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Handler sends gRPC requests to grpcHandler, typically a *grpc.Server, and
+// everything else to httpHandler.
+func Handler(grpcHandler, httpHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsGRPC(r) {
+			grpcHandler.ServeHTTP(w, r)
+			return
+		}
+		httpHandler.ServeHTTP(w, r)
+	})
+}
+
+// IsGRPC reports whether r is a gRPC call.
+func IsGRPC(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// NewServer returns an http.Server on addr that speaks HTTP/1.1 and
+// cleartext HTTP/2, serving h.
+func NewServer(addr string, h http.Handler) *http.Server {
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Server{
+		Addr:      addr,
+		Handler:   h,
+		Protocols: &protocols,
+	}
+}
@@ -0,0 +1,76 @@
+package multiplex
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Kovalyovv/auth-service/pkg/pb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+type verifier struct {
+	pb.UnimplementedAuthServiceServer
+}
+
+func (verifier) VerifyToken(_ context.Context, req *pb.VerifyTokenRequest) (*pb.VerifyTokenResponse, error) {
+	return &pb.VerifyTokenResponse{UserId: 42, Valid: req.Token == "good"}, nil
+}
+
+func TestHandler(t *testing.T) {
+	grpcSrv := grpc.NewServer()
+	pb.RegisterAuthServiceServer(grpcSrv, verifier{})
+	httpMux := http.NewServeMux()
+	httpMux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	})
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := NewServer(lis.Addr().String(), Handler(grpcSrv, httpMux))
+	go func() {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			t.Errorf("serve: %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("Given an HTTP request", func(t *testing.T) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+lis.Addr().String()+"/healthz", nil)
+		require.NoError(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "ok", string(body))
+	})
+
+	t.Run("Given a gRPC call", func(t *testing.T) {
+		conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		require.NoError(t, err)
+		defer conn.Close()
+
+		resp, err := pb.NewAuthServiceClient(conn).VerifyToken(ctx, &pb.VerifyTokenRequest{Token: "good"})
+
+		require.NoError(t, err)
+		assert.True(t, resp.Valid)
+		assert.Equal(t, int64(42), resp.UserId)
+	})
+}
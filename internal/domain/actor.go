@@ -0,0 +1,24 @@
+package domain
+
+import "context"
+
+// Actor is the authenticated caller on whose behalf a request runs, such as
+// the admin changing another user's role.
+type Actor struct {
+	UserID int64
+	Role   string
+}
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx carrying actor.
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor stored by WithActor. It reports false
+// for unauthenticated requests.
+func ActorFromContext(ctx context.Context) (Actor, bool) {
+	actor, ok := ctx.Value(actorKey{}).(Actor)
+	return actor, ok
+}
@@ -0,0 +1,130 @@
+package domain
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Error codes shared by every transport. They are part of the public
+// contract: clients may switch on them, so existing values must not change.
+const (
+	CodeInvalidRequest        = "invalid_request"
+	CodeInvalidCredentials    = "invalid_credentials"
+	CodeInvalidToken          = "invalid_token"
+	CodeTokenExpired          = "token_expired"
+	CodeInvalidRefreshToken   = "invalid_refresh_token"
+	CodeRefreshLimitReached   = "refresh_limit_reached"
+	CodeUnauthenticated       = "unauthenticated"
+	CodeAccountDisabled       = "account_disabled"
+	CodeAccountLocked         = "account_locked"
+	CodeForbidden             = "forbidden"
+	CodeStepUpRequired        = "step_up_required"
+	CodePasswordChangeTooSoon = "password_change_too_soon"
+	CodePasswordTooShort      = "password_too_short"
+	CodePasswordTooLong       = "password_too_long"
+	CodeTooManyAttempts       = "too_many_attempts"
+	CodeRateLimited           = "rate_limited"
+	CodeEmailExists           = "email_exists"
+	CodeAlreadyAuthenticated  = "already_authenticated"
+	CodeRegistrationClosed    = "registration_closed"
+	CodeEmailDomainNotAllowed = "email_domain_not_allowed"
+	CodeDisposableEmail       = "disposable_email"
+	CodeInvalidRole           = "invalid_role"
+	CodeUserNotFound          = "user_not_found"
+	CodeNotFound              = "not_found"
+	CodeTimeout               = "timeout"
+	CodeServiceUnavailable    = "service_unavailable"
+	CodeInternal              = "internal_error"
+)
+
+// APIError is the transport-neutral description of a failed request. HTTP
+// renders it as the JSON error body and gRPC attaches it as status details.
+type APIError struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Details map[string]string `json:"details,omitempty"`
+	// RetryAfter, if positive, is how many seconds the client should wait
+	// before trying again.
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+var apiErrorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrInvalidCredentials, CodeInvalidCredentials},
+	{ErrInvalidToken, CodeInvalidToken},
+	{ErrTokenExpired, CodeTokenExpired},
+	{ErrRefreshTokenNotFound, CodeInvalidRefreshToken},
+	{ErrEmailExists, CodeEmailExists},
+	{ErrRegistrationClosed, CodeRegistrationClosed},
+	{ErrEmailDomainNotAllowed, CodeEmailDomainNotAllowed},
+	{ErrDisposableEmail, CodeDisposableEmail},
+	{ErrInvalidRole, CodeInvalidRole},
+	{ErrStepUpRequired, CodeStepUpRequired},
+	{ErrAccountDisabled, CodeAccountDisabled},
+	{ErrUserNotFound, CodeUserNotFound},
+	{ErrServiceUnavailable, CodeServiceUnavailable},
+	{ErrPasswordChangeTooSoon, CodePasswordChangeTooSoon},
+	{ErrRefreshLimitReached, CodeRefreshLimitReached},
+	{ErrTooManyAttempts, CodeTooManyAttempts},
+	{ErrAccountLocked, CodeAccountLocked},
+	{ErrAlreadyAuthenticated, CodeAlreadyAuthenticated},
+	{ErrRateLimited, CodeRateLimited},
+	{ErrAudienceNotAllowed, CodeForbidden},
+	{ErrSessionNotFound, CodeNotFound},
+	{ErrSessionNotOwned, CodeForbidden},
+	{ErrPasswordTooShort, CodePasswordTooShort},
+	{ErrPasswordTooLong, CodePasswordTooLong},
+}
+
+// ToAPIError classifies err. An *APIError in the chain is returned as is;
+// known domain errors get their code and message; anything else becomes an
+// internal error whose message does not leak the cause.
+func ToAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	var locked *AccountLockedError
+	if errors.As(err, &locked) {
+		return &APIError{Code: CodeAccountLocked, Message: ErrAccountLocked.Error(), RetryAfter: retryAfterSeconds(time.Until(locked.Until))}
+	}
+	var tooMany *TooManyAttemptsError
+	if errors.As(err, &tooMany) {
+		return &APIError{Code: CodeTooManyAttempts, Message: ErrTooManyAttempts.Error(), RetryAfter: retryAfterSeconds(tooMany.RetryAfter)}
+	}
+	var length *PasswordLengthError
+	if errors.As(err, &length) {
+		code := CodePasswordTooShort
+		if length.TooLong {
+			code = CodePasswordTooLong
+		}
+		return &APIError{Code: code, Message: length.Error(), Details: map[string]string{
+			"min_length": strconv.Itoa(length.MinLength),
+			"max_bytes":  strconv.Itoa(length.MaxBytes),
+		}}
+	}
+	var limited *RateLimitedError
+	if errors.As(err, &limited) {
+		return &APIError{Code: CodeRateLimited, Message: ErrRateLimited.Error(), RetryAfter: retryAfterSeconds(limited.RetryAfter)}
+	}
+	for _, c := range apiErrorCodes {
+		if errors.Is(err, c.err) {
+			return &APIError{Code: c.code, Message: c.err.Error()}
+		}
+	}
+	return &APIError{Code: CodeInternal, Message: "an internal server error occurred"}
+}
+
+// retryAfterSeconds rounds d up to whole seconds, and to at least one, so a
+// client that waits as told is not turned away again.
+func retryAfterSeconds(d time.Duration) int {
+	return max(1, int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,48 @@
+package domain
+
+import "time"
+
+// Page size bounds for audit queries.
+const (
+	DefaultAuditPageSize = 50
+	MaxAuditPageSize     = 200
+)
+
+// AuthEvent is a recorded authentication attempt or account change.
+// UserID is zero when the attempt could not be tied to an account. ActorID is
+// the authenticated user who made the change, such as an admin, and zero for
+// unauthenticated requests.
+type AuthEvent struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id,omitempty"`
+	ActorID   int64     `json:"actor_id,omitempty"`
+	Email     string    `json:"email,omitempty"`
+	Type      string    `json:"type"`
+	Success   bool      `json:"success"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuthEventFilter narrows an audit query. Zero values do not filter.
+type AuthEventFilter struct {
+	UserID  int64
+	Email   string
+	Type    string
+	Success *bool
+	From    time.Time
+	To      time.Time
+	Limit   int
+	Offset  int
+}
+
+// PageSize returns Limit clamped to [1, MaxAuditPageSize], defaulting to
+// DefaultAuditPageSize.
+func (f AuthEventFilter) PageSize() int {
+	switch {
+	case f.Limit <= 0:
+		return DefaultAuditPageSize
+	case f.Limit > MaxAuditPageSize:
+		return MaxAuditPageSize
+	default:
+		return f.Limit
+	}
+}
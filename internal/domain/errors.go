@@ -1,11 +1,87 @@
 package domain
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 var (
-	ErrInvalidCredentials   = errors.New("invalid credentials")
-	ErrUserNotFound         = errors.New("user not found")
-	ErrRefreshTokenNotFound = errors.New("invalid or expired refresh token")
-	ErrTokenExpired         = errors.New("token has expired")
-	ErrEmailExists          = errors.New("email already exists")
+	ErrInvalidCredentials    = errors.New("invalid credentials")
+	ErrUserNotFound          = errors.New("user not found")
+	ErrRefreshTokenNotFound  = errors.New("invalid or expired refresh token")
+	ErrTokenExpired          = errors.New("token has expired")
+	ErrInvalidToken          = errors.New("invalid token")
+	ErrEmailExists           = errors.New("email already exists")
+	ErrRegistrationClosed    = errors.New("registration is closed")
+	ErrInvalidRole           = errors.New("invalid role")
+	ErrEmailDomainNotAllowed = errors.New("email domain is not allowed")
+	ErrDisposableEmail       = errors.New("disposable email addresses are not allowed")
+	ErrServiceUnavailable    = errors.New("service is temporarily unavailable")
+	ErrAccountDisabled       = errors.New("account is disabled")
+	ErrStepUpRequired        = errors.New("recent re-authentication required")
+	ErrPasswordChangeTooSoon = errors.New("password was changed too recently")
+	ErrRefreshLimitReached   = errors.New("session cannot be refreshed any more, log in again")
+	ErrTooManyAttempts       = errors.New("too many failed attempts, try again later")
+	ErrAccountLocked         = errors.New("account is temporarily locked, try again later")
+	ErrAlreadyAuthenticated  = errors.New("already authenticated")
+	ErrRateLimited           = errors.New("too many requests, try again later")
+	ErrAudienceNotAllowed    = errors.New("not allowed to request tokens for this audience")
+	ErrSessionNotFound       = errors.New("session not found")
+	ErrSessionNotOwned       = errors.New("session belongs to another user")
+	ErrPasswordTooShort      = errors.New("password is too short")
+	ErrPasswordTooLong       = errors.New("password is too long")
 )
+
+// PasswordLengthError is ErrPasswordTooShort or ErrPasswordTooLong with the
+// bounds a password has to respect: MinLength characters and MaxBytes bytes.
+// It matches whichever of the two it reports.
+type PasswordLengthError struct {
+	MinLength int
+	MaxBytes  int
+	TooLong   bool
+}
+
+func (e *PasswordLengthError) Error() string {
+	if e.TooLong {
+		return fmt.Sprintf("password must be at most %d bytes", e.MaxBytes)
+	}
+	return fmt.Sprintf("password must be at least %d characters", e.MinLength)
+}
+
+func (e *PasswordLengthError) Is(target error) bool {
+	if e.TooLong {
+		return target == ErrPasswordTooLong
+	}
+	return target == ErrPasswordTooShort
+}
+
+// AccountLockedError is returned for a login to an account locked after too
+// many failed attempts. It matches ErrAccountLocked.
+type AccountLockedError struct {
+	Until time.Time
+}
+
+func (e *AccountLockedError) Error() string { return ErrAccountLocked.Error() }
+
+func (e *AccountLockedError) Is(target error) bool { return target == ErrAccountLocked }
+
+// TooManyAttemptsError is ErrTooManyAttempts with the time the caller has to
+// wait before trying again. It matches ErrTooManyAttempts.
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string { return ErrTooManyAttempts.Error() }
+
+func (e *TooManyAttemptsError) Is(target error) bool { return target == ErrTooManyAttempts }
+
+// RateLimitedError is ErrRateLimited with the time the caller has to wait
+// before sending another request. It matches ErrRateLimited.
+type RateLimitedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) Error() string { return ErrRateLimited.Error() }
+
+func (e *RateLimitedError) Is(target error) bool { return target == ErrRateLimited }
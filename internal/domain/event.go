@@ -0,0 +1,25 @@
+package domain
+
+import "time"
+
+// Event types published when something happens to an account.
+const (
+	EventUserRegistered      = "user.registered"
+	EventUserLogin           = "user.login"
+	EventUserPasswordChanged = "user.password_changed"
+	// EventUserDeleted tells other systems to erase what they keep about
+	// the user.
+	EventUserDeleted = "user.deleted"
+	// EventUserRoleChanged and EventUserLogout are only written to the
+	// audit log.
+	EventUserRoleChanged = "user.role_changed"
+	EventUserLogout      = "user.logout"
+)
+
+// Event describes an account change that other systems may react to.
+type Event struct {
+	Type       string            `json:"type"`
+	UserID     int64             `json:"user_id"`
+	OccurredAt time.Time         `json:"occurred_at"`
+	Data       map[string]string `json:"data,omitempty"`
+}
@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxDeviceNameLength bounds, in characters, the device name kept with a
+// session. Longer names are truncated.
+const MaxDeviceNameLength = 100
+
+// MaxUserAgentLength bounds, in bytes, the user agent kept with a session.
+// Longer user agents are truncated.
+const MaxUserAgentLength = 255
+
+// ClientInfo describes the client a session is opened for.
+type ClientInfo struct {
+	// DeviceName is a label the client chose, such as "Alice's iPhone".
+	DeviceName string
+	// IP is the address the request came from, if known.
+	IP string
+	// UserAgent is the User-Agent the client sent, if any.
+	UserAgent string
+	// AccessToken is the access token the client held when it refreshed, if
+	// it sent one. It may have expired.
+	AccessToken string
+}
+
+// Normalized returns c with the device name trimmed, stripped of control
+// characters and truncated to MaxDeviceNameLength, and the user agent
+// truncated to MaxUserAgentLength.
+func (c ClientInfo) Normalized() ClientInfo {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, c.DeviceName)
+	name = strings.TrimSpace(name)
+	if r := []rune(name); len(r) > MaxDeviceNameLength {
+		name = strings.TrimSpace(string(r[:MaxDeviceNameLength]))
+	}
+	c.DeviceName = name
+	c.UserAgent = strings.ToValidUTF8(truncateBytes(c.UserAgent, MaxUserAgentLength), "")
+	return c
+}
+
+// truncateBytes cuts s to at most n bytes without splitting a character.
+func truncateBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// Session is a live refresh token as shown to its owner. The token itself is
+// never part of it.
+type Session struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"user_id"`
+	DeviceName string    `json:"device_name,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// UserAgent and IP describe the client that opened the session.
+	UserAgent string `json:"user_agent,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	// LastUsedAt and LastUsedIP describe the most recent refresh; they are
+	// empty until the session is first refreshed.
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+}
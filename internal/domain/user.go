@@ -2,15 +2,120 @@ package domain
 
 import "time"
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// IsValidRole reports whether role is one of the roles known to the service.
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleUser, RoleAdmin:
+		return true
+	}
+	return false
+}
+
 type User struct {
 	ID           int64
 	Username     string
 	Email        string
 	PasswordHash string
+	Role         string
 	CreatedAt    time.Time
+	// LastLoginAt is zero if the user never logged in.
+	LastLoginAt time.Time
+	// DisabledAt is zero while the account is active.
+	DisabledAt time.Time
+	// PasswordChangedAt is zero if the password was never changed since
+	// registration.
+	PasswordChangedAt time.Time
+	// LockedUntil is when a lock after too many failed logins ends. It is
+	// zero, or in the past, while the account is not locked.
+	LockedUntil time.Time
+	// TokenVersion is embedded in access tokens; bumping it invalidates
+	// every access token issued before, where versions are checked.
+	TokenVersion int64
+	// EmailVerifiedAt is zero until the user confirmed their email address.
+	EmailVerifiedAt time.Time
+}
+
+// UserExport is what the service keeps about a user, as handed to them on
+// request. It never includes the password hash.
+type UserExport struct {
+	User       ExportedUser `json:"user"`
+	Sessions   []Session    `json:"sessions"`
+	AuthEvents []AuthEvent  `json:"auth_events"`
+	ExportedAt time.Time    `json:"exported_at"`
+}
+
+// ExportedUser is the account record of a UserExport. Times that never
+// happened are null.
+type ExportedUser struct {
+	ID                int64      `json:"id"`
+	Username          string     `json:"username"`
+	Email             string     `json:"email"`
+	Role              string     `json:"role"`
+	CreatedAt         time.Time  `json:"created_at"`
+	LastLoginAt       *time.Time `json:"last_login_at"`
+	PasswordChangedAt *time.Time `json:"password_changed_at"`
+	DisabledAt        *time.Time `json:"disabled_at"`
+}
+
+// Disabled reports whether the account was deactivated.
+func (u *User) Disabled() bool {
+	return !u.DisabledAt.IsZero()
+}
+
+// EmailVerified reports whether the user confirmed their email address.
+func (u *User) EmailVerified() bool {
+	return !u.EmailVerifiedAt.IsZero()
+}
+
+// LockedAt reports whether the account is locked at t.
+func (u *User) LockedAt(t time.Time) bool {
+	return u.LockedUntil.After(t)
 }
 
 type TokenPair struct {
 	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// RefreshExpiresAt is when RefreshToken expires, zero without one.
+	RefreshExpiresAt time.Time `json:"-"`
+	// Rotated reports whether a refresh consumed the presented refresh
+	// token and issued RefreshToken in its place.
+	Rotated bool `json:"-"`
+}
+
+// RegisterResult reports the outcome of a registration, so that every
+// registration mode can be answered the same way.
+type RegisterResult struct {
+	// User is the created account. It is nil when enumeration-safe
+	// registration hid that the email was already taken.
+	User *User
+	// VerificationSent reports whether an email verification link was sent.
+	VerificationSent bool
+	// Tokens is set when the user was signed in right away.
+	Tokens *TokenPair
+}
+
+// ImportResult reports the outcome of a bulk user import.
+type ImportResult struct {
+	Imported int             `json:"imported"`
+	Failed   []ImportFailure `json:"failed"`
+}
+
+// ImportFailure explains why the user at Index of the import was skipped.
+type ImportFailure struct {
+	Index   int    `json:"index"`
+	Email   string `json:"email"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// CleanupStatus reports the outcome of the most recent expired-token cleanup.
+type CleanupStatus struct {
+	LastRun        time.Time `json:"last_run"`
+	DeletedLastRun int64     `json:"deleted_last_run"`
+	LastError      string    `json:"last_error,omitempty"`
 }
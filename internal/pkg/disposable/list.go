@@ -0,0 +1,129 @@
+// Package disposable recognises email domains of disposable and temporary
+// mailbox providers.
+package disposable
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// List is a set of disposable email domains, safe for concurrent use. A
+// domain also covers its subdomains.
+type List struct {
+	path string
+
+	mu      sync.RWMutex
+	domains map[string]bool
+}
+
+// NewList returns a fixed list of domains.
+func NewList(domains []string) *List {
+	return &List{domains: toSet(domains)}
+}
+
+// LoadFile reads the list from path, one domain per line. Blank lines and
+// lines starting with # are ignored. Reload reads the file again.
+func LoadFile(path string) (*List, error) {
+	l := &List{path: path}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload replaces the domains with the current content of the list's file.
+// On failure the previous domains stay in effect. Lists built with NewList
+// have no file and are left unchanged.
+func (l *List) Reload() error {
+	if l.path == "" {
+		return nil
+	}
+	f, err := os.Open(l.path)
+	if err != nil {
+		return fmt.Errorf("open disposable domain list: %w", err)
+	}
+	defer f.Close()
+
+	domains, err := parse(f)
+	if err != nil {
+		return fmt.Errorf("read disposable domain list %s: %w", l.path, err)
+	}
+	l.mu.Lock()
+	l.domains = toSet(domains)
+	l.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the list every interval until ctx is cancelled. Failed
+// reloads are logged.
+func (l *List) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.Reload(); err != nil {
+				slog.Error("failed to reload disposable email domains", "error", err)
+			}
+		}
+	}
+}
+
+// IsDisposable reports whether domain, or a domain it is a subdomain of, is
+// on the list. The comparison ignores case.
+func (l *List) IsDisposable(domain string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for domain != "" {
+		if l.domains[domain] {
+			return true
+		}
+		_, parent, ok := strings.Cut(domain, ".")
+		if !ok {
+			return false
+		}
+		domain = parent
+	}
+	return false
+}
+
+// Len returns the number of domains on the list.
+func (l *List) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.domains)
+}
+
+func parse(r io.Reader) ([]string, error) {
+	var domains []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains = append(domains, line)
+	}
+	return domains, sc.Err()
+}
+
+func toSet(domains []string) map[string]bool {
+	set := make(map[string]bool, len(domains))
+	for _, d := range domains {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			set[d] = true
+		}
+	}
+	return set
+}
@@ -0,0 +1,49 @@
+package disposable
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestList(t *testing.T) {
+	t.Run("Given a fixed list", func(t *testing.T) {
+		l := NewList([]string{"Mailinator.com", " tempmail.dev "})
+
+		assert.True(t, l.IsDisposable("mailinator.com"))
+		assert.True(t, l.IsDisposable("MAILINATOR.COM"))
+		assert.True(t, l.IsDisposable("eu.tempmail.dev"), "subdomains are covered")
+		assert.False(t, l.IsDisposable("example.com"))
+		assert.False(t, l.IsDisposable("notmailinator.com"))
+	})
+
+	t.Run("Given a list file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "disposable.txt")
+		require.NoError(t, os.WriteFile(path, []byte("# providers\nmailinator.com\n\n"), 0o600))
+
+		l, err := LoadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, 1, l.Len())
+		assert.True(t, l.IsDisposable("mailinator.com"))
+
+		require.NoError(t, os.WriteFile(path, []byte("tempmail.dev\n"), 0o600))
+		require.NoError(t, l.Reload())
+
+		assert.False(t, l.IsDisposable("mailinator.com"))
+		assert.True(t, l.IsDisposable("tempmail.dev"))
+	})
+
+	t.Run("Given the file disappears", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "disposable.txt")
+		require.NoError(t, os.WriteFile(path, []byte("mailinator.com\n"), 0o600))
+		l, err := LoadFile(path)
+		require.NoError(t, err)
+		require.NoError(t, os.Remove(path))
+
+		assert.Error(t, l.Reload())
+		assert.True(t, l.IsDisposable("mailinator.com"), "the previous list stays in effect")
+	})
+}
@@ -1,13 +1,77 @@
 package hash
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
 
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
 	return string(bytes), err
 }
 
+// CheckPasswordHash verifies password against a bcrypt or Argon2id hash,
+// choosing the algorithm from the hash's prefix.
 func CheckPasswordHash(password, hash string) bool {
+	if strings.HasPrefix(hash, argon2idPrefix) {
+		return checkArgon2id(password, hash)
+	}
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+// bcryptHashLength is the length of every bcrypt hash in modular crypt format.
+const bcryptHashLength = 60
+
+// ValidateHash reports whether encoded is a well-formed bcrypt or Argon2id
+// hash, that is one CheckPasswordHash can verify passwords against.
+func ValidateHash(encoded string) error {
+	if strings.HasPrefix(encoded, argon2idPrefix) {
+		_, _, _, err := decodeArgon2id(encoded)
+		return err
+	}
+	if len(encoded) != bcryptHashLength {
+		return errors.New("not a bcrypt or argon2id hash")
+	}
+	if _, err := bcrypt.Cost([]byte(encoded)); err != nil {
+		return errors.New("invalid bcrypt hash")
+	}
+	return nil
+}
+
+// Hasher creates hashes with a configured algorithm while still verifying
+// hashes made by any supported one.
+type Hasher struct {
+	algorithm string
+	argon2    Argon2Params
+}
+
+// NewHasher returns a Hasher producing algorithm hashes. argon2 is only used
+// when algorithm is AlgorithmArgon2id.
+func NewHasher(algorithm string, argon2 Argon2Params) *Hasher {
+	return &Hasher{algorithm: algorithm, argon2: argon2}
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.algorithm == AlgorithmArgon2id {
+		return HashPasswordArgon2id(password, h.argon2)
+	}
+	return HashPassword(password)
+}
+
+func (h *Hasher) Check(password, hash string) bool {
+	return CheckPasswordHash(password, hash)
+}
+
+// NeedsRehash reports whether hash should be upgraded to Argon2id after a
+// successful login. Argon2id hashes are never downgraded to bcrypt.
+func (h *Hasher) NeedsRehash(hash string) bool {
+	return h.algorithm == AlgorithmArgon2id && !strings.HasPrefix(hash, argon2idPrefix)
+}
@@ -0,0 +1,101 @@
+package hash
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckPasswordHash(t *testing.T) {
+	t.Run("Given a bcrypt hash", func(t *testing.T) {
+		h, err := HashPassword("password123")
+		require.NoError(t, err)
+
+		assert.True(t, CheckPasswordHash("password123", h))
+		assert.False(t, CheckPasswordHash("wrong", h))
+	})
+
+	t.Run("Given an argon2id hash", func(t *testing.T) {
+		h, err := HashPasswordArgon2id("password123", DefaultArgon2Params)
+		require.NoError(t, err)
+
+		assert.True(t, strings.HasPrefix(h, "$argon2id$v=19$m=65536,t=3,p=2$"))
+		assert.True(t, CheckPasswordHash("password123", h))
+		assert.False(t, CheckPasswordHash("wrong", h))
+	})
+
+	t.Run("Given a malformed argon2id hash", func(t *testing.T) {
+		assert.False(t, CheckPasswordHash("password123", "$argon2id$v=19$m=1$bad"))
+	})
+}
+
+func TestHasher(t *testing.T) {
+	bcryptHash, err := HashPassword("password123")
+	require.NoError(t, err)
+	argonHash, err := HashPasswordArgon2id("password123", DefaultArgon2Params)
+	require.NoError(t, err)
+
+	t.Run("Given argon2id as the target", func(t *testing.T) {
+		h := NewHasher(AlgorithmArgon2id, DefaultArgon2Params)
+
+		newHash, err := h.Hash("password123")
+		require.NoError(t, err)
+
+		assert.True(t, strings.HasPrefix(newHash, argon2idPrefix))
+		assert.True(t, h.Check("password123", bcryptHash))
+		assert.True(t, h.NeedsRehash(bcryptHash))
+		assert.False(t, h.NeedsRehash(argonHash))
+	})
+
+	t.Run("Given bcrypt as the target", func(t *testing.T) {
+		h := NewHasher(AlgorithmBcrypt, DefaultArgon2Params)
+
+		assert.True(t, h.Check("password123", argonHash))
+		assert.False(t, h.NeedsRehash(bcryptHash))
+		assert.False(t, h.NeedsRehash(argonHash))
+	})
+}
+
+func TestHasher_Argon2ParamsChange(t *testing.T) {
+	oldParams := Argon2Params{Memory: 32 * 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	oldHash, err := NewHasher(AlgorithmArgon2id, oldParams).Hash("password123")
+	require.NoError(t, err)
+	assert.Contains(t, oldHash, "$m=32768,t=2,p=1$")
+
+	newParams := Argon2Params{Memory: 128 * 1024, Iterations: 4, Parallelism: 4, SaltLength: 16, KeyLength: 32}
+	h := NewHasher(AlgorithmArgon2id, newParams)
+
+	assert.True(t, h.Check("password123", oldHash))
+	assert.False(t, h.Check("wrong", oldHash))
+}
+
+func TestValidateHash(t *testing.T) {
+	argonHash, err := HashPasswordArgon2id("password123", DefaultArgon2Params)
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		hash  string
+		valid bool
+	}{
+		"Given a bcrypt hash":                 {"$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", true},
+		"Given an argon2id hash":              {argonHash, true},
+		"Given a truncated bcrypt hash":       {"$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lh", false},
+		"Given a bcrypt hash with a bad cost": {"$2a$99$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", false},
+		"Given a malformed argon2id hash":     {"$argon2id$v=19$m=1$bad", false},
+		"Given a plaintext password":          {"password123", false},
+		"Given an md5 crypt hash":             {"$1$saltsalt$qjXMvbEw8oaL.CzflDugX/", false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateHash(tt.hash)
+
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
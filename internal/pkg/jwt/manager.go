@@ -5,58 +5,524 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/Kovalyovv/auth-service/internal/pkg/clock"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Claims is the decoded content of an access token.
+type Claims struct {
+	UserID int64
+	Role   string
+	// ACR is the authentication context class; ACRStepUp marks a token
+	// issued right after the user re-entered their password.
+	ACR string
+	// SessionID is the sid claim: the session whose refresh token the
+	// access token was issued with, or zero if there is none.
+	SessionID int64
+	// TokenVersion is the ver claim: the user's token version when the
+	// token was issued. Tokens without it are version zero.
+	TokenVersion int64
+	// Audience is the aud claim: the resource server the token is meant
+	// for, or empty for tokens meant for this service.
+	Audience string
+	// AuthTime is the auth_time claim: when the user last entered their
+	// password, which refreshes carry over unchanged. It is zero for tokens
+	// without it.
+	AuthTime  time.Time
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	// Extra holds custom claims, such as a tenant id. Entries named like a
+	// registered claim are ignored when signing.
+	Extra map[string]any
+}
+
+// reservedClaims are the claim names the manager sets or checks itself.
+var reservedClaims = map[string]bool{
+	"sub": true, "role": true, "acr": true, "exp": true, "iat": true,
+	"nbf": true, "iss": true, "aud": true, "jti": true, "typ": true,
+	"sid": true, "ver": true, "auth_time": true,
+}
+
+// ACRStepUp is the acr claim of step-up tokens.
+const ACRStepUp = "step-up"
+
+// RefreshClaims is the decoded content of a JWT refresh token.
+type RefreshClaims struct {
+	ID     string
+	UserID int64
+	// AuthTime is when the user logged in to the session the token
+	// belongs to, or zero if it was not recorded.
+	AuthTime time.Time
+	// TokenVersion is the user's token version when the token was issued.
+	TokenVersion int64
+	ExpiresAt    time.Time
+}
+
+const (
+	refreshTokenType = "refresh"
+	// verificationTokenType marks tokens confirming an email address.
+	verificationTokenType = "email_verification"
+	// refreshTokenBytes is the entropy of an opaque refresh token; it is
+	// hex-encoded, so the token is twice as many characters long.
+	refreshTokenBytes = 32
+	// rotatedSecretBytes is the entropy of secrets RotateKey generates.
+	rotatedSecretBytes = 32
+)
+
+// ErrEmptySecret is returned by NewTokenManager for an empty secret, with
+// which any token would be trivially forgeable. Judging whether a non-empty
+// secret is strong enough is left to the configuration.
+var ErrEmptySecret = errors.New("jwt: empty signing secret")
+
+// DefaultLeeway is the clock skew tolerated on iat and nbf unless WithLeeway
+// says otherwise.
+const DefaultLeeway = 30 * time.Second
+
+// DefaultAlgorithm is the HMAC variant used unless WithAlgorithm says
+// otherwise.
+const DefaultAlgorithm = "HS256"
+
+var hmacMethods = map[string]*jwt.SigningMethodHMAC{
+	"HS256": jwt.SigningMethodHS256,
+	"HS384": jwt.SigningMethodHS384,
+	"HS512": jwt.SigningMethodHS512,
+}
+
 type TokenManager struct {
+	// keyMu guards the secrets, which RotateKey replaces at runtime.
+	keyMu     sync.RWMutex
 	secretKey string
+	// previousKey, if set, still verifies tokens but signs none.
+	previousKey string
+	leeway      time.Duration
+	// expiryLeeway is how long past exp a token is still accepted.
+	expiryLeeway time.Duration
+	method       *jwt.SigningMethodHMAC
+	clock        clock.Clock
+	// secretPolicy makes RotateKey check given secrets with CheckSecret
+	// against minSecretBits.
+	secretPolicy  bool
+	minSecretBits int
+}
+
+// Option configures optional TokenManager behaviour.
+type Option func(*TokenManager)
+
+// WithLeeway sets how far a token's iat and nbf may lie in the future, to
+// absorb clock skew between nodes. It does not extend the lifetime of
+// tokens; see WithExpiryLeeway for that.
+func WithLeeway(d time.Duration) Option {
+	return func(m *TokenManager) {
+		m.leeway = d
+	}
+}
+
+// WithExpiryLeeway accepts tokens for d past their exp. It is zero unless
+// set, so a token is rejected from the second it expires.
+func WithExpiryLeeway(d time.Duration) Option {
+	return func(m *TokenManager) {
+		m.expiryLeeway = d
+	}
+}
+
+// WithAlgorithm selects the HMAC variant, HS256, HS384 or HS512, that tokens
+// are signed with. Tokens signed with any other variant are rejected. Unknown
+// names leave the default in place.
+func WithAlgorithm(alg string) Option {
+	return func(m *TokenManager) {
+		if method, ok := hmacMethods[alg]; ok {
+			m.method = method
+		}
+	}
+}
+
+// WithPreviousSecret keeps accepting tokens signed with secret while new
+// tokens are signed with the primary secret, so the secret can be rotated
+// without logging everyone out. Drop it once the longest-lived token signed
+// with it has expired. An empty secret is ignored.
+func WithPreviousSecret(secret string) Option {
+	return func(m *TokenManager) {
+		m.previousKey = secret
+	}
+}
+
+// WithSecretPolicy makes RotateKey refuse given secrets that CheckSecret
+// rejects with minBits, the check the configuration applies to JWT_SECRET.
+func WithSecretPolicy(minBits int) Option {
+	return func(m *TokenManager) {
+		m.secretPolicy = true
+		m.minSecretBits = minBits
+	}
+}
+
+// WithClock sets the clock tokens are issued and checked against. It
+// defaults to the system clock.
+func WithClock(c clock.Clock) Option {
+	return func(m *TokenManager) {
+		m.clock = c
+	}
+}
+
+// NewTokenManager returns a manager signing tokens with secretKey, or
+// ErrEmptySecret if it is empty.
+func NewTokenManager(secretKey string, opts ...Option) (*TokenManager, error) {
+	if secretKey == "" {
+		return nil, ErrEmptySecret
+	}
+	m := &TokenManager{secretKey: secretKey, leeway: DefaultLeeway, method: hmacMethods[DefaultAlgorithm], clock: clock.Real{}}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m, nil
+}
+
+// RotateKey makes secret the signing secret and keeps the current one as
+// the previous secret, so tokens signed with it stay valid until they
+// expire; the former previous secret is dropped. An empty secret is
+// replaced by a random one. It returns the new signing secret. The rotation
+// only lasts until restart and is not shared with other instances. Under
+// WithSecretPolicy, a secret CheckSecret rejects fails with an error
+// matching ErrWeakSecret and leaves the keys as they were.
+func (m *TokenManager) RotateKey(secret string) (string, error) {
+	if secret == "" {
+		b := make([]byte, rotatedSecretBytes)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		secret = hex.EncodeToString(b)
+	} else if m.secretPolicy {
+		if err := CheckSecret(secret, m.minSecretBits); err != nil {
+			return "", fmt.Errorf("signing secret %w", err)
+		}
+	}
+
+	m.keyMu.Lock()
+	defer m.keyMu.Unlock()
+	m.previousKey, m.secretKey = m.secretKey, secret
+	return secret, nil
 }
 
-func NewTokenManager(secretKey string) *TokenManager {
-	return &TokenManager{secretKey: secretKey}
+// signingKey returns the secret new tokens are signed with.
+func (m *TokenManager) signingKey() []byte {
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	return []byte(m.secretKey)
 }
 
-func (m *TokenManager) GenerateAccessToken(userID int64, duration time.Duration) (string, error) {
+func (m *TokenManager) GenerateAccessToken(c Claims, duration time.Duration) (string, error) {
+	now := m.clock.Now()
 	claims := jwt.MapClaims{
-		"sub": userID,
-		"exp": time.Now().Add(duration).Unix(),
-		"iat": time.Now().Unix(),
+		"sub":  c.UserID,
+		"role": c.Role,
+		"exp":  now.Add(duration).Unix(),
+		"iat":  now.Unix(),
+	}
+	if c.ACR != "" {
+		claims["acr"] = c.ACR
+	}
+	if c.SessionID != 0 {
+		claims["sid"] = c.SessionID
+	}
+	if c.TokenVersion != 0 {
+		claims["ver"] = c.TokenVersion
+	}
+	if c.Audience != "" {
+		claims["aud"] = c.Audience
+	}
+	if !c.AuthTime.IsZero() {
+		claims["auth_time"] = c.AuthTime.Unix()
+	}
+	for name, value := range c.Extra {
+		if !reservedClaims[name] {
+			claims[name] = value
+		}
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(m.secretKey))
+	token := jwt.NewWithClaims(m.method, claims)
+	return token.SignedString(m.signingKey())
 }
 
 func (m *TokenManager) GenerateRefreshToken() (string, error) {
-	b := make([]byte, 32)
+	b := make([]byte, refreshTokenBytes)
 	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
 	return hex.EncodeToString(b), nil
 }
 
+// IsWellFormedRefreshToken reports whether token has the shape produced by
+// GenerateRefreshToken. It says nothing about whether the token exists.
+func (m *TokenManager) IsWellFormedRefreshToken(token string) bool {
+	if len(token) != hex.EncodedLen(refreshTokenBytes) {
+		return false
+	}
+	for i := 0; i < len(token); i++ {
+		c := token[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// GenerateRefreshJWT issues a self-describing refresh token carrying a random
+// jti, used when refresh tokens are validated statelessly. A non-zero
+// authTime is carried as auth_time, so the access tokens it is exchanged for
+// keep it, and a non-zero tokenVersion as ver, like in access tokens.
+func (m *TokenManager) GenerateRefreshJWT(userID, tokenVersion int64, authTime time.Time, duration time.Duration) (string, *RefreshClaims, error) {
+	jti, err := m.GenerateRefreshToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := m.clock.Now()
+	rc := &RefreshClaims{
+		ID:           jti,
+		UserID:       userID,
+		TokenVersion: tokenVersion,
+		ExpiresAt:    now.Add(duration),
+	}
+	claims := jwt.MapClaims{
+		"sub": userID,
+		"jti": jti,
+		"typ": refreshTokenType,
+		"exp": rc.ExpiresAt.Unix(),
+		"iat": now.Unix(),
+	}
+	if tokenVersion != 0 {
+		claims["ver"] = tokenVersion
+	}
+	if !authTime.IsZero() {
+		rc.AuthTime = time.Unix(authTime.Unix(), 0)
+		claims["auth_time"] = authTime.Unix()
+	}
+
+	token, err := jwt.NewWithClaims(m.method, claims).SignedString(m.signingKey())
+	if err != nil {
+		return "", nil, err
+	}
+	return token, rc, nil
+}
+
+// ParseRefreshJWT validates a token produced by GenerateRefreshJWT. It does
+// not consult any revocation list.
+func (m *TokenManager) ParseRefreshJWT(tokenStr string) (*RefreshClaims, error) {
+	mc, err := m.parse(tokenStr, true)
+	if err != nil {
+		return nil, err
+	}
+	if typ, _ := mc["typ"].(string); typ != refreshTokenType {
+		return nil, fmt.Errorf("%w: not a refresh token", domain.ErrInvalidToken)
+	}
+
+	sub, ok := mc["sub"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing subject", domain.ErrInvalidToken)
+	}
+	jti, ok := mc["jti"].(string)
+	if !ok || jti == "" {
+		return nil, fmt.Errorf("%w: missing jti", domain.ErrInvalidToken)
+	}
+	exp, err := mc.GetExpirationTime()
+	if err != nil || exp == nil {
+		return nil, fmt.Errorf("%w: missing expiry", domain.ErrInvalidToken)
+	}
+
+	rc := &RefreshClaims{
+		ID:        jti,
+		UserID:    int64(sub),
+		ExpiresAt: exp.Time,
+	}
+	if authTime, ok := mc["auth_time"].(float64); ok {
+		rc.AuthTime = time.Unix(int64(authTime), 0)
+	}
+	if ver, ok := mc["ver"].(float64); ok {
+		rc.TokenVersion = int64(ver)
+	}
+	return rc, nil
+}
+
+// GenerateVerificationToken issues a token confirming that userID owns email,
+// to be mailed to that address. It is bound to the address, so it stops
+// working once the user changes it.
+func (m *TokenManager) GenerateVerificationToken(userID int64, email string, duration time.Duration) (string, error) {
+	now := m.clock.Now()
+	claims := jwt.MapClaims{
+		"sub":   userID,
+		"email": email,
+		"typ":   verificationTokenType,
+		"exp":   now.Add(duration).Unix(),
+		"iat":   now.Unix(),
+	}
+	return jwt.NewWithClaims(m.method, claims).SignedString(m.signingKey())
+}
+
+// ParseVerificationToken validates a token produced by
+// GenerateVerificationToken and returns the user and address it confirms.
+func (m *TokenManager) ParseVerificationToken(tokenStr string) (int64, string, error) {
+	mc, err := m.parse(tokenStr, true)
+	if err != nil {
+		return 0, "", err
+	}
+	if typ, _ := mc["typ"].(string); typ != verificationTokenType {
+		return 0, "", fmt.Errorf("%w: not a verification token", domain.ErrInvalidToken)
+	}
+	sub, ok := mc["sub"].(float64)
+	if !ok {
+		return 0, "", fmt.Errorf("%w: missing subject", domain.ErrInvalidToken)
+	}
+	email, ok := mc["email"].(string)
+	if !ok || email == "" {
+		return 0, "", fmt.Errorf("%w: missing email", domain.ErrInvalidToken)
+	}
+	return int64(sub), email, nil
+}
+
 func (m *TokenManager) ValidateToken(tokenStr string) (int64, error) {
+	claims, err := m.ParseToken(tokenStr)
+	if err != nil {
+		return 0, err
+	}
+	return claims.UserID, nil
+}
+
+// ParseToken validates tokenStr and returns its claims. Tokens minted before
+// roles were introduced carry no role claim and are treated as domain.RoleUser.
+func (m *TokenManager) ParseToken(tokenStr string) (*Claims, error) {
+	mc, err := m.parse(tokenStr, true)
+	if err != nil {
+		return nil, err
+	}
+	return accessClaims(mc)
+}
+
+// ParseUnverifiedExpiry is ParseToken without the exp check: it returns the
+// claims of an access token with a valid signature and structure even if it
+// has expired, for flows such as logout or auditing that need to know who a
+// token was issued to. It must never be used to authorize a request.
+func (m *TokenManager) ParseUnverifiedExpiry(tokenStr string) (*Claims, error) {
+	mc, err := m.parse(tokenStr, false)
+	if err != nil {
+		return nil, err
+	}
+	return accessClaims(mc)
+}
+
+func accessClaims(mc jwt.MapClaims) (*Claims, error) {
+	if typ, _ := mc["typ"].(string); typ != "" {
+		return nil, fmt.Errorf("%w: %s token used as access token", domain.ErrInvalidToken, typ)
+	}
+
+	sub, ok := mc["sub"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing subject", domain.ErrInvalidToken)
+	}
+
+	claims := &Claims{
+		UserID: int64(sub),
+		Role:   domain.RoleUser,
+	}
+	if role, ok := mc["role"].(string); ok && role != "" {
+		claims.Role = role
+	}
+	if acr, ok := mc["acr"].(string); ok {
+		claims.ACR = acr
+	}
+	if sid, ok := mc["sid"].(float64); ok {
+		claims.SessionID = int64(sid)
+	}
+	if ver, ok := mc["ver"].(float64); ok {
+		claims.TokenVersion = int64(ver)
+	}
+	if aud, err := mc.GetAudience(); err == nil && len(aud) > 0 {
+		claims.Audience = aud[0]
+	}
+	if authTime, ok := mc["auth_time"].(float64); ok {
+		claims.AuthTime = time.Unix(int64(authTime), 0)
+	}
+	if iat, err := mc.GetIssuedAt(); err == nil && iat != nil {
+		claims.IssuedAt = iat.Time
+	}
+	if exp, err := mc.GetExpirationTime(); err == nil && exp != nil {
+		claims.ExpiresAt = exp.Time
+	}
+	for name, value := range mc {
+		if reservedClaims[name] {
+			continue
+		}
+		if claims.Extra == nil {
+			claims.Extra = make(map[string]any)
+		}
+		claims.Extra[name] = value
+	}
+	return claims, nil
+}
+
+// parse verifies the signature and time claims of tokenStr against the
+// primary and, if set, previous secret. Only the configured HMAC variant is
+// accepted. A token whose iat or nbf is in the future by more than the
+// leeway was minted by a node with a badly skewed clock, or forged, and is
+// rejected as invalid. exp is only checked if checkExpiry is set, with the
+// separate expiry leeway.
+func (m *TokenManager) parse(tokenStr string, checkExpiry bool) (jwt.MapClaims, error) {
+	// The library applies a single leeway to every time claim, so they are
+	// checked below instead.
 	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method")
 		}
-		return []byte(m.secretKey), nil
-	})
-
-	if err != nil {
-		if errors.Is(err, jwt.ErrTokenExpired) {
-			return 0, domain.ErrTokenExpired
+		m.keyMu.RLock()
+		defer m.keyMu.RUnlock()
+		if m.previousKey == "" {
+			return []byte(m.secretKey), nil
 		}
-		return 0, fmt.Errorf("invalid token: %w", err)
+		return jwt.VerificationKeySet{Keys: []jwt.VerificationKey{[]byte(m.secretKey), []byte(m.previousKey)}}, nil
+	}, jwt.WithValidMethods([]string{m.method.Alg()}), jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", domain.ErrInvalidToken, err)
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		userID := int64(claims["sub"].(float64))
-		return userID, nil
+	mc, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, domain.ErrInvalidToken
 	}
+	if err := m.checkTimes(mc, checkExpiry); err != nil {
+		return nil, err
+	}
+	return mc, nil
+}
 
-	return 0, fmt.Errorf("invalid token")
+// checkTimes validates the iat, nbf and, if checkExpiry is set, exp claims
+// of mc against the manager's clock.
+func (m *TokenManager) checkTimes(mc jwt.MapClaims, checkExpiry bool) error {
+	now := m.clock.Now()
+	iat, err := mc.GetIssuedAt()
+	if err != nil {
+		return fmt.Errorf("%w: %w", domain.ErrInvalidToken, err)
+	}
+	if iat != nil && iat.After(now.Add(m.leeway)) {
+		return fmt.Errorf("%w: %w", domain.ErrInvalidToken, jwt.ErrTokenUsedBeforeIssued)
+	}
+	nbf, err := mc.GetNotBefore()
+	if err != nil {
+		return fmt.Errorf("%w: %w", domain.ErrInvalidToken, err)
+	}
+	if nbf != nil && nbf.After(now.Add(m.leeway)) {
+		return fmt.Errorf("%w: %w", domain.ErrInvalidToken, jwt.ErrTokenNotValidYet)
+	}
+	if !checkExpiry {
+		return nil
+	}
+	exp, err := mc.GetExpirationTime()
+	if err != nil {
+		return fmt.Errorf("%w: %w", domain.ErrInvalidToken, err)
+	}
+	if exp != nil && !now.Before(exp.Add(m.expiryLeeway)) {
+		return domain.ErrTokenExpired
+	}
+	return nil
 }
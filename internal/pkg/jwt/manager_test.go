@@ -0,0 +1,455 @@
+package jwt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/Kovalyovv/auth-service/internal/pkg/clock"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newManager(t *testing.T, secret string, opts ...Option) *TokenManager {
+	t.Helper()
+	m, err := NewTokenManager(secret, opts...)
+	require.NoError(t, err)
+	return m
+}
+
+func TestNewTokenManager_EmptySecret(t *testing.T) {
+	m, err := NewTokenManager("")
+
+	assert.ErrorIs(t, err, ErrEmptySecret)
+	assert.Nil(t, m)
+}
+
+func signWithIssuedAt(t *testing.T, secret string, iat time.Time) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":  1,
+		"role": domain.RoleUser,
+		"iat":  iat.Unix(),
+		"exp":  iat.Add(15 * time.Minute).Unix(),
+	}).SignedString([]byte(secret))
+	require.NoError(t, err)
+	return token
+}
+
+func TestTokenManager_ValidateToken_IssuedAt(t *testing.T) {
+	m := newManager(t, "secret", WithLeeway(30*time.Second))
+
+	t.Run("Given an iat slightly in the future", func(t *testing.T) {
+		token := signWithIssuedAt(t, "secret", time.Now().Add(10*time.Second))
+
+		userID, err := m.ValidateToken(token)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), userID)
+	})
+
+	t.Run("Given an iat far in the future", func(t *testing.T) {
+		token := signWithIssuedAt(t, "secret", time.Now().Add(time.Hour))
+
+		_, err := m.ValidateToken(token)
+
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+	})
+
+	t.Run("Given an iat in the past", func(t *testing.T) {
+		token := signWithIssuedAt(t, "secret", time.Now().Add(-time.Minute))
+
+		_, err := m.ValidateToken(token)
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestTokenManager_Algorithm(t *testing.T) {
+	algs := []string{"HS256", "HS384", "HS512"}
+	for _, signAlg := range algs {
+		for _, verifyAlg := range algs {
+			t.Run(signAlg+" verified with "+verifyAlg, func(t *testing.T) {
+				signer := newManager(t, "secret", WithAlgorithm(signAlg))
+				verifier := newManager(t, "secret", WithAlgorithm(verifyAlg))
+				token, err := signer.GenerateAccessToken(Claims{UserID: 1, Role: domain.RoleUser}, time.Minute)
+				require.NoError(t, err)
+
+				userID, err := verifier.ValidateToken(token)
+
+				if signAlg != verifyAlg {
+					assert.ErrorIs(t, err, domain.ErrInvalidToken)
+					return
+				}
+				assert.NoError(t, err)
+				assert.Equal(t, int64(1), userID)
+			})
+		}
+	}
+}
+
+func TestTokenManager_ExtraClaims(t *testing.T) {
+	m := newManager(t, "secret")
+
+	token, err := m.GenerateAccessToken(Claims{
+		UserID: 1,
+		Role:   domain.RoleUser,
+		Extra:  map[string]any{"tenant_id": "acme", "sub": float64(2), "role": domain.RoleAdmin},
+	}, time.Minute)
+	require.NoError(t, err)
+
+	claims, err := m.ParseToken(token)
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"tenant_id": "acme"}, claims.Extra)
+	assert.Equal(t, int64(1), claims.UserID, "extra claims must not override sub")
+	assert.Equal(t, domain.RoleUser, claims.Role, "extra claims must not override role")
+}
+
+func TestTokenManager_Clock(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Given an access token at its expiry boundary", func(t *testing.T) {
+		c := clock.NewFake(start)
+		m := newManager(t, "secret", WithLeeway(0), WithClock(c))
+		token, err := m.GenerateAccessToken(Claims{UserID: 1}, time.Minute)
+		require.NoError(t, err)
+
+		c.Advance(time.Minute - time.Second)
+		claims, err := m.ParseToken(token)
+		require.NoError(t, err)
+		assert.True(t, claims.IssuedAt.Equal(start))
+		assert.True(t, claims.ExpiresAt.Equal(start.Add(time.Minute)))
+
+		c.Advance(time.Second)
+		_, err = m.ParseToken(token)
+		assert.ErrorIs(t, err, domain.ErrTokenExpired)
+	})
+
+	t.Run("Given a leeway", func(t *testing.T) {
+		c := clock.NewFake(start)
+		m := newManager(t, "secret", WithLeeway(30*time.Second), WithClock(c))
+		token, err := m.GenerateAccessToken(Claims{UserID: 1}, time.Minute)
+		require.NoError(t, err)
+
+		c.Advance(time.Minute - time.Second)
+		_, err = m.ParseToken(token)
+		assert.NoError(t, err)
+
+		c.Advance(time.Second)
+		_, err = m.ParseToken(token)
+		assert.ErrorIs(t, err, domain.ErrTokenExpired, "the leeway must not extend a token past exp")
+	})
+
+	t.Run("Given an expiry leeway", func(t *testing.T) {
+		c := clock.NewFake(start)
+		m := newManager(t, "secret", WithLeeway(0), WithExpiryLeeway(30*time.Second), WithClock(c))
+		token, err := m.GenerateAccessToken(Claims{UserID: 1}, time.Minute)
+		require.NoError(t, err)
+
+		c.Advance(time.Minute + 29*time.Second)
+		_, err = m.ParseToken(token)
+		assert.NoError(t, err)
+
+		c.Advance(time.Second)
+		_, err = m.ParseToken(token)
+		assert.ErrorIs(t, err, domain.ErrTokenExpired)
+	})
+
+	t.Run("Given a refresh JWT at its expiry boundary", func(t *testing.T) {
+		c := clock.NewFake(start)
+		m := newManager(t, "secret", WithLeeway(0), WithClock(c))
+		token, rc, err := m.GenerateRefreshJWT(1, 0, time.Time{}, time.Hour)
+		require.NoError(t, err)
+		assert.True(t, rc.ExpiresAt.Equal(start.Add(time.Hour)))
+
+		c.Advance(time.Hour - time.Second)
+		_, err = m.ParseRefreshJWT(token)
+		require.NoError(t, err)
+
+		c.Advance(time.Second)
+		_, err = m.ParseRefreshJWT(token)
+		assert.ErrorIs(t, err, domain.ErrTokenExpired)
+	})
+
+	t.Run("Given a token issued by a clock running ahead", func(t *testing.T) {
+		ahead := newManager(t, "secret", WithClock(clock.NewFake(start.Add(time.Hour))))
+		token, err := ahead.GenerateAccessToken(Claims{UserID: 1}, 2*time.Hour)
+		require.NoError(t, err)
+
+		m := newManager(t, "secret", WithLeeway(30*time.Second), WithClock(clock.NewFake(start)))
+		_, err = m.ParseToken(token)
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+	})
+}
+
+func TestTokenManager_SessionID(t *testing.T) {
+	m := newManager(t, "secret")
+
+	t.Run("Given a token issued with a session", func(t *testing.T) {
+		token, err := m.GenerateAccessToken(Claims{UserID: 1, SessionID: 42}, time.Minute)
+		require.NoError(t, err)
+
+		claims, err := m.ParseToken(token)
+
+		require.NoError(t, err)
+		assert.Equal(t, int64(42), claims.SessionID)
+		assert.Empty(t, claims.Extra)
+	})
+
+	t.Run("Given a token issued without a session", func(t *testing.T) {
+		token, err := m.GenerateAccessToken(Claims{UserID: 1, Extra: map[string]any{"sid": float64(7)}}, time.Minute)
+		require.NoError(t, err)
+
+		claims, err := m.ParseToken(token)
+
+		require.NoError(t, err)
+		assert.Zero(t, claims.SessionID)
+	})
+}
+
+func TestTokenManager_TokenVersion(t *testing.T) {
+	m := newManager(t, "secret")
+
+	token, err := m.GenerateAccessToken(Claims{UserID: 1, TokenVersion: 3, Extra: map[string]any{"ver": float64(9)}}, time.Minute)
+	require.NoError(t, err)
+
+	claims, err := m.ParseToken(token)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), claims.TokenVersion)
+	assert.Empty(t, claims.Extra)
+
+	refreshToken, _, err := m.GenerateRefreshJWT(1, 4, time.Time{}, time.Minute)
+	require.NoError(t, err)
+
+	rc, err := m.ParseRefreshJWT(refreshToken)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), rc.TokenVersion)
+}
+
+func TestTokenManager_Audience(t *testing.T) {
+	m := newManager(t, "secret")
+
+	token, err := m.GenerateAccessToken(Claims{UserID: 1, Audience: "reports", Extra: map[string]any{"aud": "billing"}}, time.Minute)
+	require.NoError(t, err)
+
+	claims, err := m.ParseToken(token)
+
+	require.NoError(t, err)
+	assert.Equal(t, "reports", claims.Audience)
+	assert.Empty(t, claims.Extra)
+}
+
+func TestTokenManager_VerificationToken(t *testing.T) {
+	m := newManager(t, "secret")
+
+	token, err := m.GenerateVerificationToken(7, "alice@example.com", time.Hour)
+	require.NoError(t, err)
+
+	t.Run("Given a verification token", func(t *testing.T) {
+		userID, email, err := m.ParseVerificationToken(token)
+
+		require.NoError(t, err)
+		assert.Equal(t, int64(7), userID)
+		assert.Equal(t, "alice@example.com", email)
+	})
+
+	t.Run("Given it is used as an access token", func(t *testing.T) {
+		_, err := m.ParseToken(token)
+
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+	})
+
+	t.Run("Given an access token", func(t *testing.T) {
+		access, err := m.GenerateAccessToken(Claims{UserID: 7}, time.Minute)
+		require.NoError(t, err)
+
+		_, _, err = m.ParseVerificationToken(access)
+
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+	})
+}
+
+func TestTokenManager_AuthTime(t *testing.T) {
+	m := newManager(t, "secret")
+	authTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	t.Run("Given an access token", func(t *testing.T) {
+		token, err := m.GenerateAccessToken(Claims{UserID: 1, AuthTime: authTime, Extra: map[string]any{"auth_time": float64(0)}}, time.Minute)
+		require.NoError(t, err)
+
+		claims, err := m.ParseToken(token)
+
+		require.NoError(t, err)
+		assert.True(t, authTime.Equal(claims.AuthTime))
+		assert.Empty(t, claims.Extra)
+	})
+
+	t.Run("Given a refresh token", func(t *testing.T) {
+		token, rc, err := m.GenerateRefreshJWT(1, 0, authTime, time.Hour)
+		require.NoError(t, err)
+
+		parsed, err := m.ParseRefreshJWT(token)
+
+		require.NoError(t, err)
+		assert.True(t, authTime.Equal(rc.AuthTime))
+		assert.True(t, authTime.Equal(parsed.AuthTime))
+	})
+}
+
+func TestTokenManager_RotateKey(t *testing.T) {
+	m := newManager(t, "old-secret")
+	oldToken, err := m.GenerateAccessToken(Claims{UserID: 1, Role: domain.RoleUser}, time.Minute)
+	require.NoError(t, err)
+
+	secret, err := m.RotateKey("")
+	require.NoError(t, err)
+	assert.Len(t, secret, 2*rotatedSecretBytes)
+
+	_, err = m.ValidateToken(oldToken)
+	assert.NoError(t, err, "tokens signed with the replaced secret must stay valid")
+	newToken, err := m.GenerateAccessToken(Claims{UserID: 2, Role: domain.RoleUser}, time.Minute)
+	require.NoError(t, err)
+	userID, err := newManager(t, secret).ValidateToken(newToken)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), userID)
+
+	_, err = m.RotateKey("newest-secret")
+	require.NoError(t, err)
+	_, err = m.ValidateToken(oldToken)
+	assert.ErrorIs(t, err, domain.ErrInvalidToken, "a second rotation drops the oldest secret")
+	_, err = m.ValidateToken(newToken)
+	assert.NoError(t, err)
+}
+
+func TestTokenManager_RotateKey_SecretPolicy(t *testing.T) {
+	m := newManager(t, "old-secret", WithSecretPolicy(80))
+
+	for _, weak := range []string{strings.Repeat("a", 32), "your-super-secret-key"} {
+		_, err := m.RotateKey(weak)
+		assert.ErrorIs(t, err, ErrWeakSecret, weak)
+	}
+	token, err := m.GenerateAccessToken(Claims{UserID: 1, Role: domain.RoleUser}, time.Minute)
+	require.NoError(t, err)
+	_, err = newManager(t, "old-secret").ValidateToken(token)
+	assert.NoError(t, err, "a rejected secret must leave the signing key as it was")
+
+	_, err = m.RotateKey("3q2+7wYH8fK0pLZr5TNcVb1mXa4sJd6E")
+	assert.NoError(t, err)
+	_, err = m.RotateKey("")
+	assert.NoError(t, err, "generated secrets need no check")
+}
+
+func TestTokenManager_PreviousSecret(t *testing.T) {
+	old := newManager(t, "old-secret")
+	rotated := newManager(t, "new-secret", WithPreviousSecret("old-secret"))
+	afterOverlap := newManager(t, "new-secret")
+
+	oldToken, err := old.GenerateAccessToken(Claims{UserID: 1, Role: domain.RoleUser}, time.Minute)
+	require.NoError(t, err)
+
+	t.Run("Given a token signed with the previous secret", func(t *testing.T) {
+		userID, err := rotated.ValidateToken(oldToken)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), userID)
+	})
+
+	t.Run("Given a new token", func(t *testing.T) {
+		token, err := rotated.GenerateAccessToken(Claims{UserID: 2, Role: domain.RoleUser}, time.Minute)
+		require.NoError(t, err)
+
+		_, err = old.ValidateToken(token)
+		assert.ErrorIs(t, err, domain.ErrInvalidToken, "new tokens must be signed with the primary secret")
+		userID, err := afterOverlap.ValidateToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), userID)
+	})
+
+	t.Run("Given the previous secret was removed", func(t *testing.T) {
+		_, err := afterOverlap.ValidateToken(oldToken)
+
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+	})
+
+	t.Run("Given an expired token signed with the previous secret", func(t *testing.T) {
+		expired, err := old.GenerateAccessToken(Claims{UserID: 1, Role: domain.RoleUser}, -time.Hour)
+		require.NoError(t, err)
+
+		_, err = rotated.ValidateToken(expired)
+
+		assert.ErrorIs(t, err, domain.ErrTokenExpired)
+	})
+
+	t.Run("Given a token signed with an unknown secret", func(t *testing.T) {
+		forged, err := newManager(t, "other-secret").GenerateAccessToken(Claims{UserID: 1, Role: domain.RoleUser}, time.Minute)
+		require.NoError(t, err)
+
+		_, err = rotated.ValidateToken(forged)
+
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+	})
+}
+
+func TestTokenManager_ParseUnverifiedExpiry(t *testing.T) {
+	m := newManager(t, "secret")
+
+	t.Run("Given an expired access token", func(t *testing.T) {
+		token, err := m.GenerateAccessToken(Claims{UserID: 7, Role: domain.RoleAdmin}, -time.Hour)
+		require.NoError(t, err)
+
+		claims, err := m.ParseUnverifiedExpiry(token)
+
+		require.NoError(t, err)
+		assert.Equal(t, int64(7), claims.UserID)
+		assert.Equal(t, domain.RoleAdmin, claims.Role)
+		_, err = m.ParseToken(token)
+		assert.ErrorIs(t, err, domain.ErrTokenExpired)
+	})
+
+	t.Run("Given a token signed with another secret", func(t *testing.T) {
+		token, err := newManager(t, "other").GenerateAccessToken(Claims{UserID: 7}, -time.Hour)
+		require.NoError(t, err)
+
+		_, err = m.ParseUnverifiedExpiry(token)
+
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+	})
+
+	t.Run("Given an expired token with a tampered payload", func(t *testing.T) {
+		token, err := m.GenerateAccessToken(Claims{UserID: 7, Role: domain.RoleUser}, -time.Hour)
+		require.NoError(t, err)
+		parts := strings.Split(token, ".")
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		require.NoError(t, err)
+		payload = bytes.Replace(payload, []byte(`"role":"user"`), []byte(`"role":"admin"`), 1)
+		parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+
+		_, err = m.ParseUnverifiedExpiry(strings.Join(parts, "."))
+
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+	})
+
+	t.Run("Given a token issued in the future", func(t *testing.T) {
+		token := signWithIssuedAt(t, "secret", time.Now().Add(time.Hour))
+
+		_, err := m.ParseUnverifiedExpiry(token)
+
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+	})
+
+	t.Run("Given a refresh token", func(t *testing.T) {
+		token, _, err := m.GenerateRefreshJWT(7, 0, time.Time{}, time.Hour)
+		require.NoError(t, err)
+
+		_, err = m.ParseUnverifiedExpiry(token)
+
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+	})
+}
@@ -0,0 +1,80 @@
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ErrWeakSecret is matched by the errors CheckSecret returns.
+var ErrWeakSecret = errors.New("weak signing secret")
+
+// weakSecrets are placeholder and dictionary values that show up in copied
+// configuration. They are compared case-insensitively.
+var weakSecrets = map[string]bool{
+	"secret":                true,
+	"secretkey":             true,
+	"secret-key":            true,
+	"secret_key":            true,
+	"supersecret":           true,
+	"jwt-secret":            true,
+	"jwt_secret":            true,
+	"jwtsecret":             true,
+	"password":              true,
+	"changeme":              true,
+	"change-me":             true,
+	"default":               true,
+	"admin":                 true,
+	"test":                  true,
+	"qwerty":                true,
+	"letmein":               true,
+	"123456":                true,
+	"12345678":              true,
+	"your-super-secret-key": true,
+	"your_secret_key_here":  true,
+}
+
+// secretEntropy estimates the entropy of s in bits from the frequency of
+// its characters. It is a lower bound for random secrets and an
+// overestimate for words, which the blocklist covers instead.
+func secretEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var perChar float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		perChar -= p * math.Log2(p)
+	}
+	return perChar * float64(n)
+}
+
+// weakSecretError says why CheckSecret rejected a secret, phrased to follow
+// the secret's name. It matches ErrWeakSecret.
+type weakSecretError struct {
+	reason string
+}
+
+func (e *weakSecretError) Error() string { return e.reason }
+
+func (e *weakSecretError) Is(target error) bool { return target == ErrWeakSecret }
+
+// CheckSecret rejects blocklisted secrets and secrets whose estimated
+// entropy is below minBits. The error reads as a predicate, e.g. "is too
+// predictable: ...", for callers to prefix with the secret's name.
+func CheckSecret(secret string, minBits int) error {
+	if weakSecrets[strings.ToLower(secret)] {
+		return &weakSecretError{"is a well-known placeholder; generate a random one, e.g. with `openssl rand -base64 32`"}
+	}
+	if bits := secretEntropy(secret); bits < float64(minBits) {
+		return &weakSecretError{fmt.Sprintf("is too predictable: about %.0f bits of entropy, need %d; use a longer random value", bits, minBits)}
+	}
+	return nil
+}
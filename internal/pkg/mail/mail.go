@@ -0,0 +1,211 @@
+// Package mail sends the account emails of the verification, password reset
+// and registration flows.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"text/template"
+)
+
+// message is a rendered email.
+type message struct {
+	Subject string
+	Body    string
+}
+
+type templateData struct {
+	Link string
+}
+
+var (
+	verificationTemplate = template.Must(template.New("verification").Parse(
+		`Please confirm your email address by opening this link:
+
+{{.Link}}
+
+If you did not create an account, ignore this email.
+`))
+	passwordResetTemplate = template.Must(template.New("password_reset").Parse(
+		`A password reset was requested for your account. To choose a new password, open this link:
+
+{{.Link}}
+
+If you did not request a reset, ignore this email; your password is unchanged.
+`))
+	accountExistsTemplate = template.Must(template.New("account_exists").Parse(
+		`Someone tried to create an account with this email address, but you already have one. If it was you, sign in here:
+
+{{.Link}}
+
+If you forgot your password, you can reset it from the sign-in page. If it was not you, ignore this email.
+`))
+)
+
+const (
+	verificationSubject  = "Confirm your email address"
+	passwordResetSubject = "Reset your password"
+	accountExistsSubject = "You already have an account"
+
+	verificationPath  = "/verify-email"
+	passwordResetPath = "/reset-password"
+	loginPath         = "/login"
+)
+
+// links builds the URLs that carry tokens back to the frontend.
+type links struct {
+	baseURL string
+}
+
+func (l links) url(path string) string {
+	return strings.TrimRight(l.baseURL, "/") + path
+}
+
+func (l links) withToken(path, token string) string {
+	return l.url(path) + "?token=" + url.QueryEscape(token)
+}
+
+func (l links) render(tmpl *template.Template, subject, link string) (message, error) {
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, templateData{Link: link}); err != nil {
+		return message{}, fmt.Errorf("render %s email: %w", tmpl.Name(), err)
+	}
+	return message{Subject: subject, Body: body.String()}, nil
+}
+
+func (l links) verification(token string) (message, error) {
+	return l.render(verificationTemplate, verificationSubject, l.withToken(verificationPath, token))
+}
+
+func (l links) passwordReset(token string) (message, error) {
+	return l.render(passwordResetTemplate, passwordResetSubject, l.withToken(passwordResetPath, token))
+}
+
+func (l links) accountExists() (message, error) {
+	return l.render(accountExistsTemplate, accountExistsSubject, l.url(loginPath))
+}
+
+// SMTPConfig locates the SMTP relay. Username may be empty for relays that
+// do not authenticate.
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	// LinkBaseURL is the frontend origin that verification and reset links
+	// point to.
+	LinkBaseURL string
+}
+
+// SMTPMailer sends mail through an SMTP relay.
+type SMTPMailer struct {
+	addr  string
+	auth  smtp.Auth
+	from  string
+	links links
+	send  func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func NewSMTPMailer(cfg SMTPConfig) *SMTPMailer {
+	m := &SMTPMailer{
+		addr:  net.JoinHostPort(cfg.Host, cfg.Port),
+		from:  cfg.From,
+		links: links{baseURL: cfg.LinkBaseURL},
+		send:  smtp.SendMail,
+	}
+	if cfg.Username != "" {
+		m.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	return m
+}
+
+// SendVerification mails to a link confirming their address with token.
+func (m *SMTPMailer) SendVerification(ctx context.Context, to, token string) error {
+	msg, err := m.links.verification(token)
+	if err != nil {
+		return err
+	}
+	return m.deliver(to, msg)
+}
+
+// SendPasswordReset mails to a link that resets their password with token.
+func (m *SMTPMailer) SendPasswordReset(ctx context.Context, to, token string) error {
+	msg, err := m.links.passwordReset(token)
+	if err != nil {
+		return err
+	}
+	return m.deliver(to, msg)
+}
+
+// SendAccountExists tells to that someone tried to register with their
+// address although it already has an account.
+func (m *SMTPMailer) SendAccountExists(ctx context.Context, to string) error {
+	msg, err := m.links.accountExists()
+	if err != nil {
+		return err
+	}
+	return m.deliver(to, msg)
+}
+
+func (m *SMTPMailer) deliver(to string, msg message) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", m.from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	if err := m.send(m.addr, m.auth, m.from, []string{to}, b.Bytes()); err != nil {
+		return fmt.Errorf("send mail to %s: %w", to, err)
+	}
+	return nil
+}
+
+// LogMailer writes emails to the log instead of sending them. It is meant
+// for development, where following the logged link stands in for a mailbox.
+type LogMailer struct {
+	links links
+}
+
+func NewLogMailer(linkBaseURL string) *LogMailer {
+	return &LogMailer{links: links{baseURL: linkBaseURL}}
+}
+
+func (m *LogMailer) SendVerification(ctx context.Context, to, token string) error {
+	msg, err := m.links.verification(token)
+	if err != nil {
+		return err
+	}
+	m.log(ctx, to, msg)
+	return nil
+}
+
+func (m *LogMailer) SendPasswordReset(ctx context.Context, to, token string) error {
+	msg, err := m.links.passwordReset(token)
+	if err != nil {
+		return err
+	}
+	m.log(ctx, to, msg)
+	return nil
+}
+
+func (m *LogMailer) SendAccountExists(ctx context.Context, to string) error {
+	msg, err := m.links.accountExists()
+	if err != nil {
+		return err
+	}
+	m.log(ctx, to, msg)
+	return nil
+}
+
+func (m *LogMailer) log(ctx context.Context, to string, msg message) {
+	slog.InfoContext(ctx, "mail not sent: log mailer", "to", to, "subject", msg.Subject, "body", msg.Body)
+}
@@ -0,0 +1,89 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"net/smtp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sent struct {
+	addr string
+	from string
+	to   []string
+	msg  string
+}
+
+func newTestSMTPMailer(sendErr error) (*SMTPMailer, *[]sent) {
+	var outbox []sent
+	m := NewSMTPMailer(SMTPConfig{
+		Host:        "smtp.example.com",
+		Port:        "587",
+		From:        "no-reply@example.com",
+		LinkBaseURL: "https://app.example.com/",
+	})
+	m.send = func(addr string, _ smtp.Auth, from string, to []string, msg []byte) error {
+		outbox = append(outbox, sent{addr: addr, from: from, to: to, msg: string(msg)})
+		return sendErr
+	}
+	return m, &outbox
+}
+
+func TestSMTPMailer(t *testing.T) {
+	tests := map[string]struct {
+		send        func(m *SMTPMailer) error
+		wantSubject string
+		wantLink    string
+	}{
+		"Given a verification email": {
+			send: func(m *SMTPMailer) error {
+				return m.SendVerification(context.Background(), "alice@example.com", "tok/en")
+			},
+			wantSubject: "Subject: " + verificationSubject,
+			wantLink:    "https://app.example.com/verify-email?token=tok%2Fen",
+		},
+		"Given a password reset email": {
+			send: func(m *SMTPMailer) error {
+				return m.SendPasswordReset(context.Background(), "alice@example.com", "tok/en")
+			},
+			wantSubject: "Subject: " + passwordResetSubject,
+			wantLink:    "https://app.example.com/reset-password?token=tok%2Fen",
+		},
+		"Given an account exists email": {
+			send: func(m *SMTPMailer) error {
+				return m.SendAccountExists(context.Background(), "alice@example.com")
+			},
+			wantSubject: "Subject: " + accountExistsSubject,
+			wantLink:    "https://app.example.com/login",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			m, outbox := newTestSMTPMailer(nil)
+
+			err := tt.send(m)
+
+			require.NoError(t, err)
+			require.Len(t, *outbox, 1)
+			got := (*outbox)[0]
+			assert.Equal(t, "smtp.example.com:587", got.addr)
+			assert.Equal(t, "no-reply@example.com", got.from)
+			assert.Equal(t, []string{"alice@example.com"}, got.to)
+			assert.Contains(t, got.msg, "To: alice@example.com\r\n")
+			assert.Contains(t, got.msg, tt.wantSubject+"\r\n")
+			assert.Contains(t, got.msg, tt.wantLink)
+		})
+	}
+
+	t.Run("Given the relay fails", func(t *testing.T) {
+		relayErr := errors.New("connection refused")
+		m, _ := newTestSMTPMailer(relayErr)
+
+		err := m.SendVerification(context.Background(), "alice@example.com", "token")
+
+		assert.ErrorIs(t, err, relayErr)
+	})
+}
@@ -0,0 +1,163 @@
+// Package webhook delivers domain events to an external HTTP endpoint.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+)
+
+const (
+	// SignatureHeader carries "sha256=" followed by the hex HMAC-SHA256 of
+	// the request body keyed with the shared secret.
+	SignatureHeader = "X-Webhook-Signature"
+	// EventHeader repeats the event type so receivers can route without
+	// decoding the body.
+	EventHeader = "X-Webhook-Event"
+
+	defaultQueueSize   = 256
+	defaultMaxAttempts = 3
+	defaultTimeout     = 5 * time.Second
+	defaultBackoff     = 500 * time.Millisecond
+)
+
+// Dispatcher queues events and POSTs them to a URL from a background worker,
+// retrying failed deliveries a bounded number of times. Publish never blocks:
+// when the queue is full the event is dropped and logged.
+type Dispatcher struct {
+	url         string
+	secret      []byte
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	queue       chan domain.Event
+}
+
+// Option configures optional Dispatcher behaviour.
+type Option func(*Dispatcher)
+
+// WithMaxAttempts bounds how many times one event is sent before giving up.
+func WithMaxAttempts(n int) Option {
+	return func(d *Dispatcher) {
+		d.maxAttempts = n
+	}
+}
+
+// WithTimeout bounds a single delivery attempt.
+func WithTimeout(timeout time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.client.Timeout = timeout
+	}
+}
+
+// WithBackoff sets the delay before the first retry; it doubles after each
+// further failure.
+func WithBackoff(backoff time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.backoff = backoff
+	}
+}
+
+// WithQueueSize sets how many events may wait for delivery.
+func WithQueueSize(n int) Option {
+	return func(d *Dispatcher) {
+		d.queue = make(chan domain.Event, n)
+	}
+}
+
+func NewDispatcher(url, secret string, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		url:         url,
+		secret:      []byte(secret),
+		client:      &http.Client{Timeout: defaultTimeout},
+		maxAttempts: defaultMaxAttempts,
+		backoff:     defaultBackoff,
+		queue:       make(chan domain.Event, defaultQueueSize),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Publish queues event for delivery.
+func (d *Dispatcher) Publish(_ context.Context, event domain.Event) {
+	select {
+	case d.queue <- event:
+	default:
+		slog.Warn("webhook queue full, dropping event", "type", event.Type, "user_id", event.UserID)
+	}
+}
+
+// Run delivers queued events until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-d.queue:
+			if err := d.deliver(ctx, event); err != nil {
+				slog.Error("webhook delivery failed", "type", event.Type, "user_id", event.UserID, "error", err)
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, event domain.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+
+	backoff := d.backoff
+	for attempt := 1; ; attempt++ {
+		err = d.send(ctx, event.Type, body)
+		if err == nil || attempt >= d.maxAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, eventType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, eventType)
+	req.Header.Set(SignatureHeader, Sign(d.secret, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the SignatureHeader value for body.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
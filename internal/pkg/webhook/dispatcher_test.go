@@ -0,0 +1,89 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+func newReceiver(t *testing.T, statuses ...int) (*httptest.Server, <-chan received) {
+	t.Helper()
+	ch := make(chan received, 10)
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ch <- received{header: r.Header.Clone(), body: body}
+		status := http.StatusNoContent
+		if calls < len(statuses) {
+			status = statuses[calls]
+		}
+		calls++
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, ch
+}
+
+func waitFor(t *testing.T, ch <-chan received) received {
+	t.Helper()
+	select {
+	case r := <-ch:
+		return r
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook was not delivered")
+		return received{}
+	}
+}
+
+func TestDispatcher_Publish(t *testing.T) {
+	t.Run("Given a registration event", func(t *testing.T) {
+		srv, ch := newReceiver(t)
+		d := NewDispatcher(srv.URL, "secret")
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go d.Run(ctx)
+
+		event := domain.Event{
+			Type:       domain.EventUserRegistered,
+			UserID:     42,
+			OccurredAt: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+			Data:       map[string]string{"email": "test@example.com"},
+		}
+		d.Publish(ctx, event)
+
+		got := waitFor(t, ch)
+		assert.Equal(t, Sign([]byte("secret"), got.body), got.header.Get(SignatureHeader))
+		assert.Equal(t, domain.EventUserRegistered, got.header.Get(EventHeader))
+		var payload domain.Event
+		require.NoError(t, json.Unmarshal(got.body, &payload))
+		assert.Equal(t, event, payload)
+	})
+
+	t.Run("Given the receiver fails transiently", func(t *testing.T) {
+		srv, ch := newReceiver(t, http.StatusInternalServerError, http.StatusBadGateway)
+		d := NewDispatcher(srv.URL, "secret", WithMaxAttempts(3), WithBackoff(time.Millisecond))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go d.Run(ctx)
+
+		d.Publish(ctx, domain.Event{Type: domain.EventUserLogin, UserID: 1})
+
+		first := waitFor(t, ch)
+		waitFor(t, ch)
+		last := waitFor(t, ch)
+		assert.Equal(t, first.body, last.body)
+	})
+}
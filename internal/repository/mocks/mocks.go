@@ -0,0 +1,10 @@
+// Package mocks holds mockery mocks of the repository interfaces. Files other
+// than this one are generated; do not edit them by hand.
+package mocks
+
+import "github.com/Kovalyovv/auth-service/internal/repository"
+
+var (
+	_ repository.UserRepository         = (*UserRepository)(nil)
+	_ repository.TokenCleanupRepository = (*TokenCleanupRepository)(nil)
+)
@@ -0,0 +1,75 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+)
+
+// RecordAuthEvent stores e. A zero UserID or ActorID is stored as NULL.
+func (r *UserRepo) RecordAuthEvent(ctx context.Context, e domain.AuthEvent) error {
+	query := `INSERT INTO auth_events (user_id, actor_id, email, type, success) VALUES (NULLIF($1, 0), NULLIF($2, 0), $3, $4, $5)`
+	_, err := r.db.Exec(ctx, query, e.UserID, e.ActorID, e.Email, e.Type, e.Success)
+	if err != nil {
+		return fmt.Errorf("failed to record auth event: %w", err)
+	}
+	return nil
+}
+
+// ListAuthEvents returns events matching f, newest first.
+func (r *UserRepo) ListAuthEvents(ctx context.Context, f domain.AuthEventFilter) ([]domain.AuthEvent, error) {
+	var (
+		where []string
+		args  []any
+	)
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if f.UserID != 0 {
+		add("user_id = $%d", f.UserID)
+	}
+	if f.Email != "" {
+		add("email = $%d", f.Email)
+	}
+	if f.Type != "" {
+		add("type = $%d", f.Type)
+	}
+	if f.Success != nil {
+		add("success = $%d", *f.Success)
+	}
+	if !f.From.IsZero() {
+		add("created_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("created_at < $%d", f.To)
+	}
+
+	query := `SELECT id, COALESCE(user_id, 0), COALESCE(actor_id, 0), email, type, success, created_at FROM auth_events`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, f.PageSize(), max(f.Offset, 0))
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ListAuthEvents query failed: %w", err)
+	}
+	defer rows.Close()
+
+	events := []domain.AuthEvent{}
+	for rows.Next() {
+		var e domain.AuthEvent
+		if err := rows.Scan(&e.ID, &e.UserID, &e.ActorID, &e.Email, &e.Type, &e.Success, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ListAuthEvents scan failed: %w", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ListAuthEvents rows failed: %w", err)
+	}
+	return events, nil
+}
@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserRepo_ListAuthEvents(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepo(testPool)
+
+	setupTables(t, ctx)
+	defer cleanupTables(t, ctx)
+
+	alice := &domain.User{Username: "alice", Email: "alice@test.com", PasswordHash: "hash", Role: domain.RoleUser}
+	require.NoError(t, repo.Create(ctx, alice))
+	bob := &domain.User{Username: "bob", Email: "bob@test.com", PasswordHash: "hash", Role: domain.RoleUser}
+	require.NoError(t, repo.Create(ctx, bob))
+
+	seed := []domain.AuthEvent{
+		{UserID: alice.ID, Email: alice.Email, Type: domain.EventUserRegistered, Success: true},
+		{UserID: alice.ID, Email: alice.Email, Type: domain.EventUserLogin, Success: true},
+		{UserID: alice.ID, Email: alice.Email, Type: domain.EventUserLogin, Success: false},
+		{UserID: bob.ID, Email: bob.Email, Type: domain.EventUserLogin, Success: true},
+		{UserID: bob.ID, ActorID: alice.ID, Type: domain.EventUserRoleChanged, Success: true},
+		{Email: "ghost@test.com", Type: domain.EventUserLogin, Success: false},
+	}
+	for _, e := range seed {
+		require.NoError(t, repo.RecordAuthEvent(ctx, e))
+	}
+	// Move the registration back in time so the time range filter has
+	// something to exclude.
+	_, err := testPool.Exec(ctx, `UPDATE auth_events SET created_at = now() - interval '2 days' WHERE type = $1`, domain.EventUserRegistered)
+	require.NoError(t, err)
+
+	failed := false
+	tests := map[string]struct {
+		filter domain.AuthEventFilter
+		want   int
+	}{
+		"Given no filter":           {domain.AuthEventFilter{}, 6},
+		"Given a user id":           {domain.AuthEventFilter{UserID: alice.ID}, 3},
+		"Given an email":            {domain.AuthEventFilter{Email: "ghost@test.com"}, 1},
+		"Given an event type":       {domain.AuthEventFilter{Type: domain.EventUserLogin}, 4},
+		"Given failures only":       {domain.AuthEventFilter{Success: &failed}, 2},
+		"Given a time range":        {domain.AuthEventFilter{From: time.Now().Add(-time.Hour), To: time.Now().Add(time.Hour)}, 5},
+		"Given combined filters":    {domain.AuthEventFilter{UserID: alice.ID, Type: domain.EventUserLogin, Success: &failed}, 1},
+		"Given a page size":         {domain.AuthEventFilter{Limit: 2}, 2},
+		"Given an offset past data": {domain.AuthEventFilter{Offset: 10}, 0},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			events, err := repo.ListAuthEvents(ctx, tt.filter)
+
+			require.NoError(t, err)
+			assert.Len(t, events, tt.want)
+			for i := 1; i < len(events); i++ {
+				assert.False(t, events[i].CreatedAt.After(events[i-1].CreatedAt), "events must be newest first")
+			}
+		})
+	}
+
+	t.Run("Given an unknown user", func(t *testing.T) {
+		events, err := repo.ListAuthEvents(ctx, domain.AuthEventFilter{Email: "ghost@test.com"})
+
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Zero(t, events[0].UserID)
+	})
+
+	t.Run("Given an event with an actor", func(t *testing.T) {
+		events, err := repo.ListAuthEvents(ctx, domain.AuthEventFilter{Type: domain.EventUserRoleChanged})
+
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, bob.ID, events[0].UserID)
+		assert.Equal(t, alice.ID, events[0].ActorID)
+	})
+}
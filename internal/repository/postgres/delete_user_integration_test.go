@@ -0,0 +1,65 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserRepo_DeleteUser(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepo(testPool)
+
+	t.Run("Given a user with sessions and audit events", func(t *testing.T) {
+		setupTables(t, ctx)
+		defer cleanupTables(t, ctx)
+		alice := &domain.User{Username: "alice", Email: "alice@test.com", PasswordHash: "hash", Role: domain.RoleAdmin}
+		require.NoError(t, repo.Create(ctx, alice))
+		bob := &domain.User{Username: "bob", Email: "bob@test.com", PasswordHash: "hash", Role: domain.RoleUser}
+		require.NoError(t, repo.Create(ctx, bob))
+		saveRefreshToken(t, ctx, repo, alice.ID, "alice-token", time.Now().Add(time.Hour))
+		saveRefreshToken(t, ctx, repo, bob.ID, "bob-token", time.Now().Add(time.Hour))
+		for _, e := range []domain.AuthEvent{
+			{UserID: alice.ID, Email: alice.Email, Type: domain.EventUserLogin, Success: true},
+			{Email: alice.Email, Type: domain.EventUserLogin, Success: false},
+			{UserID: bob.ID, ActorID: alice.ID, Type: domain.EventUserRoleChanged, Success: true},
+			{UserID: bob.ID, Email: bob.Email, Type: domain.EventUserLogin, Success: true},
+		} {
+			require.NoError(t, repo.RecordAuthEvent(ctx, e))
+		}
+
+		err := repo.DeleteUser(ctx, alice.ID)
+
+		require.NoError(t, err)
+		_, err = repo.GetByID(ctx, alice.ID)
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+		var tokens, events, actorEvents int
+		require.NoError(t, testPool.QueryRow(ctx, `SELECT count(*) FROM refresh_tokens WHERE user_id = $1`, alice.ID).Scan(&tokens))
+		assert.Zero(t, tokens)
+		require.NoError(t, testPool.QueryRow(ctx, `SELECT count(*) FROM auth_events WHERE user_id = $1 OR email = $2`, alice.ID, alice.Email).Scan(&events))
+		assert.Zero(t, events)
+		require.NoError(t, testPool.QueryRow(ctx, `SELECT count(*) FROM auth_events WHERE actor_id = $1`, alice.ID).Scan(&actorEvents))
+		assert.Zero(t, actorEvents)
+
+		_, err = repo.GetByID(ctx, bob.ID)
+		assert.NoError(t, err, "other users are kept")
+		bobEvents, err := repo.ListAuthEvents(ctx, domain.AuthEventFilter{UserID: bob.ID, Limit: 10})
+		require.NoError(t, err)
+		assert.Len(t, bobEvents, 2, "events of other users are kept")
+		_, err = repo.GetRefreshToken(ctx, "bob-token")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Given an unknown user", func(t *testing.T) {
+		setupTables(t, ctx)
+		defer cleanupTables(t, ctx)
+
+		err := repo.DeleteUser(ctx, 42)
+
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	})
+}
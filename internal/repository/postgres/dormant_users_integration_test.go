@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserRepo_DormantUsers(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepo(testPool)
+
+	setupTables(t, ctx)
+	defer cleanupTables(t, ctx)
+
+	now := time.Now()
+	longAgo := now.Add(-200 * 24 * time.Hour)
+	recently := now.Add(-24 * time.Hour)
+	seed := []struct {
+		email                   string
+		createdAt               time.Time
+		lastLoginAt, disabledAt *time.Time
+	}{
+		{email: "recent-login@test.com", createdAt: longAgo, lastLoginAt: &recently},
+		{email: "recent-signup@test.com", createdAt: recently},
+		{email: "dormant-login@test.com", createdAt: longAgo, lastLoginAt: &longAgo},
+		{email: "never-logged-in@test.com", createdAt: longAgo},
+		{email: "already-disabled@test.com", createdAt: longAgo, disabledAt: &recently},
+	}
+	ids := make(map[string]int64, len(seed))
+	for _, u := range seed {
+		var id int64
+		err := testPool.QueryRow(ctx, `
+			INSERT INTO users (username, email, password_hash, created_at, last_login_at, disabled_at)
+			VALUES ('test', $1, 'hash', $2, $3, $4) RETURNING id`,
+			u.email, u.createdAt, u.lastLoginAt, u.disabledAt,
+		).Scan(&id)
+		require.NoError(t, err)
+		ids[u.email] = id
+	}
+	cutoff := now.Add(-90 * 24 * time.Hour)
+
+	t.Run("Given recent, dormant and disabled users", func(t *testing.T) {
+		users, err := repo.ListDormantUsers(ctx, cutoff)
+		require.NoError(t, err)
+
+		var emails []string
+		for _, u := range users {
+			emails = append(emails, u.Email)
+		}
+		assert.ElementsMatch(t, []string{"dormant-login@test.com", "never-logged-in@test.com"}, emails)
+	})
+
+	t.Run("Given a batch deactivation", func(t *testing.T) {
+		dormantID := ids["dormant-login@test.com"]
+		saveRefreshToken(t, ctx, repo, dormantID, "dormant-token", now.Add(time.Hour))
+
+		n, err := repo.DeactivateDormantUsers(ctx, cutoff)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+
+		u, err := repo.GetByID(ctx, dormantID)
+		require.NoError(t, err)
+		assert.True(t, u.Disabled())
+
+		_, err = repo.GetRefreshToken(ctx, "dormant-token")
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+
+		users, err := repo.ListDormantUsers(ctx, cutoff)
+		require.NoError(t, err)
+		assert.Empty(t, users)
+	})
+}
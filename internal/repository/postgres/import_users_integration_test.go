@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserRepo_ImportUsers(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepo(testPool)
+	const bcryptHash = "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"
+
+	t.Run("Given new users", func(t *testing.T) {
+		setupTables(t, ctx)
+		defer cleanupTables(t, ctx)
+		joined := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+		users := []domain.User{
+			{Username: "alice", Email: "alice@test.com", PasswordHash: bcryptHash, Role: domain.RoleUser, CreatedAt: joined},
+			{Username: "bob", Email: "bob@test.com", PasswordHash: bcryptHash, Role: domain.RoleAdmin},
+		}
+
+		rowErrs, err := repo.ImportUsers(ctx, users)
+
+		require.NoError(t, err)
+		assert.Equal(t, []error{nil, nil}, rowErrs)
+		alice, err := repo.GetByEmail(ctx, "alice@test.com")
+		require.NoError(t, err)
+		assert.Equal(t, users[0].ID, alice.ID)
+		assert.Equal(t, bcryptHash, alice.PasswordHash)
+		assert.True(t, joined.Equal(alice.CreatedAt), "created_at must be kept")
+		bob, err := repo.GetByEmail(ctx, "bob@test.com")
+		require.NoError(t, err)
+		assert.Equal(t, domain.RoleAdmin, bob.Role)
+		assert.False(t, bob.CreatedAt.IsZero())
+	})
+
+	t.Run("Given a user whose email is taken", func(t *testing.T) {
+		setupTables(t, ctx)
+		defer cleanupTables(t, ctx)
+		existing := &domain.User{Username: "alice", Email: "alice@test.com", PasswordHash: "hash", Role: domain.RoleUser}
+		require.NoError(t, repo.Create(ctx, existing))
+		users := []domain.User{
+			{Username: "carol", Email: "carol@test.com", PasswordHash: bcryptHash, Role: domain.RoleUser},
+			{Username: "impostor", Email: "alice@test.com", PasswordHash: bcryptHash, Role: domain.RoleUser},
+			{Username: "dave", Email: "dave@test.com", PasswordHash: bcryptHash, Role: domain.RoleUser},
+		}
+
+		rowErrs, err := repo.ImportUsers(ctx, users)
+
+		require.NoError(t, err)
+		require.Len(t, rowErrs, 3)
+		assert.NoError(t, rowErrs[0])
+		assert.ErrorIs(t, rowErrs[1], domain.ErrEmailExists)
+		assert.NoError(t, rowErrs[2])
+		alice, err := repo.GetByEmail(ctx, "alice@test.com")
+		require.NoError(t, err)
+		assert.Equal(t, "hash", alice.PasswordHash, "the existing account must be left alone")
+		_, err = repo.GetByEmail(ctx, "dave@test.com")
+		assert.NoError(t, err, "rows after a conflict must still be imported")
+	})
+}
@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/Kovalyovv/auth-service/internal/pkg/hash"
+	"github.com/Kovalyovv/auth-service/internal/usecase"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshLimit(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepo(testPool)
+
+	setupTables(t, ctx)
+	defer cleanupTables(t, ctx)
+
+	password := "password123"
+	hashed, err := hash.HashPassword(password)
+	require.NoError(t, err)
+	user := &domain.User{Username: "test", Email: "test@test.com", PasswordHash: hashed, Role: domain.RoleUser}
+	require.NoError(t, repo.Create(ctx, user))
+
+	const maxRefreshes = 3
+	uc := usecase.NewAuthUseCase(repo, newTokenManager(t, "secret"), 15*time.Minute, time.Hour,
+		usecase.WithMaxRefreshes(maxRefreshes),
+	)
+
+	pair, _, err := uc.Login(ctx, user.Email, password, domain.ClientInfo{})
+	require.NoError(t, err)
+
+	t.Run("Given refreshes up to the limit", func(t *testing.T) {
+		for i := 0; i < maxRefreshes; i++ {
+			pair, _, err = uc.Refresh(ctx, pair.RefreshToken, domain.ClientInfo{})
+			require.NoError(t, err, "refresh %d", i+1)
+		}
+	})
+
+	t.Run("Given a refresh past the limit", func(t *testing.T) {
+		_, _, err := uc.Refresh(ctx, pair.RefreshToken, domain.ClientInfo{})
+		assert.ErrorIs(t, err, domain.ErrRefreshLimitReached)
+
+		_, _, err = uc.Refresh(ctx, pair.RefreshToken, domain.ClientInfo{})
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound, "the exhausted token must be gone")
+
+		sessions, err := uc.ListSessions(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Empty(t, sessions)
+	})
+
+	t.Run("Given a fresh login", func(t *testing.T) {
+		pair, _, err := uc.Login(ctx, user.Email, password, domain.ClientInfo{})
+		require.NoError(t, err)
+
+		_, _, err = uc.Refresh(ctx, pair.RefreshToken, domain.ClientInfo{})
+		assert.NoError(t, err, "a new login starts a new chain")
+	})
+}
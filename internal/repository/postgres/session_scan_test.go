@@ -0,0 +1,112 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubRow is a pgx.Row that copies fixed column values into Scan's targets.
+type stubRow struct {
+	values []any
+	err    error
+}
+
+func (r stubRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	if len(dest) != len(r.values) {
+		return errors.New("column count mismatch")
+	}
+	for i, d := range dest {
+		target := reflect.ValueOf(d).Elem()
+		if r.values[i] == nil {
+			target.Set(reflect.Zero(target.Type()))
+			continue
+		}
+		target.Set(reflect.ValueOf(r.values[i]))
+	}
+	return nil
+}
+
+func TestScanSession(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := createdAt.Add(24 * time.Hour)
+	lastUsedAt := createdAt.Add(time.Hour)
+
+	t.Run("Given a refreshed session", func(t *testing.T) {
+		row := stubRow{values: []any{int64(3), int64(7), "Work laptop", &createdAt, expiresAt, "curl/8.5.0", "192.0.2.1", &lastUsedAt, "198.51.100.7"}}
+
+		s, err := scanSession(row)
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(3), s.ID)
+		assert.Equal(t, int64(7), s.UserID)
+		assert.Equal(t, "Work laptop", s.DeviceName)
+		assert.Equal(t, createdAt, s.CreatedAt)
+		assert.Equal(t, expiresAt, s.ExpiresAt)
+		assert.Equal(t, "curl/8.5.0", s.UserAgent)
+		assert.Equal(t, "192.0.2.1", s.IP)
+		require.NotNil(t, s.LastUsedAt)
+		assert.Equal(t, lastUsedAt, *s.LastUsedAt)
+		assert.Equal(t, "198.51.100.7", s.LastUsedIP)
+	})
+
+	t.Run("Given a session without timestamps", func(t *testing.T) {
+		row := stubRow{values: []any{int64(3), int64(7), "", nil, expiresAt, "", "", nil, ""}}
+
+		s, err := scanSession(row)
+		require.NoError(t, err)
+
+		assert.True(t, s.CreatedAt.IsZero())
+		assert.Nil(t, s.LastUsedAt)
+	})
+
+	t.Run("Given a scan error", func(t *testing.T) {
+		_, err := scanSession(stubRow{err: errors.New("boom")})
+
+		assert.EqualError(t, err, "boom")
+	})
+}
+
+// stubQueries answers every QueryRow with row.
+type stubQueries struct {
+	Queries
+	row pgx.Row
+}
+
+func (q stubQueries) QueryRow(context.Context, string, ...any) pgx.Row { return q.row }
+
+func TestUserRepo_GetRefreshToken_Errors(t *testing.T) {
+	ctx := context.Background()
+	for name, tt := range map[string]struct {
+		err  error
+		want error
+	}{
+		"Given no such token":     {err: pgx.ErrNoRows, want: domain.ErrRefreshTokenNotFound},
+		"Given a timed out query": {err: context.DeadlineExceeded, want: domain.ErrServiceUnavailable},
+		"Given a database error":  {err: errors.New("connection reset"), want: nil},
+	} {
+		t.Run(name, func(t *testing.T) {
+			repo := NewUserRepo(nil).WithQueries(stubQueries{row: stubRow{err: tt.err}})
+
+			_, err := repo.GetRefreshToken(ctx, "token")
+
+			require.Error(t, err)
+			if tt.want != nil {
+				assert.ErrorIs(t, err, tt.want)
+			} else {
+				assert.ErrorIs(t, err, tt.err)
+				assert.NotErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+			}
+		})
+	}
+}
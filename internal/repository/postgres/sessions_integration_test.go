@@ -0,0 +1,355 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/Kovalyovv/auth-service/internal/pkg/hash"
+	"github.com/Kovalyovv/auth-service/internal/pkg/jwt"
+	"github.com/Kovalyovv/auth-service/internal/usecase"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTokenManager(t *testing.T, secret string) *jwt.TokenManager {
+	t.Helper()
+	tm, err := jwt.NewTokenManager(secret)
+	require.NoError(t, err)
+	return tm
+}
+
+func TestSessionDeviceName(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepo(testPool)
+
+	setupTables(t, ctx)
+	defer cleanupTables(t, ctx)
+
+	password := "password123"
+	hashed, err := hash.HashPassword(password)
+	require.NoError(t, err)
+	user := &domain.User{Username: "test", Email: "test@test.com", PasswordHash: hashed, Role: domain.RoleUser}
+	require.NoError(t, repo.Create(ctx, user))
+
+	uc := usecase.NewAuthUseCase(repo, newTokenManager(t, "secret"), 15*time.Minute, time.Hour)
+
+	pair, _, err := uc.Login(ctx, user.Email, password, domain.ClientInfo{DeviceName: "Work laptop"})
+	require.NoError(t, err)
+
+	t.Run("Given a login with a device name", func(t *testing.T) {
+		sessions, err := uc.ListSessions(ctx, user.ID)
+		require.NoError(t, err)
+
+		require.Len(t, sessions, 1)
+		assert.Equal(t, "Work laptop", sessions[0].DeviceName)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), sessions[0].ExpiresAt, time.Minute)
+	})
+
+	t.Run("Given a rotated refresh token", func(t *testing.T) {
+		_, _, err := uc.Refresh(ctx, pair.RefreshToken, domain.ClientInfo{})
+		require.NoError(t, err)
+
+		sessions, err := uc.ListSessions(ctx, user.ID)
+		require.NoError(t, err)
+
+		require.Len(t, sessions, 1)
+		assert.Equal(t, "Work laptop", sessions[0].DeviceName)
+	})
+
+	t.Run("Given an overlong device name", func(t *testing.T) {
+		_, _, err := uc.Login(ctx, user.Email, password, domain.ClientInfo{DeviceName: strings.Repeat("ж", domain.MaxDeviceNameLength+1)})
+		require.NoError(t, err)
+
+		sessions, err := uc.ListSessions(ctx, user.ID)
+		require.NoError(t, err)
+
+		require.Len(t, sessions, 2)
+		assert.Equal(t, strings.Repeat("ж", domain.MaxDeviceNameLength), sessions[0].DeviceName)
+	})
+
+	t.Run("Given a login without a device name", func(t *testing.T) {
+		_, _, err := uc.Login(ctx, user.Email, password, domain.ClientInfo{})
+		require.NoError(t, err)
+
+		sessions, err := uc.ListSessions(ctx, user.ID)
+		require.NoError(t, err)
+
+		require.Len(t, sessions, 3)
+		assert.Empty(t, sessions[0].DeviceName)
+	})
+}
+
+func TestSessionLastUsed(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepo(testPool)
+
+	setupTables(t, ctx)
+	defer cleanupTables(t, ctx)
+
+	password := "password123"
+	hashed, err := hash.HashPassword(password)
+	require.NoError(t, err)
+	user := &domain.User{Username: "test", Email: "test@test.com", PasswordHash: hashed, Role: domain.RoleUser}
+	require.NoError(t, repo.Create(ctx, user))
+
+	uc := usecase.NewAuthUseCase(repo, newTokenManager(t, "secret"), 15*time.Minute, time.Hour)
+
+	pair, _, err := uc.Login(ctx, user.Email, password, domain.ClientInfo{})
+	require.NoError(t, err)
+
+	t.Run("Given a session that was never refreshed", func(t *testing.T) {
+		sessions, err := uc.ListSessions(ctx, user.ID)
+		require.NoError(t, err)
+
+		require.Len(t, sessions, 1)
+		assert.Nil(t, sessions[0].LastUsedAt)
+		assert.Empty(t, sessions[0].LastUsedIP)
+	})
+
+	t.Run("Given a refresh", func(t *testing.T) {
+		pair, _, err = uc.Refresh(ctx, pair.RefreshToken, domain.ClientInfo{IP: "192.0.2.1"})
+		require.NoError(t, err)
+
+		sessions, err := uc.ListSessions(ctx, user.ID)
+		require.NoError(t, err)
+
+		require.Len(t, sessions, 1)
+		require.NotNil(t, sessions[0].LastUsedAt)
+		assert.WithinDuration(t, time.Now(), *sessions[0].LastUsedAt, time.Minute)
+		assert.Equal(t, "192.0.2.1", sessions[0].LastUsedIP)
+	})
+
+	t.Run("Given a refresh from another address", func(t *testing.T) {
+		previousIP, err := repo.TouchRefreshToken(ctx, pair.RefreshToken, "198.51.100.7")
+		require.NoError(t, err)
+		assert.Equal(t, "192.0.2.1", previousIP)
+
+		sessions, err := uc.ListSessions(ctx, user.ID)
+		require.NoError(t, err)
+
+		require.Len(t, sessions, 1)
+		assert.Equal(t, "198.51.100.7", sessions[0].LastUsedIP)
+	})
+
+	t.Run("Given an unknown token", func(t *testing.T) {
+		_, err := repo.TouchRefreshToken(ctx, "unknown", "192.0.2.1")
+
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+	})
+}
+
+func TestSessionClient(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepo(testPool)
+
+	setupTables(t, ctx)
+	defer cleanupTables(t, ctx)
+
+	password := "password123"
+	hashed, err := hash.HashPassword(password)
+	require.NoError(t, err)
+	user := &domain.User{Username: "test", Email: "test@test.com", PasswordHash: hashed, Role: domain.RoleUser}
+	require.NoError(t, repo.Create(ctx, user))
+
+	uc := usecase.NewAuthUseCase(repo, newTokenManager(t, "secret"), 15*time.Minute, time.Hour)
+
+	pair, _, err := uc.Login(ctx, user.Email, password, domain.ClientInfo{IP: "192.0.2.1", UserAgent: "curl/8.5.0"})
+	require.NoError(t, err)
+
+	t.Run("Given a login", func(t *testing.T) {
+		sessions, err := uc.ListSessions(ctx, user.ID)
+		require.NoError(t, err)
+
+		require.Len(t, sessions, 1)
+		assert.Equal(t, user.ID, sessions[0].UserID)
+		assert.Equal(t, "192.0.2.1", sessions[0].IP)
+		assert.Equal(t, "curl/8.5.0", sessions[0].UserAgent)
+		assert.WithinDuration(t, time.Now(), sessions[0].CreatedAt, time.Minute)
+	})
+
+	t.Run("Given a rotated refresh token", func(t *testing.T) {
+		_, _, err := uc.Refresh(ctx, pair.RefreshToken, domain.ClientInfo{IP: "198.51.100.7"})
+		require.NoError(t, err)
+
+		sessions, err := uc.ListSessions(ctx, user.ID)
+		require.NoError(t, err)
+
+		require.Len(t, sessions, 1)
+		assert.Equal(t, "192.0.2.1", sessions[0].IP)
+		assert.Equal(t, "curl/8.5.0", sessions[0].UserAgent)
+		assert.Equal(t, "198.51.100.7", sessions[0].LastUsedIP)
+	})
+}
+
+func TestSessionLogout_JWTMode(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepo(testPool)
+
+	setupTables(t, ctx)
+	defer cleanupTables(t, ctx)
+
+	password := "password123"
+	hashed, err := hash.HashPassword(password)
+	require.NoError(t, err)
+	user := &domain.User{Username: "test", Email: "test@test.com", PasswordHash: hashed, Role: domain.RoleUser}
+	require.NoError(t, repo.Create(ctx, user))
+
+	uc := usecase.NewAuthUseCase(repo, newTokenManager(t, "secret"), 15*time.Minute, time.Hour,
+		usecase.WithRefreshTokenMode(usecase.RefreshModeJWT))
+	pair, _, err := uc.Login(ctx, user.Email, password, domain.ClientInfo{})
+	require.NoError(t, err)
+	claims, err := uc.Authenticate(ctx, pair.AccessToken)
+	require.NoError(t, err)
+
+	require.NoError(t, uc.Logout(ctx, claims.UserID, claims.SessionID, pair.RefreshToken))
+
+	_, _, err = uc.Refresh(ctx, pair.RefreshToken, domain.ClientInfo{})
+	assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+}
+
+func TestSessionLogout(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepo(testPool)
+
+	setupTables(t, ctx)
+	defer cleanupTables(t, ctx)
+
+	password := "password123"
+	hashed, err := hash.HashPassword(password)
+	require.NoError(t, err)
+	user := &domain.User{Username: "test", Email: "test@test.com", PasswordHash: hashed, Role: domain.RoleUser}
+	require.NoError(t, repo.Create(ctx, user))
+
+	uc := usecase.NewAuthUseCase(repo, newTokenManager(t, "secret"), 15*time.Minute, time.Hour)
+	logout := func(t *testing.T, accessToken string) {
+		t.Helper()
+		claims, err := uc.Authenticate(ctx, accessToken)
+		require.NoError(t, err)
+		require.NotZero(t, claims.SessionID)
+		require.NoError(t, uc.Logout(ctx, claims.UserID, claims.SessionID, ""))
+	}
+
+	phone, _, err := uc.Login(ctx, user.Email, password, domain.ClientInfo{DeviceName: "Phone"})
+	require.NoError(t, err)
+	laptop, _, err := uc.Login(ctx, user.Email, password, domain.ClientInfo{DeviceName: "Laptop"})
+	require.NoError(t, err)
+	tablet, _, err := uc.Login(ctx, user.Email, password, domain.ClientInfo{DeviceName: "Tablet"})
+	require.NoError(t, err)
+
+	t.Run("Given a logout from one session", func(t *testing.T) {
+		logout(t, phone.AccessToken)
+
+		sessions, err := uc.ListSessions(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, sessions, 2)
+		assert.Equal(t, "Tablet", sessions[0].DeviceName)
+		assert.Equal(t, "Laptop", sessions[1].DeviceName)
+
+		_, _, err = uc.Refresh(ctx, phone.RefreshToken, domain.ClientInfo{})
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+	})
+
+	t.Run("Given a logout after the session was refreshed", func(t *testing.T) {
+		refreshed, _, err := uc.Refresh(ctx, laptop.RefreshToken, domain.ClientInfo{})
+		require.NoError(t, err)
+
+		logout(t, refreshed.AccessToken)
+
+		sessions, err := uc.ListSessions(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		assert.Equal(t, "Tablet", sessions[0].DeviceName)
+
+		_, _, err = uc.Refresh(ctx, refreshed.RefreshToken, domain.ClientInfo{})
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+	})
+
+	t.Run("Given a repeated logout", func(t *testing.T) {
+		logout(t, phone.AccessToken)
+
+		_, _, err := uc.Refresh(ctx, tablet.RefreshToken, domain.ClientInfo{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Given another user's session id", func(t *testing.T) {
+		claims, err := uc.Authenticate(ctx, tablet.AccessToken)
+		require.NoError(t, err)
+
+		err = repo.DeleteSession(ctx, user.ID+1000, claims.SessionID)
+
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+		sessions, err := uc.ListSessions(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Len(t, sessions, 1)
+	})
+}
+
+func TestRevokeSession(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepo(testPool)
+
+	setupTables(t, ctx)
+	defer cleanupTables(t, ctx)
+
+	password := "password123"
+	hashed, err := hash.HashPassword(password)
+	require.NoError(t, err)
+	alice := &domain.User{Username: "alice", Email: "alice@test.com", PasswordHash: hashed, Role: domain.RoleUser}
+	require.NoError(t, repo.Create(ctx, alice))
+	bob := &domain.User{Username: "bob", Email: "bob@test.com", PasswordHash: hashed, Role: domain.RoleUser}
+	require.NoError(t, repo.Create(ctx, bob))
+
+	uc := usecase.NewAuthUseCase(repo, newTokenManager(t, "secret"), 15*time.Minute, time.Hour)
+
+	_, _, err = uc.Login(ctx, alice.Email, password, domain.ClientInfo{DeviceName: "phone"})
+	require.NoError(t, err)
+	laptop, _, err := uc.Login(ctx, alice.Email, password, domain.ClientInfo{DeviceName: "laptop"})
+	require.NoError(t, err)
+	_, _, err = uc.Login(ctx, bob.Email, password, domain.ClientInfo{})
+	require.NoError(t, err)
+
+	aliceSessions, err := uc.ListSessions(ctx, alice.ID)
+	require.NoError(t, err)
+	require.Len(t, aliceSessions, 2)
+	phone := aliceSessions[1]
+	require.Equal(t, "phone", phone.DeviceName)
+	bobSessions, err := uc.ListSessions(ctx, bob.ID)
+	require.NoError(t, err)
+	require.Len(t, bobSessions, 1)
+
+	t.Run("Given another user's session", func(t *testing.T) {
+		err := uc.RevokeSession(ctx, bob.ID, phone.ID)
+
+		assert.ErrorIs(t, err, domain.ErrSessionNotOwned)
+		sessions, err := uc.ListSessions(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Len(t, sessions, 2, "the session must survive")
+	})
+
+	t.Run("Given one of the user's sessions", func(t *testing.T) {
+		err := uc.RevokeSession(ctx, alice.ID, phone.ID)
+
+		require.NoError(t, err)
+		sessions, err := uc.ListSessions(ctx, alice.ID)
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		assert.Equal(t, "laptop", sessions[0].DeviceName)
+		_, _, err = uc.Refresh(ctx, laptop.RefreshToken, domain.ClientInfo{})
+		assert.NoError(t, err, "other sessions must stay signed in")
+	})
+
+	t.Run("Given a session that was already revoked", func(t *testing.T) {
+		err := uc.RevokeSession(ctx, alice.ID, phone.ID)
+
+		assert.ErrorIs(t, err, domain.ErrSessionNotFound)
+	})
+
+	t.Run("Given the other user's own session", func(t *testing.T) {
+		err := uc.RevokeSession(ctx, bob.ID, bobSessions[0].ID)
+
+		assert.NoError(t, err)
+	})
+}
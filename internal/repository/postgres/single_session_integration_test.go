@@ -0,0 +1,50 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/Kovalyovv/auth-service/internal/pkg/hash"
+	"github.com/Kovalyovv/auth-service/internal/usecase"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSingleSession(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepo(testPool)
+
+	setupTables(t, ctx)
+	defer cleanupTables(t, ctx)
+
+	password := "password123"
+	hashed, err := hash.HashPassword(password)
+	require.NoError(t, err)
+	user := &domain.User{Username: "test", Email: "test@test.com", PasswordHash: hashed, Role: domain.RoleUser}
+	require.NoError(t, repo.Create(ctx, user))
+
+	uc := usecase.NewAuthUseCase(repo, newTokenManager(t, "secret"), 15*time.Minute, time.Hour,
+		usecase.WithSingleSession(true),
+	)
+
+	first, _, err := uc.Login(ctx, user.Email, password, domain.ClientInfo{})
+	require.NoError(t, err)
+	second, _, err := uc.Login(ctx, user.Email, password, domain.ClientInfo{})
+	require.NoError(t, err)
+
+	t.Run("Given the first session after a second login", func(t *testing.T) {
+		_, _, err := uc.Refresh(ctx, first.RefreshToken, domain.ClientInfo{})
+
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+	})
+
+	t.Run("Given the second session", func(t *testing.T) {
+		rotated, _, err := uc.Refresh(ctx, second.RefreshToken, domain.ClientInfo{})
+		require.NoError(t, err)
+
+		_, _, err = uc.Refresh(ctx, rotated.RefreshToken, domain.ClientInfo{})
+		assert.NoError(t, err, "rotation must keep the single session alive")
+	})
+}
@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserRepo_InTx(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepo(testPool)
+
+	t.Run("Given fn succeeds", func(t *testing.T) {
+		setupTables(t, ctx)
+		defer cleanupTables(t, ctx)
+		user := &domain.User{Username: "alice", Email: "alice@test.com", PasswordHash: "hash", Role: domain.RoleUser}
+
+		err := repo.InTx(ctx, func(q Queries) error {
+			txRepo := repo.WithQueries(q)
+			if err := txRepo.Create(ctx, user); err != nil {
+				return err
+			}
+			return txRepo.UpdateRole(ctx, user.ID, domain.RoleAdmin)
+		})
+
+		require.NoError(t, err)
+		got, err := repo.GetByEmail(ctx, "alice@test.com")
+		require.NoError(t, err)
+		assert.Equal(t, domain.RoleAdmin, got.Role)
+	})
+
+	t.Run("Given fn fails", func(t *testing.T) {
+		setupTables(t, ctx)
+		defer cleanupTables(t, ctx)
+		boom := errors.New("boom")
+
+		err := repo.InTx(ctx, func(q Queries) error {
+			user := &domain.User{Username: "alice", Email: "alice@test.com", PasswordHash: "hash", Role: domain.RoleUser}
+			if err := repo.WithQueries(q).Create(ctx, user); err != nil {
+				return err
+			}
+			return boom
+		})
+
+		assert.ErrorIs(t, err, boom)
+		_, err = repo.GetByEmail(ctx, "alice@test.com")
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	})
+
+	t.Run("Given a nested transaction that fails", func(t *testing.T) {
+		setupTables(t, ctx)
+		defer cleanupTables(t, ctx)
+
+		err := repo.InTx(ctx, func(q Queries) error {
+			txRepo := repo.WithQueries(q)
+			alice := &domain.User{Username: "alice", Email: "alice@test.com", PasswordHash: "hash", Role: domain.RoleUser}
+			if err := txRepo.Create(ctx, alice); err != nil {
+				return err
+			}
+			nestedErr := txRepo.InTx(ctx, func(q Queries) error {
+				bob := &domain.User{Username: "bob", Email: "bob@test.com", PasswordHash: "hash", Role: domain.RoleUser}
+				if err := repo.WithQueries(q).Create(ctx, bob); err != nil {
+					return err
+				}
+				return errors.New("boom")
+			})
+			assert.Error(t, nestedErr)
+			return nil
+		})
+
+		require.NoError(t, err)
+		_, err = repo.GetByEmail(ctx, "alice@test.com")
+		assert.NoError(t, err)
+		_, err = repo.GetByEmail(ctx, "bob@test.com")
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	})
+}
@@ -7,24 +7,58 @@ import (
 	"time"
 
 	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/Kovalyovv/auth-service/internal/pkg/clock"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Queries is what UserRepo runs its statements on: a *pgxpool.Pool or a
+// pgx.Tx. Begin on a pgx.Tx starts a savepoint, so methods that need a
+// transaction of their own nest inside an enclosing one.
+type Queries interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
 type UserRepo struct {
-	pool *pgxpool.Pool
+	db    Queries
+	clock clock.Clock
 }
 
 func NewUserRepo(pool *pgxpool.Pool) *UserRepo {
-	return &UserRepo{pool: pool}
+	return &UserRepo{db: pool, clock: clock.Real{}}
+}
+
+// WithQueries returns a repository running its statements on q, typically
+// the transaction InTx passes in.
+func (r *UserRepo) WithQueries(q Queries) *UserRepo {
+	return &UserRepo{db: q, clock: r.clock}
+}
+
+// WithClock returns a repository that reads the current time from c where
+// it computes durations itself. Queries still use the database's now().
+func (r *UserRepo) WithClock(c clock.Clock) *UserRepo {
+	return &UserRepo{db: r.db, clock: c}
+}
+
+// InTx runs fn in a transaction, committed if fn returns nil and rolled back
+// otherwise. Use WithQueries(q) inside fn to run repository methods in it.
+// Called on a repository that is already in a transaction, it nests as a
+// savepoint.
+func (r *UserRepo) InTx(ctx context.Context, fn func(q Queries) error) error {
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		return fn(tx)
+	})
 }
 
 func (r *UserRepo) Create(ctx context.Context, user *domain.User) error {
-	query := `INSERT INTO users (username, email, password_hash) VALUES ($1, $2, $3) RETURNING id, created_at`
-	err := r.pool.QueryRow(ctx, query, user.Username, user.Email, user.PasswordHash).Scan(&user.ID, &user.CreatedAt)
+	query := `INSERT INTO users (username, email, password_hash, role) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+	err := r.db.QueryRow(ctx, query, user.Username, user.Email, user.PasswordHash, user.Role).Scan(&user.ID, &user.CreatedAt)
 	if err != nil {
-		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23505" {
+		if isUniqueViolation(err) {
 			return domain.ErrEmailExists
 		}
 		return fmt.Errorf("failed to create user: %w", err)
@@ -32,50 +66,586 @@ func (r *UserRepo) Create(ctx context.Context, user *domain.User) error {
 	return nil
 }
 
+// uniqueViolation is the SQLSTATE of a unique constraint violation.
+const uniqueViolation = "23505"
+
+// isUniqueViolation reports whether err, or an error it wraps, is a unique
+// constraint violation reported by PostgreSQL.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
+
+// isContextError reports whether err stems from the request's context being
+// cancelled or timing out rather than from the database.
+func isContextError(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
+
+// ImportUsers inserts users in one transaction and sets their IDs and, where
+// zero, CreatedAt. A user whose email is already taken is skipped, with
+// domain.ErrEmailExists at its index in rowErrs; any other failure rolls back
+// the whole import.
+func (r *UserRepo) ImportUsers(ctx context.Context, users []domain.User) ([]error, error) {
+	query := `
+		INSERT INTO users (username, email, password_hash, role, created_at)
+		VALUES ($1, $2, $3, $4, COALESCE($5, now()))
+		ON CONFLICT (email) DO NOTHING
+		RETURNING id, created_at`
+	rowErrs := make([]error, len(users))
+	err := r.InTx(ctx, func(q Queries) error {
+		for i := range users {
+			u := &users[i]
+			var createdAt *time.Time
+			if !u.CreatedAt.IsZero() {
+				createdAt = &u.CreatedAt
+			}
+			err := q.QueryRow(ctx, query, u.Username, u.Email, u.PasswordHash, u.Role, createdAt).Scan(&u.ID, &u.CreatedAt)
+			switch {
+			case errors.Is(err, pgx.ErrNoRows):
+				rowErrs[i] = domain.ErrEmailExists
+			case err != nil:
+				return fmt.Errorf("import user %d: %w", i, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rowErrs, nil
+}
+
+// userColumns is the select list read by scanUser.
+const userColumns = `id, username, email, password_hash, role, created_at, last_login_at, disabled_at, password_changed_at, locked_until, token_version, email_verified_at`
+
+func scanUser(row pgx.Row) (*domain.User, error) {
+	var (
+		u                                                                        domain.User
+		lastLoginAt, disabledAt, passwordChangedAt, lockedUntil, emailVerifiedAt *time.Time
+	)
+	err := row.Scan(&u.ID, &u.Username, &u.Email, &u.PasswordHash, &u.Role, &u.CreatedAt, &lastLoginAt, &disabledAt, &passwordChangedAt, &lockedUntil, &u.TokenVersion, &emailVerifiedAt)
+	if err != nil {
+		return nil, err
+	}
+	if lastLoginAt != nil {
+		u.LastLoginAt = *lastLoginAt
+	}
+	if disabledAt != nil {
+		u.DisabledAt = *disabledAt
+	}
+	if lockedUntil != nil {
+		u.LockedUntil = *lockedUntil
+	}
+	if passwordChangedAt != nil {
+		u.PasswordChangedAt = *passwordChangedAt
+	}
+	if emailVerifiedAt != nil {
+		u.EmailVerifiedAt = *emailVerifiedAt
+	}
+	return &u, nil
+}
+
 func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
-	var u domain.User
-	query := `SELECT id, username, email, password_hash, created_at FROM users WHERE email = $1`
-	err := r.pool.QueryRow(ctx, query, email).Scan(&u.ID, &u.Username, &u.Email, &u.PasswordHash, &u.CreatedAt)
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = $1`
+	u, err := scanUser(r.db.QueryRow(ctx, query, email))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, domain.ErrUserNotFound
 		}
 		return nil, fmt.Errorf("GetByEmail query failed: %w", err)
 	}
-	return &u, nil
+	return u, nil
+}
+
+// GetByEmailOrUsername returns the user whose email is identifier or,
+// failing that, the only user whose username is. Usernames are not unique;
+// one shared by several users matches none.
+func (r *UserRepo) GetByEmailOrUsername(ctx context.Context, identifier string) (*domain.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users u
+		WHERE email = $1
+		   OR (username = $1 AND NOT EXISTS (SELECT 1 FROM users o WHERE o.username = $1 AND o.id <> u.id))
+		ORDER BY email = $1 DESC
+		LIMIT 1`
+	u, err := scanUser(r.db.QueryRow(ctx, query, identifier))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("GetByEmailOrUsername query failed: %w", err)
+	}
+	return u, nil
+}
+
+func (r *UserRepo) GetByID(ctx context.Context, id int64) (*domain.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	u, err := scanUser(r.db.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("GetByID query failed: %w", err)
+	}
+	return u, nil
+}
+
+// TouchLastLogin records that the user logged in now, which also clears
+// their failed login count.
+func (r *UserRepo) TouchLastLogin(ctx context.Context, userID int64) error {
+	query := `UPDATE users SET last_login_at = now(), failed_login_attempts = 0, locked_until = NULL WHERE id = $1`
+	_, err := r.db.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update last login: %w", err)
+	}
+	return nil
+}
+
+// RecordFailedLogin counts a failed login by the user. The maxFailures-th
+// failure since the last successful login, or the last lock, locks the
+// account for lockFor and restarts the count. It returns when the account is
+// locked until, which is zero if it is not locked.
+func (r *UserRepo) RecordFailedLogin(ctx context.Context, userID int64, maxFailures int, lockFor time.Duration) (time.Time, error) {
+	query := `
+		UPDATE users SET
+			failed_login_attempts = CASE WHEN failed_login_attempts + 1 >= $2 THEN 0 ELSE failed_login_attempts + 1 END,
+			locked_until = CASE WHEN failed_login_attempts + 1 >= $2 THEN now() + $3 * interval '1 second' ELSE locked_until END
+		WHERE id = $1
+		RETURNING locked_until`
+	var lockedUntil *time.Time
+	err := r.db.QueryRow(ctx, query, userID, maxFailures, lockFor.Seconds()).Scan(&lockedUntil)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, domain.ErrUserNotFound
+		}
+		return time.Time{}, fmt.Errorf("failed to record failed login: %w", err)
+	}
+	if lockedUntil == nil {
+		return time.Time{}, nil
+	}
+	return *lockedUntil, nil
 }
 
-func (r *UserRepo) SaveRefreshToken(ctx context.Context, userID int64, token string, expiresAt time.Time) error {
-	query := `INSERT INTO refresh_tokens (user_id, token, expires_at) VALUES ($1, $2, $3)`
-	_, err := r.pool.Exec(ctx, query, userID, token, expiresAt)
+// ListDormantUsers returns active users whose last login, or registration if
+// they never logged in, is before the given time, oldest activity first.
+func (r *UserRepo) ListDormantUsers(ctx context.Context, before time.Time) ([]domain.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users
+		WHERE disabled_at IS NULL AND COALESCE(last_login_at, created_at) < $1
+		ORDER BY COALESCE(last_login_at, created_at), id`
+	rows, err := r.db.Query(ctx, query, before)
 	if err != nil {
-		return fmt.Errorf("failed to save refresh token: %w", err)
+		return nil, fmt.Errorf("ListDormantUsers query failed: %w", err)
+	}
+	defer rows.Close()
+
+	users := []domain.User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ListDormantUsers scan failed: %w", err)
+		}
+		users = append(users, *u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ListDormantUsers rows failed: %w", err)
+	}
+	return users, nil
+}
+
+// CountUsers returns the number of users, disabled ones included.
+func (r *UserRepo) CountUsers(ctx context.Context) (int64, error) {
+	var n int64
+	if err := r.db.QueryRow(ctx, `SELECT count(*) FROM users`).Scan(&n); err != nil {
+		return 0, fmt.Errorf("CountUsers query failed: %w", err)
+	}
+	return n, nil
+}
+
+// DeactivateDormantUsers disables every user ListDormantUsers would return
+// and revokes their refresh tokens in the same transaction. It returns the
+// number of users disabled.
+func (r *UserRepo) DeactivateDormantUsers(ctx context.Context, before time.Time) (int64, error) {
+	var ids []int64
+	err := r.InTx(ctx, func(q Queries) error {
+		rows, err := q.Query(ctx, `
+			UPDATE users SET disabled_at = now()
+			WHERE disabled_at IS NULL AND COALESCE(last_login_at, created_at) < $1
+			RETURNING id`, before)
+		if err != nil {
+			return fmt.Errorf("deactivate dormant users: %w", err)
+		}
+		ids, err = pgx.CollectRows(rows, pgx.RowTo[int64])
+		if err != nil {
+			return fmt.Errorf("deactivate dormant users: %w", err)
+		}
+
+		_, err = q.Exec(ctx, `DELETE FROM refresh_tokens WHERE user_id = ANY($1)`, ids)
+		if err != nil {
+			return fmt.Errorf("revoke refresh tokens of dormant users: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(ids)), nil
+}
+
+// UpdateRole assigns role to the user, bumps their token version and revokes
+// their refresh tokens, all in one transaction.
+func (r *UserRepo) UpdateRole(ctx context.Context, userID int64, role string) error {
+	return r.InTx(ctx, func(q Queries) error {
+		query := `UPDATE users SET role = $2, token_version = token_version + 1 WHERE id = $1`
+		tag, err := q.Exec(ctx, query, userID, role)
+		if err != nil {
+			return fmt.Errorf("failed to update role: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return domain.ErrUserNotFound
+		}
+		return r.WithQueries(q).RevokeAllRefreshTokens(ctx, userID)
+	})
+}
+
+// MarkEmailVerified records that the user confirmed their email address. An
+// earlier confirmation time is kept.
+func (r *UserRepo) MarkEmailVerified(ctx context.Context, userID int64) error {
+	query := `UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = $1`
+	tag, err := r.db.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *UserRepo) UpdatePasswordHash(ctx context.Context, userID int64, passwordHash string) error {
+	query := `UPDATE users SET password_hash = $2 WHERE id = $1`
+	tag, err := r.db.Exec(ctx, query, userID, passwordHash)
+	if err != nil {
+		return fmt.Errorf("failed to update password hash: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+// ChangePassword stores a password the user chose. Unlike UpdatePasswordHash,
+// which re-hashes the same password, it records when the change happened and
+// bumps the token version.
+func (r *UserRepo) ChangePassword(ctx context.Context, userID int64, passwordHash string) error {
+	query := `UPDATE users SET password_hash = $2, password_changed_at = now(), token_version = token_version + 1 WHERE id = $1`
+	tag, err := r.db.Exec(ctx, query, userID, passwordHash)
+	if err != nil {
+		return fmt.Errorf("failed to change password: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrUserNotFound
 	}
 	return nil
 }
 
-func (r *UserRepo) ConsumeRefreshToken(ctx context.Context, token string) (int64, error) {
-	var userID int64
+// GetTokenVersion returns the user's current token version.
+func (r *UserRepo) GetTokenVersion(ctx context.Context, userID int64) (int64, error) {
+	var version int64
+	err := r.db.QueryRow(ctx, `SELECT token_version FROM users WHERE id = $1`, userID).Scan(&version)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, domain.ErrUserNotFound
+		}
+		return 0, fmt.Errorf("failed to get token version: %w", err)
+	}
+	return version, nil
+}
+
+// BumpTokenVersion increments the user's token version, invalidating the
+// access tokens issued under the previous one, and returns the new version.
+func (r *UserRepo) BumpTokenVersion(ctx context.Context, userID int64) (int64, error) {
+	var version int64
+	query := `UPDATE users SET token_version = token_version + 1 WHERE id = $1 RETURNING token_version`
+	err := r.db.QueryRow(ctx, query, userID).Scan(&version)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, domain.ErrUserNotFound
+		}
+		return 0, fmt.Errorf("failed to bump token version: %w", err)
+	}
+	return version, nil
+}
+
+// SaveRefreshToken stores token as a new session and returns the session id.
+func (r *UserRepo) SaveRefreshToken(ctx context.Context, userID int64, token string, expiresAt time.Time, client domain.ClientInfo) (int64, error) {
+	var sessionID int64
+	query := `INSERT INTO refresh_tokens (user_id, token, expires_at, device_name, user_agent, ip) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+	err := r.db.QueryRow(ctx, query, userID, token, expiresAt, client.DeviceName, client.UserAgent, client.IP).Scan(&sessionID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save refresh token: %w", err)
+	}
+	return sessionID, nil
+}
+
+// RotateRefreshToken replaces oldToken with newToken in one transaction, so a
+// failure part way through leaves the old token usable. The new token keeps
+// the old one's session id, creation time, client details and last use and
+// counts one more refresh. It returns domain.ErrRefreshTokenNotFound if
+// oldToken does not belong to userID, has expired or was already rotated.
+// If oldToken was already refreshed maxRefreshes times, it is deleted
+// without a successor and domain.ErrRefreshLimitReached is returned. Zero maxRefreshes means no limit.
+// If ctx is cancelled or times out first, the error matches
+// domain.ErrServiceUnavailable, so the caller can answer 503 and the client
+// retry with the old token, which is then still valid unless the rotation
+// had already committed.
+func (r *UserRepo) RotateRefreshToken(ctx context.Context, oldToken, newToken string, userID int64, expiresAt time.Time, maxRefreshes int) error {
+	var exhausted bool
+	err := r.InTx(ctx, func(q Queries) error {
+		var err error
+		exhausted, err = rotateRefreshToken(ctx, q, oldToken, newToken, userID, expiresAt, maxRefreshes)
+		return err
+	})
+	if isContextError(err) {
+		return fmt.Errorf("%w: rotate refresh token: %w", domain.ErrServiceUnavailable, err)
+	}
+	if err == nil && exhausted {
+		return domain.ErrRefreshLimitReached
+	}
+	return err
+}
+
+// rotateRefreshToken does the work of RotateRefreshToken on q. It reports
+// whether oldToken had reached maxRefreshes, in which case it was only
+// deleted, so that the deletion is committed.
+func rotateRefreshToken(ctx context.Context, q Queries, oldToken, newToken string, userID int64, expiresAt time.Time, maxRefreshes int) (exhausted bool, err error) {
+	var (
+		sessionID    int64
+		deviceName   string
+		userAgent    string
+		ip           string
+		refreshCount int
+		lastUsedAt   *time.Time
+		lastUsedIP   string
+		createdAt    *time.Time
+	)
+	err = q.QueryRow(ctx, `
+		DELETE FROM refresh_tokens WHERE token = $1 AND user_id = $2 AND expires_at > now()
+		RETURNING id, device_name, user_agent, ip, refresh_count, last_used_at, last_used_ip, created_at`, oldToken, userID).
+		Scan(&sessionID, &deviceName, &userAgent, &ip, &refreshCount, &lastUsedAt, &lastUsedIP, &createdAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, domain.ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("delete rotated refresh token: %w", err)
+	}
 
+	if maxRefreshes > 0 && refreshCount >= maxRefreshes {
+		return true, nil
+	}
+
+	_, err = q.Exec(ctx, `
+		INSERT INTO refresh_tokens (id, user_id, token, expires_at, device_name, user_agent, ip, refresh_count, last_used_at, last_used_ip, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, COALESCE($11, now()))`,
+		sessionID, userID, newToken, expiresAt, deviceName, userAgent, ip, refreshCount+1, lastUsedAt, lastUsedIP, createdAt)
+	if err != nil {
+		return false, fmt.Errorf("insert rotated refresh token: %w", err)
+	}
+	return false, nil
+}
+
+// TouchRefreshToken records that token was just used from ip and returns the
+// address it was last used from, empty if this is its first use.
+func (r *UserRepo) TouchRefreshToken(ctx context.Context, token, ip string) (string, error) {
+	var previousIP string
 	query := `
-		DELETE FROM refresh_tokens
-		WHERE token = $1 AND expires_at > now()
-		RETURNING user_id
-	`
-	err := r.pool.QueryRow(ctx, query, token).Scan(&userID)
+		UPDATE refresh_tokens t SET last_used_at = now(), last_used_ip = $2
+		FROM (SELECT id, last_used_ip FROM refresh_tokens WHERE token = $1 FOR UPDATE) prev
+		WHERE t.id = prev.id
+		RETURNING prev.last_used_ip`
+	err := r.db.QueryRow(ctx, query, token, ip).Scan(&previousIP)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", domain.ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("touch refresh token: %w", err)
+	}
+	return previousIP, nil
+}
+
+// sessionColumns is the refresh_tokens select list read by scanSession. It
+// leaves out the token itself.
+const sessionColumns = `id, user_id, device_name, created_at, expires_at, user_agent, ip, last_used_at, last_used_ip`
+
+func scanSession(row pgx.Row) (domain.Session, error) {
+	var (
+		s         domain.Session
+		createdAt *time.Time
+	)
+	err := row.Scan(&s.ID, &s.UserID, &s.DeviceName, &createdAt, &s.ExpiresAt, &s.UserAgent, &s.IP, &s.LastUsedAt, &s.LastUsedIP)
+	if err != nil {
+		return domain.Session{}, err
+	}
+	if createdAt != nil {
+		s.CreatedAt = *createdAt
+	}
+	return s, nil
+}
+
+// ListSessions returns the user's unexpired refresh tokens, newest first.
+func (r *UserRepo) ListSessions(ctx context.Context, userID int64) ([]domain.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM refresh_tokens
+		WHERE user_id = $1 AND expires_at > now()
+		ORDER BY created_at DESC, id DESC`
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ListSessions query failed: %w", err)
+	}
+	sessions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (domain.Session, error) {
+		return scanSession(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ListSessions scan failed: %w", err)
+	}
+	return sessions, nil
+}
+
+// DeleteSession deletes the refresh token of session sessionID. It returns
+// domain.ErrRefreshTokenNotFound if userID has no such session.
+func (r *UserRepo) DeleteSession(ctx context.Context, userID, sessionID int64) error {
+	query := `DELETE FROM refresh_tokens WHERE id = $1 AND user_id = $2`
+	tag, err := r.db.Exec(ctx, query, sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrRefreshTokenNotFound
+	}
+	return nil
+}
+
+// DeleteUser erases userID in one transaction: their refresh tokens, their
+// audit events, including failed logins recorded under their email only, and
+// the account itself. Events they caused as the actor of another account's
+// change are kept, with the actor cleared.
+func (r *UserRepo) DeleteUser(ctx context.Context, userID int64) error {
+	return r.InTx(ctx, func(q Queries) error {
+		var email string
+		err := q.QueryRow(ctx, `SELECT email FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&email)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.ErrUserNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lock user: %w", err)
+		}
+		if _, err := q.Exec(ctx, `DELETE FROM refresh_tokens WHERE user_id = $1`, userID); err != nil {
+			return fmt.Errorf("failed to delete refresh tokens: %w", err)
+		}
+		if _, err := q.Exec(ctx, `DELETE FROM auth_events WHERE user_id = $1 OR email = $2`, userID, email); err != nil {
+			return fmt.Errorf("failed to delete auth events: %w", err)
+		}
+		if _, err := q.Exec(ctx, `DELETE FROM users WHERE id = $1`, userID); err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *UserRepo) RevokeAllRefreshTokens(ctx context.Context, userID int64) error {
+	query := `DELETE FROM refresh_tokens WHERE user_id = $1`
+	_, err := r.db.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// RevokeRefreshJTI adds a JWT refresh token id to the revocation list. It
+// reports false if the id was already revoked.
+func (r *UserRepo) RevokeRefreshJTI(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	query := `INSERT INTO revoked_refresh_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING`
+	tag, err := r.db.Exec(ctx, query, jti, expiresAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *UserRepo) IsRefreshJTIRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	query := `SELECT EXISTS (SELECT 1 FROM revoked_refresh_tokens WHERE jti = $1)`
+	err := r.db.QueryRow(ctx, query, jti).Scan(&revoked)
+	if err != nil {
+		return false, fmt.Errorf("check refresh token revocation failed: %w", err)
+	}
+	return revoked, nil
+}
+
+// deleteExpiredRefreshTokens is served by idx_refresh_tokens_expires_at.
+const deleteExpiredRefreshTokens = `DELETE FROM refresh_tokens WHERE expires_at <= now()`
+
+// DeleteExpiredRefreshTokens removes expired refresh tokens and revocation
+// entries that no longer need to be remembered, returning the total removed.
+func (r *UserRepo) DeleteExpiredRefreshTokens(ctx context.Context) (int64, error) {
+	tokens, err := r.db.Exec(ctx, deleteExpiredRefreshTokens)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired refresh tokens: %w", err)
+	}
+	revoked, err := r.db.Exec(ctx, `DELETE FROM revoked_refresh_tokens WHERE expires_at <= now()`)
+	if err != nil {
+		return tokens.RowsAffected(), fmt.Errorf("failed to delete expired revocations: %w", err)
+	}
+	return tokens.RowsAffected() + revoked.RowsAffected(), nil
+}
+
+// VacuumRefreshTokens runs VACUUM (ANALYZE) on the refresh token and
+// revocation tables. It cannot run inside a transaction.
+func (r *UserRepo) VacuumRefreshTokens(ctx context.Context) error {
+	if _, err := r.db.Exec(ctx, `VACUUM (ANALYZE) refresh_tokens, revoked_refresh_tokens`); err != nil {
+		return fmt.Errorf("failed to vacuum refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// GetRefreshToken returns the session token belongs to, expired or not, or
+// domain.ErrRefreshTokenNotFound if there is none.
+func (r *UserRepo) GetRefreshToken(ctx context.Context, token string) (domain.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM refresh_tokens WHERE token = $1`
+	s, err := scanSession(r.db.QueryRow(ctx, query, token))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return 0, domain.ErrRefreshTokenNotFound
+			return domain.Session{}, domain.ErrRefreshTokenNotFound
+		}
+		if isContextError(err) {
+			return domain.Session{}, fmt.Errorf("%w: get refresh token: %w", domain.ErrServiceUnavailable, err)
 		}
-		return 0, fmt.Errorf("consume refresh token failed: %w", err)
+		return domain.Session{}, fmt.Errorf("get refresh token failed: %w", err)
 	}
-	return userID, nil
+	return s, nil
 }
 
-func (r *UserRepo) GetRefreshToken(ctx context.Context, token string) (int64, time.Time, error) {
-	var userID int64
-	var expiresAt time.Time
-	query := `SELECT user_id, expires_at FROM refresh_tokens WHERE token = $1`
-	err := r.pool.QueryRow(ctx, query, token).Scan(&userID, &expiresAt)
-	return userID, expiresAt, err
+// GetSession returns the live session sessionID of any user, or
+// domain.ErrRefreshTokenNotFound if there is none.
+func (r *UserRepo) GetSession(ctx context.Context, sessionID int64) (domain.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM refresh_tokens WHERE id = $1 AND expires_at > now()`
+	s, err := scanSession(r.db.QueryRow(ctx, query, sessionID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.Session{}, domain.ErrRefreshTokenNotFound
+		}
+		if isContextError(err) {
+			return domain.Session{}, fmt.Errorf("%w: get session: %w", domain.ErrServiceUnavailable, err)
+		}
+		return domain.Session{}, fmt.Errorf("get session failed: %w", err)
+	}
+	return s, nil
+}
+
+// RefreshTokenTTL returns how long token stays valid without consuming it:
+// zero or negative once it has expired, and domain.ErrRefreshTokenNotFound
+// if there is no such token.
+func (r *UserRepo) RefreshTokenTTL(ctx context.Context, token string) (time.Duration, error) {
+	s, err := r.GetRefreshToken(ctx, token)
+	if err != nil {
+		return 0, err
+	}
+	return s.ExpiresAt.Sub(r.clock.Now()), nil
 }
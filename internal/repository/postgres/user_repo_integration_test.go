@@ -2,11 +2,16 @@ package postgres
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/Kovalyovv/auth-service/internal/pkg/clock"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -61,64 +66,543 @@ func setupTables(t *testing.T, ctx context.Context) {
             username VARCHAR(50) NOT NULL,
             email VARCHAR(255) UNIQUE NOT NULL,
             password_hash VARCHAR(255) NOT NULL,
-            created_at TIMESTAMPTZ DEFAULT NOW()
+            role VARCHAR(20) NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin')),
+            created_at TIMESTAMPTZ DEFAULT NOW(),
+            last_login_at TIMESTAMPTZ,
+            disabled_at TIMESTAMPTZ,
+            password_changed_at TIMESTAMPTZ,
+            failed_login_attempts INT NOT NULL DEFAULT 0,
+            locked_until TIMESTAMPTZ,
+            token_version BIGINT NOT NULL DEFAULT 0,
+            email_verified_at TIMESTAMPTZ
         );
         CREATE TABLE IF NOT EXISTS refresh_tokens (
             id SERIAL PRIMARY KEY,
             user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
             token TEXT NOT NULL UNIQUE,
             expires_at TIMESTAMPTZ NOT NULL,
+            device_name VARCHAR(100) NOT NULL DEFAULT '',
+            user_agent VARCHAR(255) NOT NULL DEFAULT '',
+            ip VARCHAR(45) NOT NULL DEFAULT '',
+            refresh_count INT NOT NULL DEFAULT 0,
+            last_used_at TIMESTAMPTZ,
+            last_used_ip VARCHAR(45) NOT NULL DEFAULT '',
             created_at TIMESTAMPTZ DEFAULT NOW()
         );
+        CREATE INDEX IF NOT EXISTS idx_refresh_tokens_expires_at ON refresh_tokens (expires_at);
+        CREATE TABLE IF NOT EXISTS revoked_refresh_tokens (
+            jti TEXT PRIMARY KEY,
+            expires_at TIMESTAMPTZ NOT NULL,
+            revoked_at TIMESTAMPTZ DEFAULT NOW()
+        );
+        CREATE TABLE IF NOT EXISTS auth_events (
+            id BIGSERIAL PRIMARY KEY,
+            user_id INT REFERENCES users(id) ON DELETE SET NULL,
+            actor_id INT REFERENCES users(id) ON DELETE SET NULL,
+            email VARCHAR(255) NOT NULL DEFAULT '',
+            type VARCHAR(64) NOT NULL,
+            success BOOLEAN NOT NULL,
+            created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+        );
     `)
 	require.NoError(t, err)
 }
 
+// saveRefreshToken stores token for userID and returns its session id.
+func saveRefreshToken(t *testing.T, ctx context.Context, repo *UserRepo, userID int64, token string, expiresAt time.Time) int64 {
+	t.Helper()
+	sessionID, err := repo.SaveRefreshToken(ctx, userID, token, expiresAt, domain.ClientInfo{})
+	require.NoError(t, err)
+	return sessionID
+}
+
 func cleanupTables(t *testing.T, ctx context.Context) {
-	_, err := testPool.Exec(ctx, "DROP TABLE IF EXISTS refresh_tokens, users;")
+	_, err := testPool.Exec(ctx, "DROP TABLE IF EXISTS auth_events, revoked_refresh_tokens, refresh_tokens, users;")
 	require.NoError(t, err)
 }
 
-func TestUserRepo_ConsumeRefreshToken(t *testing.T) {
+func TestUserRepo_Create(t *testing.T) {
 	ctx := context.Background()
 	repo := NewUserRepo(testPool)
 
 	setupTables(t, ctx)
 	defer cleanupTables(t, ctx)
 
-	user := &domain.User{Username: "test", Email: "test@test.com", PasswordHash: "hash"}
-	err := repo.Create(ctx, user)
+	user := &domain.User{Username: "test", Email: "test@test.com", PasswordHash: "hash", Role: domain.RoleUser}
+	require.NoError(t, repo.Create(ctx, user))
+
+	t.Run("Given a new email", func(t *testing.T) {
+		assert.NotZero(t, user.ID)
+		assert.False(t, user.CreatedAt.IsZero())
+	})
+
+	t.Run("Given an email that is already taken", func(t *testing.T) {
+		duplicate := &domain.User{Username: "other", Email: user.Email, PasswordHash: "hash", Role: domain.RoleUser}
+
+		err := repo.Create(ctx, duplicate)
+
+		assert.ErrorIs(t, err, domain.ErrEmailExists)
+		assert.Zero(t, duplicate.ID)
+		got, err := repo.GetByEmail(ctx, user.Email)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, got.ID, "the original user must be kept")
+	})
+}
+
+func TestUserRepo_Create_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepo(testPool)
+
+	setupTables(t, ctx)
+	defer cleanupTables(t, ctx)
+
+	const n = 10
+	errs := make([]error, n)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			user := &domain.User{Username: fmt.Sprintf("racer%d", i), Email: "race@test.com", PasswordHash: "hash", Role: domain.RoleUser}
+			errs[i] = repo.Create(ctx, user)
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	succeeded := 0
+	for i, err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		assert.ErrorIs(t, err, domain.ErrEmailExists, "registration %d", i)
+	}
+	assert.Equal(t, 1, succeeded, "exactly one registration must win")
+	count, err := repo.CountUsers(ctx)
 	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestUserRepo_GetByEmailOrUsername(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepo(testPool)
+
+	setupTables(t, ctx)
+	defer cleanupTables(t, ctx)
+
+	alice := &domain.User{Username: "alice", Email: "alice@test.com", PasswordHash: "hash", Role: domain.RoleUser}
+	require.NoError(t, repo.Create(ctx, alice))
+	// bob's username is alice's email, which must still log alice in.
+	bob := &domain.User{Username: "alice@test.com", Email: "bob@test.com", PasswordHash: "hash", Role: domain.RoleUser}
+	require.NoError(t, repo.Create(ctx, bob))
+	for _, email := range []string{"twin1@test.com", "twin2@test.com"} {
+		require.NoError(t, repo.Create(ctx, &domain.User{Username: "twin", Email: email, PasswordHash: "hash", Role: domain.RoleUser}))
+	}
+
+	t.Run("Given an email", func(t *testing.T) {
+		got, err := repo.GetByEmailOrUsername(ctx, alice.Email)
+
+		require.NoError(t, err)
+		assert.Equal(t, alice.ID, got.ID)
+	})
+
+	t.Run("Given a username", func(t *testing.T) {
+		got, err := repo.GetByEmailOrUsername(ctx, "alice")
+
+		require.NoError(t, err)
+		assert.Equal(t, alice.ID, got.ID)
+	})
+
+	t.Run("Given a username shared by several users", func(t *testing.T) {
+		_, err := repo.GetByEmailOrUsername(ctx, "twin")
+
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	})
+
+	t.Run("Given an unknown identifier", func(t *testing.T) {
+		_, err := repo.GetByEmailOrUsername(ctx, "nobody")
+
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	})
+}
+
+func TestUserRepo_CountUsers(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepo(testPool)
+
+	setupTables(t, ctx)
+	defer cleanupTables(t, ctx)
+
+	t.Run("Given no users", func(t *testing.T) {
+		n, err := repo.CountUsers(ctx)
+
+		require.NoError(t, err)
+		assert.Zero(t, n)
+	})
 
-	t.Run("Given a valid and unexpired token", func(t *testing.T) {
-		token := "valid-token"
-		expiresAt := time.Now().Add(time.Hour)
-		err := repo.SaveRefreshToken(ctx, user.ID, token, expiresAt)
+	t.Run("Given seeded users", func(t *testing.T) {
+		for _, email := range []string{"a@test.com", "b@test.com", "c@test.com"} {
+			require.NoError(t, repo.Create(ctx, &domain.User{Username: "user", Email: email, PasswordHash: "hash", Role: domain.RoleUser}))
+		}
+
+		n, err := repo.CountUsers(ctx)
+
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), n)
+	})
+}
+
+func TestUserRepo_RotateRefreshToken(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepo(testPool)
+
+	setupTables(t, ctx)
+	defer cleanupTables(t, ctx)
+
+	user := &domain.User{Username: "test", Email: "test@test.com", PasswordHash: "hash", Role: domain.RoleUser}
+	require.NoError(t, repo.Create(ctx, user))
+	expiresAt := time.Now().Add(time.Hour)
+
+	t.Run("Given a valid token", func(t *testing.T) {
+		oldID := saveRefreshToken(t, ctx, repo, user.ID, "old-token", expiresAt)
+		_, err := testPool.Exec(ctx, `UPDATE refresh_tokens SET created_at = now() - interval '1 hour' WHERE token = 'old-token'`)
+		require.NoError(t, err)
+		old, err := repo.GetRefreshToken(ctx, "old-token")
 		require.NoError(t, err)
 
-		userID, err := repo.ConsumeRefreshToken(ctx, token)
+		err = repo.RotateRefreshToken(ctx, "old-token", "new-token", user.ID, expiresAt, 0)
 
 		assert.NoError(t, err)
-		assert.Equal(t, user.ID, userID)
+		_, err = repo.GetRefreshToken(ctx, "old-token")
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+		session, err := repo.GetRefreshToken(ctx, "new-token")
+		assert.NoError(t, err)
+		assert.Equal(t, user.ID, session.UserID)
+		assert.Equal(t, oldID, session.ID, "the session id must survive rotation")
+		assert.True(t, old.CreatedAt.Equal(session.CreatedAt), "the session creation time must survive rotation")
+	})
+
+	t.Run("Given a token that was already rotated", func(t *testing.T) {
+		err := repo.RotateRefreshToken(ctx, "old-token", "another-token", user.ID, expiresAt, 0)
+
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+		_, err = repo.GetRefreshToken(ctx, "another-token")
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+	})
+
+	t.Run("Given an expired token", func(t *testing.T) {
+		saveRefreshToken(t, ctx, repo, user.ID, "expired-token", time.Now().Add(-time.Hour))
+
+		err := repo.RotateRefreshToken(ctx, "expired-token", "fresh-token", user.ID, expiresAt, 0)
+
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+	})
+
+	t.Run("Given the insert fails after the delete", func(t *testing.T) {
+		saveRefreshToken(t, ctx, repo, user.ID, "kept-token", expiresAt)
+		saveRefreshToken(t, ctx, repo, user.ID, "taken-token", expiresAt)
+
+		// The new token collides with an existing one, so the insert fails
+		// once the old token has already been deleted inside the transaction.
+		err := repo.RotateRefreshToken(ctx, "kept-token", "taken-token", user.ID, expiresAt, 0)
+
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+		session, err := repo.GetRefreshToken(ctx, "kept-token")
+		assert.NoError(t, err, "old token must survive a failed rotation")
+		assert.Equal(t, user.ID, session.UserID)
+	})
+
+	t.Run("Given a cancelled context", func(t *testing.T) {
+		saveRefreshToken(t, ctx, repo, user.ID, "survivor-token", expiresAt)
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		err := repo.RotateRefreshToken(cancelled, "survivor-token", "orphan-token", user.ID, expiresAt, 0)
+
+		assert.ErrorIs(t, err, domain.ErrServiceUnavailable)
+		assert.Equal(t, domain.CodeServiceUnavailable, domain.ToAPIError(err).Code)
+		_, err = repo.GetRefreshToken(ctx, "survivor-token")
+		assert.NoError(t, err, "the token must survive a cancelled rotation")
+	})
+}
+
+func TestUserRepo_MarkEmailVerified(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepo(testPool)
+
+	setupTables(t, ctx)
+	defer cleanupTables(t, ctx)
+
+	user := &domain.User{Username: "test", Email: "test@test.com", PasswordHash: "hash", Role: domain.RoleUser}
+	err := repo.Create(ctx, user)
+	require.NoError(t, err)
+
+	t.Run("Given an unverified user", func(t *testing.T) {
+		got, err := repo.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.False(t, got.EmailVerified())
+
+		require.NoError(t, repo.MarkEmailVerified(ctx, user.ID))
+
+		got, err = repo.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.True(t, got.EmailVerified())
+	})
+
+	t.Run("Given an already verified user", func(t *testing.T) {
+		before, err := repo.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+
+		require.NoError(t, repo.MarkEmailVerified(ctx, user.ID))
+
+		got, err := repo.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.True(t, before.EmailVerifiedAt.Equal(got.EmailVerifiedAt))
+	})
+
+	t.Run("Given a non-existent user", func(t *testing.T) {
+		err := repo.MarkEmailVerified(ctx, user.ID+1000)
+
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	})
+}
+
+func TestUserRepo_UpdateRole(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepo(testPool)
+
+	setupTables(t, ctx)
+	defer cleanupTables(t, ctx)
 
-		_, _, err = repo.GetRefreshToken(ctx, token)
-		assert.Error(t, err, "token should have been deleted")
+	user := &domain.User{Username: "test", Email: "test@test.com", PasswordHash: "hash", Role: domain.RoleUser}
+	err := repo.Create(ctx, user)
+	require.NoError(t, err)
+
+	t.Run("Given a valid role", func(t *testing.T) {
+		_, err := repo.SaveRefreshToken(ctx, user.ID, "before-role-change", time.Now().Add(time.Hour), domain.ClientInfo{})
+		require.NoError(t, err)
+
+		err = repo.UpdateRole(ctx, user.ID, domain.RoleAdmin)
+		require.NoError(t, err)
+
+		got, err := repo.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, domain.RoleAdmin, got.Role)
+		_, err = repo.GetRefreshToken(ctx, "before-role-change")
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound, "a role change must revoke refresh tokens")
 	})
 
-	t.Run("Given a non-existent token", func(t *testing.T) {
-		_, err := repo.ConsumeRefreshToken(ctx, "non-existent-token")
+	t.Run("Given an invalid role value", func(t *testing.T) {
+		err := repo.UpdateRole(ctx, user.ID, "superuser")
 
+		assert.Error(t, err)
+	})
+
+	t.Run("Given a non-existent user", func(t *testing.T) {
+		err := repo.UpdateRole(ctx, user.ID+1000, domain.RoleAdmin)
+
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	})
+
+	t.Run("Revoking all refresh tokens", func(t *testing.T) {
+		_, err := repo.SaveRefreshToken(ctx, user.ID, "token-1", time.Now().Add(time.Hour), domain.ClientInfo{})
+		require.NoError(t, err)
+		_, err = repo.SaveRefreshToken(ctx, user.ID, "token-2", time.Now().Add(time.Hour), domain.ClientInfo{})
+		require.NoError(t, err)
+
+		err = repo.RevokeAllRefreshTokens(ctx, user.ID)
+		require.NoError(t, err)
+
+		_, err = repo.GetRefreshToken(ctx, "token-1")
 		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+		_, err = repo.GetRefreshToken(ctx, "token-2")
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+	})
+}
+
+func TestUserRepo_TokenVersion(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepo(testPool)
+
+	setupTables(t, ctx)
+	defer cleanupTables(t, ctx)
+
+	user := &domain.User{Username: "test", Email: "test@test.com", PasswordHash: "hash", Role: domain.RoleUser}
+	require.NoError(t, repo.Create(ctx, user))
+
+	t.Run("Given a new user", func(t *testing.T) {
+		version, err := repo.GetTokenVersion(ctx, user.ID)
+
+		require.NoError(t, err)
+		assert.Zero(t, version)
+	})
+
+	t.Run("Given a bump", func(t *testing.T) {
+		version, err := repo.BumpTokenVersion(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), version)
+
+		got, err := repo.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), got.TokenVersion)
+	})
+
+	t.Run("Given a password or role change", func(t *testing.T) {
+		require.NoError(t, repo.ChangePassword(ctx, user.ID, "new-hash"))
+		require.NoError(t, repo.UpdateRole(ctx, user.ID, domain.RoleAdmin))
+
+		version, err := repo.GetTokenVersion(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), version)
+	})
+
+	t.Run("Given a non-existent user", func(t *testing.T) {
+		_, err := repo.GetTokenVersion(ctx, user.ID+1000)
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+
+		_, err = repo.BumpTokenVersion(ctx, user.ID+1000)
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	})
+}
+
+func TestUserRepo_RevokeRefreshJTI(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepo(testPool)
+
+	setupTables(t, ctx)
+	defer cleanupTables(t, ctx)
+
+	expiresAt := time.Now().Add(time.Hour)
+
+	revoked, err := repo.RevokeRefreshJTI(ctx, "jti-1", expiresAt)
+	require.NoError(t, err)
+	assert.True(t, revoked, "first revocation should succeed")
+
+	revoked, err = repo.RevokeRefreshJTI(ctx, "jti-1", expiresAt)
+	require.NoError(t, err)
+	assert.False(t, revoked, "second revocation should report reuse")
+}
+
+func TestUserRepo_DeleteExpiredRefreshTokens(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepo(testPool)
+
+	setupTables(t, ctx)
+	defer cleanupTables(t, ctx)
+
+	user := &domain.User{Username: "test", Email: "test@test.com", PasswordHash: "hash", Role: domain.RoleUser}
+	require.NoError(t, repo.Create(ctx, user))
+	saveRefreshToken(t, ctx, repo, user.ID, "expired", time.Now().Add(-time.Hour))
+	saveRefreshToken(t, ctx, repo, user.ID, "live", time.Now().Add(time.Hour))
+	_, err := repo.RevokeRefreshJTI(ctx, "expired-jti", time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+
+	deleted, err := repo.DeleteExpiredRefreshTokens(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+	_, err = repo.GetRefreshToken(ctx, "live")
+	assert.NoError(t, err)
+
+	t.Run("Given the tables are vacuumed", func(t *testing.T) {
+		assert.NoError(t, repo.VacuumRefreshTokens(ctx))
+	})
+}
+
+func TestUserRepo_DeleteExpiredRefreshTokens_UsesIndex(t *testing.T) {
+	ctx := context.Background()
+
+	setupTables(t, ctx)
+	defer cleanupTables(t, ctx)
+
+	// A near-empty table is cheaper to scan sequentially, so rule that out
+	// to see whether the index can serve the query at all.
+	tx, err := testPool.Begin(ctx)
+	require.NoError(t, err)
+	defer func() { _ = tx.Rollback(ctx) }()
+	_, err = tx.Exec(ctx, `SET LOCAL enable_seqscan = off`)
+	require.NoError(t, err)
+
+	rows, err := tx.Query(ctx, `EXPLAIN `+deleteExpiredRefreshTokens)
+	require.NoError(t, err)
+	plan, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	require.NoError(t, err)
+
+	assert.Contains(t, strings.Join(plan, "\n"), "idx_refresh_tokens_expires_at")
+}
+
+func TestUserRepo_RefreshTokenTTL(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	repo := NewUserRepo(testPool).WithClock(clock.NewFake(now))
+
+	setupTables(t, ctx)
+	defer cleanupTables(t, ctx)
+
+	user := &domain.User{Username: "test", Email: "test@test.com", PasswordHash: "hash", Role: domain.RoleUser}
+	require.NoError(t, repo.Create(ctx, user))
+	saveRefreshToken(t, ctx, repo, user.ID, "live", now.Add(time.Hour))
+	saveRefreshToken(t, ctx, repo, user.ID, "expired", now.Add(-time.Hour))
+
+	t.Run("Given a live token", func(t *testing.T) {
+		ttl, err := repo.RefreshTokenTTL(ctx, "live")
+
+		require.NoError(t, err)
+		assert.Equal(t, time.Hour, ttl)
+
+		_, err = repo.GetRefreshToken(ctx, "live")
+		assert.NoError(t, err, "the token must not be consumed")
 	})
 
 	t.Run("Given an expired token", func(t *testing.T) {
-		token := "expired-token"
-		expiresAt := time.Now().Add(-time.Hour)
-		err := repo.SaveRefreshToken(ctx, user.ID, token, expiresAt)
+		ttl, err := repo.RefreshTokenTTL(ctx, "expired")
+
 		require.NoError(t, err)
+		assert.Equal(t, -time.Hour, ttl)
+	})
 
-		_, err = repo.ConsumeRefreshToken(ctx, token)
+	t.Run("Given a missing token", func(t *testing.T) {
+		_, err := repo.RefreshTokenTTL(ctx, "missing")
 
 		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
 	})
 }
+
+func TestUserRepo_RecordFailedLogin(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepo(testPool)
+
+	setupTables(t, ctx)
+	defer cleanupTables(t, ctx)
+
+	user := &domain.User{Username: "alice", Email: "alice@test.com", PasswordHash: "hash", Role: domain.RoleUser}
+	require.NoError(t, repo.Create(ctx, user))
+
+	for i := 0; i < 2; i++ {
+		lockedUntil, err := repo.RecordFailedLogin(ctx, user.ID, 3, time.Minute)
+		require.NoError(t, err)
+		assert.True(t, lockedUntil.IsZero(), "failure %d must not lock", i+1)
+	}
+	lockedUntil, err := repo.RecordFailedLogin(ctx, user.ID, 3, time.Minute)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), lockedUntil, 5*time.Second)
+
+	got, err := repo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.True(t, got.LockedAt(time.Now()))
+
+	require.NoError(t, repo.TouchLastLogin(ctx, user.ID))
+	got, err = repo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.True(t, got.LockedUntil.IsZero(), "a successful login must clear the lock")
+	lockedUntil, err = repo.RecordFailedLogin(ctx, user.ID, 3, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, lockedUntil.IsZero(), "a successful login must reset the count")
+
+	_, err = repo.RecordFailedLogin(ctx, 999, 3, time.Minute)
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+}
@@ -0,0 +1,32 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsUniqueViolation(t *testing.T) {
+	unique := &pgconn.PgError{Code: "23505", ConstraintName: "users_email_key"}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"Given a unique violation", unique, true},
+		{"Given a wrapped unique violation", fmt.Errorf("scan: %w", unique), true},
+		{"Given a doubly wrapped unique violation", fmt.Errorf("insert: %w", fmt.Errorf("scan: %w", unique)), true},
+		{"Given another database error", &pgconn.PgError{Code: "23503"}, false},
+		{"Given a non-database error", errors.New("connection reset"), false},
+		{"Given no error", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isUniqueViolation(tt.err))
+		})
+	}
+}
@@ -0,0 +1,52 @@
+// Package repository declares the storage interfaces the use cases depend
+// on. The postgres package implements them; mocks holds generated test
+// doubles, refreshed with go generate after an interface changes.
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+)
+
+//go:generate mockery --name UserRepository --output mocks --outpkg mocks
+//go:generate mockery --name TokenCleanupRepository --output mocks --outpkg mocks
+
+type UserRepository interface {
+	Create(ctx context.Context, user *domain.User) error
+	GetByEmail(ctx context.Context, email string) (*domain.User, error)
+	GetByEmailOrUsername(ctx context.Context, identifier string) (*domain.User, error)
+	GetByID(ctx context.Context, id int64) (*domain.User, error)
+	UpdateRole(ctx context.Context, userID int64, role string) error
+	UpdatePasswordHash(ctx context.Context, userID int64, passwordHash string) error
+	MarkEmailVerified(ctx context.Context, userID int64) error
+	ChangePassword(ctx context.Context, userID int64, passwordHash string) error
+	GetTokenVersion(ctx context.Context, userID int64) (int64, error)
+	BumpTokenVersion(ctx context.Context, userID int64) (int64, error)
+	SaveRefreshToken(ctx context.Context, userID int64, token string, expiresAt time.Time, client domain.ClientInfo) (int64, error)
+	RotateRefreshToken(ctx context.Context, oldToken, newToken string, userID int64, expiresAt time.Time, maxRefreshes int) error
+	RevokeAllRefreshTokens(ctx context.Context, userID int64) error
+	RevokeRefreshJTI(ctx context.Context, jti string, expiresAt time.Time) (bool, error)
+	GetRefreshToken(ctx context.Context, token string) (domain.Session, error)
+	GetSession(ctx context.Context, sessionID int64) (domain.Session, error)
+	DeleteSession(ctx context.Context, userID, sessionID int64) error
+	IsRefreshJTIRevoked(ctx context.Context, jti string) (bool, error)
+	ListSessions(ctx context.Context, userID int64) ([]domain.Session, error)
+	TouchRefreshToken(ctx context.Context, token, ip string) (string, error)
+	TouchLastLogin(ctx context.Context, userID int64) error
+	RecordFailedLogin(ctx context.Context, userID int64, maxFailures int, lockFor time.Duration) (time.Time, error)
+	ListDormantUsers(ctx context.Context, before time.Time) ([]domain.User, error)
+	CountUsers(ctx context.Context) (int64, error)
+	DeactivateDormantUsers(ctx context.Context, before time.Time) (int64, error)
+	ImportUsers(ctx context.Context, users []domain.User) ([]error, error)
+	DeleteUser(ctx context.Context, userID int64) error
+}
+
+type TokenCleanupRepository interface {
+	DeleteExpiredRefreshTokens(ctx context.Context) (int64, error)
+	// VacuumRefreshTokens makes the space of deleted refresh tokens and
+	// revocations reusable, for when a cleanup removed too many rows to
+	// wait for autovacuum.
+	VacuumRefreshTokens(ctx context.Context) error
+}
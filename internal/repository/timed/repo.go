@@ -0,0 +1,206 @@
+// Package timed wraps a user repository with per-operation latency metrics
+// and slow query logging.
+package timed
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/Kovalyovv/auth-service/internal/repository"
+	"github.com/Kovalyovv/auth-service/internal/usecase"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "auth_repo_query_duration_seconds",
+	Help:    "Latency of user repository operations, by operation.",
+	Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+}, []string{"operation"})
+
+// Repository is everything the service needs from its user store.
+type Repository interface {
+	repository.UserRepository
+	repository.TokenCleanupRepository
+	usecase.AuditLog
+}
+
+// UserRepo times every call to the repository it wraps. Calls slower than
+// the slow threshold are logged; a zero threshold logs none.
+type UserRepo struct {
+	next Repository
+	slow time.Duration
+}
+
+var _ Repository = (*UserRepo)(nil)
+
+func NewUserRepo(next Repository, slow time.Duration) *UserRepo {
+	return &UserRepo{next: next, slow: slow}
+}
+
+// observe records the time since start under op. Use it deferred, so the
+// start time is taken when the call begins.
+func (r *UserRepo) observe(op string, start time.Time) {
+	d := time.Since(start)
+	queryDuration.WithLabelValues(op).Observe(d.Seconds())
+	if r.slow > 0 && d >= r.slow {
+		slog.Warn("slow repository query", "operation", op, "duration", d)
+	}
+}
+
+func (r *UserRepo) Create(ctx context.Context, user *domain.User) error {
+	defer r.observe("create", time.Now())
+	return r.next.Create(ctx, user)
+}
+
+func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	defer r.observe("get_by_email", time.Now())
+	return r.next.GetByEmail(ctx, email)
+}
+
+func (r *UserRepo) GetByEmailOrUsername(ctx context.Context, identifier string) (*domain.User, error) {
+	defer r.observe("get_by_email_or_username", time.Now())
+	return r.next.GetByEmailOrUsername(ctx, identifier)
+}
+
+func (r *UserRepo) GetByID(ctx context.Context, id int64) (*domain.User, error) {
+	defer r.observe("get_by_id", time.Now())
+	return r.next.GetByID(ctx, id)
+}
+
+func (r *UserRepo) UpdateRole(ctx context.Context, userID int64, role string) error {
+	defer r.observe("update_role", time.Now())
+	return r.next.UpdateRole(ctx, userID, role)
+}
+
+func (r *UserRepo) MarkEmailVerified(ctx context.Context, userID int64) error {
+	defer r.observe("mark_email_verified", time.Now())
+	return r.next.MarkEmailVerified(ctx, userID)
+}
+
+func (r *UserRepo) UpdatePasswordHash(ctx context.Context, userID int64, passwordHash string) error {
+	defer r.observe("update_password_hash", time.Now())
+	return r.next.UpdatePasswordHash(ctx, userID, passwordHash)
+}
+
+func (r *UserRepo) ChangePassword(ctx context.Context, userID int64, passwordHash string) error {
+	defer r.observe("change_password", time.Now())
+	return r.next.ChangePassword(ctx, userID, passwordHash)
+}
+
+func (r *UserRepo) GetTokenVersion(ctx context.Context, userID int64) (int64, error) {
+	defer r.observe("get_token_version", time.Now())
+	return r.next.GetTokenVersion(ctx, userID)
+}
+
+func (r *UserRepo) BumpTokenVersion(ctx context.Context, userID int64) (int64, error) {
+	defer r.observe("bump_token_version", time.Now())
+	return r.next.BumpTokenVersion(ctx, userID)
+}
+
+func (r *UserRepo) SaveRefreshToken(ctx context.Context, userID int64, token string, expiresAt time.Time, client domain.ClientInfo) (int64, error) {
+	defer r.observe("save_refresh", time.Now())
+	return r.next.SaveRefreshToken(ctx, userID, token, expiresAt, client)
+}
+
+func (r *UserRepo) RotateRefreshToken(ctx context.Context, oldToken, newToken string, userID int64, expiresAt time.Time, maxRefreshes int) error {
+	defer r.observe("rotate_refresh", time.Now())
+	return r.next.RotateRefreshToken(ctx, oldToken, newToken, userID, expiresAt, maxRefreshes)
+}
+
+func (r *UserRepo) RevokeAllRefreshTokens(ctx context.Context, userID int64) error {
+	defer r.observe("revoke_all_refresh", time.Now())
+	return r.next.RevokeAllRefreshTokens(ctx, userID)
+}
+
+func (r *UserRepo) RevokeRefreshJTI(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	defer r.observe("revoke_refresh_jti", time.Now())
+	return r.next.RevokeRefreshJTI(ctx, jti, expiresAt)
+}
+
+func (r *UserRepo) GetRefreshToken(ctx context.Context, token string) (domain.Session, error) {
+	defer r.observe("get_refresh", time.Now())
+	return r.next.GetRefreshToken(ctx, token)
+}
+
+func (r *UserRepo) GetSession(ctx context.Context, sessionID int64) (domain.Session, error) {
+	defer r.observe("get_session", time.Now())
+	return r.next.GetSession(ctx, sessionID)
+}
+
+func (r *UserRepo) DeleteSession(ctx context.Context, userID, sessionID int64) error {
+	defer r.observe("delete_session", time.Now())
+	return r.next.DeleteSession(ctx, userID, sessionID)
+}
+
+func (r *UserRepo) IsRefreshJTIRevoked(ctx context.Context, jti string) (bool, error) {
+	defer r.observe("is_refresh_jti_revoked", time.Now())
+	return r.next.IsRefreshJTIRevoked(ctx, jti)
+}
+
+func (r *UserRepo) ListSessions(ctx context.Context, userID int64) ([]domain.Session, error) {
+	defer r.observe("list_sessions", time.Now())
+	return r.next.ListSessions(ctx, userID)
+}
+
+func (r *UserRepo) TouchRefreshToken(ctx context.Context, token, ip string) (string, error) {
+	defer r.observe("touch_refresh", time.Now())
+	return r.next.TouchRefreshToken(ctx, token, ip)
+}
+
+func (r *UserRepo) TouchLastLogin(ctx context.Context, userID int64) error {
+	defer r.observe("touch_last_login", time.Now())
+	return r.next.TouchLastLogin(ctx, userID)
+}
+
+func (r *UserRepo) ListDormantUsers(ctx context.Context, before time.Time) ([]domain.User, error) {
+	defer r.observe("list_dormant_users", time.Now())
+	return r.next.ListDormantUsers(ctx, before)
+}
+
+func (r *UserRepo) CountUsers(ctx context.Context) (int64, error) {
+	defer r.observe("count_users", time.Now())
+	return r.next.CountUsers(ctx)
+}
+
+func (r *UserRepo) DeactivateDormantUsers(ctx context.Context, before time.Time) (int64, error) {
+	defer r.observe("deactivate_dormant_users", time.Now())
+	return r.next.DeactivateDormantUsers(ctx, before)
+}
+
+func (r *UserRepo) RecordFailedLogin(ctx context.Context, userID int64, maxFailures int, lockFor time.Duration) (time.Time, error) {
+	defer r.observe("record_failed_login", time.Now())
+	return r.next.RecordFailedLogin(ctx, userID, maxFailures, lockFor)
+}
+
+func (r *UserRepo) ImportUsers(ctx context.Context, users []domain.User) ([]error, error) {
+	defer r.observe("import_users", time.Now())
+	return r.next.ImportUsers(ctx, users)
+}
+
+func (r *UserRepo) DeleteUser(ctx context.Context, userID int64) error {
+	defer r.observe("delete_user", time.Now())
+	return r.next.DeleteUser(ctx, userID)
+}
+
+func (r *UserRepo) DeleteExpiredRefreshTokens(ctx context.Context) (int64, error) {
+	defer r.observe("delete_expired_refresh", time.Now())
+	return r.next.DeleteExpiredRefreshTokens(ctx)
+}
+
+func (r *UserRepo) VacuumRefreshTokens(ctx context.Context) error {
+	defer r.observe("vacuum_refresh_tokens", time.Now())
+	return r.next.VacuumRefreshTokens(ctx)
+}
+
+func (r *UserRepo) RecordAuthEvent(ctx context.Context, e domain.AuthEvent) error {
+	defer r.observe("record_auth_event", time.Now())
+	return r.next.RecordAuthEvent(ctx, e)
+}
+
+func (r *UserRepo) ListAuthEvents(ctx context.Context, f domain.AuthEventFilter) ([]domain.AuthEvent, error) {
+	defer r.observe("list_auth_events", time.Now())
+	return r.next.ListAuthEvents(ctx, f)
+}
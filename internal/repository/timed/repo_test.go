@@ -0,0 +1,79 @@
+package timed
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubRepo implements only the calls under test; the rest panic.
+type stubRepo struct {
+	Repository
+	delay time.Duration
+	err   error
+}
+
+func (s *stubRepo) Create(context.Context, *domain.User) error {
+	time.Sleep(s.delay)
+	return s.err
+}
+
+func (s *stubRepo) GetByEmail(context.Context, string) (*domain.User, error) {
+	time.Sleep(s.delay)
+	return &domain.User{ID: 1}, s.err
+}
+
+func sampleCount(t *testing.T, op string) uint64 {
+	t.Helper()
+	var m dto.Metric
+	require.NoError(t, queryDuration.WithLabelValues(op).(prometheus.Histogram).Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestUserRepo(t *testing.T) {
+	t.Run("Given calls to different operations", func(t *testing.T) {
+		repo := NewUserRepo(&stubRepo{}, 0)
+		creates, lookups := sampleCount(t, "create"), sampleCount(t, "get_by_email")
+
+		require.NoError(t, repo.Create(context.Background(), &domain.User{}))
+		user, err := repo.GetByEmail(context.Background(), "alice@example.com")
+		require.NoError(t, err)
+		_, _ = repo.GetByEmail(context.Background(), "bob@example.com")
+
+		assert.Equal(t, int64(1), user.ID)
+		assert.Equal(t, creates+1, sampleCount(t, "create"))
+		assert.Equal(t, lookups+2, sampleCount(t, "get_by_email"))
+	})
+
+	t.Run("Given a failing call", func(t *testing.T) {
+		dbErr := errors.New("connection reset")
+		repo := NewUserRepo(&stubRepo{err: dbErr}, 0)
+		before := sampleCount(t, "create")
+
+		err := repo.Create(context.Background(), &domain.User{})
+
+		assert.ErrorIs(t, err, dbErr)
+		assert.Equal(t, before+1, sampleCount(t, "create"))
+	})
+
+	t.Run("Given a call slower than the threshold", func(t *testing.T) {
+		var logs bytes.Buffer
+		defer slog.SetDefault(slog.Default())
+		slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+		_ = NewUserRepo(&stubRepo{delay: 20 * time.Millisecond}, 10*time.Millisecond).Create(context.Background(), &domain.User{})
+		_, _ = NewUserRepo(&stubRepo{}, time.Second).GetByEmail(context.Background(), "alice@example.com")
+
+		assert.Contains(t, logs.String(), "operation=create")
+		assert.NotContains(t, logs.String(), "operation=get_by_email")
+	})
+}
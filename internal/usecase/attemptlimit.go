@@ -0,0 +1,96 @@
+package usecase
+
+import (
+	"sync"
+	"time"
+)
+
+// attemptLimiter counts failed attempts per key in fixed windows and blocks a
+// key once it reached max failures, until its window ends. It keeps state in
+// memory, so each instance counts on its own. A nil limiter admits
+// everything.
+type attemptLimiter struct {
+	max    int
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	windows   map[string]*attemptWindow
+	lastSweep time.Time
+}
+
+type attemptWindow struct {
+	failures int
+	resetAt  time.Time
+}
+
+func newAttemptLimiter(max int, window time.Duration) *attemptLimiter {
+	if max <= 0 || window <= 0 {
+		return nil
+	}
+	return &attemptLimiter{max: max, window: window, now: time.Now, windows: make(map[string]*attemptWindow)}
+}
+
+// allow reports whether key may make another attempt. If not, retryAfter is
+// how long until it may.
+func (l *attemptLimiter) allow(key string) (retryAfter time.Duration, ok bool) {
+	if l == nil {
+		return 0, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w := l.current(key)
+	if w == nil || w.failures < l.max {
+		return 0, true
+	}
+	return w.resetAt.Sub(l.now()), false
+}
+
+// fail records a failed attempt by key.
+func (l *attemptLimiter) fail(key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w := l.current(key)
+	if w == nil {
+		w = &attemptWindow{resetAt: l.now().Add(l.window)}
+		l.windows[key] = w
+	}
+	w.failures++
+}
+
+// reset forgets the failures of key, typically after a successful attempt.
+func (l *attemptLimiter) reset(key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.windows, key)
+}
+
+// current returns the live window of key, or nil if it has none. Expired
+// windows of every key are dropped once per window length. Callers must hold
+// l.mu.
+func (l *attemptLimiter) current(key string) *attemptWindow {
+	now := l.now()
+	if now.Sub(l.lastSweep) > l.window {
+		for k, w := range l.windows {
+			if !now.Before(w.resetAt) {
+				delete(l.windows, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	w, ok := l.windows[key]
+	if ok && !now.Before(w.resetAt) {
+		delete(l.windows, key)
+		return nil
+	}
+	return w
+}
@@ -0,0 +1,46 @@
+package usecase
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttemptLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := newAttemptLimiter(2, time.Minute)
+	l.now = func() time.Time { return now }
+
+	l.fail("alice")
+	_, ok := l.allow("alice")
+	assert.True(t, ok, "one failure is below the limit")
+
+	l.fail("alice")
+	retryAfter, ok := l.allow("alice")
+	assert.False(t, ok)
+	assert.Equal(t, time.Minute, retryAfter)
+
+	_, ok = l.allow("bob")
+	assert.True(t, ok, "keys are counted separately")
+
+	now = now.Add(40 * time.Second)
+	retryAfter, ok = l.allow("alice")
+	assert.False(t, ok)
+	assert.Equal(t, 20*time.Second, retryAfter)
+
+	now = now.Add(20 * time.Second)
+	_, ok = l.allow("alice")
+	assert.True(t, ok, "the window has ended")
+
+	l.fail("alice")
+	l.fail("alice")
+	l.reset("alice")
+	_, ok = l.allow("alice")
+	assert.True(t, ok, "reset clears failures")
+
+	var disabled *attemptLimiter
+	disabled.fail("alice")
+	_, ok = disabled.allow("alice")
+	assert.True(t, ok)
+}
@@ -2,94 +2,1783 @@ package usecase
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/Kovalyovv/auth-service/internal/pkg/clock"
 	"github.com/Kovalyovv/auth-service/internal/pkg/hash"
 	"github.com/Kovalyovv/auth-service/internal/pkg/jwt"
+	"github.com/Kovalyovv/auth-service/internal/repository"
 )
 
-type UserRepository interface {
-	Create(ctx context.Context, user *domain.User) error
-	GetByEmail(ctx context.Context, email string) (*domain.User, error)
-	SaveRefreshToken(ctx context.Context, userID int64, token string, expiresAt time.Time) error
-	ConsumeRefreshToken(ctx context.Context, token string) (int64, error)
+// EventPublisher receives account events. Implementations must not block the
+// caller; delivery happens in the background.
+type EventPublisher interface {
+	Publish(ctx context.Context, event domain.Event)
 }
 
+// AuditLog stores and queries authentication events.
+type AuditLog interface {
+	RecordAuthEvent(ctx context.Context, e domain.AuthEvent) error
+	ListAuthEvents(ctx context.Context, f domain.AuthEventFilter) ([]domain.AuthEvent, error)
+}
+
+// Mailer sends account emails. AuthUseCase calls it in the background, so
+// implementations may block on the network.
+type Mailer interface {
+	SendVerification(ctx context.Context, to, token string) error
+	SendPasswordReset(ctx context.Context, to, token string) error
+	// SendAccountExists tells the owner of to that someone tried to
+	// register with their address.
+	SendAccountExists(ctx context.Context, to string) error
+}
+
+// ClaimsEnricher returns custom claims, such as a tenant id or plan tier, to
+// add to the access tokens issued for user. Claims named like one the token
+// manager sets itself are dropped.
+type ClaimsEnricher func(user *domain.User) map[string]any
+
+func noExtraClaims(*domain.User) map[string]any { return nil }
+
+type noopPublisher struct{}
+
+func (noopPublisher) Publish(context.Context, domain.Event) {}
+
+// PasswordHasher hashes and verifies passwords; *hash.Hasher implements it.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Check(password, hash string) bool
+	NeedsRehash(hash string) bool
+}
+
+const (
+	// RefreshModeOpaque issues random refresh tokens persisted in the database.
+	RefreshModeOpaque = "opaque"
+	// RefreshModeJWT issues signed refresh tokens validated statelessly and
+	// checked against a revocation list.
+	RefreshModeJWT = "jwt"
+)
+
 type AuthUseCase struct {
-	repo            UserRepository
+	repo            repository.UserRepository
 	tokenManager    *jwt.TokenManager
 	accessTokenTTL  time.Duration
 	refreshTokenTTL time.Duration
+	maxAccessTTL    time.Duration
+
+	registrationEnabled bool
+	defaultRole         string
+	firstUserAdmin      bool
+	refreshMode         string
+	rotateThreshold     time.Duration
+	hasher              PasswordHasher
+	hashSlots           *hashLimiter
+	stepUpTTL           time.Duration
+	events              EventPublisher
+	audit               AuditLog
+	singleSession       bool
+	allowedDomains      map[string]bool
+	blockedDomains      map[string]bool
+	disposable          DisposableDomains
+	mailer              Mailer
+	passwordCooldown    time.Duration
+	minPasswordLength   int
+	maxPasswordBytes    int
+	hideExistingEmails  bool
+	signInOnRegister    bool
+	enrichClaims        ClaimsEnricher
+	maxRefreshes        int
+	verifyAttempts      *attemptLimiter
+	resendAttempts      *attemptLimiter
+	verificationTTL     time.Duration
+	lockoutThreshold    int
+	lockoutDuration     time.Duration
+	loginBackoff        *loginBackoff
+	loginIPAttempts     *attemptLimiter
+	loginEmailAttempts  *attemptLimiter
+	verifyGrace         time.Duration
+	checkVersions       bool
+	authTimeClaim       bool
+	usernameLogin       bool
+	loginFailureLevel   slog.Level
+	audiences           map[string]string
+	versions            *versionCache
+	clock               clock.Clock
+}
+
+// Default limits on failed VerifyPassword attempts per user, unless
+// WithVerifyPasswordLimit says otherwise.
+const (
+	DefaultVerifyPasswordMaxFailures = 5
+	DefaultVerifyPasswordWindow      = 15 * time.Minute
+)
+
+// Default password length bounds, unless WithPasswordLength says otherwise.
+// bcrypt only hashes the first 72 bytes of a password, so longer ones would
+// be accepted but silently truncated.
+const (
+	DefaultMinPasswordLength = 8
+	DefaultMaxPasswordBytes  = 72
+)
+
+// Defaults for email verification, unless WithVerificationTokenTTL and
+// WithVerificationResendInterval say otherwise.
+const (
+	DefaultVerificationTokenTTL       = 24 * time.Hour
+	DefaultVerificationResendInterval = time.Minute
+)
+
+// DefaultStepUpTTL is how long a step-up token stays valid unless
+// WithStepUpTTL says otherwise.
+const DefaultStepUpTTL = 5 * time.Minute
+
+// Option configures optional AuthUseCase behaviour.
+type Option func(*AuthUseCase)
+
+// WithClock sets the clock that token expiries, lockouts, cooldowns and
+// attempt limits are measured against. It defaults to the system clock. Give
+// the token manager the same clock so both agree on the time.
+func WithClock(c clock.Clock) Option {
+	return func(uc *AuthUseCase) {
+		uc.clock = c
+	}
+}
+
+// WithVerifyExpiredGrace makes Verify accept access tokens that expired no
+// more than grace ago, reporting them as in grace. It does not affect
+// Authenticate or token issuance. Zero, the default, disables it.
+func WithVerifyExpiredGrace(grace time.Duration) Option {
+	return func(uc *AuthUseCase) {
+		uc.verifyGrace = grace
+	}
+}
+
+// WithTokenVersionCheck makes Authenticate and Verify reject access tokens
+// whose ver claim is not the user's current token version, so that a
+// password or role change, or RevokeAccessTokens, ends every access token
+// issued before it. Each check reads the version from the repository.
+// Tokens carrying a privileged role are checked even without it. JWT
+// refresh tokens, which cannot be deleted like opaque ones, are checked the
+// same way on refresh.
+func WithTokenVersionCheck(enabled bool) Option {
+	return func(uc *AuthUseCase) {
+		uc.checkVersions = enabled
+	}
+}
+
+// WithAuthTimeClaim adds an auth_time claim to access tokens: when the user
+// last entered their password, at login or step-up. Refreshes carry it over
+// unchanged, so clients can demand a fresh login once it is too old, however
+// recently the token was issued.
+func WithAuthTimeClaim(enabled bool) Option {
+	return func(uc *AuthUseCase) {
+		uc.authTimeClaim = enabled
+	}
+}
+
+// WithTokenVersionCache caches token versions read by WithTokenVersionCheck
+// for ttl. Changes made through this use case drop the cached version at
+// once; other instances see them within ttl. Zero, the default, disables the
+// cache.
+func WithTokenVersionCache(ttl time.Duration) Option {
+	return func(uc *AuthUseCase) {
+		uc.versions = newVersionCache(ttl)
+	}
+}
+
+// WithUsernameLogin lets Login take a username wherever it takes an email.
+// An identifier matching one user's email and another's username logs in
+// the former; a username shared by several users matches none of them.
+func WithUsernameLogin(enabled bool) Option {
+	return func(uc *AuthUseCase) {
+		uc.usernameLogin = enabled
+	}
+}
+
+// WithResourceAudiences lets users request access tokens scoped to other
+// resource servers with IssueResourceToken. audiences maps each resource to
+// the role a user needs to request it, or to "" if any user may. Resources
+// not in the map are refused.
+func WithResourceAudiences(audiences map[string]string) Option {
+	return func(uc *AuthUseCase) {
+		uc.audiences = audiences
+	}
+}
+
+// WithLoginFailureLogLevel sets the level failed logins are logged at, with
+// the identifier, client IP and reason. It defaults to slog.LevelWarn.
+func WithLoginFailureLogLevel(level slog.Level) Option {
+	return func(uc *AuthUseCase) {
+		uc.loginFailureLevel = level
+	}
+}
+
+// WithRegistrationEnabled toggles whether new accounts may be registered.
+func WithRegistrationEnabled(enabled bool) Option {
+	return func(uc *AuthUseCase) {
+		uc.registrationEnabled = enabled
+	}
+}
+
+// WithDefaultRole sets the role Register gives new users. It defaults to
+// domain.RoleUser.
+func WithDefaultRole(role string) Option {
+	return func(uc *AuthUseCase) {
+		uc.defaultRole = role
+	}
+}
+
+// WithFirstUserAdmin makes Register give domain.RoleAdmin to the user
+// registering while there are no users yet, to bootstrap a deployment. Two
+// registrations racing for an empty table may both become admins.
+func WithFirstUserAdmin(enabled bool) Option {
+	return func(uc *AuthUseCase) {
+		uc.firstUserAdmin = enabled
+	}
+}
+
+// WithRefreshTokenMode selects how refresh tokens are issued and validated.
+func WithRefreshTokenMode(mode string) Option {
+	return func(uc *AuthUseCase) {
+		uc.refreshMode = mode
+	}
+}
+
+// WithRefreshRotateThreshold makes Refresh keep an opaque refresh token that
+// is further than threshold from expiry, issuing only a new access token.
+// Zero rotates on every refresh.
+func WithRefreshRotateThreshold(threshold time.Duration) Option {
+	return func(uc *AuthUseCase) {
+		uc.rotateThreshold = threshold
+	}
+}
+
+// WithHasher sets the password hasher used for new hashes and upgrades.
+func WithHasher(h PasswordHasher) Option {
+	return func(uc *AuthUseCase) {
+		uc.hasher = h
+	}
 }
 
-func NewAuthUseCase(repo UserRepository, tm *jwt.TokenManager, accessTTL, refreshTTL time.Duration) *AuthUseCase {
-	return &AuthUseCase{
-		repo:            repo,
-		tokenManager:    tm,
-		accessTokenTTL:  accessTTL,
-		refreshTokenTTL: refreshTTL,
+// WithHashConcurrency allows at most n password hashes or verifications at
+// once. A request that cannot start within wait fails with
+// domain.ErrServiceUnavailable. Zero or less disables the cap.
+func WithHashConcurrency(n int, wait time.Duration) Option {
+	return func(uc *AuthUseCase) {
+		uc.hashSlots = newHashLimiter(n, wait)
 	}
 }
 
-func (uc *AuthUseCase) Register(ctx context.Context, username, email, password string) error {
-	h, err := hash.HashPassword(password)
+// WithMaxAccessTTL caps the lifetime of every access token issued, step-up
+// and resource tokens included, at max, whatever lifetime was configured.
+// Capped issuances are logged. Zero disables the cap.
+func WithMaxAccessTTL(max time.Duration) Option {
+	return func(uc *AuthUseCase) {
+		uc.maxAccessTTL = max
+	}
+}
+
+// WithStepUpTTL sets the lifetime of tokens issued by StepUp.
+func WithStepUpTTL(ttl time.Duration) Option {
+	return func(uc *AuthUseCase) {
+		uc.stepUpTTL = ttl
+	}
+}
+
+// WithEventPublisher sends account events such as registrations and logins
+// to p.
+func WithEventPublisher(p EventPublisher) Option {
+	return func(uc *AuthUseCase) {
+		uc.events = p
+	}
+}
+
+// WithMailer sends account emails through m.
+func WithMailer(m Mailer) Option {
+	return func(uc *AuthUseCase) {
+		uc.mailer = m
+	}
+}
+
+// WithPasswordChangeCooldown makes ChangePassword refuse a change within d of
+// the previous one. Zero allows changes at any time.
+func WithPasswordChangeCooldown(d time.Duration) Option {
+	return func(uc *AuthUseCase) {
+		uc.passwordCooldown = d
+	}
+}
+
+// WithPasswordLength sets the bounds Register and ChangePassword enforce on
+// new passwords: at least minLength characters and at most maxBytes bytes.
+// A maxBytes above 72 only makes sense with Argon2id hashing, since bcrypt
+// ignores everything past the 72nd byte.
+func WithPasswordLength(minLength, maxBytes int) Option {
+	return func(uc *AuthUseCase) {
+		uc.minPasswordLength = minLength
+		uc.maxPasswordBytes = maxBytes
+	}
+}
+
+// WithMaxRefreshes caps how many times a session can be refreshed by
+// rotation before Refresh fails with domain.ErrRefreshLimitReached and the
+// user has to log in again. Refreshes that only reissue the access token, see
+// WithRefreshRotateThreshold, are not counted. Zero means no limit. It
+// applies to opaque refresh tokens only.
+func WithMaxRefreshes(n int) Option {
+	return func(uc *AuthUseCase) {
+		uc.maxRefreshes = n
+	}
+}
+
+// WithVerifyPasswordLimit blocks VerifyPassword and StepUp for a user with
+// domain.ErrTooManyAttempts once maxFailures wrong passwords were given to
+// either within window. A correct password clears the count. Zero
+// maxFailures disables the limit.
+func WithVerifyPasswordLimit(maxFailures int, window time.Duration) Option {
+	return func(uc *AuthUseCase) {
+		uc.verifyAttempts = newAttemptLimiter(maxFailures, window)
+	}
+}
+
+// WithVerificationTokenTTL sets how long an email verification link stays
+// valid.
+func WithVerificationTokenTTL(ttl time.Duration) Option {
+	return func(uc *AuthUseCase) {
+		uc.verificationTTL = ttl
+	}
+}
+
+// WithVerificationResendInterval makes ResendVerification refuse a request
+// for an address within d of the previous one with
+// domain.ErrTooManyAttempts. Zero disables the limit.
+func WithVerificationResendInterval(d time.Duration) Option {
+	return func(uc *AuthUseCase) {
+		uc.resendAttempts = newAttemptLimiter(1, d)
+	}
+}
+
+// WithAccountLockout locks an account for duration once maxFailures logins
+// in a row failed on a wrong password. Logins to a locked account fail with
+// a *domain.AccountLockedError, without checking the password, until the
+// lock ends. Zero maxFailures disables locking.
+func WithAccountLockout(maxFailures int, duration time.Duration) Option {
+	return func(uc *AuthUseCase) {
+		uc.lockoutThreshold = maxFailures
+		uc.lockoutDuration = duration
+	}
+}
+
+// WithLoginBackoff slows down password guessing per email: after threshold
+// failed logins in a row, the next login is refused with a
+// *domain.TooManyAttemptsError until base has passed, and each further
+// failure doubles the wait, up to maxDelay. A successful login resets the
+// email. Unknown emails are slowed down the same way, so the backoff does not
+// reveal which accounts exist. Unlike WithAccountLockout, it keeps state in
+// memory. Zero threshold disables it.
+func WithLoginBackoff(threshold int, base, maxDelay time.Duration) Option {
+	return func(uc *AuthUseCase) {
+		uc.loginBackoff = newLoginBackoff(threshold, base, maxDelay)
+	}
+}
+
+// WithLoginIPLimit refuses logins from a client IP with a
+// *domain.TooManyAttemptsError once maxFailures logins from it failed within
+// window, whichever accounts they were for. Successful logins do not clear
+// the count, so one valid account does not let an attacker keep guessing at
+// others. Logins without a known IP are not counted. Zero maxFailures
+// disables the limit.
+func WithLoginIPLimit(maxFailures int, window time.Duration) Option {
+	return func(uc *AuthUseCase) {
+		uc.loginIPAttempts = newAttemptLimiter(maxFailures, window)
+	}
+}
+
+// WithLoginEmailLimit refuses logins to an email with a
+// *domain.TooManyAttemptsError once maxFailures logins to it failed within
+// window, from whichever IPs, so guessing spread over many addresses is still
+// capped. A successful login clears the count. It is counted independently of
+// WithLoginIPLimit. Zero maxFailures disables the limit.
+func WithLoginEmailLimit(maxFailures int, window time.Duration) Option {
+	return func(uc *AuthUseCase) {
+		uc.loginEmailAttempts = newAttemptLimiter(maxFailures, window)
+	}
+}
+
+// WithSingleSession makes each login revoke the user's existing refresh
+// tokens, so only the newest session can be refreshed. Refresh keeps that
+// session alive by rotation. It applies to opaque refresh tokens only.
+func WithSingleSession(enabled bool) Option {
+	return func(uc *AuthUseCase) {
+		uc.singleSession = enabled
+	}
+}
+
+// WithEnumerationSafeRegistration makes Register succeed for an email that
+// already has an account, mailing its owner instead of reporting the
+// conflict, so registration cannot be used to probe which emails exist.
+// ValidateRegistration then skips the availability check for the same
+// reason.
+func WithEnumerationSafeRegistration(enabled bool) Option {
+	return func(uc *AuthUseCase) {
+		uc.hideExistingEmails = enabled
+	}
+}
+
+// WithSignInOnRegister makes Register sign the new user in and return a
+// token pair. It is ignored under WithEnumerationSafeRegistration, since
+// tokens would tell a new email from a taken one.
+func WithSignInOnRegister(enabled bool) Option {
+	return func(uc *AuthUseCase) {
+		uc.signInOnRegister = enabled
+	}
+}
+
+// WithClaimsEnricher adds the claims returned by enrich to every access token,
+// step-up tokens included. A nil enrich adds nothing.
+func WithClaimsEnricher(enrich ClaimsEnricher) Option {
+	return func(uc *AuthUseCase) {
+		if enrich != nil {
+			uc.enrichClaims = enrich
+		}
+	}
+}
+
+// WithAuditLog records registrations and login attempts in log.
+func WithAuditLog(log AuditLog) Option {
+	return func(uc *AuthUseCase) {
+		uc.audit = log
+	}
+}
+
+// WithEmailDomains restricts which email domains may register. An empty
+// allowed list admits every domain that is not blocked. Domains are compared
+// case-insensitively and must match exactly; subdomains are not implied.
+func WithEmailDomains(allowed, blocked []string) Option {
+	return func(uc *AuthUseCase) {
+		uc.allowedDomains = domainSet(allowed)
+		uc.blockedDomains = domainSet(blocked)
+	}
+}
+
+// DisposableDomains recognises email domains of disposable mailbox
+// providers.
+type DisposableDomains interface {
+	IsDisposable(domain string) bool
+}
+
+// WithDisposableEmailCheck rejects registrations whose email domain d
+// reports as disposable with domain.ErrDisposableEmail.
+func WithDisposableEmailCheck(d DisposableDomains) Option {
+	return func(uc *AuthUseCase) {
+		uc.disposable = d
+	}
+}
+
+func domainSet(domains []string) map[string]bool {
+	set := make(map[string]bool, len(domains))
+	for _, d := range domains {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			set[d] = true
+		}
+	}
+	return set
+}
+
+func NewAuthUseCase(repo repository.UserRepository, tm *jwt.TokenManager, accessTTL, refreshTTL time.Duration, opts ...Option) *AuthUseCase {
+	uc := &AuthUseCase{
+		repo:                repo,
+		tokenManager:        tm,
+		accessTokenTTL:      accessTTL,
+		refreshTokenTTL:     refreshTTL,
+		registrationEnabled: true,
+		defaultRole:         domain.RoleUser,
+		refreshMode:         RefreshModeOpaque,
+		hasher:              hash.NewHasher(hash.AlgorithmBcrypt, hash.DefaultArgon2Params),
+		stepUpTTL:           DefaultStepUpTTL,
+		minPasswordLength:   DefaultMinPasswordLength,
+		maxPasswordBytes:    DefaultMaxPasswordBytes,
+		events:              noopPublisher{},
+		mailer:              noopMailer{},
+		enrichClaims:        noExtraClaims,
+		verifyAttempts:      newAttemptLimiter(DefaultVerifyPasswordMaxFailures, DefaultVerifyPasswordWindow),
+		resendAttempts:      newAttemptLimiter(1, DefaultVerificationResendInterval),
+		verificationTTL:     DefaultVerificationTokenTTL,
+		loginFailureLevel:   slog.LevelWarn,
+		clock:               clock.Real{},
+	}
+	for _, opt := range opts {
+		opt(uc)
+	}
+	if uc.verifyAttempts != nil {
+		uc.verifyAttempts.now = uc.clock.Now
+	}
+	if uc.resendAttempts != nil {
+		uc.resendAttempts.now = uc.clock.Now
+	}
+	if uc.loginBackoff != nil {
+		uc.loginBackoff.now = uc.clock.Now
+	}
+	if uc.loginIPAttempts != nil {
+		uc.loginIPAttempts.now = uc.clock.Now
+	}
+	if uc.loginEmailAttempts != nil {
+		uc.loginEmailAttempts.now = uc.clock.Now
+	}
+	if uc.versions != nil {
+		uc.versions.now = uc.clock.Now
+	}
+	return uc
+}
+
+// Register creates an account. With WithEnumerationSafeRegistration, a
+// taken email is reported as success with no user in the result. When a
+// mailer is configured, the new user is sent an email verification link
+// before Register returns. Neither a failed email nor a failed sign-in
+// fails the registration; the result just lacks them.
+func (uc *AuthUseCase) Register(ctx context.Context, username, email, password string) (domain.RegisterResult, error) {
+	email = normalizeEmail(email)
+	if !uc.registrationEnabled {
+		return domain.RegisterResult{}, domain.ErrRegistrationClosed
+	}
+	if err := uc.checkEmailDomain(email); err != nil {
+		return domain.RegisterResult{}, err
+	}
+	if err := uc.checkPasswordLength(password); err != nil {
+		return domain.RegisterResult{}, err
+	}
+
+	role, err := uc.registrationRole(ctx)
 	if err != nil {
-		return err
+		return domain.RegisterResult{}, err
+	}
+	h, err := uc.hashPassword(ctx, password)
+	if err != nil {
+		return domain.RegisterResult{}, err
 	}
 	user := &domain.User{
 		Username:     username,
 		Email:        email,
 		PasswordHash: h,
+		Role:         role,
+	}
+	if err := uc.repo.Create(ctx, user); err != nil {
+		if uc.hideExistingEmails && errors.Is(err, domain.ErrEmailExists) {
+			uc.sendMail("account_exists", email, func(ctx context.Context, m Mailer) error {
+				return m.SendAccountExists(ctx, email)
+			})
+			return domain.RegisterResult{}, nil
+		}
+		return domain.RegisterResult{}, err
 	}
-	return uc.repo.Create(ctx, user)
+
+	uc.recordAuthEvent(ctx, domain.EventUserRegistered, user.ID, user.Email, true)
+	uc.publish(ctx, domain.EventUserRegistered, user.ID, map[string]string{
+		"username": user.Username,
+		"email":    user.Email,
+	})
+
+	result := domain.RegisterResult{User: user}
+	if uc.mailEnabled() {
+		if send, err := uc.verificationMail(user); err != nil {
+			slog.Error("failed to send email", "kind", "verification", "to", user.Email, "error", err)
+		} else {
+			result.VerificationSent = uc.deliverMail(ctx, "verification", user.Email, send) == nil
+		}
+	}
+	if uc.signInOnRegister && !uc.hideExistingEmails {
+		pair, err := uc.generatePair(ctx, user, domain.ClientInfo{}, uc.clock.Now())
+		if err != nil {
+			slog.Error("failed to sign in registered user", "user_id", user.ID, "error", err)
+		} else {
+			result.Tokens = &pair
+		}
+	}
+	return result, nil
 }
 
-func (uc *AuthUseCase) Login(ctx context.Context, email, password string) (domain.TokenPair, error) {
+// ResendVerification mails a new email verification link to the account
+// registered with email. Unknown, already verified and disabled accounts get
+// nothing but are answered the same, so the result does not reveal which
+// addresses are registered. Each address may ask once per resend interval;
+// further requests fail with a *domain.TooManyAttemptsError.
+func (uc *AuthUseCase) ResendVerification(ctx context.Context, email string) error {
+	email = normalizeEmail(email)
+	if wait, ok := uc.resendAttempts.allow(email); !ok {
+		return &domain.TooManyAttemptsError{RetryAfter: wait}
+	}
+	uc.resendAttempts.fail(email)
+
 	user, err := uc.repo.GetByEmail(ctx, email)
 	if err != nil {
-		return domain.TokenPair{}, domain.ErrInvalidCredentials
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.EmailVerified() || user.Disabled() {
+		return nil
+	}
+	return uc.sendVerification(user)
+}
+
+// sendVerification mails user a link confirming their email address.
+func (uc *AuthUseCase) sendVerification(user *domain.User) error {
+	send, err := uc.verificationMail(user)
+	if err != nil {
+		return err
+	}
+	uc.sendMail("verification", user.Email, send)
+	return nil
+}
+
+// verificationMail returns a send function for a new verification link for
+// user.
+func (uc *AuthUseCase) verificationMail(user *domain.User) (func(ctx context.Context, m Mailer) error, error) {
+	token, err := uc.tokenManager.GenerateVerificationToken(user.ID, user.Email, uc.verificationTTL)
+	if err != nil {
+		return nil, fmt.Errorf("generate verification token: %w", err)
+	}
+	to := user.Email
+	return func(ctx context.Context, m Mailer) error {
+		return m.SendVerification(ctx, to, token)
+	}, nil
+}
+
+// VerifyEmail confirms the email address a verification link was sent to. A
+// link for an address the user has since changed is invalid.
+func (uc *AuthUseCase) VerifyEmail(ctx context.Context, token string) error {
+	userID, email, err := uc.tokenManager.ParseVerificationToken(token)
+	if err != nil {
+		return err
+	}
+	user, err := uc.repo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return domain.ErrInvalidToken
+		}
+		return err
+	}
+	if user.Email != email {
+		return fmt.Errorf("%w: email changed", domain.ErrInvalidToken)
+	}
+	if user.EmailVerified() {
+		return nil
+	}
+	return uc.repo.MarkEmailVerified(ctx, user.ID)
+}
+
+// registrationRole returns the role of a user registering now.
+func (uc *AuthUseCase) registrationRole(ctx context.Context) (string, error) {
+	if !uc.firstUserAdmin {
+		return uc.defaultRole, nil
+	}
+	n, err := uc.repo.CountUsers(ctx)
+	if err != nil {
+		return "", fmt.Errorf("count users: %w", err)
+	}
+	if n == 0 {
+		return domain.RoleAdmin, nil
+	}
+	return uc.defaultRole, nil
+}
+
+// ValidateRegistration runs the checks Register would, including whether the
+// email is taken, without creating the account.
+func (uc *AuthUseCase) ValidateRegistration(ctx context.Context, username, email, password string) error {
+	email = normalizeEmail(email)
+	if !uc.registrationEnabled {
+		return domain.ErrRegistrationClosed
+	}
+	if err := uc.checkEmailDomain(email); err != nil {
+		return err
+	}
+	if err := uc.checkPasswordLength(password); err != nil {
+		return err
+	}
+
+	if uc.hideExistingEmails {
+		return nil
+	}
+
+	_, err := uc.repo.GetByEmail(ctx, email)
+	switch {
+	case err == nil:
+		return domain.ErrEmailExists
+	case errors.Is(err, domain.ErrUserNotFound):
+		return nil
+	default:
+		return err
+	}
+}
+
+// normalizeEmail drops whitespace pasted around an email address. Case is
+// kept: existing accounts were stored as typed. Passwords are never
+// normalized, since whitespace in them may be intentional.
+func normalizeEmail(email string) string {
+	return strings.TrimSpace(email)
+}
+
+// checkEmailDomain applies the allow and block lists and the disposable
+// provider check to the domain of email.
+func (uc *AuthUseCase) checkEmailDomain(email string) error {
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return domain.ErrEmailDomainNotAllowed
+	}
+	d := strings.ToLower(email[at+1:])
+	if uc.blockedDomains[d] || len(uc.allowedDomains) > 0 && !uc.allowedDomains[d] {
+		return domain.ErrEmailDomainNotAllowed
+	}
+	if uc.disposable != nil && uc.disposable.IsDisposable(d) {
+		return domain.ErrDisposableEmail
+	}
+	return nil
+}
+
+// checkPasswordLength returns a *domain.PasswordLengthError unless password
+// is within the configured bounds. The minimum counts characters; the
+// maximum counts bytes, which is what the hash limits.
+func (uc *AuthUseCase) checkPasswordLength(password string) error {
+	tooShort := utf8.RuneCountInString(password) < uc.minPasswordLength
+	tooLong := uc.maxPasswordBytes > 0 && len(password) > uc.maxPasswordBytes
+	if !tooShort && !tooLong {
+		return nil
+	}
+	return &domain.PasswordLengthError{MinLength: uc.minPasswordLength, MaxBytes: uc.maxPasswordBytes, TooLong: tooLong}
+}
+
+// recordAuthEvent writes to the audit log if one is configured, attributing
+// the event to the actor in ctx, if any. It is best effort: a failure is
+// logged and does not fail the request.
+func (uc *AuthUseCase) recordAuthEvent(ctx context.Context, eventType string, userID int64, email string, success bool) {
+	if uc.audit == nil {
+		return
+	}
+	actor, _ := domain.ActorFromContext(ctx)
+	err := uc.audit.RecordAuthEvent(ctx, domain.AuthEvent{
+		UserID:  userID,
+		ActorID: actor.UserID,
+		Email:   email,
+		Type:    eventType,
+		Success: success,
+	})
+	if err != nil {
+		slog.Error("failed to record auth event", "type", eventType, "user_id", userID, "error", err)
+	}
+}
+
+// ListAuthEvents queries the audit log. Without one it returns no events.
+func (uc *AuthUseCase) ListAuthEvents(ctx context.Context, f domain.AuthEventFilter) ([]domain.AuthEvent, error) {
+	if uc.audit == nil {
+		return []domain.AuthEvent{}, nil
+	}
+	f.Limit = f.PageSize()
+	return uc.audit.ListAuthEvents(ctx, f)
+}
+
+func (uc *AuthUseCase) publish(ctx context.Context, eventType string, userID int64, data map[string]string) {
+	uc.events.Publish(ctx, domain.Event{
+		Type:       eventType,
+		UserID:     userID,
+		OccurredAt: uc.clock.Now().UTC(),
+		Data:       data,
+	})
+}
+
+// Login checks the credentials and issues a token pair for the session
+// described by client. identifier is the user's email or, under
+// WithUsernameLogin, their username. The authenticated user is returned
+// alongside so callers can render a profile without another lookup.
+func (uc *AuthUseCase) Login(ctx context.Context, identifier, password string, client domain.ClientInfo) (domain.TokenPair, *domain.User, error) {
+	return uc.login(ctx, identifier, password, client, true)
+}
+
+// LoginAccessOnly is Login for clients, typically other services, that need
+// no refresh token: it issues an access token only and opens no session, so
+// the pair's RefreshToken is empty and the login cannot be refreshed. The
+// client logs in again once the access token expires.
+func (uc *AuthUseCase) LoginAccessOnly(ctx context.Context, identifier, password string, client domain.ClientInfo) (domain.TokenPair, *domain.User, error) {
+	return uc.login(ctx, identifier, password, client, false)
+}
+
+// login implements Login and, without withRefresh, LoginAccessOnly.
+func (uc *AuthUseCase) login(ctx context.Context, identifier, password string, client domain.ClientInfo, withRefresh bool) (domain.TokenPair, *domain.User, error) {
+	identifier = normalizeEmail(identifier)
+	if identifier == "" || password == "" {
+		uc.logLoginFailure(ctx, identifier, client.IP, loginFailureMissingCredentials)
+		return domain.TokenPair{}, nil, domain.ErrInvalidCredentials
+	}
+	backoffKey := strings.ToLower(identifier)
+	if wait, ok := uc.allowLogin(backoffKey, client.IP); !ok {
+		uc.logLoginFailure(ctx, identifier, client.IP, loginFailureThrottled)
+		return domain.TokenPair{}, nil, &domain.TooManyAttemptsError{RetryAfter: wait}
+	}
+
+	user, err := uc.loginUser(ctx, identifier)
+	if err != nil {
+		reason := loginFailureUnknownUser
+		if !errors.Is(err, domain.ErrUserNotFound) {
+			reason = loginFailureLookupError
+		}
+		uc.logLoginFailure(ctx, identifier, client.IP, reason)
+		uc.recordAuthEvent(ctx, domain.EventUserLogin, 0, identifier, false)
+		uc.failLogin(backoffKey, client.IP)
+		return domain.TokenPair{}, nil, domain.ErrInvalidCredentials
+	}
+	if user.LockedAt(uc.clock.Now()) {
+		uc.logLoginFailure(ctx, identifier, client.IP, loginFailureLocked)
+		uc.recordAuthEvent(ctx, domain.EventUserLogin, user.ID, user.Email, false)
+		return domain.TokenPair{}, nil, &domain.AccountLockedError{Until: user.LockedUntil}
+	}
+
+	ok, err := uc.checkPassword(ctx, password, user.PasswordHash)
+	if err != nil {
+		return domain.TokenPair{}, nil, err
+	}
+	if !ok {
+		uc.logLoginFailure(ctx, identifier, client.IP, loginFailureBadPassword)
+		uc.recordAuthEvent(ctx, domain.EventUserLogin, user.ID, user.Email, false)
+		uc.failLogin(backoffKey, client.IP)
+		if lockedUntil := uc.recordFailedLogin(ctx, user.ID); lockedUntil.After(uc.clock.Now()) {
+			return domain.TokenPair{}, nil, &domain.AccountLockedError{Until: lockedUntil}
+		}
+		return domain.TokenPair{}, nil, domain.ErrInvalidCredentials
+	}
+	if user.Disabled() {
+		uc.logLoginFailure(ctx, identifier, client.IP, loginFailureDisabled)
+		uc.recordAuthEvent(ctx, domain.EventUserLogin, user.ID, user.Email, false)
+		return domain.TokenPair{}, nil, domain.ErrAccountDisabled
+	}
+
+	uc.loginBackoff.reset(backoffKey)
+	uc.loginEmailAttempts.reset(backoffKey)
+
+	if uc.hasher.NeedsRehash(user.PasswordHash) {
+		uc.upgradePasswordHash(ctx, user, password)
+	}
+
+	var pair domain.TokenPair
+	authTime := uc.clock.Now()
+	if withRefresh {
+		if uc.singleSession {
+			if err := uc.repo.RevokeAllRefreshTokens(ctx, user.ID); err != nil {
+				return domain.TokenPair{}, nil, fmt.Errorf("revoke previous sessions: %w", err)
+			}
+		}
+		if pair, err = uc.generatePair(ctx, user, client.Normalized(), authTime); err != nil {
+			return domain.TokenPair{}, nil, err
+		}
+	} else if pair.AccessToken, err = uc.generateAccessToken(user, 0, authTime); err != nil {
+		return domain.TokenPair{}, nil, err
+	}
+
+	if err := uc.repo.TouchLastLogin(ctx, user.ID); err != nil {
+		slog.Error("failed to record last login", "user_id", user.ID, "error", err)
+	}
+	uc.recordAuthEvent(ctx, domain.EventUserLogin, user.ID, user.Email, true)
+	uc.publish(ctx, domain.EventUserLogin, user.ID, nil)
+	return pair, user, nil
+}
+
+// Reasons a login failed, as logged by logLoginFailure.
+const (
+	loginFailureMissingCredentials = "missing_credentials"
+	loginFailureThrottled          = "throttled"
+	loginFailureUnknownUser        = "unknown_user"
+	loginFailureLookupError        = "lookup_error"
+	loginFailureLocked             = "locked"
+	loginFailureBadPassword        = "bad_password"
+	loginFailureDisabled           = "disabled"
+)
+
+// logLoginFailure logs a failed login for security monitoring. It never
+// takes the password.
+func (uc *AuthUseCase) logLoginFailure(ctx context.Context, identifier, ip, reason string) {
+	slog.Log(ctx, uc.loginFailureLevel, "login failed", "email", identifier, "ip", ip, "reason", reason)
+}
+
+// allowLogin reports whether a login to email from ip may go ahead under the
+// login backoff and the per-email and per-IP limits. If not, retryAfter is
+// the longest of the waits that apply.
+func (uc *AuthUseCase) allowLogin(email, ip string) (retryAfter time.Duration, ok bool) {
+	ok = true
+	check := func(wait time.Duration, allowed bool) {
+		if !allowed {
+			ok = false
+			retryAfter = max(retryAfter, wait)
+		}
+	}
+	check(uc.loginBackoff.allow(email))
+	check(uc.loginEmailAttempts.allow(email))
+	if ip != "" {
+		check(uc.loginIPAttempts.allow(ip))
+	}
+	return retryAfter, ok
+}
+
+// failLogin counts a failed login to email from ip against the login backoff
+// and limits.
+func (uc *AuthUseCase) failLogin(email, ip string) {
+	uc.loginBackoff.fail(email)
+	uc.loginEmailAttempts.fail(email)
+	if ip != "" {
+		uc.loginIPAttempts.fail(ip)
+	}
+}
+
+// loginUser finds the user identifier names for Login.
+func (uc *AuthUseCase) loginUser(ctx context.Context, identifier string) (*domain.User, error) {
+	if uc.usernameLogin {
+		return uc.repo.GetByEmailOrUsername(ctx, identifier)
+	}
+	return uc.repo.GetByEmail(ctx, identifier)
+}
+
+// recordFailedLogin counts a wrong password towards the account lockout and
+// returns when the account is locked until, or zero if it is not. It is best
+// effort: a failure is logged and the login fails as usual.
+func (uc *AuthUseCase) recordFailedLogin(ctx context.Context, userID int64) time.Time {
+	if uc.lockoutThreshold <= 0 {
+		return time.Time{}
+	}
+	lockedUntil, err := uc.repo.RecordFailedLogin(ctx, userID, uc.lockoutThreshold, uc.lockoutDuration)
+	if err != nil {
+		slog.Error("failed to record failed login", "user_id", userID, "error", err)
+		return time.Time{}
+	}
+	return lockedUntil
+}
+
+// ListSessions returns the user's live sessions. Only opaque refresh tokens
+// are tracked, so in JWT mode the list is always empty.
+func (uc *AuthUseCase) ListSessions(ctx context.Context, userID int64) ([]domain.Session, error) {
+	if uc.refreshMode == RefreshModeJWT {
+		return []domain.Session{}, nil
+	}
+	return uc.repo.ListSessions(ctx, userID)
+}
+
+// ExportUserData gathers the account record, live sessions and audit events
+// of userID for a data export. Audit events are only included under
+// WithAuditLog.
+func (uc *AuthUseCase) ExportUserData(ctx context.Context, userID int64) (domain.UserExport, error) {
+	user, err := uc.repo.GetByID(ctx, userID)
+	if err != nil {
+		return domain.UserExport{}, err
+	}
+	sessions, err := uc.ListSessions(ctx, userID)
+	if err != nil {
+		return domain.UserExport{}, fmt.Errorf("list sessions: %w", err)
+	}
+	events, err := uc.userAuthEvents(ctx, userID)
+	if err != nil {
+		return domain.UserExport{}, fmt.Errorf("list auth events: %w", err)
 	}
 
-	if !hash.CheckPasswordHash(password, user.PasswordHash) {
-		return domain.TokenPair{}, domain.ErrInvalidCredentials
+	return domain.UserExport{
+		User: domain.ExportedUser{
+			ID:                user.ID,
+			Username:          user.Username,
+			Email:             user.Email,
+			Role:              user.Role,
+			CreatedAt:         user.CreatedAt,
+			LastLoginAt:       optionalTime(user.LastLoginAt),
+			PasswordChangedAt: optionalTime(user.PasswordChangedAt),
+			DisabledAt:        optionalTime(user.DisabledAt),
+		},
+		Sessions:   sessions,
+		AuthEvents: events,
+		ExportedAt: uc.clock.Now().UTC(),
+	}, nil
+}
+
+// userAuthEvents returns every audit event of userID, reading the audit log
+// page by page.
+func (uc *AuthUseCase) userAuthEvents(ctx context.Context, userID int64) ([]domain.AuthEvent, error) {
+	events := []domain.AuthEvent{}
+	if uc.audit == nil {
+		return events, nil
+	}
+	f := domain.AuthEventFilter{UserID: userID, Limit: domain.MaxAuditPageSize}
+	for {
+		page, err := uc.audit.ListAuthEvents(ctx, f)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, page...)
+		if len(page) < f.Limit {
+			return events, nil
+		}
+		f.Offset += len(page)
 	}
+}
 
-	return uc.generatePair(ctx, user.ID)
+// optionalTime returns nil for the zero time and &t otherwise.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
 }
 
-func (uc *AuthUseCase) Verify(token string) (int64, error) {
-	return uc.tokenManager.ValidateToken(token)
+// Logout ends the session sessionID of userID, taken from the caller's access
+// token, by deleting its refresh token. The user's other sessions are left
+// alone. In JWT refresh mode access tokens name no session, so refreshToken,
+// the refresh token the client holds, is revoked instead; one belonging to
+// another user fails with domain.ErrSessionNotOwned. A session or refresh
+// token that is already gone or expired is not an error. The access token
+// itself stays valid until it expires.
+func (uc *AuthUseCase) Logout(ctx context.Context, userID, sessionID int64, refreshToken string) error {
+	if uc.refreshMode == RefreshModeJWT {
+		return uc.logoutJWT(ctx, userID, refreshToken)
+	}
+	if sessionID == 0 {
+		// Logins without a refresh token open no session.
+		return nil
+	}
+	err := uc.repo.DeleteSession(ctx, userID, sessionID)
+	if errors.Is(err, domain.ErrRefreshTokenNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	uc.recordAuthEvent(ctx, domain.EventUserLogout, userID, "", true)
+	return nil
 }
 
-func (uc *AuthUseCase) Refresh(ctx context.Context, refreshToken string) (domain.TokenPair, error) {
-	userID, err := uc.repo.ConsumeRefreshToken(ctx, refreshToken)
+// logoutJWT revokes the JWT refresh token of userID's session.
+func (uc *AuthUseCase) logoutJWT(ctx context.Context, userID int64, refreshToken string) error {
+	if refreshToken == "" {
+		return nil
+	}
+	claims, err := uc.tokenManager.ParseRefreshJWT(refreshToken)
+	if err != nil {
+		return nil
+	}
+	if claims.UserID != userID {
+		return domain.ErrSessionNotOwned
+	}
+	revoked, err := uc.repo.RevokeRefreshJTI(ctx, claims.ID, claims.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		uc.recordAuthEvent(ctx, domain.EventUserLogout, userID, "", true)
+	}
+	return nil
+}
+
+// RevokeSession ends session sessionID of userID, for example on a lost
+// device. It fails with domain.ErrSessionNotFound if there is no such live
+// session and with domain.ErrSessionNotOwned if it is another user's.
+func (uc *AuthUseCase) RevokeSession(ctx context.Context, userID, sessionID int64) error {
+	session, err := uc.repo.GetSession(ctx, sessionID)
+	if errors.Is(err, domain.ErrRefreshTokenNotFound) {
+		return domain.ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return domain.ErrSessionNotOwned
+	}
+
+	err = uc.repo.DeleteSession(ctx, userID, sessionID)
+	if errors.Is(err, domain.ErrRefreshTokenNotFound) {
+		return domain.ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	uc.recordAuthEvent(ctx, domain.EventUserLogout, userID, "", true)
+	return nil
+}
+
+// GetUserByEmail returns the user registered with email, or
+// domain.ErrUserNotFound.
+func (uc *AuthUseCase) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return uc.repo.GetByEmail(ctx, normalizeEmail(email))
+}
+
+// CountUsers returns how many accounts exist, disabled ones included.
+func (uc *AuthUseCase) CountUsers(ctx context.Context) (int64, error) {
+	return uc.repo.CountUsers(ctx)
+}
+
+// ListDormantUsers returns active users that have not logged in, or
+// registered if they never logged in, within inactiveFor.
+func (uc *AuthUseCase) ListDormantUsers(ctx context.Context, inactiveFor time.Duration) ([]domain.User, error) {
+	return uc.repo.ListDormantUsers(ctx, uc.clock.Now().Add(-inactiveFor))
+}
+
+// DeactivateDormantUsers disables the users ListDormantUsers would return and
+// revokes their refresh tokens. It returns how many users were disabled.
+func (uc *AuthUseCase) DeactivateDormantUsers(ctx context.Context, inactiveFor time.Duration) (int64, error) {
+	return uc.repo.DeactivateDormantUsers(ctx, uc.clock.Now().Add(-inactiveFor))
+}
+
+// MaxImportUsers caps how many users one ImportUsers call accepts.
+const MaxImportUsers = 1000
+
+// ImportUsers creates accounts migrated from another system, keeping their
+// bcrypt or Argon2id password hashes so the users can log in with their
+// existing passwords. Users without a role get domain.RoleUser. Invalid users
+// and users whose email is taken, by an existing account or earlier in the
+// batch, are reported in the result; the others are imported together.
+func (uc *AuthUseCase) ImportUsers(ctx context.Context, users []domain.User) (domain.ImportResult, error) {
+	if len(users) > MaxImportUsers {
+		return domain.ImportResult{}, &domain.APIError{
+			Code:    domain.CodeInvalidRequest,
+			Message: fmt.Sprintf("at most %d users can be imported at once", MaxImportUsers),
+		}
+	}
+
+	result := domain.ImportResult{Failed: []domain.ImportFailure{}}
+	fail := func(i int, email string, err error) {
+		apiErr := domain.ToAPIError(err)
+		result.Failed = append(result.Failed, domain.ImportFailure{Index: i, Email: email, Code: apiErr.Code, Message: apiErr.Message})
+	}
+
+	var (
+		valid   []domain.User
+		indexes []int
+		seen    = make(map[string]bool, len(users))
+	)
+	for i, u := range users {
+		u.Email = normalizeEmail(u.Email)
+		if u.Role == "" {
+			u.Role = domain.RoleUser
+		}
+		if err := validateImportUser(u); err != nil {
+			fail(i, u.Email, err)
+			continue
+		}
+		if seen[u.Email] {
+			fail(i, u.Email, domain.ErrEmailExists)
+			continue
+		}
+		seen[u.Email] = true
+		valid = append(valid, domain.User{
+			Username:     u.Username,
+			Email:        u.Email,
+			PasswordHash: u.PasswordHash,
+			Role:         u.Role,
+			CreatedAt:    u.CreatedAt,
+		})
+		indexes = append(indexes, i)
+	}
+
+	if len(valid) > 0 {
+		rowErrs, err := uc.repo.ImportUsers(ctx, valid)
+		if err != nil {
+			return domain.ImportResult{}, err
+		}
+		for j, err := range rowErrs {
+			if err != nil {
+				fail(indexes[j], valid[j].Email, err)
+				continue
+			}
+			result.Imported++
+		}
+	}
+
+	slices.SortFunc(result.Failed, func(a, b domain.ImportFailure) int { return a.Index - b.Index })
+	return result, nil
+}
+
+// validateImportUser checks the fields ImportUsers stores.
+func validateImportUser(u domain.User) error {
+	invalid := func(msg string) error {
+		return &domain.APIError{Code: domain.CodeInvalidRequest, Message: msg}
+	}
+	switch {
+	case strings.TrimSpace(u.Username) == "":
+		return invalid("username is required")
+	case utf8.RuneCountInString(u.Username) > maxUsernameLength:
+		return invalid(fmt.Sprintf("username must be at most %d characters", maxUsernameLength))
+	case !isEmailAddress(u.Email):
+		return invalid("email is not a valid address")
+	case !domain.IsValidRole(u.Role):
+		return domain.ErrInvalidRole
+	}
+	if err := hash.ValidateHash(u.PasswordHash); err != nil {
+		return invalid("password_hash must be a bcrypt or argon2id hash")
+	}
+	return nil
+}
+
+// maxUsernameLength is the width of the users.username column.
+const maxUsernameLength = 50
+
+// isEmailAddress reports whether s is a bare address such as a@example.com.
+func isEmailAddress(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s
+}
+
+// upgradePasswordHash re-hashes password with the configured algorithm. It is
+// best effort: a failure is logged and the old hash keeps working.
+func (uc *AuthUseCase) upgradePasswordHash(ctx context.Context, user *domain.User, password string) {
+	h, err := uc.hashPassword(ctx, password)
+	if err != nil {
+		slog.Error("failed to rehash password", "user_id", user.ID, "error", err)
+		return
+	}
+	if err := uc.repo.UpdatePasswordHash(ctx, user.ID, h); err != nil {
+		slog.Error("failed to store upgraded password hash", "user_id", user.ID, "error", err)
+		return
+	}
+	user.PasswordHash = h
+}
+
+// Verify validates an access token and returns its user. Under
+// WithVerifyExpiredGrace a token that expired within the grace period is
+// still accepted, with inGrace set.
+func (uc *AuthUseCase) Verify(ctx context.Context, token string) (userID int64, inGrace bool, err error) {
+	claims, err := uc.tokenManager.ParseToken(token)
+	if err != nil {
+		if uc.verifyGrace <= 0 || !errors.Is(err, domain.ErrTokenExpired) {
+			return 0, false, err
+		}
+		expired, parseErr := uc.tokenManager.ParseUnverifiedExpiry(token)
+		if parseErr != nil || expired.ExpiresAt.IsZero() || uc.clock.Now().Sub(expired.ExpiresAt) > uc.verifyGrace {
+			return 0, false, err
+		}
+		claims, inGrace = expired, true
+	}
+
+	if err := uc.checkTokenVersion(ctx, claims); err != nil {
+		return 0, false, err
+	}
+	return claims.UserID, inGrace, nil
+}
+
+// Authenticate validates an access token and returns its claims. Tokens
+// scoped to another resource by IssueResourceToken are rejected.
+func (uc *AuthUseCase) Authenticate(ctx context.Context, token string) (*jwt.Claims, error) {
+	claims, err := uc.tokenManager.ParseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Audience != "" {
+		return nil, fmt.Errorf("%w: token is scoped to %q", domain.ErrInvalidToken, claims.Audience)
+	}
+	if err := uc.checkTokenVersion(ctx, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// checkTokenVersion rejects claims issued before the user's token version
+// was last bumped. Without WithTokenVersionCheck it only checks claims
+// carrying a role above domain.RoleUser, so that a demoted admin loses their
+// rights at once; a stale token of a promoted user only grants less.
+func (uc *AuthUseCase) checkTokenVersion(ctx context.Context, claims *jwt.Claims) error {
+	if !uc.checkVersions && claims.Role == domain.RoleUser {
+		return nil
+	}
+	version, ok := uc.versions.get(claims.UserID)
+	if !ok {
+		var err error
+		version, err = uc.repo.GetTokenVersion(ctx, claims.UserID)
+		if err != nil {
+			if errors.Is(err, domain.ErrUserNotFound) {
+				return fmt.Errorf("%w: unknown user", domain.ErrInvalidToken)
+			}
+			return fmt.Errorf("%w: get token version: %w", domain.ErrServiceUnavailable, err)
+		}
+		uc.versions.put(claims.UserID, version)
+	}
+	if claims.TokenVersion != version {
+		return fmt.Errorf("%w: token version %d was revoked", domain.ErrInvalidToken, claims.TokenVersion)
+	}
+	return nil
+}
+
+// RevokeAccessTokens bumps the user's token version, which ends every access
+// token issued to them so far under WithTokenVersionCheck. Opaque refresh
+// tokens are unaffected; JWT refresh tokens stop working too.
+func (uc *AuthUseCase) RevokeAccessTokens(ctx context.Context, userID int64) error {
+	defer uc.versions.invalidate(userID)
+	_, err := uc.repo.BumpTokenVersion(ctx, userID)
+	return err
+}
+
+// RotateSigningKey makes secret, or a random secret if it is empty, the
+// signing secret of access tokens. Tokens signed with the current secret
+// stay valid until they expire. Only this instance is affected, until it
+// restarts. A secret too weak for the token manager is an invalid request.
+func (uc *AuthUseCase) RotateSigningKey(ctx context.Context, secret string) error {
+	if _, err := uc.tokenManager.RotateKey(secret); err != nil {
+		if errors.Is(err, jwt.ErrWeakSecret) {
+			return &domain.APIError{Code: domain.CodeInvalidRequest, Message: err.Error()}
+		}
+		return fmt.Errorf("%w: rotate signing key: %w", domain.ErrServiceUnavailable, err)
+	}
+	return nil
+}
+
+// VerifyPassword reports whether password is the user's current password,
+// without issuing any token. Wrong passwords count towards the
+// VerifyPassword limit; past it, the call fails with domain.ErrTooManyAttempts
+// until the window ends.
+func (uc *AuthUseCase) VerifyPassword(ctx context.Context, userID int64, password string) (bool, error) {
+	key := strconv.FormatInt(userID, 10)
+	if wait, ok := uc.verifyAttempts.allow(key); !ok {
+		return false, &domain.TooManyAttemptsError{RetryAfter: wait}
+	}
+
+	user, err := uc.repo.GetByID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if user.Disabled() {
+		return false, domain.ErrAccountDisabled
+	}
+
+	ok, err := uc.checkPassword(ctx, password, user.PasswordHash)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		uc.verifyAttempts.fail(key)
+		return false, nil
+	}
+	uc.verifyAttempts.reset(key)
+	return true, nil
+}
+
+// StepUp re-verifies the password of an already authenticated user and
+// issues a short-lived access token marked with jwt.ACRStepUp, which
+// sensitive operations require as proof of recent authentication. Wrong
+// passwords count towards the same limit as VerifyPassword's.
+func (uc *AuthUseCase) StepUp(ctx context.Context, userID int64, password string) (string, error) {
+	key := strconv.FormatInt(userID, 10)
+	if wait, ok := uc.verifyAttempts.allow(key); !ok {
+		return "", &domain.TooManyAttemptsError{RetryAfter: wait}
+	}
+
+	user, err := uc.repo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return "", domain.ErrInvalidCredentials
+		}
+		return "", err
+	}
+	if user.Disabled() {
+		return "", domain.ErrAccountDisabled
+	}
+
+	ok, err := uc.checkPassword(ctx, password, user.PasswordHash)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		uc.verifyAttempts.fail(key)
+		return "", domain.ErrInvalidCredentials
+	}
+	uc.verifyAttempts.reset(key)
+
+	claims := uc.accessClaims(user)
+	claims.ACR = jwt.ACRStepUp
+	if uc.authTimeClaim {
+		claims.AuthTime = uc.clock.Now()
+	}
+	token, err := uc.issueAccessToken(claims, uc.stepUpTTL)
+	if err != nil {
+		tokenIssueFailures.WithLabelValues(stageGenerate).Inc()
+		return "", fmt.Errorf("generate step-up token: %w", err)
+	}
+	return token, nil
+}
+
+// IssueResourceToken issues an access token whose aud claim is audience, for
+// the resource server of that name. Audiences not configured with
+// WithResourceAudiences, or whose required role the user lacks, fail with
+// domain.ErrAudienceNotAllowed.
+func (uc *AuthUseCase) IssueResourceToken(ctx context.Context, userID int64, audience string) (string, error) {
+	role, ok := uc.audiences[audience]
+	if !ok {
+		return "", domain.ErrAudienceNotAllowed
+	}
+	user, err := uc.repo.GetByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if user.Disabled() {
+		return "", domain.ErrAccountDisabled
+	}
+	if role != "" && user.Role != role {
+		return "", domain.ErrAudienceNotAllowed
+	}
+
+	claims := uc.accessClaims(user)
+	claims.Audience = audience
+	token, err := uc.issueAccessToken(claims, uc.accessTokenTTL)
+	if err != nil {
+		tokenIssueFailures.WithLabelValues(stageGenerate).Inc()
+		return "", fmt.Errorf("generate resource token: %w", err)
+	}
+	return token, nil
+}
+
+// ChangePassword replaces the user's password with newPassword. Callers are
+// expected to have re-authenticated the user, e.g. with StepUp. A password
+// outside the WithPasswordLength bounds fails with a
+// *domain.PasswordLengthError, and a change within the configured cooldown
+// of the previous one with domain.ErrPasswordChangeTooSoon.
+func (uc *AuthUseCase) ChangePassword(ctx context.Context, userID int64, newPassword string) error {
+	if err := uc.checkPasswordLength(newPassword); err != nil {
+		return err
+	}
+	user, err := uc.repo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if uc.passwordCooldown > 0 && !user.PasswordChangedAt.IsZero() &&
+		uc.clock.Now().Sub(user.PasswordChangedAt) < uc.passwordCooldown {
+		return domain.ErrPasswordChangeTooSoon
+	}
+
+	h, err := uc.hashPassword(ctx, newPassword)
+	if err != nil {
+		return err
+	}
+	// The change bumps the token version; drop the cached one even if the
+	// call failed, since it may have committed.
+	defer uc.versions.invalidate(user.ID)
+	if err := uc.repo.ChangePassword(ctx, user.ID, h); err != nil {
+		return err
+	}
+
+	uc.publish(ctx, domain.EventUserPasswordChanged, user.ID, nil)
+	return nil
+}
+
+// DeleteAccount erases the user for good, along with their sessions and
+// audit events. Access tokens already issued stay valid until they expire
+// unless WithTokenVersionCheck is on. EventUserDeleted is published so other
+// systems can erase their copies.
+func (uc *AuthUseCase) DeleteAccount(ctx context.Context, userID int64) error {
+	defer uc.versions.invalidate(userID)
+	if err := uc.repo.DeleteUser(ctx, userID); err != nil {
+		return err
+	}
+	uc.publish(ctx, domain.EventUserDeleted, userID, nil)
+	return nil
+}
+
+// UpdateRole assigns role to the user and, in the same transaction, bumps
+// their token version and revokes their refresh tokens, so the next access
+// token they obtain carries the new role. Access tokens issued with a
+// privileged role stop working at once, whatever WithTokenVersionCheck says;
+// see checkTokenVersion. The change is audited under the actor in ctx.
+func (uc *AuthUseCase) UpdateRole(ctx context.Context, userID int64, role string) error {
+	if !domain.IsValidRole(role) {
+		return domain.ErrInvalidRole
+	}
+	defer uc.versions.invalidate(userID)
+	if err := uc.repo.UpdateRole(ctx, userID, role); err != nil {
+		return err
+	}
+	uc.recordAuthEvent(ctx, domain.EventUserRoleChanged, userID, "", true)
+	return nil
+}
+
+// Refresh exchanges refreshToken for a new token pair and returns the user it
+// belongs to. For opaque tokens it records when and from client.IP the
+// session was used. If client.AccessToken is set it must have been issued to
+// the same user, expired or not; otherwise the refresh token is left
+// untouched and domain.ErrInvalidToken is returned. The pair reports whether
+// refreshToken was consumed and when the returned refresh token expires.
+func (uc *AuthUseCase) Refresh(ctx context.Context, refreshToken string, client domain.ClientInfo) (domain.TokenPair, *domain.User, error) {
+	if uc.refreshMode == RefreshModeJWT {
+		return uc.refreshJWT(ctx, refreshToken, client)
+	}
+
+	if !uc.tokenManager.IsWellFormedRefreshToken(refreshToken) {
+		return domain.TokenPair{}, nil, domain.ErrRefreshTokenNotFound
+	}
+
+	session, err := uc.repo.GetRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return domain.TokenPair{}, nil, err
+	}
+	remaining := session.ExpiresAt.Sub(uc.clock.Now())
+	if remaining <= 0 {
+		return domain.TokenPair{}, nil, domain.ErrRefreshTokenNotFound
+	}
+	if err := uc.checkAccessTokenOwner(client.AccessToken, session.UserID); err != nil {
+		return domain.TokenPair{}, nil, err
+	}
+
+	user, err := uc.repo.GetByID(ctx, session.UserID)
+	if err != nil {
+		return domain.TokenPair{}, nil, err
+	}
+	if user.Disabled() {
+		return domain.TokenPair{}, nil, domain.ErrAccountDisabled
+	}
+
+	var pair domain.TokenPair
+	if uc.rotateThreshold > 0 && remaining > uc.rotateThreshold {
+		pair, err = uc.reissueAccessToken(user, session, refreshToken)
+	} else {
+		pair, err = uc.rotatePair(ctx, user, session, refreshToken)
+	}
+	if err != nil {
+		return domain.TokenPair{}, nil, err
+	}
+	uc.touchSession(ctx, user.ID, pair.RefreshToken, client.IP)
+	return pair, user, nil
+}
+
+// touchSession records the use of refreshToken from ip and flags the session
+// when the address changed since its previous use. Failures are only logged:
+// the refresh itself already succeeded.
+func (uc *AuthUseCase) touchSession(ctx context.Context, userID int64, refreshToken, ip string) {
+	previousIP, err := uc.repo.TouchRefreshToken(ctx, refreshToken, ip)
+	if err != nil {
+		slog.Error("failed to record refresh token use", "user_id", userID, "error", err)
+		return
+	}
+	if previousIP != "" && ip != "" && previousIP != ip {
+		sessionIPChanges.Inc()
+		slog.Warn("refresh token used from a new address", "user_id", userID, "previous_ip", previousIP, "ip", ip)
+	}
+}
+
+// checkAccessTokenOwner verifies that accessToken, if given, was issued to
+// userID. Its expiry is ignored: clients typically refresh because it expired.
+// Access tokens carry no jti, so the subject is all there is to compare.
+func (uc *AuthUseCase) checkAccessTokenOwner(accessToken string, userID int64) error {
+	if accessToken == "" {
+		return nil
+	}
+	claims, err := uc.tokenManager.ParseUnverifiedExpiry(accessToken)
+	if err != nil {
+		return domain.ErrInvalidToken
+	}
+	if claims.UserID != userID {
+		slog.Warn("refresh token presented with another user's access token", "user_id", userID, "access_token_user_id", claims.UserID)
+		return domain.ErrInvalidToken
+	}
+	return nil
+}
+
+// refreshJWT consumes a JWT refresh token by adding its jti to the
+// revocation list, so a token that was already used is rejected as if it did
+// not exist.
+func (uc *AuthUseCase) refreshJWT(ctx context.Context, refreshToken string, client domain.ClientInfo) (domain.TokenPair, *domain.User, error) {
+	claims, err := uc.tokenManager.ParseRefreshJWT(refreshToken)
+	if err != nil {
+		return domain.TokenPair{}, nil, domain.ErrRefreshTokenNotFound
+	}
+	if err := uc.checkAccessTokenOwner(client.AccessToken, claims.UserID); err != nil {
+		return domain.TokenPair{}, nil, err
+	}
+
+	revoked, err := uc.repo.RevokeRefreshJTI(ctx, claims.ID, claims.ExpiresAt)
+	if err != nil {
+		return domain.TokenPair{}, nil, err
+	}
+	if !revoked {
+		return domain.TokenPair{}, nil, domain.ErrRefreshTokenNotFound
+	}
+
+	user, err := uc.repo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return domain.TokenPair{}, nil, err
+	}
+	if user.Disabled() {
+		return domain.TokenPair{}, nil, domain.ErrAccountDisabled
+	}
+	if uc.checkVersions && claims.TokenVersion != user.TokenVersion {
+		return domain.TokenPair{}, nil, domain.ErrRefreshTokenNotFound
+	}
+
+	pair, err := uc.generatePair(ctx, user, domain.ClientInfo{}, claims.AuthTime)
+	if err != nil {
+		return domain.TokenPair{}, nil, err
+	}
+	pair.Rotated = true
+	return pair, user, nil
+}
+
+// SessionExpiry returns when refreshToken expires without consuming it.
+// Unknown, revoked and expired tokens all yield domain.ErrRefreshTokenNotFound.
+func (uc *AuthUseCase) SessionExpiry(ctx context.Context, refreshToken string) (time.Time, error) {
+	var expiresAt time.Time
+	if uc.refreshMode == RefreshModeJWT {
+		claims, err := uc.tokenManager.ParseRefreshJWT(refreshToken)
+		if err != nil {
+			return time.Time{}, domain.ErrRefreshTokenNotFound
+		}
+		revoked, err := uc.repo.IsRefreshJTIRevoked(ctx, claims.ID)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if revoked {
+			return time.Time{}, domain.ErrRefreshTokenNotFound
+		}
+		expiresAt = claims.ExpiresAt
+	} else {
+		if !uc.tokenManager.IsWellFormedRefreshToken(refreshToken) {
+			return time.Time{}, domain.ErrRefreshTokenNotFound
+		}
+		session, err := uc.repo.GetRefreshToken(ctx, refreshToken)
+		if err != nil {
+			return time.Time{}, err
+		}
+		expiresAt = session.ExpiresAt
+	}
+
+	if !expiresAt.After(uc.clock.Now()) {
+		return time.Time{}, domain.ErrRefreshTokenNotFound
+	}
+	return expiresAt, nil
+}
+
+// reissueAccessToken returns a new access token for session alongside the
+// unchanged refreshToken.
+func (uc *AuthUseCase) reissueAccessToken(user *domain.User, session domain.Session, refreshToken string) (domain.TokenPair, error) {
+	accessToken, err := uc.generateAccessToken(user, session.ID, session.CreatedAt)
 	if err != nil {
 		return domain.TokenPair{}, err
 	}
 
-	return uc.generatePair(ctx, userID)
+	return domain.TokenPair{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: session.ExpiresAt,
+	}, nil
 }
 
-func (uc *AuthUseCase) generatePair(ctx context.Context, userID int64) (domain.TokenPair, error) {
-	accessToken, err := uc.tokenManager.GenerateAccessToken(userID, uc.accessTokenTTL)
+// rotatePair issues a new token pair and atomically swaps oldToken for the new
+// refresh token, so a failure cannot leave the user without either. The
+// session keeps its id and creation time.
+func (uc *AuthUseCase) rotatePair(ctx context.Context, user *domain.User, session domain.Session, oldToken string) (domain.TokenPair, error) {
+	accessToken, err := uc.generateAccessToken(user, session.ID, session.CreatedAt)
 	if err != nil {
 		return domain.TokenPair{}, err
 	}
 
 	refreshToken, err := uc.tokenManager.GenerateRefreshToken()
 	if err != nil {
+		tokenIssueFailures.WithLabelValues(stageGenerate).Inc()
+		return domain.TokenPair{}, fmt.Errorf("generate refresh token: %w", err)
+	}
+
+	expiresAt := uc.clock.Now().Add(uc.refreshTokenTTL)
+	err = uc.repo.RotateRefreshToken(ctx, oldToken, refreshToken, user.ID, expiresAt, uc.maxRefreshes)
+	if errors.Is(err, domain.ErrRefreshTokenNotFound) || errors.Is(err, domain.ErrRefreshLimitReached) ||
+		errors.Is(err, domain.ErrServiceUnavailable) {
 		return domain.TokenPair{}, err
 	}
+	// A client that gave up mid-rotation is not a server fault: it may retry
+	// with the old token, which survives unless the rotation committed.
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return domain.TokenPair{}, fmt.Errorf("%w: rotate refresh token: %w", domain.ErrServiceUnavailable, err)
+	}
+	if err != nil {
+		tokenIssueFailures.WithLabelValues(stagePersist).Inc()
+		return domain.TokenPair{}, fmt.Errorf("persist refresh token: %w", err)
+	}
+
+	return domain.TokenPair{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: expiresAt,
+		Rotated:          true,
+	}, nil
+}
+
+// accessClaims builds the claims of an access token for user.
+func (uc *AuthUseCase) accessClaims(user *domain.User) jwt.Claims {
+	return jwt.Claims{UserID: user.ID, Role: user.Role, TokenVersion: user.TokenVersion, Extra: uc.enrichClaims(user)}
+}
+
+// issueAccessToken signs claims into an access token valid for ttl, or for
+// the WithMaxAccessTTL cap if that is shorter.
+func (uc *AuthUseCase) issueAccessToken(claims jwt.Claims, ttl time.Duration) (string, error) {
+	if uc.maxAccessTTL > 0 && ttl > uc.maxAccessTTL {
+		slog.Warn("access token lifetime capped", "user_id", claims.UserID, "ttl", ttl, "max", uc.maxAccessTTL)
+		ttl = uc.maxAccessTTL
+	}
+	return uc.tokenManager.GenerateAccessToken(claims, ttl)
+}
+
+// generateAccessToken issues an access token for user in sessionID, zero if
+// the token belongs to no stored session. authTime is when the user logged
+// in, sent as auth_time under WithAuthTimeClaim.
+func (uc *AuthUseCase) generateAccessToken(user *domain.User, sessionID int64, authTime time.Time) (string, error) {
+	claims := uc.accessClaims(user)
+	claims.SessionID = sessionID
+	if uc.authTimeClaim {
+		claims.AuthTime = authTime
+	}
+	accessToken, err := uc.issueAccessToken(claims, uc.accessTokenTTL)
+	if err != nil {
+		tokenIssueFailures.WithLabelValues(stageGenerate).Inc()
+		return "", fmt.Errorf("generate access token: %w", err)
+	}
+	return accessToken, nil
+}
+
+// generatePair issues a new token pair for a login at authTime. client is
+// stored with an opaque refresh token, and the access token names the session
+// it opens; JWT refresh tokens carry no session metadata but authTime.
+func (uc *AuthUseCase) generatePair(ctx context.Context, user *domain.User, client domain.ClientInfo, authTime time.Time) (domain.TokenPair, error) {
+	if uc.refreshMode == RefreshModeJWT {
+		accessToken, err := uc.generateAccessToken(user, 0, authTime)
+		if err != nil {
+			return domain.TokenPair{}, err
+		}
+		if !uc.authTimeClaim {
+			authTime = time.Time{}
+		}
+		refreshToken, refreshClaims, err := uc.tokenManager.GenerateRefreshJWT(user.ID, user.TokenVersion, authTime, uc.refreshTokenTTL)
+		if err != nil {
+			tokenIssueFailures.WithLabelValues(stageGenerate).Inc()
+			return domain.TokenPair{}, fmt.Errorf("generate refresh token: %w", err)
+		}
+		return domain.TokenPair{
+			AccessToken:      accessToken,
+			RefreshToken:     refreshToken,
+			RefreshExpiresAt: refreshClaims.ExpiresAt,
+		}, nil
+	}
+
+	refreshToken, err := uc.tokenManager.GenerateRefreshToken()
+	if err != nil {
+		tokenIssueFailures.WithLabelValues(stageGenerate).Inc()
+		return domain.TokenPair{}, fmt.Errorf("generate refresh token: %w", err)
+	}
+
+	expiresAt := uc.clock.Now().Add(uc.refreshTokenTTL)
+	sessionID, err := uc.repo.SaveRefreshToken(ctx, user.ID, refreshToken, expiresAt, client)
+	if err != nil {
+		tokenIssueFailures.WithLabelValues(stagePersist).Inc()
+		return domain.TokenPair{}, fmt.Errorf("persist refresh token: %w", err)
+	}
 
-	expiresAt := time.Now().Add(uc.refreshTokenTTL)
-	err = uc.repo.SaveRefreshToken(ctx, userID, refreshToken, expiresAt)
+	accessToken, err := uc.generateAccessToken(user, sessionID, authTime)
 	if err != nil {
 		return domain.TokenPair{}, err
 	}
 
 	return domain.TokenPair{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: expiresAt,
 	}, nil
 }
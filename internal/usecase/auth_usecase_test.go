@@ -1,47 +1,46 @@
 package usecase
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/Kovalyovv/auth-service/internal/pkg/clock"
 	"github.com/Kovalyovv/auth-service/internal/pkg/hash"
 	"github.com/Kovalyovv/auth-service/internal/pkg/jwt"
+	"github.com/Kovalyovv/auth-service/internal/repository/mocks"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
-type MockUserRepository struct {
-	mock.Mock
+func newTokenManager(t *testing.T, secret string, opts ...jwt.Option) *jwt.TokenManager {
+	t.Helper()
+	tm, err := jwt.NewTokenManager(secret, opts...)
+	require.NoError(t, err)
+	return tm
 }
 
-func (m *MockUserRepository) Create(ctx context.Context, user *domain.User) error {
-	args := m.Called(ctx, user)
-	return args.Error(0)
-}
-
-func (m *MockUserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
-	args := m.Called(ctx, email)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
+func newRefreshToken(t *testing.T, tm *jwt.TokenManager) string {
+	t.Helper()
+	token, err := tm.GenerateRefreshToken()
+	if err != nil {
+		t.Fatalf("generate refresh token: %v", err)
 	}
-	return args.Get(0).(*domain.User), args.Error(1)
-}
-
-func (m *MockUserRepository) SaveRefreshToken(ctx context.Context, userID int64, token string, expiresAt time.Time) error {
-	args := m.Called(ctx, userID, token, expiresAt)
-	return args.Error(0)
-}
-
-func (m *MockUserRepository) ConsumeRefreshToken(ctx context.Context, token string) (int64, error) {
-	args := m.Called(ctx, token)
-	return int64(args.Int(0)), args.Error(1)
+	return token
 }
 
 func TestAuthUseCase_Login(t *testing.T) {
-	mockRepo := new(MockUserRepository)
-	tokenManager := jwt.NewTokenManager("secret")
+	mockRepo := new(mocks.UserRepository)
+	tokenManager := newTokenManager(t, "secret")
 	uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour)
 	password := "password123"
 	hashedPassword, _ := hash.HashPassword(password)
@@ -55,13 +54,18 @@ func TestAuthUseCase_Login(t *testing.T) {
 		}
 
 		mockRepo.On("GetByEmail", ctx, user.Email).Return(user, nil).Once()
-		mockRepo.On("SaveRefreshToken", ctx, user.ID, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(nil).Once()
+		mockRepo.On("SaveRefreshToken", ctx, user.ID, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time"), domain.ClientInfo{}).Return(int64(5), nil).Once()
+		mockRepo.On("TouchLastLogin", ctx, user.ID).Return(nil).Once()
 
-		pair, err := uc.Login(ctx, user.Email, password)
+		pair, gotUser, err := uc.Login(ctx, user.Email, password, domain.ClientInfo{})
 
 		assert.NoError(t, err)
 		assert.NotEmpty(t, pair.AccessToken)
 		assert.NotEmpty(t, pair.RefreshToken)
+		assert.Equal(t, user, gotUser)
+		claims, err := uc.Authenticate(ctx, pair.AccessToken)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(5), claims.SessionID)
 		mockRepo.AssertExpectations(t)
 	})
 
@@ -70,12 +74,27 @@ func TestAuthUseCase_Login(t *testing.T) {
 		email := "notfound@example.com"
 		mockRepo.On("GetByEmail", ctx, email).Return(nil, domain.ErrUserNotFound).Once()
 
-		_, err := uc.Login(ctx, email, password)
+		_, _, err := uc.Login(ctx, email, password, domain.ClientInfo{})
 
 		assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
 		mockRepo.AssertExpectations(t)
 	})
 
+	for name, creds := range map[string][2]string{
+		"Given an empty email":    {"  ", password},
+		"Given an empty password": {"test@example.com", ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			repo := new(mocks.UserRepository)
+			uc := NewAuthUseCase(repo, tokenManager, 15*time.Minute, 7*24*time.Hour)
+
+			_, _, err := uc.Login(context.Background(), creds[0], creds[1], domain.ClientInfo{})
+
+			assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+			repo.AssertNotCalled(t, "GetByEmail", mock.Anything, mock.Anything)
+		})
+	}
+
 	t.Run("Given incorrect password", func(t *testing.T) {
 		ctx := context.Background()
 		user := &domain.User{
@@ -85,27 +104,249 @@ func TestAuthUseCase_Login(t *testing.T) {
 		}
 		mockRepo.On("GetByEmail", ctx, user.Email).Return(user, nil).Once()
 
-		_, err := uc.Login(ctx, user.Email, "wrongpassword")
+		_, _, err := uc.Login(ctx, user.Email, "wrongpassword", domain.ClientInfo{})
+
+		assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given a disabled account", func(t *testing.T) {
+		ctx := context.Background()
+		user := &domain.User{
+			ID:           1,
+			Email:        "test@example.com",
+			PasswordHash: hashedPassword,
+			DisabledAt:   time.Now().Add(-time.Hour),
+		}
+		mockRepo.On("GetByEmail", ctx, user.Email).Return(user, nil).Once()
+
+		_, _, err := uc.Login(ctx, user.Email, password, domain.ClientInfo{})
+
+		assert.ErrorIs(t, err, domain.ErrAccountDisabled)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestAuthUseCase_Login_AccountLockout(t *testing.T) {
+	tokenManager := newTokenManager(t, "secret")
+	passwordHash, err := hash.HashPassword("password123")
+	assert.NoError(t, err)
+
+	t.Run("Given the failure that reaches the threshold", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, time.Hour, WithAccountLockout(5, 10*time.Minute))
+		user := &domain.User{ID: 1, Email: "test@test.com", PasswordHash: passwordHash, Role: domain.RoleUser}
+		lockedUntil := time.Now().Add(10 * time.Minute)
+
+		mockRepo.On("GetByEmail", ctx, user.Email).Return(user, nil).Once()
+		mockRepo.On("RecordFailedLogin", ctx, user.ID, 5, 10*time.Minute).Return(lockedUntil, nil).Once()
+
+		_, _, err := uc.Login(ctx, user.Email, "wrong", domain.ClientInfo{})
+
+		var locked *domain.AccountLockedError
+		assert.ErrorAs(t, err, &locked)
+		assert.Equal(t, lockedUntil, locked.Until)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given a failure below the threshold", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, time.Hour, WithAccountLockout(5, 10*time.Minute))
+		user := &domain.User{ID: 1, Email: "test@test.com", PasswordHash: passwordHash, Role: domain.RoleUser}
+
+		mockRepo.On("GetByEmail", ctx, user.Email).Return(user, nil).Once()
+		mockRepo.On("RecordFailedLogin", ctx, user.ID, 5, 10*time.Minute).Return(time.Time{}, nil).Once()
+
+		_, _, err := uc.Login(ctx, user.Email, "wrong", domain.ClientInfo{})
+
+		assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given a locked account and the right password", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, time.Hour, WithAccountLockout(5, 10*time.Minute))
+		user := &domain.User{ID: 1, Email: "test@test.com", PasswordHash: passwordHash, Role: domain.RoleUser, LockedUntil: time.Now().Add(time.Minute)}
+
+		mockRepo.On("GetByEmail", ctx, user.Email).Return(user, nil).Once()
+
+		_, _, err := uc.Login(ctx, user.Email, "password123", domain.ClientInfo{})
+
+		assert.ErrorIs(t, err, domain.ErrAccountLocked)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given lockout is disabled", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, time.Hour)
+		user := &domain.User{ID: 1, Email: "test@test.com", PasswordHash: passwordHash, Role: domain.RoleUser}
+
+		mockRepo.On("GetByEmail", ctx, user.Email).Return(user, nil).Once()
+
+		_, _, err := uc.Login(ctx, user.Email, "wrong", domain.ClientInfo{})
+
+		assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+		mockRepo.AssertNotCalled(t, "RecordFailedLogin", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthUseCase_Login_Backoff(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.UserRepository)
+	uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, time.Hour, WithLoginBackoff(3, time.Minute, time.Hour))
 
+	mockRepo.On("GetByEmail", ctx, "ghost@test.com").Return(nil, domain.ErrUserNotFound).Times(3)
+
+	for i := 0; i < 3; i++ {
+		_, _, err := uc.Login(ctx, "ghost@test.com", "guess", domain.ClientInfo{})
+		assert.ErrorIs(t, err, domain.ErrInvalidCredentials, "attempt %d", i+1)
+	}
+	_, _, err := uc.Login(ctx, "Ghost@test.com", "guess", domain.ClientInfo{})
+
+	var tooMany *domain.TooManyAttemptsError
+	assert.ErrorAs(t, err, &tooMany)
+	assert.InDelta(t, time.Minute.Seconds(), tooMany.RetryAfter.Seconds(), 1)
+	assert.Equal(t, 60, domain.ToAPIError(err).RetryAfter)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestAuthUseCase_LoginAccessOnly(t *testing.T) {
+	passwordHash, err := hash.HashPassword("password123")
+	require.NoError(t, err)
+
+	for name, mode := range map[string]string{"Given opaque refresh tokens": RefreshModeOpaque, "Given JWT refresh tokens": RefreshModeJWT} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			mockRepo := new(mocks.UserRepository)
+			tm := newTokenManager(t, "secret")
+			uc := NewAuthUseCase(mockRepo, tm, 15*time.Minute, time.Hour, WithRefreshTokenMode(mode), WithSingleSession(true))
+			user := &domain.User{ID: 1, Email: "svc@test.com", PasswordHash: passwordHash, Role: domain.RoleUser}
+			mockRepo.On("GetByEmail", ctx, "svc@test.com").Return(user, nil).Once()
+			mockRepo.On("TouchLastLogin", ctx, int64(1)).Return(nil).Once()
+
+			pair, got, err := uc.LoginAccessOnly(ctx, "svc@test.com", "password123", domain.ClientInfo{IP: "192.0.2.1"})
+
+			require.NoError(t, err)
+			assert.Equal(t, user, got)
+			assert.Empty(t, pair.RefreshToken)
+			claims, err := tm.ParseToken(pair.AccessToken)
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), claims.UserID)
+			assert.Zero(t, claims.SessionID, "no session is opened")
+			mockRepo.AssertNotCalled(t, "SaveRefreshToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			mockRepo.AssertNotCalled(t, "RevokeAllRefreshTokens", mock.Anything, mock.Anything)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+
+	t.Run("Given a wrong password", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, time.Hour)
+		mockRepo.On("GetByEmail", ctx, "svc@test.com").Return(&domain.User{ID: 1, PasswordHash: passwordHash, Role: domain.RoleUser}, nil).Once()
+
+		_, _, err := uc.LoginAccessOnly(ctx, "svc@test.com", "wrong", domain.ClientInfo{})
+
+		assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+		mockRepo.AssertNotCalled(t, "SaveRefreshToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthUseCase_Login_IPAndEmailLimits(t *testing.T) {
+	t.Run("Given failures from one IP against several accounts", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, time.Hour,
+			WithLoginIPLimit(2, time.Minute), WithLoginEmailLimit(5, time.Minute))
+		attacker := domain.ClientInfo{IP: "203.0.113.9"}
+		mockRepo.On("GetByEmail", ctx, mock.Anything).Return(nil, domain.ErrUserNotFound).Times(2)
+
+		_, _, err := uc.Login(ctx, "a@test.com", "guess", attacker)
+		assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+		_, _, err = uc.Login(ctx, "b@test.com", "guess", attacker)
 		assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+		_, _, err = uc.Login(ctx, "c@test.com", "guess", attacker)
+
+		var tooMany *domain.TooManyAttemptsError
+		require.ErrorAs(t, err, &tooMany)
+		assert.InDelta(t, time.Minute.Seconds(), tooMany.RetryAfter.Seconds(), 1)
+		mockRepo.AssertExpectations(t)
+
+		mockRepo.On("GetByEmail", ctx, "c@test.com").Return(nil, domain.ErrUserNotFound).Once()
+		_, _, err = uc.Login(ctx, "c@test.com", "guess", domain.ClientInfo{IP: "198.51.100.1"})
+		assert.ErrorIs(t, err, domain.ErrInvalidCredentials, "other IPs are not limited")
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given failures against one account from rotating IPs", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, time.Hour,
+			WithLoginIPLimit(5, time.Minute), WithLoginEmailLimit(2, time.Minute))
+		mockRepo.On("GetByEmail", ctx, "victim@test.com").Return(nil, domain.ErrUserNotFound).Times(2)
+
+		for i := 1; i <= 2; i++ {
+			_, _, err := uc.Login(ctx, "victim@test.com", "guess", domain.ClientInfo{IP: fmt.Sprintf("203.0.113.%d", i)})
+			assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+		}
+		_, _, err := uc.Login(ctx, "Victim@test.com", "guess", domain.ClientInfo{IP: "203.0.113.3"})
+
+		var tooMany *domain.TooManyAttemptsError
+		assert.ErrorAs(t, err, &tooMany)
+		mockRepo.AssertExpectations(t)
+
+		mockRepo.On("GetByEmail", ctx, "other@test.com").Return(nil, domain.ErrUserNotFound).Once()
+		_, _, err = uc.Login(ctx, "other@test.com", "guess", domain.ClientInfo{IP: "203.0.113.3"})
+		assert.ErrorIs(t, err, domain.ErrInvalidCredentials, "other accounts are not limited")
 		mockRepo.AssertExpectations(t)
 	})
+
+	t.Run("Given a successful login", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, time.Hour,
+			WithRefreshTokenMode(RefreshModeJWT), WithLoginIPLimit(2, time.Minute), WithLoginEmailLimit(2, time.Minute))
+		passwordHash, err := hash.HashPassword("password123")
+		require.NoError(t, err)
+		user := &domain.User{ID: 1, Email: "alice@test.com", PasswordHash: passwordHash, Role: domain.RoleUser}
+		client := domain.ClientInfo{IP: "203.0.113.9"}
+		mockRepo.On("GetByEmail", ctx, "alice@test.com").Return(user, nil)
+		mockRepo.On("TouchLastLogin", ctx, int64(1)).Return(nil)
+
+		_, _, err = uc.Login(ctx, "alice@test.com", "wrong", client)
+		assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+		_, _, err = uc.Login(ctx, "alice@test.com", "password123", client)
+		require.NoError(t, err)
+		_, _, err = uc.Login(ctx, "alice@test.com", "wrong", client)
+		assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+
+		_, _, err = uc.Login(ctx, "alice@test.com", "password123", client)
+
+		var tooMany *domain.TooManyAttemptsError
+		assert.ErrorAs(t, err, &tooMany, "success clears the email count but not the IP count")
+	})
 }
 
 func TestAuthUseCase_Refresh(t *testing.T) {
-	mockRepo := new(MockUserRepository)
-	tokenManager := jwt.NewTokenManager("secret")
+	mockRepo := new(mocks.UserRepository)
+	tokenManager := newTokenManager(t, "secret")
 	uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour)
 
 	t.Run("Given valid refresh token", func(t *testing.T) {
 		ctx := context.Background()
-		refreshToken := "valid-token"
+		refreshToken := newRefreshToken(t, tokenManager)
 		userID := int64(1)
 
-		mockRepo.On("ConsumeRefreshToken", ctx, refreshToken).Return(int(userID), nil).Once()
-		mockRepo.On("SaveRefreshToken", ctx, userID, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(nil).Once()
+		mockRepo.On("GetRefreshToken", ctx, refreshToken).Return(domain.Session{ID: 1, UserID: userID, ExpiresAt: time.Now().Add(time.Hour)}, nil).Once()
+		mockRepo.On("GetByID", ctx, userID).Return(&domain.User{ID: userID, Role: domain.RoleUser}, nil).Once()
+		mockRepo.On("RotateRefreshToken", ctx, refreshToken, mock.AnythingOfType("string"), userID, mock.AnythingOfType("time.Time"), 0).Return(nil).Once()
+		mockRepo.On("TouchRefreshToken", ctx, mock.AnythingOfType("string"), "192.0.2.1").Return("", nil).Once()
 
-		pair, err := uc.Refresh(ctx, refreshToken)
+		pair, _, err := uc.Refresh(ctx, refreshToken, domain.ClientInfo{IP: "192.0.2.1"})
 
 		assert.NoError(t, err)
 		assert.NotEmpty(t, pair.AccessToken)
@@ -113,15 +354,2412 @@ func TestAuthUseCase_Refresh(t *testing.T) {
 		mockRepo.AssertExpectations(t)
 	})
 
+	t.Run("Given the token is rotated concurrently", func(t *testing.T) {
+		ctx := context.Background()
+		refreshToken := newRefreshToken(t, tokenManager)
+		userID := int64(1)
+
+		mockRepo.On("GetRefreshToken", ctx, refreshToken).Return(domain.Session{ID: 1, UserID: userID, ExpiresAt: time.Now().Add(time.Hour)}, nil).Once()
+		mockRepo.On("GetByID", ctx, userID).Return(&domain.User{ID: userID, Role: domain.RoleUser}, nil).Once()
+		mockRepo.On("RotateRefreshToken", ctx, refreshToken, mock.AnythingOfType("string"), userID, mock.AnythingOfType("time.Time"), 0).Return(domain.ErrRefreshTokenNotFound).Once()
+
+		_, _, err := uc.Refresh(ctx, refreshToken, domain.ClientInfo{})
+
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given the user was disabled", func(t *testing.T) {
+		ctx := context.Background()
+		refreshToken := newRefreshToken(t, tokenManager)
+		userID := int64(1)
+
+		mockRepo.On("GetRefreshToken", ctx, refreshToken).Return(domain.Session{ID: 1, UserID: userID, ExpiresAt: time.Now().Add(time.Hour)}, nil).Once()
+		mockRepo.On("GetByID", ctx, userID).Return(&domain.User{ID: userID, Role: domain.RoleUser, DisabledAt: time.Now()}, nil).Once()
+
+		_, _, err := uc.Refresh(ctx, refreshToken, domain.ClientInfo{})
+
+		assert.ErrorIs(t, err, domain.ErrAccountDisabled)
+		mockRepo.AssertExpectations(t)
+	})
+
 	t.Run("Given invalid refresh token", func(t *testing.T) {
 		ctx := context.Background()
-		refreshToken := "invalid-token"
+		refreshToken := newRefreshToken(t, tokenManager)
 
-		mockRepo.On("ConsumeRefreshToken", ctx, refreshToken).Return(0, domain.ErrRefreshTokenNotFound).Once()
+		mockRepo.On("GetRefreshToken", ctx, refreshToken).Return(domain.Session{}, domain.ErrRefreshTokenNotFound).Once()
 
-		_, err := uc.Refresh(ctx, refreshToken)
+		_, _, err := uc.Refresh(ctx, refreshToken, domain.ClientInfo{})
 
 		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
 		mockRepo.AssertExpectations(t)
 	})
 }
+
+func TestAuthUseCase_Register(t *testing.T) {
+	t.Run("Given registration is disabled", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour,
+			WithRegistrationEnabled(false),
+		)
+
+		_, err := uc.Register(context.Background(), "test", "test@example.com", "password123")
+
+		assert.ErrorIs(t, err, domain.ErrRegistrationClosed)
+		mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Given a taken email", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+		mockRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.User")).Return(domain.ErrEmailExists).Once()
+
+		_, err := uc.Register(context.Background(), "test", "test@example.com", "password123")
+
+		assert.ErrorIs(t, err, domain.ErrEmailExists)
+	})
+
+	t.Run("Given a taken email in enumeration-safe mode", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		mailer := newStubMailer(nil)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour,
+			WithEnumerationSafeRegistration(true),
+			WithMailer(mailer),
+		)
+		mockRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.User")).Return(domain.ErrEmailExists).Once()
+
+		result, err := uc.Register(context.Background(), "test", "test@example.com", "password123")
+
+		assert.NoError(t, err)
+		assert.Equal(t, domain.RegisterResult{}, result)
+		assert.Equal(t, sentMail{kind: "account_exists", to: "test@example.com"}, mailer.wait(t))
+	})
+
+	t.Run("Given a mailer", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		mailer := newStubMailer(nil)
+		tm := newTokenManager(t, "secret")
+		uc := NewAuthUseCase(mockRepo, tm, 15*time.Minute, 7*24*time.Hour, WithMailer(mailer))
+		mockRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.User")).Run(func(args mock.Arguments) {
+			args.Get(1).(*domain.User).ID = 7
+		}).Return(nil).Once()
+
+		result, err := uc.Register(context.Background(), "test", "test@example.com", "password123")
+
+		assert.NoError(t, err)
+		assert.True(t, result.VerificationSent)
+		assert.Nil(t, result.Tokens)
+		sent := mailer.wait(t)
+		assert.Equal(t, "verification", sent.kind)
+		userID, email, err := tm.ParseVerificationToken(sent.token)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), userID)
+		assert.Equal(t, "test@example.com", email)
+	})
+
+	t.Run("Given the mailer fails", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		mailer := newStubMailer(errors.New("smtp down"))
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour, WithMailer(mailer))
+		mockRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.User")).Return(nil).Once()
+
+		result, err := uc.Register(context.Background(), "test", "test@example.com", "password123")
+
+		assert.NoError(t, err, "a failed email must not fail the registration")
+		assert.NotNil(t, result.User)
+		assert.False(t, result.VerificationSent)
+	})
+
+	t.Run("Given sign-in on register", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		tm := newTokenManager(t, "secret")
+		uc := NewAuthUseCase(mockRepo, tm, 15*time.Minute, 7*24*time.Hour, WithSignInOnRegister(true))
+		mockRepo.On("Create", ctx, mock.AnythingOfType("*domain.User")).Run(func(args mock.Arguments) {
+			args.Get(1).(*domain.User).ID = 7
+		}).Return(nil).Once()
+		mockRepo.On("SaveRefreshToken", ctx, int64(7), mock.AnythingOfType("string"), mock.AnythingOfType("time.Time"), domain.ClientInfo{}).Return(int64(3), nil).Once()
+
+		result, err := uc.Register(ctx, "test", "test@example.com", "password123")
+
+		assert.NoError(t, err)
+		assert.False(t, result.VerificationSent)
+		if assert.NotNil(t, result.Tokens) {
+			claims, err := tm.ParseToken(result.Tokens.AccessToken)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(7), claims.UserID)
+			assert.NotEmpty(t, result.Tokens.RefreshToken)
+		}
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given sign-in on register in enumeration-safe mode", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour,
+			WithSignInOnRegister(true),
+			WithEnumerationSafeRegistration(true),
+		)
+		mockRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.User")).Return(nil).Once()
+
+		result, err := uc.Register(context.Background(), "test", "test@example.com", "password123")
+
+		assert.NoError(t, err)
+		assert.Nil(t, result.Tokens, "tokens would reveal that the email was new")
+		mockRepo.AssertNotCalled(t, "SaveRefreshToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthUseCase_Register_EmailDomains(t *testing.T) {
+	tests := map[string]struct {
+		allowed, blocked []string
+		email            string
+		wantErr          error
+	}{
+		"Given a domain on the allowlist": {
+			allowed: []string{"corp.example"},
+			email:   "alice@Corp.Example",
+		},
+		"Given a domain not on the allowlist": {
+			allowed: []string{"corp.example"},
+			email:   "alice@gmail.com",
+			wantErr: domain.ErrEmailDomainNotAllowed,
+		},
+		"Given a blocked domain and no allowlist": {
+			blocked: []string{"mailinator.com"},
+			email:   "alice@mailinator.com",
+			wantErr: domain.ErrEmailDomainNotAllowed,
+		},
+		"Given an unlisted domain and no allowlist": {
+			blocked: []string{"mailinator.com"},
+			email:   "alice@gmail.com",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			mockRepo := new(mocks.UserRepository)
+			uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour,
+				WithEmailDomains(tt.allowed, tt.blocked),
+			)
+			if tt.wantErr == nil {
+				mockRepo.On("Create", ctx, mock.AnythingOfType("*domain.User")).Return(nil).Once()
+			}
+
+			_, err := uc.Register(ctx, "alice", tt.email, "password123")
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+				return
+			}
+			assert.NoError(t, err)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+// stubDisposable reports the domains in it as disposable.
+type stubDisposable map[string]bool
+
+func (s stubDisposable) IsDisposable(domain string) bool { return s[domain] }
+
+func TestAuthUseCase_Register_DisposableEmail(t *testing.T) {
+	disposable := stubDisposable{"mailinator.com": true}
+
+	t.Run("Given a disposable domain", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour, WithDisposableEmailCheck(disposable))
+
+		_, err := uc.Register(ctx, "alice", "alice@Mailinator.com", "password123")
+		validateErr := uc.ValidateRegistration(ctx, "alice", "alice@mailinator.com", "password123")
+
+		assert.ErrorIs(t, err, domain.ErrDisposableEmail)
+		assert.ErrorIs(t, validateErr, domain.ErrDisposableEmail)
+		assert.Equal(t, domain.CodeDisposableEmail, domain.ToAPIError(err).Code)
+		mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Given a legitimate domain", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour, WithDisposableEmailCheck(disposable))
+		mockRepo.On("Create", ctx, mock.AnythingOfType("*domain.User")).Return(nil).Once()
+
+		_, err := uc.Register(ctx, "alice", "alice@example.com", "password123")
+
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestAuthUseCase_Login_Whitespace(t *testing.T) {
+	ctx := context.Background()
+	password := " pass word "
+	hashed, err := hash.HashPassword(password)
+	assert.NoError(t, err)
+	user := &domain.User{ID: 1, Email: "test@example.com", PasswordHash: hashed, Role: domain.RoleUser}
+
+	t.Run("Given an email with surrounding whitespace", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+		mockRepo.On("GetByEmail", ctx, "test@example.com").Return(user, nil).Once()
+		mockRepo.On("SaveRefreshToken", ctx, user.ID, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time"), domain.ClientInfo{}).Return(int64(1), nil).Once()
+		mockRepo.On("TouchLastLogin", ctx, user.ID).Return(nil).Once()
+
+		_, _, err := uc.Login(ctx, " \ttest@example.com\n", password, domain.ClientInfo{})
+
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+
+	// Whitespace in passwords may be intentional, so it is compared as is.
+	t.Run("Given a password with its whitespace trimmed", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+		mockRepo.On("GetByEmail", ctx, user.Email).Return(user, nil).Once()
+
+		_, _, err := uc.Login(ctx, user.Email, strings.TrimSpace(password), domain.ClientInfo{})
+
+		assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+	})
+}
+
+func TestAuthUseCase_Register_Role(t *testing.T) {
+	tests := map[string]struct {
+		opts     []Option
+		users    int64
+		wantRole string
+	}{
+		"Given the defaults":                               {wantRole: domain.RoleUser},
+		"Given a default role":                             {opts: []Option{WithDefaultRole(domain.RoleAdmin)}, wantRole: domain.RoleAdmin},
+		"Given first-user-admin and no users yet":          {opts: []Option{WithFirstUserAdmin(true)}, users: 0, wantRole: domain.RoleAdmin},
+		"Given first-user-admin and existing users":        {opts: []Option{WithFirstUserAdmin(true)}, users: 3, wantRole: domain.RoleUser},
+		"Given first-user-admin, a default role and users": {opts: []Option{WithFirstUserAdmin(true), WithDefaultRole(domain.RoleAdmin)}, users: 3, wantRole: domain.RoleAdmin},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			mockRepo := new(mocks.UserRepository)
+			uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour, tt.opts...)
+			if uc.firstUserAdmin {
+				mockRepo.On("CountUsers", ctx).Return(tt.users, nil).Once()
+			}
+			var created *domain.User
+			mockRepo.On("Create", ctx, mock.AnythingOfType("*domain.User")).Run(func(args mock.Arguments) {
+				created = args.Get(1).(*domain.User)
+			}).Return(nil).Once()
+
+			_, err := uc.Register(ctx, "test", "test@example.com", "password123")
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantRole, created.Role)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+
+	t.Run("Given first-user-admin and a failing count", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour, WithFirstUserAdmin(true))
+		mockRepo.On("CountUsers", ctx).Return(int64(0), errors.New("db down")).Once()
+
+		_, err := uc.Register(ctx, "test", "test@example.com", "password123")
+
+		assert.Error(t, err)
+		mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthUseCase_PasswordLength(t *testing.T) {
+	tests := map[string]struct {
+		password string
+		opts     []Option
+		wantErr  error
+	}{
+		"Given a password of the minimum length":    {password: "12345678"},
+		"Given a password one below the minimum":    {password: "1234567", wantErr: domain.ErrPasswordTooShort},
+		"Given multibyte characters at the minimum": {password: "пароль12"},
+		"Given a password of exactly 72 bytes":      {password: strings.Repeat("a", 72)},
+		"Given a password of 73 bytes":              {password: strings.Repeat("a", 73), wantErr: domain.ErrPasswordTooLong},
+		"Given a password below a configured minimum": {
+			password: "123456789", opts: []Option{WithPasswordLength(12, 64)}, wantErr: domain.ErrPasswordTooShort,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			mockRepo := new(mocks.UserRepository)
+			uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour, tt.opts...)
+			if tt.wantErr == nil {
+				mockRepo.On("Create", ctx, mock.MatchedBy(func(u *domain.User) bool {
+					return hash.CheckPasswordHash(tt.password, u.PasswordHash)
+				})).Return(nil).Once()
+			}
+
+			_, err := uc.Register(ctx, "test", "test@example.com", tt.password)
+
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr == nil {
+				mockRepo.AssertExpectations(t)
+			} else {
+				mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+			}
+		})
+	}
+
+	t.Run("Given a too long new password", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+
+		err := uc.ChangePassword(context.Background(), 1, strings.Repeat("a", 73))
+
+		var lengthErr *domain.PasswordLengthError
+		assert.ErrorAs(t, err, &lengthErr)
+		assert.Equal(t, domain.PasswordLengthError{MinLength: 8, MaxBytes: 72, TooLong: true}, *lengthErr)
+		mockRepo.AssertNotCalled(t, "GetByID", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Given a too short password at a dry run", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+
+		err := uc.ValidateRegistration(context.Background(), "test", "test@example.com", "short")
+
+		assert.ErrorIs(t, err, domain.ErrPasswordTooShort)
+		mockRepo.AssertNotCalled(t, "GetByEmail", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthUseCase_Register_Whitespace(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.UserRepository)
+	uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour,
+		WithEmailDomains([]string{"example.com"}, nil),
+	)
+	var created *domain.User
+	mockRepo.On("Create", ctx, mock.AnythingOfType("*domain.User")).Run(func(args mock.Arguments) {
+		created = args.Get(1).(*domain.User)
+	}).Return(nil).Once()
+
+	result, err := uc.Register(ctx, "test", "  test@example.com ", " pass word ")
+
+	assert.NoError(t, err)
+	assert.Same(t, created, result.User)
+	assert.False(t, result.VerificationSent)
+	assert.Nil(t, result.Tokens)
+	assert.Equal(t, "test@example.com", created.Email)
+	assert.True(t, hash.CheckPasswordHash(" pass word ", created.PasswordHash), "the password must keep its whitespace")
+	assert.False(t, hash.CheckPasswordHash("pass word", created.PasswordHash))
+}
+
+func TestAuthUseCase_Login_Username(t *testing.T) {
+	ctx := context.Background()
+	password := "password123"
+	hashed, err := hash.HashPassword(password)
+	assert.NoError(t, err)
+	user := &domain.User{ID: 1, Username: "alice", Email: "alice@example.com", PasswordHash: hashed, Role: domain.RoleUser}
+
+	for name, identifier := range map[string]string{
+		"Given a username": " alice ",
+		"Given an email":   user.Email,
+	} {
+		t.Run(name, func(t *testing.T) {
+			mockRepo := new(mocks.UserRepository)
+			uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour, WithUsernameLogin(true))
+			mockRepo.On("GetByEmailOrUsername", ctx, strings.TrimSpace(identifier)).Return(user, nil).Once()
+			mockRepo.On("SaveRefreshToken", ctx, user.ID, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time"), domain.ClientInfo{}).Return(int64(1), nil).Once()
+			mockRepo.On("TouchLastLogin", ctx, user.ID).Return(nil).Once()
+
+			_, got, err := uc.Login(ctx, identifier, password, domain.ClientInfo{})
+
+			assert.NoError(t, err)
+			assert.Equal(t, user, got)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+
+	t.Run("Given a username while username login is disabled", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+		mockRepo.On("GetByEmail", ctx, "alice").Return(nil, domain.ErrUserNotFound).Once()
+
+		_, _, err := uc.Login(ctx, "alice", password, domain.ClientInfo{})
+
+		assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+		mockRepo.AssertNotCalled(t, "GetByEmailOrUsername", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthUseCase_Login_SingleSession(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.UserRepository)
+	uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour, WithSingleSession(true))
+	password := "password123"
+	hashed, err := hash.HashPassword(password)
+	assert.NoError(t, err)
+	user := &domain.User{ID: 1, Email: "test@example.com", PasswordHash: hashed, Role: domain.RoleUser}
+
+	mockRepo.On("GetByEmail", ctx, user.Email).Return(user, nil).Once()
+	revoke := mockRepo.On("RevokeAllRefreshTokens", ctx, user.ID).Return(nil).Once()
+	mockRepo.On("SaveRefreshToken", ctx, user.ID, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time"), domain.ClientInfo{}).Return(int64(1), nil).Once().NotBefore(revoke)
+	mockRepo.On("TouchLastLogin", ctx, user.ID).Return(nil).Once()
+
+	_, _, err = uc.Login(ctx, user.Email, password, domain.ClientInfo{})
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestAuthUseCase_Login_DeviceName(t *testing.T) {
+	ctx := context.Background()
+	password := "password123"
+	hashed, err := hash.HashPassword(password)
+	assert.NoError(t, err)
+	user := &domain.User{ID: 1, Email: "test@example.com", PasswordHash: hashed, Role: domain.RoleUser}
+
+	for name, tt := range map[string]struct {
+		deviceName string
+		want       string
+	}{
+		"Given a plain name":       {deviceName: "Work laptop", want: "Work laptop"},
+		"Given surrounding blanks": {deviceName: "  Work laptop\n", want: "Work laptop"},
+		"Given control characters": {deviceName: "Work\x00\x1b laptop", want: "Work laptop"},
+		"Given an overlong name":   {deviceName: strings.Repeat("ж", domain.MaxDeviceNameLength+20), want: strings.Repeat("ж", domain.MaxDeviceNameLength)},
+		"Given no name":            {deviceName: "", want: ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mockRepo := new(mocks.UserRepository)
+			uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+			mockRepo.On("GetByEmail", ctx, user.Email).Return(user, nil).Once()
+			mockRepo.On("SaveRefreshToken", ctx, user.ID, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time"), domain.ClientInfo{DeviceName: tt.want}).Return(int64(1), nil).Once()
+			mockRepo.On("TouchLastLogin", ctx, user.ID).Return(nil).Once()
+
+			_, _, err := uc.Login(ctx, user.Email, password, domain.ClientInfo{DeviceName: tt.deviceName})
+
+			assert.NoError(t, err)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthUseCase_ListSessions(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Given opaque refresh tokens", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+		sessions := []domain.Session{{ID: 3, DeviceName: "Phone"}}
+		mockRepo.On("ListSessions", ctx, int64(1)).Return(sessions, nil).Once()
+
+		got, err := uc.ListSessions(ctx, 1)
+
+		assert.NoError(t, err)
+		assert.Equal(t, sessions, got)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given JWT refresh tokens", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour, WithRefreshTokenMode(RefreshModeJWT))
+
+		got, err := uc.ListSessions(ctx, 1)
+
+		assert.NoError(t, err)
+		assert.Empty(t, got)
+		mockRepo.AssertNotCalled(t, "ListSessions", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthUseCase_Logout(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Given an access token with a session", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		audit := &stubAuditLog{}
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour, WithAuditLog(audit))
+		mockRepo.On("DeleteSession", ctx, int64(1), int64(3)).Return(nil).Once()
+
+		err := uc.Logout(ctx, 1, 3, "")
+
+		assert.NoError(t, err)
+		assert.Equal(t, []domain.AuthEvent{{UserID: 1, Type: domain.EventUserLogout, Success: true}}, audit.events)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given a session that is already gone", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+		mockRepo.On("DeleteSession", ctx, int64(1), int64(3)).Return(domain.ErrRefreshTokenNotFound).Once()
+
+		err := uc.Logout(ctx, 1, 3, "")
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("Given an access token without a session", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+
+		err := uc.Logout(ctx, 1, 0, "")
+
+		assert.NoError(t, err)
+		mockRepo.AssertNotCalled(t, "DeleteSession", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Given a database error", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+		dbErr := errors.New("db down")
+		mockRepo.On("DeleteSession", ctx, int64(1), int64(3)).Return(dbErr).Once()
+
+		err := uc.Logout(ctx, 1, 3, "")
+
+		assert.ErrorIs(t, err, dbErr)
+	})
+
+	t.Run("Given a JWT refresh token", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		tokenManager := newTokenManager(t, "secret")
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour, WithRefreshTokenMode(RefreshModeJWT))
+		refreshToken, claims, err := tokenManager.GenerateRefreshJWT(1, 0, time.Time{}, time.Hour)
+		assert.NoError(t, err)
+		mockRepo.On("RevokeRefreshJTI", ctx, claims.ID, mock.AnythingOfType("time.Time")).Return(true, nil).Once()
+		// The jti is on the revocation list from now on.
+		mockRepo.On("RevokeRefreshJTI", ctx, claims.ID, mock.AnythingOfType("time.Time")).Return(false, nil).Once()
+
+		err = uc.Logout(ctx, 1, 0, refreshToken)
+		assert.NoError(t, err)
+
+		_, _, err = uc.Refresh(ctx, refreshToken, domain.ClientInfo{})
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+		mockRepo.AssertExpectations(t)
+		mockRepo.AssertNotCalled(t, "DeleteSession", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Given another user's JWT refresh token", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		tokenManager := newTokenManager(t, "secret")
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour, WithRefreshTokenMode(RefreshModeJWT))
+		refreshToken, _, err := tokenManager.GenerateRefreshJWT(2, 0, time.Time{}, time.Hour)
+		assert.NoError(t, err)
+
+		err = uc.Logout(ctx, 1, 0, refreshToken)
+
+		assert.ErrorIs(t, err, domain.ErrSessionNotOwned)
+		mockRepo.AssertNotCalled(t, "RevokeRefreshJTI", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthUseCase_RevokeSession(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Given one of the user's sessions", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		audit := &stubAuditLog{}
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour, WithAuditLog(audit))
+		mockRepo.On("GetSession", ctx, int64(3)).Return(domain.Session{ID: 3, UserID: 1}, nil).Once()
+		mockRepo.On("DeleteSession", ctx, int64(1), int64(3)).Return(nil).Once()
+
+		err := uc.RevokeSession(ctx, 1, 3)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []domain.AuthEvent{{UserID: 1, Type: domain.EventUserLogout, Success: true}}, audit.events)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given another user's session", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+		mockRepo.On("GetSession", ctx, int64(3)).Return(domain.Session{ID: 3, UserID: 2}, nil).Once()
+
+		err := uc.RevokeSession(ctx, 1, 3)
+
+		assert.ErrorIs(t, err, domain.ErrSessionNotOwned)
+		mockRepo.AssertNotCalled(t, "DeleteSession", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Given an unknown session", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+		mockRepo.On("GetSession", ctx, int64(3)).Return(domain.Session{}, domain.ErrRefreshTokenNotFound).Once()
+
+		err := uc.RevokeSession(ctx, 1, 3)
+
+		assert.ErrorIs(t, err, domain.ErrSessionNotFound)
+		mockRepo.AssertNotCalled(t, "DeleteSession", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthUseCase_ExportUserData(t *testing.T) {
+	ctx := context.Background()
+	joined := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Given a user with sessions and audit events", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		audit := &stubAuditLog{events: []domain.AuthEvent{{ID: 1, UserID: 1, Type: domain.EventUserLogin, Success: true}}}
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour, WithAuditLog(audit))
+		mockRepo.On("GetByID", ctx, int64(1)).Return(&domain.User{
+			ID: 1, Username: "alice", Email: "alice@test.com", PasswordHash: "secret-hash", Role: domain.RoleUser,
+			CreatedAt: joined, LastLoginAt: joined.Add(time.Hour),
+		}, nil).Once()
+		mockRepo.On("ListSessions", ctx, int64(1)).Return([]domain.Session{{ID: 3, UserID: 1, DeviceName: "laptop"}}, nil).Once()
+
+		export, err := uc.ExportUserData(ctx, 1)
+
+		require.NoError(t, err)
+		assert.Equal(t, "alice@test.com", export.User.Email)
+		assert.Equal(t, joined, export.User.CreatedAt)
+		require.NotNil(t, export.User.LastLoginAt)
+		assert.Equal(t, joined.Add(time.Hour), *export.User.LastLoginAt)
+		assert.Nil(t, export.User.DisabledAt)
+		assert.Equal(t, []domain.Session{{ID: 3, UserID: 1, DeviceName: "laptop"}}, export.Sessions)
+		assert.Equal(t, audit.events, export.AuthEvents)
+		assert.False(t, export.ExportedAt.IsZero())
+
+		encoded, err := json.Marshal(export)
+		require.NoError(t, err)
+		for _, section := range []string{`"user"`, `"sessions"`, `"auth_events"`, `"exported_at"`} {
+			assert.Contains(t, string(encoded), section)
+		}
+		assert.NotContains(t, string(encoded), "secret-hash")
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given no audit log", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+		mockRepo.On("GetByID", ctx, int64(1)).Return(&domain.User{ID: 1, Role: domain.RoleUser}, nil).Once()
+		mockRepo.On("ListSessions", ctx, int64(1)).Return([]domain.Session{}, nil).Once()
+
+		export, err := uc.ExportUserData(ctx, 1)
+
+		require.NoError(t, err)
+		assert.Equal(t, []domain.AuthEvent{}, export.AuthEvents)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given an unknown user", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+		mockRepo.On("GetByID", ctx, int64(1)).Return(nil, domain.ErrUserNotFound).Once()
+
+		_, err := uc.ExportUserData(ctx, 1)
+
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	})
+}
+
+func TestAuthUseCase_DeleteAccount(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Given an existing user", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		events := &recordingPublisher{}
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour, WithEventPublisher(events))
+		mockRepo.On("DeleteUser", ctx, int64(1)).Return(nil).Once()
+
+		err := uc.DeleteAccount(ctx, 1)
+
+		assert.NoError(t, err)
+		require.Len(t, events.events, 1)
+		assert.Equal(t, domain.EventUserDeleted, events.events[0].Type)
+		assert.Equal(t, int64(1), events.events[0].UserID)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given an unknown user", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		events := &recordingPublisher{}
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour, WithEventPublisher(events))
+		mockRepo.On("DeleteUser", ctx, int64(1)).Return(domain.ErrUserNotFound).Once()
+
+		err := uc.DeleteAccount(ctx, 1)
+
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+		assert.Empty(t, events.events)
+	})
+}
+
+func TestAuthUseCase_ListDormantUsers(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.UserRepository)
+	uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+	dormant := []domain.User{{ID: 2, Email: "old@example.com"}}
+	cutoff := time.Now().Add(-90 * 24 * time.Hour)
+
+	mockRepo.On("ListDormantUsers", ctx, mock.MatchedBy(func(before time.Time) bool {
+		return before.Sub(cutoff).Abs() < time.Minute
+	})).Return(dormant, nil).Once()
+
+	users, err := uc.ListDormantUsers(ctx, 90*24*time.Hour)
+
+	assert.NoError(t, err)
+	assert.Equal(t, dormant, users)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestAuthUseCase_ValidateRegistration(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Given a free email", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+		mockRepo.On("GetByEmail", ctx, "test@example.com").Return(nil, domain.ErrUserNotFound).Once()
+
+		err := uc.ValidateRegistration(ctx, "test", "test@example.com", "password123")
+
+		assert.NoError(t, err)
+		mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Given a taken email", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+		mockRepo.On("GetByEmail", ctx, "test@example.com").Return(&domain.User{ID: 1}, nil).Once()
+
+		err := uc.ValidateRegistration(ctx, "test", "test@example.com", "password123")
+
+		assert.ErrorIs(t, err, domain.ErrEmailExists)
+	})
+
+	t.Run("Given enumeration-safe mode", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour,
+			WithEnumerationSafeRegistration(true),
+		)
+
+		err := uc.ValidateRegistration(ctx, "test", "test@example.com", "password123")
+
+		assert.NoError(t, err)
+		mockRepo.AssertNotCalled(t, "GetByEmail", mock.Anything, mock.Anything)
+	})
+}
+
+type recordingPublisher struct {
+	events []domain.Event
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, event domain.Event) {
+	p.events = append(p.events, event)
+}
+
+func TestAuthUseCase_Register_PublishesEvent(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.UserRepository)
+	events := &recordingPublisher{}
+	uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour, WithEventPublisher(events))
+	mockRepo.On("Create", ctx, mock.AnythingOfType("*domain.User")).Run(func(args mock.Arguments) {
+		args.Get(1).(*domain.User).ID = 42
+	}).Return(nil).Once()
+
+	_, err := uc.Register(ctx, "test", "test@example.com", "password123")
+
+	assert.NoError(t, err)
+	if assert.Len(t, events.events, 1) {
+		assert.Equal(t, domain.EventUserRegistered, events.events[0].Type)
+		assert.Equal(t, int64(42), events.events[0].UserID)
+		assert.Equal(t, "test@example.com", events.events[0].Data["email"])
+	}
+	mockRepo.AssertExpectations(t)
+}
+
+func TestAuthUseCase_UpdateRole(t *testing.T) {
+	t.Run("Given a valid role", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+
+		mockRepo.On("UpdateRole", ctx, int64(42), domain.RoleAdmin).Return(nil).Once()
+
+		err := uc.UpdateRole(ctx, 42, domain.RoleAdmin)
+
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given an invalid role", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+
+		err := uc.UpdateRole(context.Background(), 42, "superuser")
+
+		assert.ErrorIs(t, err, domain.ErrInvalidRole)
+		mockRepo.AssertNotCalled(t, "UpdateRole", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Given an admin acting", func(t *testing.T) {
+		ctx := domain.WithActor(context.Background(), domain.Actor{UserID: 1, Role: domain.RoleAdmin})
+		mockRepo := new(mocks.UserRepository)
+		audit := &stubAuditLog{}
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour, WithAuditLog(audit))
+
+		mockRepo.On("UpdateRole", ctx, int64(42), domain.RoleAdmin).Return(nil).Once()
+
+		err := uc.UpdateRole(ctx, 42, domain.RoleAdmin)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []domain.AuthEvent{{UserID: 42, ActorID: 1, Type: domain.EventUserRoleChanged, Success: true}}, audit.events)
+	})
+}
+
+// stubAuditLog keeps recorded events in memory.
+type stubAuditLog struct {
+	events []domain.AuthEvent
+}
+
+func (s *stubAuditLog) RecordAuthEvent(_ context.Context, e domain.AuthEvent) error {
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *stubAuditLog) ListAuthEvents(context.Context, domain.AuthEventFilter) ([]domain.AuthEvent, error) {
+	return s.events, nil
+}
+
+func TestAuthUseCase_ImportUsers(t *testing.T) {
+	const bcryptHash = "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"
+
+	t.Run("Given valid and invalid users", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+		users := []domain.User{
+			{Username: "alice", Email: " alice@test.com ", PasswordHash: bcryptHash},
+			{Username: "bob", Email: "bob@test.com", PasswordHash: "plaintext"},
+			{Username: "carol", Email: "not-an-email", PasswordHash: bcryptHash},
+			{Username: "dave", Email: "dave@test.com", PasswordHash: bcryptHash, Role: "superuser"},
+			{Username: "alice2", Email: "alice@test.com", PasswordHash: bcryptHash},
+			{Username: "erin", Email: "erin@test.com", PasswordHash: bcryptHash, Role: domain.RoleAdmin},
+		}
+
+		mockRepo.On("ImportUsers", ctx, []domain.User{
+			{Username: "alice", Email: "alice@test.com", PasswordHash: bcryptHash, Role: domain.RoleUser},
+			{Username: "erin", Email: "erin@test.com", PasswordHash: bcryptHash, Role: domain.RoleAdmin},
+		}).Return([]error{nil, domain.ErrEmailExists}, nil).Once()
+
+		result, err := uc.ImportUsers(ctx, users)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, result.Imported)
+		var failed []string
+		for _, f := range result.Failed {
+			failed = append(failed, fmt.Sprintf("%d:%s", f.Index, f.Code))
+		}
+		assert.Equal(t, []string{
+			"1:" + domain.CodeInvalidRequest,
+			"2:" + domain.CodeInvalidRequest,
+			"3:" + domain.CodeInvalidRole,
+			"4:" + domain.CodeEmailExists,
+			"5:" + domain.CodeEmailExists,
+		}, failed)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given too many users", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+
+		_, err := uc.ImportUsers(context.Background(), make([]domain.User, MaxImportUsers+1))
+
+		assert.Equal(t, domain.CodeInvalidRequest, domain.ToAPIError(err).Code)
+		mockRepo.AssertNotCalled(t, "ImportUsers", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthUseCase_generatePair(t *testing.T) {
+	t.Run("Given refresh token persistence fails", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+		user := &domain.User{ID: 1, Role: domain.RoleUser}
+		dbErr := errors.New("connection reset")
+
+		mockRepo.On("SaveRefreshToken", ctx, user.ID, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time"), domain.ClientInfo{}).Return(int64(0), dbErr).Once()
+		before := testutil.ToFloat64(tokenIssueFailures.WithLabelValues(stagePersist))
+
+		_, err := uc.generatePair(ctx, user, domain.ClientInfo{}, time.Now())
+
+		assert.ErrorIs(t, err, dbErr)
+		assert.ErrorContains(t, err, "persist refresh token")
+		assert.Equal(t, before+1, testutil.ToFloat64(tokenIssueFailures.WithLabelValues(stagePersist)))
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestAuthUseCase_Refresh_MaxRefreshes(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(mocks.UserRepository)
+	uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour, WithMaxRefreshes(5))
+	refreshToken := strings.Repeat("ab", 32)
+	user := &domain.User{ID: 1, Role: domain.RoleUser}
+
+	mockRepo.On("GetRefreshToken", ctx, refreshToken).Return(domain.Session{ID: 1, UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}, nil).Once()
+	mockRepo.On("GetByID", ctx, user.ID).Return(user, nil).Once()
+	mockRepo.On("RotateRefreshToken", ctx, refreshToken, mock.AnythingOfType("string"), user.ID, mock.AnythingOfType("time.Time"), 5).Return(domain.ErrRefreshLimitReached).Once()
+
+	_, _, err := uc.Refresh(ctx, refreshToken, domain.ClientInfo{})
+
+	assert.ErrorIs(t, err, domain.ErrRefreshLimitReached)
+	assert.Equal(t, domain.CodeRefreshLimitReached, domain.ToAPIError(err).Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestAuthUseCase_Refresh_ContextDone(t *testing.T) {
+	tests := map[string]error{
+		"Given the client disconnects during rotation": context.Canceled,
+		"Given the rotation times out":                 fmt.Errorf("commit rotate refresh token: %w", context.DeadlineExceeded),
+		"Given the repository reports it unavailable":  fmt.Errorf("%w: rotate refresh token: %w", domain.ErrServiceUnavailable, context.Canceled),
+	}
+	for name, rotateErr := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			mockRepo := new(mocks.UserRepository)
+			uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+			refreshToken := strings.Repeat("ab", 32)
+			user := &domain.User{ID: 1, Role: domain.RoleUser}
+			mockRepo.On("GetRefreshToken", ctx, refreshToken).Return(domain.Session{ID: 1, UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}, nil).Once()
+			mockRepo.On("GetByID", ctx, user.ID).Return(user, nil).Once()
+			mockRepo.On("RotateRefreshToken", ctx, refreshToken, mock.AnythingOfType("string"), user.ID, mock.AnythingOfType("time.Time"), 0).Return(rotateErr).Once()
+
+			_, _, err := uc.Refresh(ctx, refreshToken, domain.ClientInfo{})
+
+			assert.ErrorIs(t, err, domain.ErrServiceUnavailable)
+			assert.Equal(t, domain.CodeServiceUnavailable, domain.ToAPIError(err).Code)
+			mockRepo.AssertNotCalled(t, "TouchRefreshToken", mock.Anything, mock.Anything, mock.Anything)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthUseCase_Refresh_LastUsed(t *testing.T) {
+	tokenManager := newTokenManager(t, "secret")
+	user := &domain.User{ID: 1, Role: domain.RoleUser}
+
+	tests := map[string]struct {
+		previousIP  string
+		touchErr    error
+		wantFlagged bool
+	}{
+		"Given the first refresh of a session":  {},
+		"Given a refresh from the same address": {previousIP: "192.0.2.1"},
+		"Given a refresh from a new address":    {previousIP: "198.51.100.7", wantFlagged: true},
+		"Given recording the use fails":         {touchErr: errors.New("connection reset")},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			mockRepo := new(mocks.UserRepository)
+			uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour)
+			refreshToken := newRefreshToken(t, tokenManager)
+
+			mockRepo.On("GetRefreshToken", ctx, refreshToken).Return(domain.Session{ID: 1, UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}, nil).Once()
+			mockRepo.On("GetByID", ctx, user.ID).Return(user, nil).Once()
+			mockRepo.On("RotateRefreshToken", ctx, refreshToken, mock.AnythingOfType("string"), user.ID, mock.AnythingOfType("time.Time"), 0).Return(nil).Once()
+			mockRepo.On("TouchRefreshToken", ctx, mock.AnythingOfType("string"), "192.0.2.1").Return(tt.previousIP, tt.touchErr).Once()
+			before := testutil.ToFloat64(sessionIPChanges)
+
+			pair, _, err := uc.Refresh(ctx, refreshToken, domain.ClientInfo{IP: "192.0.2.1"})
+
+			assert.NoError(t, err)
+			assert.NotEmpty(t, pair.RefreshToken)
+			flagged := testutil.ToFloat64(sessionIPChanges) - before
+			if tt.wantFlagged {
+				assert.Equal(t, 1.0, flagged)
+			} else {
+				assert.Zero(t, flagged)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthUseCase_Refresh_AccessToken(t *testing.T) {
+	tokenManager := newTokenManager(t, "secret")
+	user := &domain.User{ID: 1, Role: domain.RoleUser}
+	accessToken := func(t *testing.T, userID int64) string {
+		token, err := tokenManager.GenerateAccessToken(jwt.Claims{UserID: userID, Role: domain.RoleUser}, -time.Minute)
+		assert.NoError(t, err)
+		return token
+	}
+
+	t.Run("Given the expired access token of the same user", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour)
+		refreshToken := newRefreshToken(t, tokenManager)
+
+		mockRepo.On("GetRefreshToken", ctx, refreshToken).Return(domain.Session{ID: 1, UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}, nil).Once()
+		mockRepo.On("GetByID", ctx, user.ID).Return(user, nil).Once()
+		mockRepo.On("RotateRefreshToken", ctx, refreshToken, mock.AnythingOfType("string"), user.ID, mock.AnythingOfType("time.Time"), 0).Return(nil).Once()
+		mockRepo.On("TouchRefreshToken", ctx, mock.AnythingOfType("string"), "").Return("", nil).Once()
+
+		pair, _, err := uc.Refresh(ctx, refreshToken, domain.ClientInfo{AccessToken: accessToken(t, user.ID)})
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, pair.AccessToken)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given another user's access token", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour)
+		refreshToken := newRefreshToken(t, tokenManager)
+
+		mockRepo.On("GetRefreshToken", ctx, refreshToken).Return(domain.Session{ID: 1, UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}, nil).Once()
+
+		_, _, err := uc.Refresh(ctx, refreshToken, domain.ClientInfo{AccessToken: accessToken(t, 2)})
+
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+		mockRepo.AssertExpectations(t)
+		mockRepo.AssertNotCalled(t, "RotateRefreshToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Given a forged access token", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour)
+		refreshToken := newRefreshToken(t, tokenManager)
+		forged, err := newTokenManager(t, "other").GenerateAccessToken(jwt.Claims{UserID: user.ID}, time.Minute)
+		assert.NoError(t, err)
+
+		mockRepo.On("GetRefreshToken", ctx, refreshToken).Return(domain.Session{ID: 1, UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}, nil).Once()
+
+		_, _, err = uc.Refresh(ctx, refreshToken, domain.ClientInfo{AccessToken: forged})
+
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given another user's access token with a JWT refresh token", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour, WithRefreshTokenMode(RefreshModeJWT))
+		refreshToken, _, err := tokenManager.GenerateRefreshJWT(user.ID, 0, time.Time{}, time.Hour)
+		assert.NoError(t, err)
+
+		_, _, err = uc.Refresh(ctx, refreshToken, domain.ClientInfo{AccessToken: accessToken(t, 2)})
+
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+		mockRepo.AssertNotCalled(t, "RevokeRefreshJTI", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthUseCase_Refresh_JWTMode(t *testing.T) {
+	tokenManager := newTokenManager(t, "secret")
+	userID := int64(1)
+
+	t.Run("Given a valid JWT refresh token", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour, WithRefreshTokenMode(RefreshModeJWT))
+		refreshToken, claims, err := tokenManager.GenerateRefreshJWT(userID, 0, time.Time{}, time.Hour)
+		assert.NoError(t, err)
+
+		mockRepo.On("RevokeRefreshJTI", ctx, claims.ID, mock.AnythingOfType("time.Time")).Return(true, nil).Once()
+		mockRepo.On("GetByID", ctx, userID).Return(&domain.User{ID: userID, Role: domain.RoleUser}, nil).Once()
+
+		pair, _, err := uc.Refresh(ctx, refreshToken, domain.ClientInfo{})
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, pair.AccessToken)
+		newClaims, err := tokenManager.ParseRefreshJWT(pair.RefreshToken)
+		assert.NoError(t, err)
+		assert.Equal(t, userID, newClaims.UserID)
+		assert.NotEqual(t, claims.ID, newClaims.ID)
+		mockRepo.AssertNotCalled(t, "SaveRefreshToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given an expired JWT refresh token", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour, WithRefreshTokenMode(RefreshModeJWT))
+		refreshToken, _, err := tokenManager.GenerateRefreshJWT(userID, 0, time.Time{}, -time.Minute)
+		assert.NoError(t, err)
+
+		_, _, err = uc.Refresh(ctx, refreshToken, domain.ClientInfo{})
+
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+		mockRepo.AssertNotCalled(t, "RevokeRefreshJTI", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Given a revoked JWT refresh token", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour, WithRefreshTokenMode(RefreshModeJWT))
+		refreshToken, claims, err := tokenManager.GenerateRefreshJWT(userID, 0, time.Time{}, time.Hour)
+		assert.NoError(t, err)
+
+		mockRepo.On("RevokeRefreshJTI", ctx, claims.ID, mock.AnythingOfType("time.Time")).Return(false, nil).Once()
+
+		_, _, err = uc.Refresh(ctx, refreshToken, domain.ClientInfo{})
+
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+		mockRepo.AssertNotCalled(t, "GetByID", mock.Anything, mock.Anything)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given token version checks", func(t *testing.T) {
+		for name, tt := range map[string]struct {
+			userVersion int64
+			wantErr     error
+		}{
+			"and a refresh token of the current version":       {userVersion: 2},
+			"and a refresh token issued before a version bump": {userVersion: 3, wantErr: domain.ErrRefreshTokenNotFound},
+		} {
+			t.Run(name, func(t *testing.T) {
+				ctx := context.Background()
+				mockRepo := new(mocks.UserRepository)
+				uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour,
+					WithRefreshTokenMode(RefreshModeJWT), WithTokenVersionCheck(true))
+				refreshToken, claims, err := tokenManager.GenerateRefreshJWT(userID, 2, time.Time{}, time.Hour)
+				assert.NoError(t, err)
+
+				mockRepo.On("RevokeRefreshJTI", ctx, claims.ID, mock.AnythingOfType("time.Time")).Return(true, nil).Once()
+				mockRepo.On("GetByID", ctx, userID).Return(&domain.User{ID: userID, Role: domain.RoleUser, TokenVersion: tt.userVersion}, nil).Once()
+
+				pair, _, err := uc.Refresh(ctx, refreshToken, domain.ClientInfo{})
+
+				if tt.wantErr != nil {
+					assert.ErrorIs(t, err, tt.wantErr)
+					return
+				}
+				assert.NoError(t, err)
+				newClaims, err := tokenManager.ParseRefreshJWT(pair.RefreshToken)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.userVersion, newClaims.TokenVersion)
+				mockRepo.AssertExpectations(t)
+			})
+		}
+	})
+
+	t.Run("Given an access token instead of a refresh token", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour, WithRefreshTokenMode(RefreshModeJWT))
+		accessToken, err := tokenManager.GenerateAccessToken(jwt.Claims{UserID: userID, Role: domain.RoleUser}, time.Hour)
+		assert.NoError(t, err)
+
+		_, _, err = uc.Refresh(context.Background(), accessToken, domain.ClientInfo{})
+
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+	})
+}
+
+func TestAuthUseCase_Refresh_RotateThreshold(t *testing.T) {
+	tokenManager := newTokenManager(t, "secret")
+	userID := int64(1)
+	user := &domain.User{ID: userID, Role: domain.RoleUser}
+
+	t.Run("Given a token far from expiry", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour, WithRefreshRotateThreshold(24*time.Hour))
+		refreshToken := newRefreshToken(t, tokenManager)
+		expiresAt := time.Now().Add(72 * time.Hour)
+
+		mockRepo.On("GetRefreshToken", ctx, refreshToken).Return(domain.Session{ID: 1, UserID: userID, ExpiresAt: expiresAt}, nil).Once()
+		mockRepo.On("GetByID", ctx, userID).Return(user, nil).Once()
+		mockRepo.On("TouchRefreshToken", ctx, refreshToken, "").Return("", nil).Once()
+
+		pair, _, err := uc.Refresh(ctx, refreshToken, domain.ClientInfo{})
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, pair.AccessToken)
+		assert.Equal(t, refreshToken, pair.RefreshToken)
+		assert.False(t, pair.Rotated)
+		assert.Equal(t, expiresAt, pair.RefreshExpiresAt)
+		mockRepo.AssertNotCalled(t, "RotateRefreshToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given a token within the rotation threshold", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour, WithRefreshRotateThreshold(24*time.Hour))
+		refreshToken := newRefreshToken(t, tokenManager)
+
+		mockRepo.On("GetRefreshToken", ctx, refreshToken).Return(domain.Session{ID: 1, UserID: userID, ExpiresAt: time.Now().Add(time.Hour)}, nil).Once()
+		mockRepo.On("GetByID", ctx, userID).Return(user, nil).Once()
+		mockRepo.On("RotateRefreshToken", ctx, refreshToken, mock.AnythingOfType("string"), userID, mock.AnythingOfType("time.Time"), 0).Return(nil).Once()
+		mockRepo.On("TouchRefreshToken", ctx, mock.AnythingOfType("string"), "").Return("", nil).Once()
+
+		pair, _, err := uc.Refresh(ctx, refreshToken, domain.ClientInfo{})
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, pair.AccessToken)
+		assert.NotEqual(t, refreshToken, pair.RefreshToken)
+		assert.True(t, pair.Rotated)
+		assert.WithinDuration(t, time.Now().Add(7*24*time.Hour), pair.RefreshExpiresAt, time.Minute)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given an unknown token", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour, WithRefreshRotateThreshold(24*time.Hour))
+
+		refreshToken := newRefreshToken(t, tokenManager)
+		mockRepo.On("GetRefreshToken", ctx, refreshToken).Return(domain.Session{}, domain.ErrRefreshTokenNotFound).Once()
+
+		_, _, err := uc.Refresh(ctx, refreshToken, domain.ClientInfo{})
+
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestAuthUseCase_SessionExpiry(t *testing.T) {
+	tokenManager := newTokenManager(t, "secret")
+
+	t.Run("Given a live token", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour)
+		expiresAt := time.Now().Add(time.Hour)
+		refreshToken := newRefreshToken(t, tokenManager)
+		mockRepo.On("GetRefreshToken", ctx, refreshToken).Return(domain.Session{ID: 1, UserID: 1, ExpiresAt: expiresAt}, nil).Once()
+
+		got, err := uc.SessionExpiry(ctx, refreshToken)
+
+		assert.NoError(t, err)
+		assert.Equal(t, expiresAt, got)
+		mockRepo.AssertNotCalled(t, "RotateRefreshToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Given an expired token", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour)
+		refreshToken := newRefreshToken(t, tokenManager)
+		mockRepo.On("GetRefreshToken", ctx, refreshToken).Return(domain.Session{ID: 1, UserID: 1, ExpiresAt: time.Now().Add(-time.Hour)}, nil).Once()
+
+		_, err := uc.SessionExpiry(ctx, refreshToken)
+
+		assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+	})
+}
+
+func TestAuthUseCase_Refresh_MalformedToken(t *testing.T) {
+	tokenManager := newTokenManager(t, "secret")
+
+	for name, token := range map[string]string{
+		"Given an arbitrary string":   "not-a-token",
+		"Given a too short hex token": "abcdef0123",
+		"Given non-hex characters":    strings.Repeat("z", 64),
+		"Given upper-case hex":        strings.ToUpper(newRefreshToken(t, tokenManager)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			mockRepo := new(mocks.UserRepository)
+			uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour)
+
+			_, _, err := uc.Refresh(context.Background(), token, domain.ClientInfo{})
+
+			assert.ErrorIs(t, err, domain.ErrRefreshTokenNotFound)
+			mockRepo.AssertNotCalled(t, "GetRefreshToken", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestAuthUseCase_Login_PasswordHashUpgrade(t *testing.T) {
+	tokenManager := newTokenManager(t, "secret")
+	password := "password123"
+	bcryptHash, _ := hash.HashPassword(password)
+
+	t.Run("Given argon2id is the target and the stored hash is bcrypt", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour,
+			WithHasher(hash.NewHasher(hash.AlgorithmArgon2id, hash.DefaultArgon2Params)),
+		)
+		user := &domain.User{ID: 1, Email: "test@example.com", PasswordHash: bcryptHash, Role: domain.RoleUser}
+
+		mockRepo.On("GetByEmail", ctx, user.Email).Return(user, nil).Once()
+		mockRepo.On("UpdatePasswordHash", ctx, user.ID, mock.MatchedBy(func(h string) bool {
+			return strings.HasPrefix(h, "$argon2id$") && hash.CheckPasswordHash(password, h)
+		})).Return(nil).Once()
+		mockRepo.On("SaveRefreshToken", ctx, user.ID, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time"), domain.ClientInfo{}).Return(int64(1), nil).Once()
+		mockRepo.On("TouchLastLogin", ctx, user.ID).Return(nil).Once()
+
+		_, _, err := uc.Login(ctx, user.Email, password, domain.ClientInfo{})
+
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given bcrypt is the target", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour)
+		user := &domain.User{ID: 1, Email: "test@example.com", PasswordHash: bcryptHash, Role: domain.RoleUser}
+
+		mockRepo.On("GetByEmail", ctx, user.Email).Return(user, nil).Once()
+		mockRepo.On("SaveRefreshToken", ctx, user.ID, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time"), domain.ClientInfo{}).Return(int64(1), nil).Once()
+		mockRepo.On("TouchLastLogin", ctx, user.ID).Return(nil).Once()
+
+		_, _, err := uc.Login(ctx, user.Email, password, domain.ClientInfo{})
+
+		assert.NoError(t, err)
+		mockRepo.AssertNotCalled(t, "UpdatePasswordHash", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthUseCase_ChangePassword(t *testing.T) {
+	tokenManager := newTokenManager(t, "secret")
+	newPassword := "new-password123"
+
+	t.Run("Given a change within the cooldown", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, time.Hour, WithPasswordChangeCooldown(24*time.Hour))
+		user := &domain.User{ID: 1, PasswordChangedAt: time.Now().Add(-time.Hour)}
+		mockRepo.On("GetByID", ctx, user.ID).Return(user, nil).Once()
+
+		err := uc.ChangePassword(ctx, user.ID, newPassword)
+
+		assert.ErrorIs(t, err, domain.ErrPasswordChangeTooSoon)
+		mockRepo.AssertNotCalled(t, "ChangePassword", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Given a change after the cooldown", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		publisher := &recordingPublisher{}
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, time.Hour,
+			WithPasswordChangeCooldown(24*time.Hour),
+			WithEventPublisher(publisher),
+		)
+		user := &domain.User{ID: 1, PasswordChangedAt: time.Now().Add(-25 * time.Hour)}
+		mockRepo.On("GetByID", ctx, user.ID).Return(user, nil).Once()
+		mockRepo.On("ChangePassword", ctx, user.ID, mock.MatchedBy(func(h string) bool {
+			return hash.CheckPasswordHash(newPassword, h)
+		})).Return(nil).Once()
+
+		err := uc.ChangePassword(ctx, user.ID, newPassword)
+
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		if assert.Len(t, publisher.events, 1) {
+			assert.Equal(t, domain.EventUserPasswordChanged, publisher.events[0].Type)
+		}
+	})
+
+	t.Run("Given the password was never changed", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, time.Hour, WithPasswordChangeCooldown(24*time.Hour))
+		user := &domain.User{ID: 1, CreatedAt: time.Now()}
+		mockRepo.On("GetByID", ctx, user.ID).Return(user, nil).Once()
+		mockRepo.On("ChangePassword", ctx, user.ID, mock.AnythingOfType("string")).Return(nil).Once()
+
+		err := uc.ChangePassword(ctx, user.ID, newPassword)
+
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestAuthUseCase_ClaimsEnricher(t *testing.T) {
+	ctx := context.Background()
+	password := "password123"
+	hashed, err := hash.HashPassword(password)
+	assert.NoError(t, err)
+	user := &domain.User{ID: 1, Email: "test@example.com", PasswordHash: hashed, Role: domain.RoleUser}
+	tenantOf := func(u *domain.User) map[string]any {
+		return map[string]any{"tenant_id": fmt.Sprintf("tenant-%d", u.ID)}
+	}
+
+	t.Run("Given a login", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour, WithClaimsEnricher(tenantOf))
+		mockRepo.On("GetByEmail", ctx, user.Email).Return(user, nil).Once()
+		mockRepo.On("SaveRefreshToken", ctx, user.ID, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time"), domain.ClientInfo{}).Return(int64(1), nil).Once()
+		mockRepo.On("TouchLastLogin", ctx, user.ID).Return(nil).Once()
+
+		pair, _, err := uc.Login(ctx, user.Email, password, domain.ClientInfo{})
+		assert.NoError(t, err)
+
+		claims, err := uc.Authenticate(ctx, pair.AccessToken)
+		assert.NoError(t, err)
+		assert.Equal(t, "tenant-1", claims.Extra["tenant_id"])
+		assert.Equal(t, user.ID, claims.UserID)
+	})
+
+	t.Run("Given a step-up", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour, WithClaimsEnricher(tenantOf))
+		mockRepo.On("GetByID", ctx, user.ID).Return(user, nil).Once()
+
+		token, err := uc.StepUp(ctx, user.ID, password)
+		assert.NoError(t, err)
+
+		claims, err := uc.Authenticate(ctx, token)
+		assert.NoError(t, err)
+		assert.Equal(t, "tenant-1", claims.Extra["tenant_id"])
+		assert.Equal(t, jwt.ACRStepUp, claims.ACR)
+	})
+
+	t.Run("Given no enricher", func(t *testing.T) {
+		uc := NewAuthUseCase(new(mocks.UserRepository), newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+
+		token, err := uc.generateAccessToken(user, 0, time.Now())
+		assert.NoError(t, err)
+
+		claims, err := uc.Authenticate(ctx, token)
+		assert.NoError(t, err)
+		assert.Empty(t, claims.Extra)
+	})
+}
+
+func TestAuthUseCase_RotateSigningKey(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Given a weak secret", func(t *testing.T) {
+		uc := NewAuthUseCase(new(mocks.UserRepository), newTokenManager(t, "secret", jwt.WithSecretPolicy(80)), 15*time.Minute, time.Hour)
+
+		err := uc.RotateSigningKey(ctx, strings.Repeat("a", 32))
+
+		var apiErr *domain.APIError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, domain.CodeInvalidRequest, apiErr.Code)
+		assert.NotErrorIs(t, err, domain.ErrServiceUnavailable)
+	})
+
+	t.Run("Given no secret", func(t *testing.T) {
+		uc := NewAuthUseCase(new(mocks.UserRepository), newTokenManager(t, "secret", jwt.WithSecretPolicy(80)), 15*time.Minute, time.Hour)
+
+		assert.NoError(t, uc.RotateSigningKey(ctx, ""))
+	})
+}
+
+func TestAuthUseCase_VerifyPassword(t *testing.T) {
+	ctx := context.Background()
+	password := "password123"
+	hashed, err := hash.HashPassword(password)
+	assert.NoError(t, err)
+	user := &domain.User{ID: 1, PasswordHash: hashed, Role: domain.RoleUser}
+
+	t.Run("Given the correct password", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+		mockRepo.On("GetByID", ctx, user.ID).Return(user, nil).Once()
+
+		ok, err := uc.VerifyPassword(ctx, user.ID, password)
+
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given an incorrect password", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour)
+		mockRepo.On("GetByID", ctx, user.ID).Return(user, nil).Once()
+
+		ok, err := uc.VerifyPassword(ctx, user.ID, "wrong")
+
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given too many incorrect passwords", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour,
+			WithVerifyPasswordLimit(2, time.Minute),
+		)
+		mockRepo.On("GetByID", ctx, user.ID).Return(user, nil).Twice()
+
+		for i := 0; i < 2; i++ {
+			ok, err := uc.VerifyPassword(ctx, user.ID, "wrong")
+			assert.NoError(t, err)
+			assert.False(t, ok)
+		}
+		_, err := uc.VerifyPassword(ctx, user.ID, password)
+
+		assert.ErrorIs(t, err, domain.ErrTooManyAttempts)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given a correct password between failures", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour,
+			WithVerifyPasswordLimit(2, time.Minute),
+		)
+		mockRepo.On("GetByID", ctx, user.ID).Return(user, nil)
+
+		for _, attempt := range []string{"wrong", password, "wrong", "wrong"} {
+			_, err := uc.VerifyPassword(ctx, user.ID, attempt)
+			assert.NoError(t, err, "the correct password must clear earlier failures")
+		}
+	})
+}
+
+func TestAuthUseCase_StepUp(t *testing.T) {
+	tokenManager := newTokenManager(t, "secret")
+	password := "password123"
+	hashed, err := hash.HashPassword(password)
+	assert.NoError(t, err)
+	user := &domain.User{ID: 1, PasswordHash: hashed, Role: domain.RoleUser}
+
+	t.Run("Given the correct password", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour, WithStepUpTTL(2*time.Minute))
+		mockRepo.On("GetByID", ctx, user.ID).Return(user, nil).Once()
+
+		token, err := uc.StepUp(ctx, user.ID, password)
+
+		assert.NoError(t, err)
+		claims, err := tokenManager.ParseToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, user.ID, claims.UserID)
+		assert.Equal(t, jwt.ACRStepUp, claims.ACR)
+		assert.WithinDuration(t, time.Now().Add(2*time.Minute), claims.ExpiresAt, 5*time.Second)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given a wrong password", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour)
+		mockRepo.On("GetByID", ctx, user.ID).Return(user, nil).Once()
+
+		token, err := uc.StepUp(ctx, user.ID, "wrong")
+
+		assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+		assert.Empty(t, token)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given too many wrong passwords", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour,
+			WithVerifyPasswordLimit(2, time.Minute),
+		)
+		mockRepo.On("GetByID", ctx, user.ID).Return(user, nil).Twice()
+
+		_, err := uc.StepUp(ctx, user.ID, "wrong")
+		assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+		ok, err := uc.VerifyPassword(ctx, user.ID, "wrong")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		token, err := uc.StepUp(ctx, user.ID, password)
+
+		assert.ErrorIs(t, err, domain.ErrTooManyAttempts)
+		assert.Empty(t, token)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given a disabled account", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour)
+		disabled := *user
+		disabled.DisabledAt = time.Now().Add(-time.Hour)
+		mockRepo.On("GetByID", ctx, user.ID).Return(&disabled, nil).Once()
+
+		token, err := uc.StepUp(ctx, user.ID, password)
+
+		assert.ErrorIs(t, err, domain.ErrAccountDisabled)
+		assert.Empty(t, token)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestAuthUseCase_Login_FailureLog(t *testing.T) {
+	const password = "s3cret-password"
+	passwordHash, err := hash.HashPassword(password)
+	assert.NoError(t, err)
+	client := domain.ClientInfo{IP: "192.0.2.1"}
+
+	tests := []struct {
+		name       string
+		identifier string
+		password   string
+		opts       []Option
+		setup      func(ctx context.Context, m *mocks.UserRepository)
+		wantLevel  string
+		wantReason string
+	}{
+		{
+			name:       "Given an empty email",
+			identifier: "", password: password,
+			wantReason: loginFailureMissingCredentials,
+		},
+		{
+			name:       "Given an unknown user",
+			identifier: "ghost@test.com", password: password,
+			setup: func(ctx context.Context, m *mocks.UserRepository) {
+				m.On("GetByEmail", ctx, "ghost@test.com").Return(nil, domain.ErrUserNotFound).Once()
+			},
+			wantReason: loginFailureUnknownUser,
+		},
+		{
+			name:       "Given a wrong password",
+			identifier: "test@test.com", password: "wrong-" + password,
+			setup: func(ctx context.Context, m *mocks.UserRepository) {
+				m.On("GetByEmail", ctx, "test@test.com").Return(&domain.User{ID: 1, Email: "test@test.com", PasswordHash: passwordHash}, nil).Once()
+			},
+			wantReason: loginFailureBadPassword,
+		},
+		{
+			name:       "Given a locked account",
+			identifier: "test@test.com", password: password,
+			setup: func(ctx context.Context, m *mocks.UserRepository) {
+				m.On("GetByEmail", ctx, "test@test.com").Return(&domain.User{ID: 1, Email: "test@test.com", PasswordHash: passwordHash, LockedUntil: time.Now().Add(time.Hour)}, nil).Once()
+			},
+			wantReason: loginFailureLocked,
+		},
+		{
+			name:       "Given a disabled account",
+			identifier: "test@test.com", password: password,
+			setup: func(ctx context.Context, m *mocks.UserRepository) {
+				m.On("GetByEmail", ctx, "test@test.com").Return(&domain.User{ID: 1, Email: "test@test.com", PasswordHash: passwordHash, DisabledAt: time.Now()}, nil).Once()
+			},
+			wantReason: loginFailureDisabled,
+		},
+		{
+			name:       "Given a configured level",
+			identifier: "ghost@test.com", password: password,
+			opts: []Option{WithLoginFailureLogLevel(slog.LevelInfo)},
+			setup: func(ctx context.Context, m *mocks.UserRepository) {
+				m.On("GetByEmail", ctx, "ghost@test.com").Return(nil, domain.ErrUserNotFound).Once()
+			},
+			wantLevel:  "INFO",
+			wantReason: loginFailureUnknownUser,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			defer slog.SetDefault(slog.Default())
+			slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+			ctx := context.Background()
+			mockRepo := new(mocks.UserRepository)
+			if tt.setup != nil {
+				tt.setup(ctx, mockRepo)
+			}
+			uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, time.Hour, tt.opts...)
+
+			_, _, err := uc.Login(ctx, tt.identifier, tt.password, client)
+
+			assert.Error(t, err)
+			var entry struct {
+				Level  string `json:"level"`
+				Msg    string `json:"msg"`
+				Email  string `json:"email"`
+				IP     string `json:"ip"`
+				Reason string `json:"reason"`
+			}
+			assert.NoError(t, json.Unmarshal(logs.Bytes(), &entry), logs.String())
+			assert.Equal(t, "login failed", entry.Msg)
+			assert.Equal(t, tt.wantReason, entry.Reason)
+			assert.Equal(t, tt.identifier, entry.Email)
+			assert.Equal(t, client.IP, entry.IP)
+			wantLevel := tt.wantLevel
+			if wantLevel == "" {
+				wantLevel = "WARN"
+			}
+			assert.Equal(t, wantLevel, entry.Level)
+			assert.NotContains(t, logs.String(), password)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+
+	t.Run("Given a throttled login", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		mockRepo.On("GetByEmail", ctx, "ghost@test.com").Return(nil, domain.ErrUserNotFound).Once()
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, time.Hour, WithLoginBackoff(1, time.Minute, time.Hour))
+		_, _, _ = uc.Login(ctx, "ghost@test.com", password, client)
+
+		var logs bytes.Buffer
+		defer slog.SetDefault(slog.Default())
+		slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+		_, _, err := uc.Login(ctx, "ghost@test.com", password, client)
+
+		assert.ErrorIs(t, err, domain.ErrTooManyAttempts)
+		assert.Contains(t, logs.String(), `"reason":"`+loginFailureThrottled+`"`)
+	})
+}
+
+func TestAuthUseCase_AuthTimeClaim(t *testing.T) {
+	passwordHash, err := hash.HashPassword("password123")
+	require.NoError(t, err)
+	loginAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Given opaque refresh tokens", func(t *testing.T) {
+		ctx := context.Background()
+		c := clock.NewFake(loginAt)
+		tm := newTokenManager(t, "secret", jwt.WithClock(c))
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tm, 15*time.Minute, 24*time.Hour, WithClock(c), WithAuthTimeClaim(true))
+		user := &domain.User{ID: 1, Email: "alice@test.com", PasswordHash: passwordHash, Role: domain.RoleUser}
+		mockRepo.On("GetByEmail", ctx, user.Email).Return(user, nil).Once()
+		mockRepo.On("SaveRefreshToken", ctx, user.ID, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time"), domain.ClientInfo{}).Return(int64(3), nil).Once()
+		mockRepo.On("TouchLastLogin", ctx, user.ID).Return(nil).Once()
+
+		pair, _, err := uc.Login(ctx, user.Email, "password123", domain.ClientInfo{})
+		require.NoError(t, err)
+		first, err := tm.ParseToken(pair.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, loginAt, first.AuthTime.UTC())
+
+		refreshToken := pair.RefreshToken
+		for i := 1; i <= 2; i++ {
+			c.Advance(10 * time.Minute)
+			mockRepo.On("GetRefreshToken", ctx, refreshToken).Return(domain.Session{ID: 3, UserID: 1, CreatedAt: loginAt, ExpiresAt: loginAt.Add(24 * time.Hour)}, nil).Once()
+			mockRepo.On("GetByID", ctx, int64(1)).Return(user, nil).Once()
+			mockRepo.On("RotateRefreshToken", ctx, refreshToken, mock.AnythingOfType("string"), int64(1), mock.AnythingOfType("time.Time"), 0).Return(nil).Once()
+			mockRepo.On("TouchRefreshToken", ctx, mock.AnythingOfType("string"), "").Return("", nil).Once()
+
+			pair, _, err = uc.Refresh(ctx, refreshToken, domain.ClientInfo{})
+			require.NoError(t, err)
+			claims, err := tm.ParseToken(pair.AccessToken)
+			require.NoError(t, err)
+			assert.Equal(t, loginAt, claims.AuthTime.UTC(), "refresh %d keeps auth_time", i)
+			assert.Equal(t, c.Now(), claims.IssuedAt.UTC(), "refresh %d moves iat", i)
+			refreshToken = pair.RefreshToken
+		}
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given JWT refresh tokens", func(t *testing.T) {
+		ctx := context.Background()
+		c := clock.NewFake(loginAt)
+		tm := newTokenManager(t, "secret", jwt.WithClock(c))
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tm, 15*time.Minute, 24*time.Hour, WithClock(c), WithAuthTimeClaim(true), WithRefreshTokenMode(RefreshModeJWT))
+		user := &domain.User{ID: 1, Email: "alice@test.com", PasswordHash: passwordHash, Role: domain.RoleUser}
+		mockRepo.On("GetByEmail", ctx, user.Email).Return(user, nil).Once()
+		mockRepo.On("TouchLastLogin", ctx, user.ID).Return(nil).Once()
+		mockRepo.On("RevokeRefreshJTI", ctx, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(true, nil)
+		mockRepo.On("GetByID", ctx, int64(1)).Return(user, nil)
+
+		pair, _, err := uc.Login(ctx, user.Email, "password123", domain.ClientInfo{})
+		require.NoError(t, err)
+		for i := 1; i <= 2; i++ {
+			c.Advance(10 * time.Minute)
+
+			pair, _, err = uc.Refresh(ctx, pair.RefreshToken, domain.ClientInfo{})
+			require.NoError(t, err)
+			claims, err := tm.ParseToken(pair.AccessToken)
+			require.NoError(t, err)
+			assert.Equal(t, loginAt, claims.AuthTime.UTC(), "refresh %d keeps auth_time", i)
+			assert.Equal(t, c.Now(), claims.IssuedAt.UTC(), "refresh %d moves iat", i)
+		}
+	})
+
+	t.Run("Given the claim is disabled", func(t *testing.T) {
+		ctx := context.Background()
+		tm := newTokenManager(t, "secret")
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tm, 15*time.Minute, 24*time.Hour, WithRefreshTokenMode(RefreshModeJWT))
+		user := &domain.User{ID: 1, Email: "alice@test.com", PasswordHash: passwordHash, Role: domain.RoleUser}
+		mockRepo.On("GetByEmail", ctx, user.Email).Return(user, nil).Once()
+		mockRepo.On("TouchLastLogin", ctx, user.ID).Return(nil).Once()
+
+		pair, _, err := uc.Login(ctx, user.Email, "password123", domain.ClientInfo{})
+
+		require.NoError(t, err)
+		claims, err := tm.ParseToken(pair.AccessToken)
+		require.NoError(t, err)
+		assert.True(t, claims.AuthTime.IsZero())
+		refresh, err := tm.ParseRefreshJWT(pair.RefreshToken)
+		require.NoError(t, err)
+		assert.True(t, refresh.AuthTime.IsZero())
+	})
+}
+
+func TestAuthUseCase_MaxAccessTTL(t *testing.T) {
+	tokenManager := newTokenManager(t, "secret")
+	passwordHash, err := hash.HashPassword("password123")
+	assert.NoError(t, err)
+	user := &domain.User{ID: 1, Email: "test@test.com", PasswordHash: passwordHash, Role: domain.RoleUser}
+
+	t.Run("Given an access TTL over the cap", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 48*time.Hour, 7*24*time.Hour, WithMaxAccessTTL(time.Hour))
+		mockRepo.On("GetByEmail", ctx, user.Email).Return(user, nil).Once()
+		mockRepo.On("SaveRefreshToken", ctx, user.ID, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time"), domain.ClientInfo{}).Return(int64(1), nil).Once()
+		mockRepo.On("TouchLastLogin", ctx, user.ID).Return(nil).Once()
+
+		pair, _, err := uc.Login(ctx, user.Email, "password123", domain.ClientInfo{})
+
+		assert.NoError(t, err)
+		claims, err := tokenManager.ParseToken(pair.AccessToken)
+		assert.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), claims.ExpiresAt, 5*time.Second)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given a step-up TTL over the cap", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour,
+			WithStepUpTTL(2*time.Hour), WithMaxAccessTTL(time.Hour))
+		mockRepo.On("GetByID", ctx, user.ID).Return(user, nil).Once()
+
+		token, err := uc.StepUp(ctx, user.ID, "password123")
+
+		assert.NoError(t, err)
+		claims, err := tokenManager.ParseToken(token)
+		assert.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), claims.ExpiresAt, 5*time.Second)
+	})
+
+	t.Run("Given an access TTL under the cap", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour, WithMaxAccessTTL(time.Hour))
+		mockRepo.On("GetByEmail", ctx, user.Email).Return(user, nil).Once()
+		mockRepo.On("SaveRefreshToken", ctx, user.ID, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time"), domain.ClientInfo{}).Return(int64(1), nil).Once()
+		mockRepo.On("TouchLastLogin", ctx, user.ID).Return(nil).Once()
+
+		pair, _, err := uc.Login(ctx, user.Email, "password123", domain.ClientInfo{})
+
+		assert.NoError(t, err)
+		claims, err := tokenManager.ParseToken(pair.AccessToken)
+		assert.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(15*time.Minute), claims.ExpiresAt, 5*time.Second)
+	})
+}
+
+func TestAuthUseCase_IssueResourceToken(t *testing.T) {
+	tokenManager := newTokenManager(t, "secret")
+	audiences := WithResourceAudiences(map[string]string{"reports": "", "billing": domain.RoleAdmin})
+	user := &domain.User{ID: 1, Role: domain.RoleUser}
+
+	t.Run("Given a resource open to every user", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour, audiences)
+		mockRepo.On("GetByID", ctx, user.ID).Return(user, nil).Once()
+
+		token, err := uc.IssueResourceToken(ctx, user.ID, "reports")
+
+		assert.NoError(t, err)
+		claims, err := tokenManager.ParseToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, user.ID, claims.UserID)
+		assert.Equal(t, "reports", claims.Audience)
+		mockRepo.AssertExpectations(t)
+
+		_, err = uc.Authenticate(ctx, token)
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+	})
+
+	t.Run("Given a resource requiring a role the user lacks", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour, audiences)
+		mockRepo.On("GetByID", ctx, user.ID).Return(user, nil).Once()
+
+		token, err := uc.IssueResourceToken(ctx, user.ID, "billing")
+
+		assert.ErrorIs(t, err, domain.ErrAudienceNotAllowed)
+		assert.Empty(t, token)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given a resource requiring the user's role", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour, audiences)
+		admin := &domain.User{ID: 2, Role: domain.RoleAdmin}
+		mockRepo.On("GetByID", ctx, admin.ID).Return(admin, nil).Once()
+
+		token, err := uc.IssueResourceToken(ctx, admin.ID, "billing")
+
+		assert.NoError(t, err)
+		claims, err := tokenManager.ParseToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, "billing", claims.Audience)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given an unknown resource", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, tokenManager, 15*time.Minute, 7*24*time.Hour, audiences)
+
+		token, err := uc.IssueResourceToken(ctx, user.ID, "payroll")
+
+		assert.ErrorIs(t, err, domain.ErrAudienceNotAllowed)
+		assert.Empty(t, token)
+		mockRepo.AssertNotCalled(t, "GetByID", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthUseCase_Clock(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	passwordHash, err := hash.HashPassword("password123")
+	assert.NoError(t, err)
+
+	t.Run("Given an access token reaching its expiry", func(t *testing.T) {
+		ctx := context.Background()
+		c := clock.NewFake(start)
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret", jwt.WithLeeway(0), jwt.WithClock(c)), 15*time.Minute, time.Hour, WithClock(c))
+		user := &domain.User{ID: 1, Email: "test@test.com", PasswordHash: passwordHash, Role: domain.RoleUser}
+
+		mockRepo.On("GetByEmail", ctx, user.Email).Return(user, nil).Once()
+		mockRepo.On("SaveRefreshToken", ctx, user.ID, mock.AnythingOfType("string"), start.Add(time.Hour), domain.ClientInfo{}).Return(int64(1), nil).Once()
+		mockRepo.On("TouchLastLogin", ctx, user.ID).Return(nil).Once()
+
+		pair, _, err := uc.Login(ctx, user.Email, "password123", domain.ClientInfo{})
+		assert.NoError(t, err)
+
+		c.Advance(15*time.Minute - time.Second)
+		_, err = uc.Authenticate(ctx, pair.AccessToken)
+		assert.NoError(t, err)
+
+		c.Advance(time.Second)
+		_, err = uc.Authenticate(ctx, pair.AccessToken)
+		assert.ErrorIs(t, err, domain.ErrTokenExpired)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given a refresh token crossing the rotate threshold", func(t *testing.T) {
+		ctx := context.Background()
+		c := clock.NewFake(start)
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret", jwt.WithClock(c)), 15*time.Minute, 2*time.Hour,
+			WithClock(c), WithRefreshRotateThreshold(time.Hour))
+		user := &domain.User{ID: 1, Email: "test@test.com", Role: domain.RoleUser}
+		refreshToken := strings.Repeat("a", 64)
+		session := domain.Session{ID: 1, UserID: user.ID, ExpiresAt: start.Add(2 * time.Hour)}
+
+		mockRepo.On("GetRefreshToken", ctx, refreshToken).Return(session, nil).Twice()
+		mockRepo.On("GetByID", ctx, user.ID).Return(user, nil).Twice()
+		mockRepo.On("TouchRefreshToken", ctx, mock.AnythingOfType("string"), "").Return("", nil).Twice()
+
+		c.Advance(time.Hour - time.Second)
+		pair, _, err := uc.Refresh(ctx, refreshToken, domain.ClientInfo{})
+		assert.NoError(t, err)
+		assert.Equal(t, refreshToken, pair.RefreshToken)
+		mockRepo.AssertNotCalled(t, "RotateRefreshToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+		mockRepo.On("RotateRefreshToken", ctx, refreshToken, mock.AnythingOfType("string"), user.ID, start.Add(3*time.Hour), 0).Return(nil).Once()
+		c.Advance(time.Second)
+		pair, _, err = uc.Refresh(ctx, refreshToken, domain.ClientInfo{})
+		assert.NoError(t, err)
+		assert.NotEqual(t, refreshToken, pair.RefreshToken)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given a lock running out", func(t *testing.T) {
+		ctx := context.Background()
+		c := clock.NewFake(start)
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret", jwt.WithClock(c)), 15*time.Minute, time.Hour,
+			WithClock(c), WithAccountLockout(5, 10*time.Minute))
+		user := &domain.User{ID: 1, Email: "test@test.com", PasswordHash: passwordHash, Role: domain.RoleUser, LockedUntil: start.Add(10 * time.Minute)}
+
+		mockRepo.On("GetByEmail", ctx, user.Email).Return(user, nil).Twice()
+		mockRepo.On("SaveRefreshToken", ctx, user.ID, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time"), domain.ClientInfo{}).Return(int64(1), nil).Once()
+		mockRepo.On("TouchLastLogin", ctx, user.ID).Return(nil).Once()
+
+		c.Advance(10*time.Minute - time.Second)
+		_, _, err := uc.Login(ctx, user.Email, "password123", domain.ClientInfo{})
+		assert.ErrorIs(t, err, domain.ErrAccountLocked)
+
+		c.Advance(time.Second)
+		_, _, err = uc.Login(ctx, user.Email, "password123", domain.ClientInfo{})
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestAuthUseCase_VerifyExpiredGrace(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	newUseCase := func(c *clock.Fake, grace time.Duration) *AuthUseCase {
+		tm := newTokenManager(t, "secret", jwt.WithLeeway(0), jwt.WithClock(c))
+		return NewAuthUseCase(new(mocks.UserRepository), tm, 15*time.Minute, time.Hour, WithClock(c), WithVerifyExpiredGrace(grace))
+	}
+	issue := func(uc *AuthUseCase) string {
+		token, err := uc.tokenManager.GenerateAccessToken(jwt.Claims{UserID: 7, Role: domain.RoleUser}, 15*time.Minute)
+		assert.NoError(t, err)
+		return token
+	}
+
+	t.Run("Given an unexpired token", func(t *testing.T) {
+		c := clock.NewFake(start)
+		uc := newUseCase(c, time.Minute)
+		token := issue(uc)
+
+		userID, inGrace, err := uc.Verify(ctx, token)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), userID)
+		assert.False(t, inGrace)
+	})
+
+	t.Run("Given a token expired within the grace period", func(t *testing.T) {
+		c := clock.NewFake(start)
+		uc := newUseCase(c, time.Minute)
+		token := issue(uc)
+		c.Advance(15*time.Minute + time.Minute)
+
+		userID, inGrace, err := uc.Verify(ctx, token)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), userID)
+		assert.True(t, inGrace)
+		_, err = uc.Authenticate(ctx, token)
+		assert.ErrorIs(t, err, domain.ErrTokenExpired, "grace must only apply to Verify")
+	})
+
+	t.Run("Given a token expired beyond the grace period", func(t *testing.T) {
+		c := clock.NewFake(start)
+		uc := newUseCase(c, time.Minute)
+		token := issue(uc)
+		c.Advance(15*time.Minute + time.Minute + time.Second)
+
+		userID, inGrace, err := uc.Verify(ctx, token)
+
+		assert.ErrorIs(t, err, domain.ErrTokenExpired)
+		assert.Zero(t, userID)
+		assert.False(t, inGrace)
+	})
+
+	t.Run("Given no grace period", func(t *testing.T) {
+		c := clock.NewFake(start)
+		uc := newUseCase(c, 0)
+		token := issue(uc)
+		c.Advance(15*time.Minute + time.Second)
+
+		_, inGrace, err := uc.Verify(ctx, token)
+
+		assert.ErrorIs(t, err, domain.ErrTokenExpired)
+		assert.False(t, inGrace)
+	})
+
+	t.Run("Given an expired token signed with another secret", func(t *testing.T) {
+		c := clock.NewFake(start)
+		uc := newUseCase(c, time.Minute)
+		forged, err := newTokenManager(t, "other", jwt.WithClock(c)).GenerateAccessToken(jwt.Claims{UserID: 7}, -time.Second)
+		assert.NoError(t, err)
+
+		_, inGrace, err := uc.Verify(ctx, forged)
+
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+		assert.False(t, inGrace)
+	})
+}
+
+func TestAuthUseCase_TokenVersion(t *testing.T) {
+	ctx := context.Background()
+	user := &domain.User{ID: 7, Role: domain.RoleUser, TokenVersion: 2}
+
+	t.Run("Given a token issued before a version bump", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, time.Hour, WithTokenVersionCheck(true))
+		token, err := uc.generateAccessToken(user, 0, time.Now())
+		assert.NoError(t, err)
+
+		mockRepo.On("GetTokenVersion", ctx, user.ID).Return(int64(2), nil).Twice()
+		_, err = uc.Authenticate(ctx, token)
+		assert.NoError(t, err)
+		_, _, err = uc.Verify(ctx, token)
+		assert.NoError(t, err)
+
+		mockRepo.On("BumpTokenVersion", ctx, user.ID).Return(int64(3), nil).Once()
+		assert.NoError(t, uc.RevokeAccessTokens(ctx, user.ID))
+
+		mockRepo.On("GetTokenVersion", ctx, user.ID).Return(int64(3), nil).Twice()
+		_, err = uc.Authenticate(ctx, token)
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+		_, _, err = uc.Verify(ctx, token)
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given a token issued after a version bump", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, time.Hour, WithTokenVersionCheck(true))
+		bumped := *user
+		bumped.TokenVersion = 3
+		token, err := uc.generateAccessToken(&bumped, 0, time.Now())
+		assert.NoError(t, err)
+		mockRepo.On("GetTokenVersion", ctx, user.ID).Return(int64(3), nil).Once()
+
+		claims, err := uc.Authenticate(ctx, token)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), claims.TokenVersion)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given the version cannot be read", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, time.Hour, WithTokenVersionCheck(true))
+		token, err := uc.generateAccessToken(user, 0, time.Now())
+		assert.NoError(t, err)
+		mockRepo.On("GetTokenVersion", ctx, user.ID).Return(int64(0), errors.New("connection reset")).Once()
+
+		_, err = uc.Authenticate(ctx, token)
+
+		assert.ErrorIs(t, err, domain.ErrServiceUnavailable)
+	})
+
+	t.Run("Given the check is disabled", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, time.Hour)
+		token, err := uc.generateAccessToken(user, 0, time.Now())
+		assert.NoError(t, err)
+
+		_, err = uc.Authenticate(ctx, token)
+
+		assert.NoError(t, err)
+		mockRepo.AssertNotCalled(t, "GetTokenVersion", mock.Anything, mock.Anything)
+	})
+	t.Run("Given the check is disabled and an admin is demoted", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, time.Hour)
+		admin := &domain.User{ID: 8, Role: domain.RoleAdmin, TokenVersion: 2}
+		token, err := uc.generateAccessToken(admin, 0, time.Now())
+		assert.NoError(t, err)
+		mockRepo.On("GetTokenVersion", ctx, admin.ID).Return(int64(2), nil).Once()
+		_, err = uc.Authenticate(ctx, token)
+		assert.NoError(t, err)
+
+		mockRepo.On("UpdateRole", ctx, admin.ID, domain.RoleUser).Return(nil).Once()
+		assert.NoError(t, uc.UpdateRole(ctx, admin.ID, domain.RoleUser))
+		mockRepo.On("GetTokenVersion", ctx, admin.ID).Return(int64(3), nil).Twice()
+
+		_, err = uc.Authenticate(ctx, token)
+		assert.ErrorIs(t, err, domain.ErrInvalidToken, "the admin token must not outlive the demotion")
+		_, _, err = uc.Verify(ctx, token)
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestAuthUseCase_TokenVersionCache(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	user := &domain.User{ID: 7, Role: domain.RoleUser, TokenVersion: 2}
+	newUseCase := func(mockRepo *mocks.UserRepository, c *clock.Fake) (*AuthUseCase, string) {
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret", jwt.WithClock(c)), 15*time.Minute, time.Hour,
+			WithClock(c), WithTokenVersionCheck(true), WithTokenVersionCache(time.Minute))
+		token, err := uc.generateAccessToken(user, 0, time.Now())
+		assert.NoError(t, err)
+		return uc, token
+	}
+
+	t.Run("Given repeated checks within the TTL", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc, token := newUseCase(mockRepo, clock.NewFake(start))
+		mockRepo.On("GetTokenVersion", ctx, user.ID).Return(int64(2), nil).Once()
+
+		for range 3 {
+			_, err := uc.Authenticate(ctx, token)
+			assert.NoError(t, err)
+		}
+		_, _, err := uc.Verify(ctx, token)
+		assert.NoError(t, err)
+
+		mockRepo.AssertNumberOfCalls(t, "GetTokenVersion", 1)
+	})
+
+	t.Run("Given the TTL has passed", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		c := clock.NewFake(start)
+		uc, token := newUseCase(mockRepo, c)
+		mockRepo.On("GetTokenVersion", ctx, user.ID).Return(int64(2), nil).Twice()
+
+		_, err := uc.Authenticate(ctx, token)
+		assert.NoError(t, err)
+		c.Advance(time.Minute)
+		_, err = uc.Authenticate(ctx, token)
+		assert.NoError(t, err)
+
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given a version bump", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc, token := newUseCase(mockRepo, clock.NewFake(start))
+		mockRepo.On("GetTokenVersion", ctx, user.ID).Return(int64(2), nil).Once()
+		_, err := uc.Authenticate(ctx, token)
+		assert.NoError(t, err)
+
+		mockRepo.On("BumpTokenVersion", ctx, user.ID).Return(int64(3), nil).Once()
+		assert.NoError(t, uc.RevokeAccessTokens(ctx, user.ID))
+		mockRepo.On("GetTokenVersion", ctx, user.ID).Return(int64(3), nil).Once()
+		_, err = uc.Authenticate(ctx, token)
+
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given a role change", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc, token := newUseCase(mockRepo, clock.NewFake(start))
+		mockRepo.On("GetTokenVersion", ctx, user.ID).Return(int64(2), nil).Once()
+		_, err := uc.Authenticate(ctx, token)
+		assert.NoError(t, err)
+
+		mockRepo.On("UpdateRole", ctx, user.ID, domain.RoleAdmin).Return(nil).Once()
+		assert.NoError(t, uc.UpdateRole(ctx, user.ID, domain.RoleAdmin))
+		mockRepo.On("GetTokenVersion", ctx, user.ID).Return(int64(3), nil).Once()
+		_, err = uc.Authenticate(ctx, token)
+
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given a password change", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		uc, token := newUseCase(mockRepo, clock.NewFake(start))
+		mockRepo.On("GetTokenVersion", ctx, user.ID).Return(int64(2), nil).Once()
+		_, err := uc.Authenticate(ctx, token)
+		assert.NoError(t, err)
+
+		mockRepo.On("GetByID", ctx, user.ID).Return(user, nil).Once()
+		mockRepo.On("ChangePassword", ctx, user.ID, mock.AnythingOfType("string")).Return(nil).Once()
+		assert.NoError(t, uc.ChangePassword(ctx, user.ID, "new-password"))
+		mockRepo.On("GetTokenVersion", ctx, user.ID).Return(int64(3), nil).Once()
+		_, err = uc.Authenticate(ctx, token)
+
+		assert.ErrorIs(t, err, domain.ErrInvalidToken)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestAuthUseCase_ResendVerification(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	user := &domain.User{ID: 1, Email: "alice@example.com", Role: domain.RoleUser}
+
+	newUseCase := func(mockRepo *mocks.UserRepository, c *clock.Fake, mailer Mailer) (*AuthUseCase, *jwt.TokenManager) {
+		tm := newTokenManager(t, "secret", jwt.WithClock(c))
+		return NewAuthUseCase(mockRepo, tm, 15*time.Minute, time.Hour,
+			WithClock(c), WithMailer(mailer), WithVerificationResendInterval(time.Minute)), tm
+	}
+
+	t.Run("Given an unverified account", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		mailer := newStubMailer(nil)
+		uc, tm := newUseCase(mockRepo, clock.NewFake(start), mailer)
+		mockRepo.On("GetByEmail", ctx, user.Email).Return(user, nil).Once()
+
+		err := uc.ResendVerification(ctx, " alice@example.com ")
+
+		assert.NoError(t, err)
+		sent := mailer.wait(t)
+		assert.Equal(t, "verification", sent.kind)
+		assert.Equal(t, user.Email, sent.to)
+		userID, email, err := tm.ParseVerificationToken(sent.token)
+		assert.NoError(t, err)
+		assert.Equal(t, user.ID, userID)
+		assert.Equal(t, user.Email, email)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given a second request within the resend interval", func(t *testing.T) {
+		ctx := context.Background()
+		c := clock.NewFake(start)
+		mockRepo := new(mocks.UserRepository)
+		mailer := newStubMailer(nil)
+		uc, _ := newUseCase(mockRepo, c, mailer)
+		mockRepo.On("GetByEmail", ctx, user.Email).Return(user, nil).Twice()
+
+		assert.NoError(t, uc.ResendVerification(ctx, user.Email))
+		mailer.wait(t)
+
+		c.Advance(40 * time.Second)
+		err := uc.ResendVerification(ctx, user.Email)
+		var tooMany *domain.TooManyAttemptsError
+		if assert.ErrorAs(t, err, &tooMany) {
+			assert.Equal(t, 20*time.Second, tooMany.RetryAfter)
+		}
+
+		c.Advance(20 * time.Second)
+		assert.NoError(t, uc.ResendVerification(ctx, user.Email))
+		mailer.wait(t)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given an already verified account", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		mailer := newStubMailer(nil)
+		uc, _ := newUseCase(mockRepo, clock.NewFake(start), mailer)
+		verified := *user
+		verified.EmailVerifiedAt = start.Add(-time.Hour)
+		mockRepo.On("GetByEmail", ctx, user.Email).Return(&verified, nil).Once()
+
+		err := uc.ResendVerification(ctx, user.Email)
+
+		assert.NoError(t, err)
+		assert.Empty(t, mailer.sent)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given an unknown email", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		mailer := newStubMailer(nil)
+		uc, _ := newUseCase(mockRepo, clock.NewFake(start), mailer)
+		mockRepo.On("GetByEmail", ctx, "nobody@example.com").Return(nil, domain.ErrUserNotFound).Once()
+
+		assert.NoError(t, uc.ResendVerification(ctx, "nobody@example.com"))
+		var tooMany *domain.TooManyAttemptsError
+		assert.ErrorAs(t, uc.ResendVerification(ctx, "nobody@example.com"), &tooMany)
+		assert.Empty(t, mailer.sent)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestAuthUseCase_VerifyEmail(t *testing.T) {
+	user := &domain.User{ID: 1, Email: "alice@example.com", Role: domain.RoleUser}
+
+	t.Run("Given a valid verification token", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		tm := newTokenManager(t, "secret")
+		uc := NewAuthUseCase(mockRepo, tm, 15*time.Minute, time.Hour)
+		token, err := tm.GenerateVerificationToken(user.ID, user.Email, time.Hour)
+		assert.NoError(t, err)
+		mockRepo.On("GetByID", ctx, user.ID).Return(user, nil).Once()
+		mockRepo.On("MarkEmailVerified", ctx, user.ID).Return(nil).Once()
+
+		assert.NoError(t, uc.VerifyEmail(ctx, token))
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given a token for an email the user since changed", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		tm := newTokenManager(t, "secret")
+		uc := NewAuthUseCase(mockRepo, tm, 15*time.Minute, time.Hour)
+		token, err := tm.GenerateVerificationToken(user.ID, "old@example.com", time.Hour)
+		assert.NoError(t, err)
+		mockRepo.On("GetByID", ctx, user.ID).Return(user, nil).Once()
+
+		assert.ErrorIs(t, uc.VerifyEmail(ctx, token), domain.ErrInvalidToken)
+		mockRepo.AssertNotCalled(t, "MarkEmailVerified", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Given an access token", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.UserRepository)
+		tm := newTokenManager(t, "secret")
+		uc := NewAuthUseCase(mockRepo, tm, 15*time.Minute, time.Hour)
+		token, err := tm.GenerateAccessToken(jwt.Claims{UserID: user.ID, Role: domain.RoleUser}, time.Hour)
+		assert.NoError(t, err)
+
+		assert.ErrorIs(t, uc.VerifyEmail(ctx, token), domain.ErrInvalidToken)
+		mockRepo.AssertNotCalled(t, "GetByID", mock.Anything, mock.Anything)
+	})
+}
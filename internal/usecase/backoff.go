@@ -0,0 +1,126 @@
+package usecase
+
+import (
+	"sync"
+	"time"
+)
+
+// loginBackoff slows down password guessing per key. Once a key failed
+// threshold times in a row, it must wait base before its next attempt, and
+// the wait doubles with every further failure up to maxDelay. A key that
+// does not fail for maxDelay after its last failure, or its last wait,
+// starts over. It keeps
+// state in memory, so each instance counts on its own. A nil backoff admits
+// everything.
+type loginBackoff struct {
+	threshold int
+	base      time.Duration
+	maxDelay  time.Duration
+	now       func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*backoffEntry
+	lastSweep time.Time
+}
+
+type backoffEntry struct {
+	failures    int
+	lastFailure time.Time
+	// until is when the key may try again; zero below the threshold.
+	until time.Time
+}
+
+func newLoginBackoff(threshold int, base, maxDelay time.Duration) *loginBackoff {
+	if threshold <= 0 || base <= 0 {
+		return nil
+	}
+	return &loginBackoff{
+		threshold: threshold,
+		base:      base,
+		maxDelay:  max(base, maxDelay),
+		now:       time.Now,
+		entries:   make(map[string]*backoffEntry),
+	}
+}
+
+// allow reports whether key may make another attempt. If not, retryAfter is
+// how long until it may.
+func (b *loginBackoff) allow(key string) (retryAfter time.Duration, ok bool) {
+	if b == nil {
+		return 0, true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e := b.current(key)
+	if e == nil || !b.now().Before(e.until) {
+		return 0, true
+	}
+	return e.until.Sub(b.now()), false
+}
+
+// fail records a failed attempt by key.
+func (b *loginBackoff) fail(key string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e := b.current(key)
+	if e == nil {
+		e = &backoffEntry{}
+		b.entries[key] = e
+	}
+	e.failures++
+	e.lastFailure = b.now()
+	if over := e.failures - b.threshold; over >= 0 {
+		e.until = e.lastFailure.Add(b.delay(over))
+	}
+}
+
+// reset forgets the failures of key, typically after a successful attempt.
+func (b *loginBackoff) reset(key string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.entries, key)
+}
+
+// delay is the wait after the threshold was exceeded by over failures.
+func (b *loginBackoff) delay(over int) time.Duration {
+	d := b.base
+	for i := 0; i < over && d < b.maxDelay; i++ {
+		d *= 2
+	}
+	return min(d, b.maxDelay)
+}
+
+// current returns the live entry of key, or nil if it has none. Stale
+// entries of every key are dropped once per maxDelay. Callers must hold
+// b.mu.
+func (b *loginBackoff) current(key string) *backoffEntry {
+	now := b.now()
+	if now.Sub(b.lastSweep) > b.maxDelay {
+		for k, e := range b.entries {
+			if b.stale(e, now) {
+				delete(b.entries, k)
+			}
+		}
+		b.lastSweep = now
+	}
+
+	e, ok := b.entries[key]
+	if ok && b.stale(e, now) {
+		delete(b.entries, key)
+		return nil
+	}
+	return e
+}
+
+// stale reports whether e was quiet long enough to be forgotten.
+func (b *loginBackoff) stale(e *backoffEntry, now time.Time) bool {
+	return now.Sub(e.lastFailure) >= b.maxDelay && now.Sub(e.until) >= b.maxDelay
+}
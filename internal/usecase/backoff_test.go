@@ -0,0 +1,50 @@
+package usecase
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginBackoff(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := newLoginBackoff(3, time.Second, 10*time.Second)
+	b.now = func() time.Time { return now }
+
+	b.fail("alice")
+	b.fail("alice")
+	_, ok := b.allow("alice")
+	assert.True(t, ok, "failures below the threshold do not slow down")
+
+	var waits []time.Duration
+	for i := 0; i < 6; i++ {
+		b.fail("alice")
+		wait, ok := b.allow("alice")
+		assert.False(t, ok)
+		waits = append(waits, wait)
+		now = now.Add(wait)
+	}
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}, waits,
+		"the wait doubles with each failure up to the maximum")
+
+	_, ok = b.allow("bob")
+	assert.True(t, ok, "keys are counted separately")
+
+	_, ok = b.allow("alice")
+	assert.True(t, ok, "the wait has passed")
+	b.reset("alice")
+	b.fail("alice")
+	_, ok = b.allow("alice")
+	assert.True(t, ok, "reset clears failures")
+
+	now = now.Add(10 * time.Second)
+	b.fail("alice")
+	b.fail("alice")
+	_, ok = b.allow("alice")
+	assert.True(t, ok, "failures are forgotten after a quiet period")
+
+	assert.Nil(t, newLoginBackoff(0, time.Second, time.Minute))
+	_, ok = (*loginBackoff)(nil).allow("alice")
+	assert.True(t, ok)
+}
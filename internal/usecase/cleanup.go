@@ -0,0 +1,95 @@
+package usecase
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/Kovalyovv/auth-service/internal/repository"
+)
+
+// TokenCleaner periodically deletes expired refresh tokens.
+type TokenCleaner struct {
+	repo            repository.TokenCleanupRepository
+	interval        time.Duration
+	vacuumThreshold int64
+
+	mu     sync.RWMutex
+	status domain.CleanupStatus
+}
+
+// CleanerOption configures optional TokenCleaner behaviour.
+type CleanerOption func(*TokenCleaner)
+
+// WithVacuumThreshold vacuums the token tables after a cleanup that deleted
+// at least n rows, instead of leaving the dead rows to autovacuum. Zero, the
+// default, never vacuums.
+func WithVacuumThreshold(n int64) CleanerOption {
+	return func(c *TokenCleaner) {
+		c.vacuumThreshold = n
+	}
+}
+
+func NewTokenCleaner(repo repository.TokenCleanupRepository, interval time.Duration, opts ...CleanerOption) *TokenCleaner {
+	c := &TokenCleaner{repo: repo, interval: interval}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Run performs a cleanup every interval until ctx is cancelled.
+func (c *TokenCleaner) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.RunOnce(ctx); err != nil {
+				slog.Error("refresh token cleanup failed", "error", err)
+			}
+		}
+	}
+}
+
+// RunOnce performs a single cleanup and records its outcome.
+func (c *TokenCleaner) RunOnce(ctx context.Context) error {
+	deleted, err := c.repo.DeleteExpiredRefreshTokens(ctx)
+	now := time.Now()
+
+	status := domain.CleanupStatus{LastRun: now, DeletedLastRun: deleted}
+	if err != nil {
+		status.LastError = err.Error()
+	}
+
+	c.mu.Lock()
+	c.status = status
+	c.mu.Unlock()
+
+	refreshTokensDeletedLastRun.Set(float64(deleted))
+	lastCleanupTimestamp.Set(float64(now.Unix()))
+
+	if err != nil {
+		return err
+	}
+	slog.Info("refresh token cleanup finished", "deleted", deleted)
+
+	if c.vacuumThreshold > 0 && deleted >= c.vacuumThreshold {
+		if err := c.repo.VacuumRefreshTokens(ctx); err != nil {
+			slog.Error("refresh token vacuum failed", "deleted", deleted, "error", err)
+		}
+	}
+	return nil
+}
+
+// Status returns the outcome of the most recent cleanup.
+func (c *TokenCleaner) Status() domain.CleanupStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.status
+}
@@ -0,0 +1,82 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Kovalyovv/auth-service/internal/repository/mocks"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenCleaner_RunOnce(t *testing.T) {
+	t.Run("Given expired tokens", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.TokenCleanupRepository)
+		cleaner := NewTokenCleaner(mockRepo, 0)
+		mockRepo.On("DeleteExpiredRefreshTokens", ctx).Return(int64(5), nil).Once()
+
+		err := cleaner.RunOnce(ctx)
+
+		assert.NoError(t, err)
+		status := cleaner.Status()
+		assert.Equal(t, int64(5), status.DeletedLastRun)
+		assert.False(t, status.LastRun.IsZero())
+		assert.Empty(t, status.LastError)
+		assert.Equal(t, float64(5), testutil.ToFloat64(refreshTokensDeletedLastRun))
+		assert.Equal(t, float64(status.LastRun.Unix()), testutil.ToFloat64(lastCleanupTimestamp))
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Given the delete fails", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.TokenCleanupRepository)
+		cleaner := NewTokenCleaner(mockRepo, 0)
+		mockRepo.On("DeleteExpiredRefreshTokens", ctx).Return(int64(0), errors.New("db down")).Once()
+
+		err := cleaner.RunOnce(ctx)
+
+		assert.Error(t, err)
+		assert.Equal(t, "db down", cleaner.Status().LastError)
+	})
+
+	for name, tt := range map[string]struct {
+		deleted int64
+		vacuum  bool
+	}{
+		"Given deletions reaching the vacuum threshold": {deleted: 100, vacuum: true},
+		"Given deletions below the vacuum threshold":    {deleted: 99, vacuum: false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			mockRepo := new(mocks.TokenCleanupRepository)
+			cleaner := NewTokenCleaner(mockRepo, 0, WithVacuumThreshold(100))
+			mockRepo.On("DeleteExpiredRefreshTokens", ctx).Return(tt.deleted, nil).Once()
+			if tt.vacuum {
+				mockRepo.On("VacuumRefreshTokens", ctx).Return(nil).Once()
+			}
+
+			err := cleaner.RunOnce(ctx)
+
+			assert.NoError(t, err)
+			mockRepo.AssertExpectations(t)
+			if !tt.vacuum {
+				mockRepo.AssertNotCalled(t, "VacuumRefreshTokens", ctx)
+			}
+		})
+	}
+
+	t.Run("Given the vacuum fails", func(t *testing.T) {
+		ctx := context.Background()
+		mockRepo := new(mocks.TokenCleanupRepository)
+		cleaner := NewTokenCleaner(mockRepo, 0, WithVacuumThreshold(1))
+		mockRepo.On("DeleteExpiredRefreshTokens", ctx).Return(int64(5), nil).Once()
+		mockRepo.On("VacuumRefreshTokens", ctx).Return(errors.New("db down")).Once()
+
+		err := cleaner.RunOnce(ctx)
+
+		assert.NoError(t, err, "the deletion itself succeeded")
+		assert.Empty(t, cleaner.Status().LastError)
+	})
+}
@@ -0,0 +1,62 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+)
+
+// hashLimiter caps how many password hashes are computed at once. Hashing is
+// deliberately slow, so without a cap a burst of logins or registrations can
+// exhaust the CPU. A nil limiter admits everything.
+type hashLimiter struct {
+	slots chan struct{}
+	wait  time.Duration
+}
+
+func newHashLimiter(concurrency int, wait time.Duration) *hashLimiter {
+	if concurrency <= 0 {
+		return nil
+	}
+	return &hashLimiter{slots: make(chan struct{}, concurrency), wait: wait}
+}
+
+// acquire waits up to l.wait for a free slot and returns a function that
+// frees it. It fails with domain.ErrServiceUnavailable when none frees up.
+func (l *hashLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return func() { <-l.slots }, nil
+	case <-timer.C:
+		hashRejections.Inc()
+		return nil, domain.ErrServiceUnavailable
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (uc *AuthUseCase) hashPassword(ctx context.Context, password string) (string, error) {
+	release, err := uc.hashSlots.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return uc.hasher.Hash(password)
+}
+
+func (uc *AuthUseCase) checkPassword(ctx context.Context, password, hash string) (bool, error) {
+	release, err := uc.hashSlots.acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	return uc.hasher.Check(password, hash), nil
+}
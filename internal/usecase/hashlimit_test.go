@@ -0,0 +1,94 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Kovalyovv/auth-service/internal/domain"
+	"github.com/Kovalyovv/auth-service/internal/repository/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// slowHasher accepts every password after a delay and records the highest
+// number of checks that ran at the same time.
+type slowHasher struct {
+	delay   time.Duration
+	running atomic.Int32
+	peak    atomic.Int32
+}
+
+func (h *slowHasher) Hash(password string) (string, error) {
+	return "hash", nil
+}
+
+func (h *slowHasher) Check(password, hash string) bool {
+	n := h.running.Add(1)
+	defer h.running.Add(-1)
+	for {
+		peak := h.peak.Load()
+		if n <= peak || h.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(h.delay)
+	return false
+}
+
+func (h *slowHasher) NeedsRehash(hash string) bool {
+	return false
+}
+
+func TestAuthUseCase_Login_HashConcurrency(t *testing.T) {
+	user := &domain.User{ID: 1, Email: "test@example.com", PasswordHash: "hash", Role: domain.RoleUser}
+
+	burst := func(uc *AuthUseCase, n int) []error {
+		errs := make([]error, n)
+		var wg sync.WaitGroup
+		for i := range n {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, _, errs[i] = uc.Login(context.Background(), user.Email, "password", domain.ClientInfo{})
+			}()
+		}
+		wg.Wait()
+		return errs
+	}
+
+	t.Run("Given a burst within the queue timeout", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		mockRepo.On("GetByEmail", mock.Anything, user.Email).Return(user, nil)
+		hasher := &slowHasher{delay: 20 * time.Millisecond}
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour,
+			WithHasher(hasher), WithHashConcurrency(2, time.Second),
+		)
+
+		for _, err := range burst(uc, 10) {
+			assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+		}
+		assert.Equal(t, int32(2), hasher.peak.Load())
+	})
+
+	t.Run("Given a burst exceeding the queue timeout", func(t *testing.T) {
+		mockRepo := new(mocks.UserRepository)
+		mockRepo.On("GetByEmail", mock.Anything, user.Email).Return(user, nil)
+		hasher := &slowHasher{delay: 100 * time.Millisecond}
+		uc := NewAuthUseCase(mockRepo, newTokenManager(t, "secret"), 15*time.Minute, 7*24*time.Hour,
+			WithHasher(hasher), WithHashConcurrency(1, 10*time.Millisecond),
+		)
+
+		unavailable := 0
+		for _, err := range burst(uc, 5) {
+			if errors.Is(err, domain.ErrServiceUnavailable) {
+				unavailable++
+			}
+		}
+		assert.Equal(t, 4, unavailable)
+		assert.Equal(t, int32(1), hasher.peak.Load())
+	})
+}
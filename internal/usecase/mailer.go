@@ -0,0 +1,41 @@
+package usecase
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// mailTimeout bounds one background email delivery.
+const mailTimeout = 30 * time.Second
+
+type noopMailer struct{}
+
+func (noopMailer) SendVerification(context.Context, string, string) error  { return nil }
+func (noopMailer) SendPasswordReset(context.Context, string, string) error { return nil }
+func (noopMailer) SendAccountExists(context.Context, string) error         { return nil }
+
+// sendMail runs send in the background so a slow or failing mail server
+// neither delays nor fails the request that triggered the email. Errors are
+// logged.
+func (uc *AuthUseCase) sendMail(kind, to string, send func(ctx context.Context, m Mailer) error) {
+	go uc.deliverMail(context.Background(), kind, to, send)
+}
+
+// deliverMail runs send within mailTimeout and logs its error before
+// returning it.
+func (uc *AuthUseCase) deliverMail(ctx context.Context, kind, to string, send func(ctx context.Context, m Mailer) error) error {
+	ctx, cancel := context.WithTimeout(ctx, mailTimeout)
+	defer cancel()
+	err := send(ctx, uc.mailer)
+	if err != nil {
+		slog.Error("failed to send email", "kind", kind, "to", to, "error", err)
+	}
+	return err
+}
+
+// mailEnabled reports whether a mailer was configured with WithMailer.
+func (uc *AuthUseCase) mailEnabled() bool {
+	_, noop := uc.mailer.(noopMailer)
+	return !noop
+}
@@ -0,0 +1,76 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Kovalyovv/auth-service/internal/repository/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+type sentMail struct {
+	kind, to, token string
+}
+
+// stubMailer reports every email it is asked to send on sent and fails with
+// err.
+type stubMailer struct {
+	sent chan sentMail
+	err  error
+}
+
+func newStubMailer(err error) *stubMailer {
+	return &stubMailer{sent: make(chan sentMail, 1), err: err}
+}
+
+func (m *stubMailer) SendVerification(_ context.Context, to, token string) error {
+	m.sent <- sentMail{kind: "verification", to: to, token: token}
+	return m.err
+}
+
+func (m *stubMailer) SendPasswordReset(_ context.Context, to, token string) error {
+	m.sent <- sentMail{kind: "password_reset", to: to, token: token}
+	return m.err
+}
+
+func (m *stubMailer) SendAccountExists(_ context.Context, to string) error {
+	m.sent <- sentMail{kind: "account_exists", to: to}
+	return m.err
+}
+
+func (m *stubMailer) wait(t *testing.T) sentMail {
+	t.Helper()
+	select {
+	case s := <-m.sent:
+		return s
+	case <-time.After(2 * time.Second):
+		t.Fatal("email was not sent")
+		return sentMail{}
+	}
+}
+
+func TestAuthUseCase_sendMail(t *testing.T) {
+	t.Run("Given a password reset email", func(t *testing.T) {
+		mailer := newStubMailer(nil)
+		uc := NewAuthUseCase(new(mocks.UserRepository), newTokenManager(t, "secret"), 15*time.Minute, time.Hour, WithMailer(mailer))
+
+		uc.sendMail("password_reset", "alice@example.com", func(ctx context.Context, m Mailer) error {
+			return m.SendPasswordReset(ctx, "alice@example.com", "reset-token")
+		})
+
+		assert.Equal(t, sentMail{kind: "password_reset", to: "alice@example.com", token: "reset-token"}, mailer.wait(t))
+	})
+
+	t.Run("Given the mailer fails", func(t *testing.T) {
+		mailer := newStubMailer(errors.New("smtp down"))
+		uc := NewAuthUseCase(new(mocks.UserRepository), newTokenManager(t, "secret"), 15*time.Minute, time.Hour, WithMailer(mailer))
+
+		uc.sendMail("verification", "alice@example.com", func(ctx context.Context, m Mailer) error {
+			return m.SendVerification(ctx, "alice@example.com", "verify-token")
+		})
+
+		assert.Equal(t, sentMail{kind: "verification", to: "alice@example.com", token: "verify-token"}, mailer.wait(t))
+	})
+}
@@ -0,0 +1,36 @@
+package usecase
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	stageGenerate = "generate"
+	stagePersist  = "persist"
+)
+
+var tokenIssueFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "auth_token_issue_failures_total",
+	Help: "Number of failures while issuing a token pair, by stage.",
+}, []string{"stage"})
+
+var hashRejections = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "auth_hash_rejections_total",
+	Help: "Number of requests rejected because no password hashing slot freed up in time.",
+})
+
+var sessionIPChanges = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "auth_session_ip_changes_total",
+	Help: "Number of refreshes from a different address than the session's previous refresh.",
+})
+
+var refreshTokensDeletedLastRun = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "refresh_tokens_deleted_last_run",
+	Help: "Number of expired refresh tokens deleted by the most recent cleanup.",
+})
+
+var lastCleanupTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "last_cleanup_timestamp",
+	Help: "Unix time of the most recent refresh token cleanup.",
+})
@@ -0,0 +1,78 @@
+package usecase
+
+import (
+	"sync"
+	"time"
+)
+
+// versionCache remembers users' token versions for ttl, so validating an
+// access token does not read the database every time. It keeps state in
+// memory: another instance's bump is only seen once the entry expires. A
+// nil cache remembers nothing.
+type versionCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	entries   map[int64]versionEntry
+	lastSweep time.Time
+}
+
+type versionEntry struct {
+	version   int64
+	expiresAt time.Time
+}
+
+func newVersionCache(ttl time.Duration) *versionCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &versionCache{ttl: ttl, now: time.Now, entries: make(map[int64]versionEntry)}
+}
+
+// get returns the cached token version of userID, if it has a live one.
+func (c *versionCache) get(userID int64) (int64, bool) {
+	if c == nil {
+		return 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[userID]
+	if !ok || !c.now().Before(e.expiresAt) {
+		return 0, false
+	}
+	return e.version, true
+}
+
+// put caches version as the token version of userID. Expired entries of
+// every user are dropped once per ttl.
+func (c *versionCache) put(userID, version int64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if now.Sub(c.lastSweep) > c.ttl {
+		for id, e := range c.entries {
+			if !now.Before(e.expiresAt) {
+				delete(c.entries, id)
+			}
+		}
+		c.lastSweep = now
+	}
+	c.entries[userID] = versionEntry{version: version, expiresAt: now.Add(c.ttl)}
+}
+
+// invalidate forgets the token version of userID, typically after a change
+// that bumped it.
+func (c *versionCache) invalidate(userID int64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, userID)
+}
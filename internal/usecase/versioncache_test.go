@@ -0,0 +1,39 @@
+package usecase
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionCache(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := newVersionCache(time.Minute)
+	c.now = func() time.Time { return now }
+
+	_, ok := c.get(1)
+	assert.False(t, ok)
+
+	c.put(1, 3)
+	version, ok := c.get(1)
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), version)
+	_, ok = c.get(2)
+	assert.False(t, ok, "users are cached separately")
+
+	c.invalidate(1)
+	_, ok = c.get(1)
+	assert.False(t, ok, "invalidate drops the entry")
+
+	c.put(1, 4)
+	now = now.Add(time.Minute)
+	_, ok = c.get(1)
+	assert.False(t, ok, "the entry has expired")
+
+	var disabled *versionCache
+	disabled.put(1, 3)
+	_, ok = disabled.get(1)
+	assert.False(t, ok, "a nil cache remembers nothing")
+	assert.Nil(t, newVersionCache(0))
+}